@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"compliancesync-api/internal/api"
+	"compliancesync-api/internal/store"
 )
 
 func main() {
@@ -21,11 +22,26 @@ func main() {
 		StripeSecretKey:     getEnv("STRIPE_SECRET_KEY", ""),
 		SendGridAPIKey:      getEnv("SENDGRID_API_KEY", ""),
 		Environment:         getEnv("ENVIRONMENT", "development"),
+		StoreBackend:        getEnv("STORE_BACKEND", "firestore"),
+		DatabaseURL:         getEnv("DATABASE_URL", ""),
+		AuthProvider:        getEnv("AUTH_PROVIDER", "firebase"),
+		JWTJWKSFile:         getEnv("JWT_JWKS_FILE", ""),
+		JWTHS256Secret:      getEnv("JWT_HS256_SECRET", ""),
+		JWTIssuer:           getEnv("JWT_ISSUER", ""),
+		JWTAudience:         getEnv("JWT_AUDIENCE", ""),
+		PublicURL:           getEnv("PUBLIC_URL", "http://localhost:8080"),
+		SSOStateSecret:      getEnv("SSO_STATE_SECRET", ""),
+		SSORedirectOrigins:  getEnv("SSO_REDIRECT_ORIGINS", ""),
+		DomainVerification:  getEnv("DOMAIN_VERIFICATION", "dns"),
+		SearchIndexPath:     getEnv("SEARCH_INDEX_PATH", ""),
+		MalwareScanner:      getEnv("MALWARE_SCANNER", "none"),
+		ClamAVAddress:       getEnv("CLAMAV_ADDRESS", "tcp://localhost:3310"),
+		WorkerSecret:        getEnv("WORKER_SECRET", ""),
 	}
 
 	// Validate required configuration
-	if config.ProjectID == "" {
-		log.Fatal("GCP_PROJECT_ID environment variable is required")
+	if config.ProjectID == "" && (config.StoreBackend == "firestore" || config.AuthProvider == "firebase") {
+		log.Fatal("GCP_PROJECT_ID environment variable is required for Firestore and Firebase Auth")
 	}
 
 	if config.StorageBucket == "" {
@@ -35,8 +51,14 @@ func main() {
 	// Create context
 	ctx := context.Background()
 
+	// Initialize the configured store backend
+	st, err := store.Open(ctx, config.StoreBackend, config.ProjectID, config.DatabaseURL)
+	if err != nil {
+		log.Fatalf("failed to initialize %s store: %v", config.StoreBackend, err)
+	}
+
 	// Initialize server
-	server, err := api.NewServer(ctx, config)
+	server, err := api.NewServer(ctx, config, st)
 	if err != nil {
 		log.Fatalf("failed to initialize server: %v", err)
 	}
@@ -0,0 +1,127 @@
+// Command audit-forward ships new audit log entries of one or more
+// organizations to a syslog collector (RFC 5424 over TCP or TLS) until it
+// is stopped. Progress is checkpointed per organization and sink in the
+// store, so a restart resumes where the previous run stopped.
+//
+// It reads the same STORE_BACKEND, GCP_PROJECT_ID and DATABASE_URL
+// environment variables as the API server.
+//
+//	audit-forward -org <organization-id>[,<organization-id>...] -addr <host:port> [-tls] [-ca <file>] [-cert <file> -key <file>]
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"compliancesync-api/internal/audit"
+	"compliancesync-api/internal/store"
+)
+
+func main() {
+	orgs := flag.String("org", "", "comma-separated organization IDs to forward (required)")
+	addr := flag.String("addr", "", "syslog collector host:port (required)")
+	useTLS := flag.Bool("tls", false, "connect to the collector over TLS")
+	caFile := flag.String("ca", "", "PEM CA bundle for verifying the collector (default: system roots)")
+	certFile := flag.String("cert", "", "PEM client certificate for mutual TLS")
+	keyFile := flag.String("key", "", "PEM client key for mutual TLS")
+	sinkName := flag.String("sink", "", "checkpoint name for this destination (default: the collector address)")
+	interval := flag.Duration("interval", 30*time.Second, "poll interval for new entries")
+	flag.Parse()
+
+	if *orgs == "" || *addr == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if *sinkName == "" {
+		*sinkName = "syslog:" + *addr
+	}
+
+	var orgIDs []string
+	for _, orgID := range strings.Split(*orgs, ",") {
+		if orgID = strings.TrimSpace(orgID); orgID != "" {
+			orgIDs = append(orgIDs, orgID)
+		}
+	}
+
+	syslogConfig := audit.SyslogConfig{Address: *addr}
+	if *useTLS {
+		tlsConfig, err := loadTLSConfig(*caFile, *certFile, *keyFile)
+		if err != nil {
+			log.Fatalf("failed to load TLS configuration: %v", err)
+		}
+		syslogConfig.TLS = tlsConfig
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	st, err := store.Open(ctx, getEnv("STORE_BACKEND", "firestore"), getEnv("GCP_PROJECT_ID", ""), getEnv("DATABASE_URL", ""))
+	if err != nil {
+		log.Fatalf("failed to initialize store: %v", err)
+	}
+	defer st.Close()
+
+	sink := audit.NewSyslogSink(syslogConfig)
+	defer sink.Close()
+
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelInfo}))
+	forwarder, err := audit.NewForwarder(st, sink, audit.ForwarderConfig{
+		SinkName:     *sinkName,
+		OrgIDs:       orgIDs,
+		PollInterval: *interval,
+	}, logger)
+	if err != nil {
+		log.Fatalf("failed to initialize forwarder: %v", err)
+	}
+
+	logger.Info("forwarding audit logs", "sink", *sinkName, "organizations", len(orgIDs))
+	if err := forwarder.Run(ctx); err != nil && !errors.Is(err, context.Canceled) {
+		log.Fatalf("forwarder stopped: %v", err)
+	}
+}
+
+// loadTLSConfig builds the client TLS configuration from optional PEM files
+func loadTLSConfig(caFile, certFile, keyFile string) (*tls.Config, error) {
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", caFile)
+		}
+		config.RootCAs = pool
+	}
+
+	if certFile != "" || keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	return config, nil
+}
+
+// getEnv gets an environment variable with a default fallback
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
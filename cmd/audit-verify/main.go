@@ -0,0 +1,99 @@
+// Command audit-verify checks the audit log hash chain of one or more
+// organizations and exits non-zero if any chain is broken.
+//
+// It reads the same STORE_BACKEND, GCP_PROJECT_ID and DATABASE_URL
+// environment variables as the API server.
+//
+//	audit-verify -org <organization-id>[,<organization-id>...] [-json]
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"compliancesync-api/internal/audit"
+	"compliancesync-api/internal/store"
+)
+
+// Exit codes
+const (
+	exitValid  = 0
+	exitBroken = 1
+	exitError  = 2
+)
+
+func main() {
+	orgs := flag.String("org", "", "comma-separated organization IDs to verify (required)")
+	asJSON := flag.Bool("json", false, "print results as JSON lines")
+	flag.Parse()
+
+	if *orgs == "" {
+		flag.Usage()
+		os.Exit(exitError)
+	}
+
+	ctx := context.Background()
+
+	st, err := store.Open(ctx, getEnv("STORE_BACKEND", "firestore"), getEnv("GCP_PROJECT_ID", ""), getEnv("DATABASE_URL", ""))
+	if err != nil {
+		log.Printf("failed to initialize store: %v", err)
+		os.Exit(exitError)
+	}
+
+	code := exitValid
+	for _, orgID := range strings.Split(*orgs, ",") {
+		orgID = strings.TrimSpace(orgID)
+		if orgID == "" {
+			continue
+		}
+
+		result, err := audit.VerifyChain(ctx, st, orgID)
+		if err != nil {
+			log.Printf("%s: verification failed: %v", orgID, err)
+			code = exitError
+			continue
+		}
+
+		if *asJSON {
+			json.NewEncoder(os.Stdout).Encode(result)
+		} else {
+			printResult(result)
+		}
+
+		if !result.Valid && code == exitValid {
+			code = exitBroken
+		}
+	}
+
+	st.Close()
+	os.Exit(code)
+}
+
+// printResult writes a one-line human readable summary of a verification
+func printResult(result *audit.VerifyResult) {
+	if result.Valid {
+		fmt.Printf("%s: OK, %d entries verified, head %d %s\n",
+			result.OrganizationID, result.EntriesChecked, result.HeadSequence, result.HeadHash)
+		return
+	}
+
+	b := result.Break
+	fmt.Printf("%s: BROKEN at sequence %d (%s)", result.OrganizationID, b.Sequence, b.Reason)
+	if b.EntryID != "" {
+		fmt.Printf(", entry %s", b.EntryID)
+	}
+	fmt.Printf("; %d entries verified before the break\n", result.EntriesChecked)
+}
+
+// getEnv gets an environment variable with a default fallback
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
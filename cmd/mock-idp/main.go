@@ -0,0 +1,417 @@
+// Command mock-idp is a local OIDC and SAML identity provider for trying out
+// single sign-on against a development API server. It signs in whoever
+// submits its login form, so never expose it beyond localhost.
+//
+// OIDC: configure the issuer as the -url value, with the -client-id and
+// -client-secret given here. SAML: configure the metadata URL as
+// <url>/saml/metadata. Keys are generated at startup, so reconfigure the
+// organization after restarting it.
+//
+//	mock-idp [-addr :9090] [-url http://localhost:9090] [-client-id compliancesync] [-client-secret secret] [-email user@example.com]
+package main
+
+import (
+	"bytes"
+	"compress/flate"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"flag"
+	"html/template"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"compliancesync-api/internal/sso"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// SAML namespaces and identifiers used in generated documents
+const (
+	nsSAML        = "urn:oasis:names:tc:SAML:2.0:assertion"
+	nsSAMLP       = "urn:oasis:names:tc:SAML:2.0:protocol"
+	nsMetadata    = "urn:oasis:names:tc:SAML:2.0:metadata"
+	nsDSig        = "http://www.w3.org/2000/09/xmldsig#"
+	nameIDEmail   = "urn:oasis:names:tc:SAML:1.1:nameid-format:emailAddress"
+	statusSuccess = "urn:oasis:names:tc:SAML:2.0:status:Success"
+	samlTime      = "2006-01-02T15:04:05Z"
+)
+
+// keyID names the single signing key in the JWKS
+const keyID = "mock-idp"
+
+// idp is the identity provider's keys and pending authorization codes
+type idp struct {
+	url          string
+	clientID     string
+	clientSecret string
+	email        string
+
+	key     *rsa.PrivateKey
+	certDER []byte
+
+	mu    sync.Mutex
+	codes map[string]authorization
+}
+
+// authorization is an issued OIDC authorization code
+type authorization struct {
+	clientID    string
+	redirectURI string
+	nonce       string
+	challenge   string
+	email       string
+	name        string
+	expires     time.Time
+}
+
+// samlRequest is what the mock reads from an AuthnRequest
+type samlRequest struct {
+	ID     string `xml:"ID,attr"`
+	ACSURL string `xml:"AssertionConsumerServiceURL,attr"`
+	Issuer string `xml:"Issuer"`
+}
+
+func main() {
+	addr := flag.String("addr", ":9090", "listen address")
+	baseURL := flag.String("url", "http://localhost:9090", "public URL; the OIDC issuer and SAML entity ID")
+	clientID := flag.String("client-id", "compliancesync", "OIDC client ID")
+	clientSecret := flag.String("client-secret", "secret", "OIDC client secret")
+	email := flag.String("email", "user@example.com", "email address prefilled on the login form")
+	flag.Parse()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		log.Fatalf("failed to generate key: %v", err)
+	}
+	certTemplate := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "mock-idp"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().AddDate(1, 0, 0),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+	certDER, err := x509.CreateCertificate(rand.Reader, certTemplate, certTemplate, &key.PublicKey, key)
+	if err != nil {
+		log.Fatalf("failed to create certificate: %v", err)
+	}
+
+	p := &idp{
+		url:          strings.TrimSuffix(*baseURL, "/"),
+		clientID:     *clientID,
+		clientSecret: *clientSecret,
+		email:        *email,
+		key:          key,
+		certDER:      certDER,
+		codes:        make(map[string]authorization),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", p.handleDiscovery)
+	mux.HandleFunc("/jwks", p.handleJWKS)
+	mux.HandleFunc("/authorize", p.handleAuthorize)
+	mux.HandleFunc("/token", p.handleToken)
+	mux.HandleFunc("/saml/metadata", p.handleSAMLMetadata)
+	mux.HandleFunc("/saml/sso", p.handleSAMLSSO)
+
+	log.Printf("mock identity provider listening on %s as %s", *addr, p.url)
+	log.Fatal(http.ListenAndServe(*addr, mux))
+}
+
+// OIDC
+
+func (p *idp) handleDiscovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"issuer":                                p.url,
+		"authorization_endpoint":                p.url + "/authorize",
+		"token_endpoint":                        p.url + "/token",
+		"jwks_uri":                              p.url + "/jwks",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"code_challenge_methods_supported":      []string{"S256"},
+	})
+}
+
+func (p *idp) handleJWKS(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"use": "sig",
+			"alg": "RS256",
+			"kid": keyID,
+			"n":   base64.RawURLEncoding.EncodeToString(p.key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(p.key.E)).Bytes()),
+		}},
+	})
+}
+
+// handleAuthorize shows the login form, then redirects back with a code
+func (p *idp) handleAuthorize(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+	if r.Form.Get("client_id") != p.clientID {
+		http.Error(w, "unknown client_id", http.StatusBadRequest)
+		return
+	}
+	if r.Form.Get("code_challenge_method") != "S256" || r.Form.Get("code_challenge") == "" {
+		http.Error(w, "PKCE with S256 is required", http.StatusBadRequest)
+		return
+	}
+	redirectURI, err := url.Parse(r.Form.Get("redirect_uri"))
+	if err != nil || redirectURI.Host == "" {
+		http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		renderLogin(w, p.email, r.Form)
+		return
+	}
+
+	code := randomString()
+	p.mu.Lock()
+	p.codes[code] = authorization{
+		clientID:    p.clientID,
+		redirectURI: redirectURI.String(),
+		nonce:       r.Form.Get("nonce"),
+		challenge:   r.Form.Get("code_challenge"),
+		email:       r.Form.Get("login_email"),
+		name:        r.Form.Get("login_name"),
+		expires:     time.Now().Add(time.Minute),
+	}
+	p.mu.Unlock()
+
+	query := redirectURI.Query()
+	query.Set("code", code)
+	query.Set("state", r.Form.Get("state"))
+	redirectURI.RawQuery = query.Encode()
+	http.Redirect(w, r, redirectURI.String(), http.StatusFound)
+}
+
+// handleToken redeems an authorization code for a signed ID token
+func (p *idp) handleToken(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil || r.Form.Get("grant_type") != "authorization_code" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "unsupported_grant_type"})
+		return
+	}
+
+	clientID, clientSecret, ok := r.BasicAuth()
+	if !ok {
+		clientID, clientSecret = r.Form.Get("client_id"), r.Form.Get("client_secret")
+	}
+	if clientID != p.clientID || subtle.ConstantTimeCompare([]byte(clientSecret), []byte(p.clientSecret)) != 1 {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+
+	p.mu.Lock()
+	auth, ok := p.codes[r.Form.Get("code")]
+	delete(p.codes, r.Form.Get("code"))
+	p.mu.Unlock()
+
+	challenge := sha256.Sum256([]byte(r.Form.Get("code_verifier")))
+	if !ok || time.Now().After(auth.expires) || auth.redirectURI != r.Form.Get("redirect_uri") ||
+		base64.RawURLEncoding.EncodeToString(challenge[:]) != auth.challenge {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	now := time.Now()
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss":            p.url,
+		"aud":            p.clientID,
+		"sub":            subject(auth.email),
+		"email":          auth.email,
+		"email_verified": true,
+		"name":           auth.name,
+		"nonce":          auth.nonce,
+		"iat":            now.Unix(),
+		"exp":            now.Add(5 * time.Minute).Unix(),
+	})
+	token.Header["kid"] = keyID
+	idToken, err := token.SignedString(p.key)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token": randomString(),
+		"token_type":   "Bearer",
+		"expires_in":   300,
+		"id_token":     idToken,
+	})
+}
+
+// SAML
+
+func (p *idp) handleSAMLMetadata(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/samlmetadata+xml")
+	io.WriteString(w, xml.Header+
+		`<md:EntityDescriptor xmlns:md="`+nsMetadata+`" xmlns:ds="`+nsDSig+`" entityID="`+p.url+`/saml/metadata">`+
+		`<md:IDPSSODescriptor protocolSupportEnumeration="urn:oasis:names:tc:SAML:2.0:protocol">`+
+		`<md:KeyDescriptor use="signing"><ds:KeyInfo><ds:X509Data><ds:X509Certificate>`+
+		base64.StdEncoding.EncodeToString(p.certDER)+
+		`</ds:X509Certificate></ds:X509Data></ds:KeyInfo></md:KeyDescriptor>`+
+		`<md:NameIDFormat>`+nameIDEmail+`</md:NameIDFormat>`+
+		`<md:SingleSignOnService Binding="urn:oasis:names:tc:SAML:2.0:bindings:HTTP-Redirect" Location="`+p.url+`/saml/sso"/>`+
+		`</md:IDPSSODescriptor></md:EntityDescriptor>`)
+}
+
+// handleSAMLSSO shows the login form for an AuthnRequest, then posts a
+// signed response to the service provider's ACS URL
+func (p *idp) handleSAMLSSO(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+	req, err := decodeAuthnRequest(r.Form.Get("SAMLRequest"))
+	if err != nil {
+		http.Error(w, "invalid SAMLRequest: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		renderLogin(w, p.email, r.Form)
+		return
+	}
+
+	response, err := p.samlResponse(req, r.Form.Get("login_email"), r.Form.Get("login_name"))
+	if err != nil {
+		http.Error(w, "failed to sign response: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	postTemplate.Execute(w, map[string]string{
+		"ACSURL":       req.ACSURL,
+		"SAMLResponse": base64.StdEncoding.EncodeToString(response),
+		"RelayState":   r.Form.Get("RelayState"),
+	})
+}
+
+// samlResponse builds a successful response with an assertion for email,
+// signed by the identity provider
+func (p *idp) samlResponse(req *samlRequest, email, name string) ([]byte, error) {
+	now := time.Now().UTC()
+	assertionID := "_" + randomString()
+	entityID := p.url + "/saml/metadata"
+
+	doc := `<samlp:Response xmlns:samlp="` + nsSAMLP + `" xmlns:saml="` + nsSAML + `"` +
+		` ID="_` + randomString() + `" Version="2.0" IssueInstant="` + now.Format(samlTime) + `"` +
+		` Destination="` + escape(req.ACSURL) + `" InResponseTo="` + escape(req.ID) + `">` +
+		`<saml:Issuer>` + escape(entityID) + `</saml:Issuer>` +
+		`<samlp:Status><samlp:StatusCode Value="` + statusSuccess + `"/></samlp:Status>` +
+		`<saml:Assertion ID="` + assertionID + `" Version="2.0" IssueInstant="` + now.Format(samlTime) + `">` +
+		`<saml:Issuer>` + escape(entityID) + `</saml:Issuer>` +
+		`<saml:Subject><saml:NameID Format="` + nameIDEmail + `">` + escape(email) + `</saml:NameID>` +
+		`<saml:SubjectConfirmation Method="urn:oasis:names:tc:SAML:2.0:cm:bearer">` +
+		`<saml:SubjectConfirmationData InResponseTo="` + escape(req.ID) + `"` +
+		` NotOnOrAfter="` + now.Add(5*time.Minute).Format(samlTime) + `" Recipient="` + escape(req.ACSURL) + `"/>` +
+		`</saml:SubjectConfirmation></saml:Subject>` +
+		`<saml:Conditions NotBefore="` + now.Add(-time.Minute).Format(samlTime) + `"` +
+		` NotOnOrAfter="` + now.Add(5*time.Minute).Format(samlTime) + `">` +
+		`<saml:AudienceRestriction><saml:Audience>` + escape(req.Issuer) + `</saml:Audience></saml:AudienceRestriction>` +
+		`</saml:Conditions>` +
+		`<saml:AuthnStatement AuthnInstant="` + now.Format(samlTime) + `">` +
+		`<saml:AuthnContext><saml:AuthnContextClassRef>urn:oasis:names:tc:SAML:2.0:ac:classes:unspecified</saml:AuthnContextClassRef></saml:AuthnContext>` +
+		`</saml:AuthnStatement>` +
+		`<saml:AttributeStatement><saml:Attribute Name="name"><saml:AttributeValue>` + escape(name) +
+		`</saml:AttributeValue></saml:Attribute></saml:AttributeStatement>` +
+		`</saml:Assertion></samlp:Response>`
+
+	return sso.SignEnveloped([]byte(doc), assertionID, p.key, p.certDER)
+}
+
+// decodeAuthnRequest inflates an HTTP-Redirect binding AuthnRequest
+func decodeAuthnRequest(encoded string) (*samlRequest, error) {
+	deflated, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(io.LimitReader(flate.NewReader(bytes.NewReader(deflated)), 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	var req samlRequest
+	if err := xml.Unmarshal(data, &req); err != nil {
+		return nil, err
+	}
+	if req.ID == "" || req.ACSURL == "" || req.Issuer == "" {
+		return nil, io.ErrUnexpectedEOF
+	}
+	return &req, nil
+}
+
+// Helpers
+
+var loginTemplate = template.Must(template.New("login").Parse(`<!DOCTYPE html>
+<html><head><title>Mock identity provider</title></head>
+<body>
+<h1>Mock identity provider</h1>
+<form method="post">
+{{range $name, $values := .Params}}{{range $values}}<input type="hidden" name="{{$name}}" value="{{.}}">
+{{end}}{{end}}<p><label>Email <input name="login_email" value="{{.Email}}"></label></p>
+<p><label>Name <input name="login_name" value="Mock User"></label></p>
+<p><button type="submit">Sign in</button></p>
+</form>
+</body></html>
+`))
+
+var postTemplate = template.Must(template.New("post").Parse(`<!DOCTYPE html>
+<html><head><title>Signing in</title></head>
+<body onload="document.forms[0].submit()">
+<form method="post" action="{{.ACSURL}}">
+<input type="hidden" name="SAMLResponse" value="{{.SAMLResponse}}">
+<input type="hidden" name="RelayState" value="{{.RelayState}}">
+<noscript><button type="submit">Continue</button></noscript>
+</form>
+</body></html>
+`))
+
+// renderLogin shows the login form, carrying the request parameters through
+func renderLogin(w http.ResponseWriter, email string, params url.Values) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	loginTemplate.Execute(w, map[string]interface{}{"Email": email, "Params": params})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// subject derives a stable subject identifier from an email address
+func subject(email string) string {
+	sum := sha256.Sum256([]byte(strings.ToLower(email)))
+	return hex.EncodeToString(sum[:16])
+}
+
+func randomString() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+func escape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
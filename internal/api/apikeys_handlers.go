@@ -0,0 +1,185 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"compliancesync-api/internal/auth"
+	"compliancesync-api/internal/models"
+	"github.com/go-chi/chi/v5"
+)
+
+// API key handlers
+
+// handleCreateAPIKey creates an organization API key. The key is returned
+// once in the response; only its hash is stored.
+func (s *Server) handleCreateAPIKey() http.HandlerFunc {
+	type request struct {
+		Name      string               `json:"name"`
+		Scopes    []models.APIKeyScope `json:"scopes"`
+		ExpiresAt *time.Time           `json:"expires_at"`
+	}
+
+	type response struct {
+		*models.APIKey
+		Key string `json:"key"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, err := auth.GetUserClaims(r)
+		if err != nil {
+			respondError(w, http.StatusUnauthorized, "authentication required")
+			return
+		}
+
+		var req request
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondError(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+
+		req.Name = strings.TrimSpace(req.Name)
+		if req.Name == "" {
+			respondError(w, http.StatusBadRequest, "name is required")
+			return
+		}
+		if len(req.Scopes) == 0 {
+			respondError(w, http.StatusBadRequest, "at least one scope is required")
+			return
+		}
+		for _, scope := range req.Scopes {
+			if !models.IsValidAPIKeyScope(scope) {
+				respondError(w, http.StatusBadRequest, fmt.Sprintf("unknown scope %q", scope))
+				return
+			}
+		}
+		if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+			respondError(w, http.StatusBadRequest, "expires_at must be in the future")
+			return
+		}
+
+		key, prefix, err := auth.GenerateAPIKey()
+		if err != nil {
+			s.logger.Error("failed to generate API key", "error", err)
+			respondError(w, http.StatusInternalServerError, "failed to create API key")
+			return
+		}
+
+		apiKey := &models.APIKey{
+			OrganizationID: claims.OrganizationID,
+			Name:           req.Name,
+			Prefix:         prefix,
+			KeyHash:        auth.HashAPIKey(key),
+			Scopes:         req.Scopes,
+			CreatedBy:      claims.UID,
+			ExpiresAt:      req.ExpiresAt,
+		}
+
+		if err := s.store.CreateAPIKey(r.Context(), apiKey); err != nil {
+			s.logger.Error("failed to create API key", "error", err)
+			respondError(w, http.StatusInternalServerError, "failed to create API key")
+			return
+		}
+
+		// Create audit log
+		auditLog := &models.AuditLog{
+			OrganizationID: claims.OrganizationID,
+			UserID:         claims.UID,
+			UserEmail:      claims.Email,
+			Action:         models.ActionAPIKeyCreated,
+			ResourceType:   "api_key",
+			ResourceID:     apiKey.ID,
+			Description:    fmt.Sprintf("Created API key %s (%s)", apiKey.Name, apiKey.Prefix),
+			Metadata: map[string]interface{}{
+				"scopes":     apiKey.Scopes,
+				"expires_at": apiKey.ExpiresAt,
+			},
+			IPAddress: r.RemoteAddr,
+			UserAgent: r.UserAgent(),
+		}
+		s.recordAudit(r.Context(), auditLog)
+
+		respondJSON(w, http.StatusCreated, response{APIKey: apiKey, Key: key})
+	}
+}
+
+// handleListAPIKeys lists the organization's API keys, including revoked
+// and expired ones
+func (s *Server) handleListAPIKeys() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, err := auth.GetUserClaims(r)
+		if err != nil {
+			respondError(w, http.StatusUnauthorized, "authentication required")
+			return
+		}
+
+		opts, err := parseListOptions(r)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		keys, nextPageToken, err := s.store.ListAPIKeys(r.Context(), claims.OrganizationID, opts)
+		if isListOptionsError(err) {
+			respondError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if err != nil {
+			s.logger.Error("failed to list API keys", "error", err)
+			respondError(w, http.StatusInternalServerError, "failed to list API keys")
+			return
+		}
+
+		respondJSON(w, http.StatusOK, listResponse{Items: keys, NextPageToken: nextPageToken})
+	}
+}
+
+// handleRevokeAPIKey revokes an API key. Requests using it fail from then on.
+func (s *Server) handleRevokeAPIKey() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, err := auth.GetUserClaims(r)
+		if err != nil {
+			respondError(w, http.StatusUnauthorized, "authentication required")
+			return
+		}
+
+		apiKey, err := s.store.GetAPIKey(r.Context(), claims.OrganizationID, chi.URLParam(r, "keyID"))
+		if err != nil {
+			respondError(w, http.StatusNotFound, "API key not found")
+			return
+		}
+		if apiKey.RevokedAt != nil {
+			respondError(w, http.StatusConflict, "API key is already revoked")
+			return
+		}
+
+		now := time.Now()
+		apiKey.RevokedAt = &now
+		apiKey.RevokedBy = claims.UID
+
+		if err := s.store.UpdateAPIKey(r.Context(), apiKey); err != nil {
+			s.logger.Error("failed to revoke API key", "error", err)
+			respondError(w, http.StatusInternalServerError, "failed to revoke API key")
+			return
+		}
+
+		// Create audit log
+		auditLog := &models.AuditLog{
+			OrganizationID: claims.OrganizationID,
+			UserID:         claims.UID,
+			UserEmail:      claims.Email,
+			Action:         models.ActionAPIKeyRevoked,
+			ResourceType:   "api_key",
+			ResourceID:     apiKey.ID,
+			Description:    fmt.Sprintf("Revoked API key %s (%s)", apiKey.Name, apiKey.Prefix),
+			IPAddress:      r.RemoteAddr,
+			UserAgent:      r.UserAgent(),
+		}
+		s.recordAudit(r.Context(), auditLog)
+
+		respondJSON(w, http.StatusOK, apiKey)
+	}
+}
@@ -1,16 +1,19 @@
 package api
 
 import (
+	"context"
 	"encoding/csv"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
-	"cloud.google.com/go/storage"
+	"compliancesync-api/internal/audit"
 	"compliancesync-api/internal/auth"
 	"compliancesync-api/internal/models"
+	"compliancesync-api/internal/store"
 	"github.com/go-chi/chi/v5"
 )
 
@@ -23,34 +26,37 @@ func (s *Server) handleListAuditLogs() http.HandlerFunc {
 			return
 		}
 
-		// Parse query parameters for filtering
-		filters := make(map[string]interface{})
-		if userID := r.URL.Query().Get("user_id"); userID != "" {
-			filters["user_id"] = userID
-		}
-		if action := r.URL.Query().Get("action"); action != "" {
-			filters["action"] = models.AuditAction(action)
+		filter, err := parseAuditLogFilter(r)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, err.Error())
+			return
 		}
-		if resourceType := r.URL.Query().Get("resource_type"); resourceType != "" {
-			filters["resource_type"] = resourceType
+
+		opts, err := parseListOptions(r)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, err.Error())
+			return
 		}
 
-		// Parse limit
-		limit := 100
-		if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
-			if parsedLimit, err := strconv.Atoi(limitStr); err == nil && parsedLimit > 0 {
-				limit = parsedLimit
+		// limit is the pre-pagination name for page_size
+		if limitStr := r.URL.Query().Get("limit"); limitStr != "" && r.URL.Query().Get("page_size") == "" {
+			if parsedLimit, err := strconv.Atoi(limitStr); err == nil && parsedLimit > 0 && parsedLimit <= store.MaxPageSize {
+				opts.PageSize = parsedLimit
 			}
 		}
 
-		logs, err := s.store.ListAuditLogs(r.Context(), claims.OrganizationID, filters, limit)
+		logs, nextPageToken, err := s.store.ListAuditLogs(r.Context(), claims.OrganizationID, filter, opts)
+		if isListOptionsError(err) {
+			respondError(w, http.StatusBadRequest, err.Error())
+			return
+		}
 		if err != nil {
 			s.logger.Error("failed to list audit logs", "error", err)
 			respondError(w, http.StatusInternalServerError, "failed to get audit logs")
 			return
 		}
 
-		respondJSON(w, http.StatusOK, logs)
+		respondJSON(w, http.StatusOK, listResponse{Items: logs, NextPageToken: nextPageToken})
 	}
 }
 
@@ -63,24 +69,26 @@ func (s *Server) handleExportAuditLogs() http.HandlerFunc {
 			return
 		}
 
-		// Parse query parameters for filtering
-		filters := make(map[string]interface{})
-		if userID := r.URL.Query().Get("user_id"); userID != "" {
-			filters["user_id"] = userID
+		filter, err := parseAuditLogFilter(r)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, err.Error())
+			return
 		}
-		if action := r.URL.Query().Get("action"); action != "" {
-			filters["action"] = models.AuditAction(action)
+
+		if format := r.URL.Query().Get("format"); format != "" && format != "csv" {
+			s.streamAuditLogs(w, r, claims.OrganizationID, filter, audit.Format(format))
+			return
 		}
 
-		// Max 10,000 entries for export
-		logs, err := s.store.ListAuditLogs(r.Context(), claims.OrganizationID, filters, 10000)
+		// Max 10,000 entries for CSV export
+		logs, nextPageToken, err := s.store.ListAuditLogs(r.Context(), claims.OrganizationID, filter, store.ListOptions{PageSize: 10000})
 		if err != nil {
 			s.logger.Error("failed to list audit logs for export", "error", err)
 			respondError(w, http.StatusInternalServerError, "failed to export audit logs")
 			return
 		}
 
-		if len(logs) >= 10000 {
+		if nextPageToken != "" {
 			respondError(w, http.StatusBadRequest, "too many results. Please narrow your date range (max 10,000 entries)")
 			return
 		}
@@ -93,7 +101,7 @@ func (s *Server) handleExportAuditLogs() http.HandlerFunc {
 		defer writer.Flush()
 
 		// Write header
-		writer.Write([]string{"Timestamp", "User Email", "User Name", "Action", "Resource Type", "Resource ID", "Description", "IP Address"})
+		writer.Write([]string{"Timestamp", "User Email", "User Name", "Actor Type", "Action", "Resource Type", "Resource ID", "Description", "IP Address", "Sequence", "Hash"})
 
 		// Write rows
 		for _, log := range logs {
@@ -101,16 +109,148 @@ func (s *Server) handleExportAuditLogs() http.HandlerFunc {
 				log.Timestamp.Format(time.RFC3339),
 				log.UserEmail,
 				log.UserID,
+				string(log.ActorType),
 				string(log.Action),
 				log.ResourceType,
 				log.ResourceID,
 				log.Description,
 				log.IPAddress,
+				strconv.FormatInt(log.Sequence, 10),
+				log.Hash,
 			})
 		}
 	}
 }
 
+// streamAuditLogs writes every matching audit log entry in a SIEM format,
+// oldest first, with no cap on the number of entries. Entries are read and
+// flushed one page at a time. Once streaming has started an error can no
+// longer change the response status, so it ends the stream early and is only
+// logged.
+func (s *Server) streamAuditLogs(w http.ResponseWriter, r *http.Request, orgID string, filter store.AuditLogFilter, format audit.Format) {
+	enc, err := audit.NewEncoder(format, w)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", format.ContentType())
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=audit_log_%s.%s", time.Now().Format("2006-01-02"), format.Extension()))
+
+	// A long export outlives the router's request timeout and the server's
+	// write timeout, so each page extends the write deadline instead. A client
+	// that goes away still ends the stream through a failed write.
+	ctx := context.WithoutCancel(r.Context())
+	rc := http.NewResponseController(w)
+	rc.SetWriteDeadline(time.Now().Add(exportPageWriteTimeout))
+
+	written, err := audit.Stream(ctx, s.store, orgID, filter, enc, func() error {
+		if err := rc.Flush(); err != nil {
+			return err
+		}
+		return rc.SetWriteDeadline(time.Now().Add(exportPageWriteTimeout))
+	})
+	if err != nil {
+		s.logger.Error("audit log export stream ended early", "organization_id", orgID, "format", format, "written", written, "error", err)
+	}
+}
+
+// exportPageWriteTimeout bounds how long one page of a streaming export may
+// take to reach the client
+const exportPageWriteTimeout = 60 * time.Second
+
+// handleVerifyAuditLogs walks the organization's audit log hash chain and
+// reports the first broken or missing link
+func (s *Server) handleVerifyAuditLogs() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, err := auth.GetUserClaims(r)
+		if err != nil {
+			respondError(w, http.StatusUnauthorized, "authentication required")
+			return
+		}
+
+		result, err := audit.VerifyChain(r.Context(), s.store, claims.OrganizationID)
+		if err != nil {
+			s.logger.Error("failed to verify audit log chain", "error", err)
+			respondError(w, http.StatusInternalServerError, "failed to verify audit logs")
+			return
+		}
+
+		if !result.Valid {
+			s.logger.Warn("audit log chain verification failed",
+				"organization_id", claims.OrganizationID,
+				"sequence", result.Break.Sequence,
+				"reason", result.Break.Reason)
+		}
+
+		respondJSON(w, http.StatusOK, result)
+	}
+}
+
+// parseAuditLogFilter reads the audit log filters shared by the list and
+// export endpoints. action may be repeated or comma-separated; from and to
+// accept RFC 3339 timestamps or YYYY-MM-DD dates, and a date given for to
+// includes that whole day.
+func parseAuditLogFilter(r *http.Request) (store.AuditLogFilter, error) {
+	query := r.URL.Query()
+	filter := store.AuditLogFilter{
+		UserID:       query.Get("user_id"),
+		ActorType:    models.ActorType(query.Get("actor_type")),
+		ResourceType: query.Get("resource_type"),
+		ResourceID:   query.Get("resource_id"),
+		Search:       strings.TrimSpace(query.Get("q")),
+	}
+
+	seen := make(map[string]bool)
+	for _, value := range query["action"] {
+		for _, action := range strings.Split(value, ",") {
+			action = strings.TrimSpace(action)
+			if action == "" || seen[action] {
+				continue
+			}
+			seen[action] = true
+			filter.Actions = append(filter.Actions, models.AuditAction(action))
+		}
+	}
+	if len(filter.Actions) > store.MaxAuditLogActions {
+		return filter, fmt.Errorf("at most %d action values are allowed", store.MaxAuditLogActions)
+	}
+
+	var err error
+	if filter.From, err = parseTimeParam(query.Get("from"), false); err != nil {
+		return filter, fmt.Errorf("invalid from: %w", err)
+	}
+	if filter.To, err = parseTimeParam(query.Get("to"), true); err != nil {
+		return filter, fmt.Errorf("invalid to: %w", err)
+	}
+	if !filter.From.IsZero() && !filter.To.IsZero() && !filter.From.Before(filter.To) {
+		return filter, fmt.Errorf("from must be before to")
+	}
+
+	return filter, nil
+}
+
+// parseTimeParam parses an RFC 3339 timestamp or a YYYY-MM-DD date (UTC).
+// With endOfDay set a date is moved to the start of the following day so it
+// can serve as an exclusive upper bound. An empty value yields the zero time.
+func parseTimeParam(value string, endOfDay bool) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+
+	t, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("expected an RFC 3339 timestamp or YYYY-MM-DD date")
+	}
+	if endOfDay {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, nil
+}
+
 // handleGenerateReport implements STORY-023 & STORY-024: Generate compliance reports
 func (s *Server) handleGenerateReport() http.HandlerFunc {
 	type request struct {
@@ -118,6 +258,7 @@ func (s *Server) handleGenerateReport() http.HandlerFunc {
 		RequirementIDs []string `json:"requirement_ids"`
 		Title          string   `json:"title"`
 		Description    string   `json:"description"`
+		AsOf           string   `json:"as_of"` // RFC 3339 or YYYY-MM-DD; shows evidence files as they were then
 	}
 
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -139,6 +280,16 @@ func (s *Server) handleGenerateReport() http.HandlerFunc {
 			return
 		}
 
+		var asOf *time.Time
+		if req.AsOf != "" {
+			t, err := parseAsOf(req.AsOf)
+			if err != nil {
+				respondError(w, http.StatusBadRequest, "invalid as_of: "+err.Error())
+				return
+			}
+			asOf = &t
+		}
+
 		// Create report record
 		report := &models.Report{
 			OrganizationID: claims.OrganizationID,
@@ -146,6 +297,7 @@ func (s *Server) handleGenerateReport() http.HandlerFunc {
 			Description:    req.Description,
 			Type:           req.Type,
 			RequirementIDs: req.RequirementIDs,
+			AsOf:           asOf,
 			Status:         "pending",
 			GeneratedBy:    claims.UID,
 		}
@@ -172,7 +324,7 @@ func (s *Server) handleGenerateReport() http.HandlerFunc {
 			IPAddress:      r.RemoteAddr,
 			UserAgent:      r.UserAgent(),
 		}
-		s.store.CreateAuditLog(r.Context(), auditLog)
+		s.recordAudit(r.Context(), auditLog)
 
 		respondJSON(w, http.StatusAccepted, report)
 	}
@@ -242,14 +394,7 @@ func (s *Server) handleGetReportDownloadURL() http.HandlerFunc {
 		}
 
 		// Generate signed URL for download
-		expiresAt := time.Now().Add(1 * time.Hour)
-		opts := &storage.SignedURLOptions{
-			Scheme:  storage.SigningSchemeV4,
-			Method:  "GET",
-			Expires: expiresAt,
-		}
-
-		url, err := storage.SignedURL(s.config.StorageBucket, report.FileURL, opts)
+		url, expiresAt, err := s.signedDownloadURL(report.FileURL)
 		if err != nil {
 			s.logger.Error("failed to generate report download URL", "error", err)
 			respondError(w, http.StatusInternalServerError, "failed to generate download URL")
@@ -0,0 +1,547 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"compliancesync-api/internal/auth"
+	"compliancesync-api/internal/models"
+	"compliancesync-api/internal/store"
+	"github.com/go-chi/chi/v5"
+)
+
+// maxAuditorGrantDuration is the longest an auditor grant may stay valid.
+// Longer examinations are covered by issuing a new grant.
+const maxAuditorGrantDuration = 90 * 24 * time.Hour
+
+// Auditor grant handlers
+
+// handleCreateAuditorGrant grants an external auditor read-only access to a
+// set of requirements, their evidence within a date window, and selected
+// reports. The access token is sent to the auditor; only its hash is stored.
+func (s *Server) handleCreateAuditorGrant() http.HandlerFunc {
+	type request struct {
+		AuditorEmail   string    `json:"auditor_email"`
+		AuditorName    string    `json:"auditor_name"`
+		Purpose        string    `json:"purpose"`
+		RequirementIDs []string  `json:"requirement_ids"`
+		ReportIDs      []string  `json:"report_ids"`
+		WindowStart    time.Time `json:"window_start"`
+		WindowEnd      time.Time `json:"window_end"`
+		ExpiresAt      time.Time `json:"expires_at"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, err := auth.GetUserClaims(r)
+		if err != nil {
+			respondError(w, http.StatusUnauthorized, "authentication required")
+			return
+		}
+
+		var req request
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondError(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+
+		req.AuditorEmail = strings.TrimSpace(req.AuditorEmail)
+		if !strings.Contains(req.AuditorEmail, "@") {
+			respondError(w, http.StatusBadRequest, "a valid auditor_email is required")
+			return
+		}
+		if len(req.RequirementIDs) == 0 {
+			respondError(w, http.StatusBadRequest, "at least one requirement is required")
+			return
+		}
+		if req.WindowStart.IsZero() || req.WindowEnd.IsZero() || !req.WindowStart.Before(req.WindowEnd) {
+			respondError(w, http.StatusBadRequest, "window_start and window_end are required and window_start must be before window_end")
+			return
+		}
+		now := time.Now()
+		if !req.ExpiresAt.After(now) {
+			respondError(w, http.StatusBadRequest, "expires_at must be in the future")
+			return
+		}
+		if req.ExpiresAt.After(now.Add(maxAuditorGrantDuration)) {
+			respondError(w, http.StatusBadRequest, fmt.Sprintf("expires_at must be within %d days", int(maxAuditorGrantDuration.Hours()/24)))
+			return
+		}
+
+		requirementIDs, err := s.validateRequirementIDs(r, claims.OrganizationID, req.RequirementIDs)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		grant := &models.AuditorGrant{
+			OrganizationID: claims.OrganizationID,
+			AuditorEmail:   req.AuditorEmail,
+			AuditorName:    strings.TrimSpace(req.AuditorName),
+			Purpose:        req.Purpose,
+			RequirementIDs: requirementIDs,
+			WindowStart:    req.WindowStart,
+			WindowEnd:      req.WindowEnd,
+			ExpiresAt:      req.ExpiresAt,
+			CreatedBy:      claims.UID,
+		}
+
+		grant.ReportIDs, err = s.validateAuditorReportIDs(r, grant, req.ReportIDs)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		token, err := auth.GenerateAuditorToken()
+		if err != nil {
+			s.logger.Error("failed to generate auditor token", "error", err)
+			respondError(w, http.StatusInternalServerError, "failed to create auditor grant")
+			return
+		}
+		grant.TokenHash = auth.HashAuditorToken(token)
+
+		// Auditors are not users, so the grant is not checked against the
+		// subscription's user limit
+		if err := s.store.CreateAuditorGrant(r.Context(), grant); err != nil {
+			s.logger.Error("failed to create auditor grant", "error", err)
+			respondError(w, http.StatusInternalServerError, "failed to create auditor grant")
+			return
+		}
+
+		s.sendAuditorAccessEmail(grant, token)
+
+		// Create audit log
+		auditLog := &models.AuditLog{
+			OrganizationID: claims.OrganizationID,
+			UserID:         claims.UID,
+			UserEmail:      claims.Email,
+			Action:         models.ActionAuditorGrantCreated,
+			ResourceType:   "auditor_grant",
+			ResourceID:     grant.ID,
+			Description:    fmt.Sprintf("Granted auditor access to %s", grant.AuditorEmail),
+			Metadata: map[string]interface{}{
+				"requirement_ids": grant.RequirementIDs,
+				"report_ids":      grant.ReportIDs,
+				"window_start":    grant.WindowStart,
+				"window_end":      grant.WindowEnd,
+				"expires_at":      grant.ExpiresAt,
+			},
+			IPAddress: r.RemoteAddr,
+			UserAgent: r.UserAgent(),
+		}
+		s.recordAudit(r.Context(), auditLog)
+
+		respondJSON(w, http.StatusCreated, grant)
+	}
+}
+
+// handleListAuditorGrants lists the organization's auditor grants, including
+// revoked and expired ones
+func (s *Server) handleListAuditorGrants() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, err := auth.GetUserClaims(r)
+		if err != nil {
+			respondError(w, http.StatusUnauthorized, "authentication required")
+			return
+		}
+
+		opts, err := parseListOptions(r)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		grants, nextPageToken, err := s.store.ListAuditorGrants(r.Context(), claims.OrganizationID, opts)
+		if isListOptionsError(err) {
+			respondError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if err != nil {
+			s.logger.Error("failed to list auditor grants", "error", err)
+			respondError(w, http.StatusInternalServerError, "failed to list auditor grants")
+			return
+		}
+
+		respondJSON(w, http.StatusOK, listResponse{Items: grants, NextPageToken: nextPageToken})
+	}
+}
+
+// handleRevokeAuditorGrant revokes an auditor grant before it expires.
+// Requests using its token fail from then on.
+func (s *Server) handleRevokeAuditorGrant() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, err := auth.GetUserClaims(r)
+		if err != nil {
+			respondError(w, http.StatusUnauthorized, "authentication required")
+			return
+		}
+
+		grant, err := s.store.GetAuditorGrant(r.Context(), claims.OrganizationID, chi.URLParam(r, "grantID"))
+		if err != nil {
+			respondError(w, http.StatusNotFound, "auditor grant not found")
+			return
+		}
+		if grant.RevokedAt != nil {
+			respondError(w, http.StatusConflict, "auditor grant is already revoked")
+			return
+		}
+
+		now := time.Now()
+		grant.RevokedAt = &now
+		grant.RevokedBy = claims.UID
+
+		if err := s.store.UpdateAuditorGrant(r.Context(), grant); err != nil {
+			s.logger.Error("failed to revoke auditor grant", "error", err)
+			respondError(w, http.StatusInternalServerError, "failed to revoke auditor grant")
+			return
+		}
+
+		// Create audit log
+		auditLog := &models.AuditLog{
+			OrganizationID: claims.OrganizationID,
+			UserID:         claims.UID,
+			UserEmail:      claims.Email,
+			Action:         models.ActionAuditorGrantRevoked,
+			ResourceType:   "auditor_grant",
+			ResourceID:     grant.ID,
+			Description:    fmt.Sprintf("Revoked auditor access for %s", grant.AuditorEmail),
+			IPAddress:      r.RemoteAddr,
+			UserAgent:      r.UserAgent(),
+		}
+		s.recordAudit(r.Context(), auditLog)
+
+		respondJSON(w, http.StatusOK, grant)
+	}
+}
+
+// Auditor portal handlers. These authenticate with the grant's token and
+// only ever read; every view and download is recorded in the audit log with
+// the auditor actor type.
+
+// handleGetAuditorGrantInfo returns the grant the auditor authenticated with
+func (s *Server) handleGetAuditorGrantInfo() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		_, grant, ok := s.loadAuditorGrant(w, r)
+		if !ok {
+			return
+		}
+
+		respondJSON(w, http.StatusOK, grant)
+	}
+}
+
+// handleAuditorListRequirements lists the requirements covered by the grant
+func (s *Server) handleAuditorListRequirements() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, grant, ok := s.loadAuditorGrant(w, r)
+		if !ok {
+			return
+		}
+
+		requirements := make([]*models.Requirement, 0, len(grant.RequirementIDs))
+		for _, id := range grant.RequirementIDs {
+			requirement, err := s.store.GetRequirement(r.Context(), claims.OrganizationID, id)
+			if err != nil {
+				continue
+			}
+			requirements = append(requirements, requirement)
+		}
+
+		s.logAuditorAccess(r, claims, models.ActionRequirementViewed, "requirement", "",
+			fmt.Sprintf("Auditor listed %d granted requirements", len(requirements)), nil)
+
+		respondJSON(w, http.StatusOK, listResponse{Items: requirements})
+	}
+}
+
+// handleAuditorGetRequirement gets a single requirement covered by the grant
+func (s *Server) handleAuditorGetRequirement() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, grant, ok := s.loadAuditorGrant(w, r)
+		if !ok {
+			return
+		}
+
+		requirementID := chi.URLParam(r, "requirementID")
+		if !grant.CoversRequirement(requirementID) {
+			respondError(w, http.StatusNotFound, "requirement not found")
+			return
+		}
+
+		requirement, err := s.store.GetRequirement(r.Context(), claims.OrganizationID, requirementID)
+		if err != nil {
+			respondError(w, http.StatusNotFound, "requirement not found")
+			return
+		}
+
+		s.logAuditorAccess(r, claims, models.ActionRequirementViewed, "requirement", requirement.ID,
+			fmt.Sprintf("Auditor viewed requirement: %s", requirement.Title), nil)
+
+		respondJSON(w, http.StatusOK, requirement)
+	}
+}
+
+// handleAuditorListEvidence lists the evidence for a granted requirement that
+// falls within the grant's date window. The window is applied after each page
+// is fetched, so a page may hold fewer items than page_size even when more
+// follow.
+func (s *Server) handleAuditorListEvidence() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, grant, ok := s.loadAuditorGrant(w, r)
+		if !ok {
+			return
+		}
+
+		requirementID := chi.URLParam(r, "requirementID")
+		if !grant.CoversRequirement(requirementID) {
+			respondError(w, http.StatusNotFound, "requirement not found")
+			return
+		}
+
+		opts, err := parseListOptions(r)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		filters := map[string]interface{}{store.EvidenceRequirementFilter: requirementID}
+		page, nextPageToken, err := s.store.ListEvidence(r.Context(), claims.OrganizationID, filters, opts)
+		if isListOptionsError(err) {
+			respondError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if err != nil {
+			s.logger.Error("failed to list evidence", "error", err)
+			respondError(w, http.StatusInternalServerError, "failed to get evidence")
+			return
+		}
+
+		evidence := make([]*models.Evidence, 0, len(page))
+		evidenceIDs := make([]string, 0, len(page))
+		for _, e := range page {
+			if grant.InWindow(e.EvidenceDate) {
+				evidence = append(evidence, e)
+				evidenceIDs = append(evidenceIDs, e.ID)
+			}
+		}
+
+		s.logAuditorAccess(r, claims, models.ActionEvidenceViewed, "requirement", requirementID,
+			fmt.Sprintf("Auditor listed %d evidence items for requirement %s", len(evidence), requirementID),
+			map[string]interface{}{"evidence_ids": evidenceIDs})
+
+		respondJSON(w, http.StatusOK, listResponse{Items: evidence, NextPageToken: nextPageToken})
+	}
+}
+
+// handleAuditorGetEvidence gets a single evidence item covered by the grant
+func (s *Server) handleAuditorGetEvidence() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, grant, ok := s.loadAuditorGrant(w, r)
+		if !ok {
+			return
+		}
+
+		evidence, err := s.store.GetEvidence(r.Context(), claims.OrganizationID, chi.URLParam(r, "evidenceID"))
+		if err != nil || !grant.CoversEvidence(evidence) {
+			respondError(w, http.StatusNotFound, "evidence not found")
+			return
+		}
+
+		s.logAuditorAccess(r, claims, models.ActionEvidenceViewed, "evidence", evidence.ID,
+			fmt.Sprintf("Auditor viewed evidence: %s", evidence.Title), nil)
+
+		respondJSON(w, http.StatusOK, evidence)
+	}
+}
+
+// handleAuditorEvidenceDownloadURL generates a signed URL for downloading an
+// evidence file covered by the grant
+func (s *Server) handleAuditorEvidenceDownloadURL() http.HandlerFunc {
+	type response struct {
+		DownloadURL string `json:"download_url"`
+		ExpiresAt   string `json:"expires_at"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, grant, ok := s.loadAuditorGrant(w, r)
+		if !ok {
+			return
+		}
+
+		evidence, err := s.store.GetEvidence(r.Context(), claims.OrganizationID, chi.URLParam(r, "evidenceID"))
+		if err != nil || !grant.CoversEvidence(evidence) {
+			respondError(w, http.StatusNotFound, "evidence not found")
+			return
+		}
+		if evidence.FileURL == "" {
+			respondError(w, http.StatusBadRequest, "evidence has no file to download")
+			return
+		}
+
+		url, expiresAt, err := s.signedDownloadURL(evidence.FileURL)
+		if err != nil {
+			s.logger.Error("failed to generate download URL", "error", err)
+			respondError(w, http.StatusInternalServerError, "failed to generate download URL")
+			return
+		}
+
+		s.logAuditorAccess(r, claims, models.ActionEvidenceDownloaded, "evidence", evidence.ID,
+			fmt.Sprintf("Auditor downloaded evidence: %s", evidence.Title), nil)
+
+		respondJSON(w, http.StatusOK, response{
+			DownloadURL: url,
+			ExpiresAt:   expiresAt.Format(time.RFC3339),
+		})
+	}
+}
+
+// handleAuditorListReports lists the reports shared with the auditor
+func (s *Server) handleAuditorListReports() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, grant, ok := s.loadAuditorGrant(w, r)
+		if !ok {
+			return
+		}
+
+		reports := make([]*models.Report, 0, len(grant.ReportIDs))
+		for _, id := range grant.ReportIDs {
+			report, err := s.store.GetReport(r.Context(), claims.OrganizationID, id)
+			if err != nil {
+				continue
+			}
+			reports = append(reports, report)
+		}
+
+		s.logAuditorAccess(r, claims, models.ActionReportViewed, "report", "",
+			fmt.Sprintf("Auditor listed %d shared reports", len(reports)), nil)
+
+		respondJSON(w, http.StatusOK, listResponse{Items: reports})
+	}
+}
+
+// handleAuditorReportDownloadURL generates a signed URL for downloading a
+// report shared with the auditor
+func (s *Server) handleAuditorReportDownloadURL() http.HandlerFunc {
+	type response struct {
+		DownloadURL string `json:"download_url"`
+		ExpiresAt   string `json:"expires_at"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, grant, ok := s.loadAuditorGrant(w, r)
+		if !ok {
+			return
+		}
+
+		reportID := chi.URLParam(r, "reportID")
+		if !grant.CoversReport(reportID) {
+			respondError(w, http.StatusNotFound, "report not found")
+			return
+		}
+
+		report, err := s.store.GetReport(r.Context(), claims.OrganizationID, reportID)
+		if err != nil {
+			respondError(w, http.StatusNotFound, "report not found")
+			return
+		}
+		if report.Status != "completed" {
+			respondError(w, http.StatusBadRequest, "report is not ready for download")
+			return
+		}
+
+		url, expiresAt, err := s.signedDownloadURL(report.FileURL)
+		if err != nil {
+			s.logger.Error("failed to generate report download URL", "error", err)
+			respondError(w, http.StatusInternalServerError, "failed to generate download URL")
+			return
+		}
+
+		s.logAuditorAccess(r, claims, models.ActionReportDownloaded, "report", report.ID,
+			fmt.Sprintf("Auditor downloaded report: %s", report.Title), nil)
+
+		respondJSON(w, http.StatusOK, response{
+			DownloadURL: url,
+			ExpiresAt:   expiresAt.Format(time.RFC3339),
+		})
+	}
+}
+
+// loadAuditorGrant loads the grant the request authenticated with. On
+// failure it writes the error response and returns false.
+func (s *Server) loadAuditorGrant(w http.ResponseWriter, r *http.Request) (*auth.UserClaims, *models.AuditorGrant, bool) {
+	claims, err := auth.GetUserClaims(r)
+	if err != nil {
+		respondError(w, http.StatusUnauthorized, "authentication required")
+		return nil, nil, false
+	}
+
+	grant, err := s.store.GetAuditorGrant(r.Context(), claims.OrganizationID, claims.AuditorGrantID)
+	if err != nil {
+		respondError(w, http.StatusUnauthorized, "auditor grant not found")
+		return nil, nil, false
+	}
+
+	return claims, grant, true
+}
+
+// logAuditorAccess records an auditor's view or download. Entries carry the
+// auditor actor type and the grant ID so access can be reviewed per grant.
+func (s *Server) logAuditorAccess(r *http.Request, claims *auth.UserClaims, action models.AuditAction,
+	resourceType, resourceID, description string, metadata map[string]interface{}) {
+	if metadata == nil {
+		metadata = make(map[string]interface{})
+	}
+	metadata["auditor_grant_id"] = claims.AuditorGrantID
+
+	auditLog := &models.AuditLog{
+		OrganizationID: claims.OrganizationID,
+		UserID:         claims.UID,
+		UserEmail:      claims.Email,
+		ActorType:      models.ActorAuditor,
+		Action:         action,
+		ResourceType:   resourceType,
+		ResourceID:     resourceID,
+		Description:    description,
+		Metadata:       metadata,
+		IPAddress:      r.RemoteAddr,
+		UserAgent:      r.UserAgent(),
+	}
+	s.recordAudit(r.Context(), auditLog)
+}
+
+// validateAuditorReportIDs removes duplicate report IDs and checks that each
+// report is a requirement detail report whose requirements all fall within
+// the grant, so sharing a report never reveals requirements outside it
+func (s *Server) validateAuditorReportIDs(r *http.Request, grant *models.AuditorGrant, ids []string) ([]string, error) {
+	seen := make(map[string]bool, len(ids))
+	unique := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+
+		report, err := s.store.GetReport(r.Context(), grant.OrganizationID, id)
+		if err != nil {
+			return nil, fmt.Errorf("report %s not found", id)
+		}
+		if report.Type != "requirement_detail" || len(report.RequirementIDs) == 0 {
+			return nil, fmt.Errorf("report %s is not limited to specific requirements", id)
+		}
+		for _, requirementID := range report.RequirementIDs {
+			if !grant.CoversRequirement(requirementID) {
+				return nil, fmt.Errorf("report %s covers requirements outside the grant", id)
+			}
+		}
+		unique = append(unique, id)
+	}
+	return unique, nil
+}
+
+// sendAuditorAccessEmail sends the auditor their access token
+func (s *Server) sendAuditorAccessEmail(grant *models.AuditorGrant, token string) {
+	// In production, this would send an email via SendGrid
+	s.logger.Info("auditor access email queued", "grant_id", grant.ID)
+}
@@ -0,0 +1,304 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+
+	"compliancesync-api/internal/auth"
+	"compliancesync-api/internal/models"
+	"compliancesync-api/internal/store"
+)
+
+// Choices for a finalized upload whose content matches existing evidence
+const (
+	onDuplicateReject = ""     // Respond 409 with the matching evidence
+	onDuplicateLink   = "link" // Link the existing evidence to the requirements and discard the upload
+	onDuplicateKeep   = "keep" // Keep the upload as separate evidence
+)
+
+// duplicateGroup is active evidence sharing the same file content, oldest first
+type duplicateGroup struct {
+	ContentHash string             `json:"content_hash"`
+	Evidence    []*models.Evidence `json:"evidence"`
+}
+
+// respondDuplicate rejects a finalized upload that matches existing evidence,
+// listing the matches so the client can retry with on_duplicate
+func respondDuplicate(w http.ResponseWriter, evidence *models.Evidence, duplicates []*models.Evidence) {
+	respondJSON(w, http.StatusConflict, map[string]interface{}{
+		"error":        "evidence with the same content already exists",
+		"evidence_id":  evidence.ID,
+		"content_hash": evidence.ContentHash,
+		"duplicates":   duplicates,
+	})
+}
+
+// evidenceByContentHash returns the organization's active evidence with the
+// given content hash, oldest first, leaving out excludeID
+func (s *Server) evidenceByContentHash(ctx context.Context, orgID, contentHash, excludeID string) ([]*models.Evidence, error) {
+	filters := map[string]interface{}{"content_hash": contentHash}
+	opts := store.ListOptions{PageSize: store.MaxPageSize, SortBy: "created_at", Order: "asc"}
+
+	var matches []*models.Evidence
+	for {
+		page, next, err := s.store.ListEvidence(ctx, orgID, filters, opts)
+		if err != nil {
+			return nil, err
+		}
+		for _, evidence := range page {
+			if evidence.ID != excludeID {
+				matches = append(matches, evidence)
+			}
+		}
+		if next == "" {
+			return matches, nil
+		}
+		opts.PageToken = next
+	}
+}
+
+// linkDuplicateUpload finishes a pending upload whose content matches
+// existing evidence by linking that evidence to the requested requirements
+// and deleting the pending record and its file. It returns the updated
+// existing evidence.
+func (s *Server) linkDuplicateUpload(r *http.Request, claims *auth.UserClaims, pending, existing *models.Evidence, requirementIDs []string) (*models.Evidence, error) {
+	oldRequirements := existing.RequirementIDs
+	existing.RequirementIDs = unionIDs(existing.RequirementIDs, requirementIDs)
+
+	if err := s.store.UpdateEvidence(r.Context(), existing); err != nil {
+		return nil, err
+	}
+	if err := s.store.DeleteEvidence(r.Context(), claims.OrganizationID, pending.ID, pending.Version); err != nil {
+		return nil, err
+	}
+	// The existing evidence keeps its own copy of the content
+	if err := s.objects.Delete(r.Context(), pending.FileURL); err != nil {
+		s.logger.Error("failed to delete duplicate upload", "path", pending.FileURL, "error", err)
+	}
+	s.indexEvidence(r.Context(), existing, false)
+
+	auditLog := &models.AuditLog{
+		OrganizationID: claims.OrganizationID,
+		UserID:         claims.UID,
+		UserEmail:      claims.Email,
+		Action:         models.ActionEvidenceUpdated,
+		ResourceType:   "evidence",
+		ResourceID:     existing.ID,
+		Description:    fmt.Sprintf("Linked duplicate upload to evidence: %s", existing.Title),
+		Changes: map[string]interface{}{
+			"requirement_ids": map[string]interface{}{
+				"from": oldRequirements,
+				"to":   existing.RequirementIDs,
+			},
+		},
+		IPAddress: r.RemoteAddr,
+		UserAgent: r.UserAgent(),
+		Metadata: map[string]interface{}{
+			"duplicate_upload_id": pending.ID,
+			"file_name":           pending.FileName,
+			"content_hash":        pending.ContentHash,
+		},
+	}
+	s.recordAudit(r.Context(), auditLog)
+
+	return existing, nil
+}
+
+// handleListDuplicateEvidence reports every group of active evidence in the
+// organization that shares the same file content
+func (s *Server) handleListDuplicateEvidence() http.HandlerFunc {
+	type response struct {
+		Groups []duplicateGroup `json:"groups"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, err := auth.GetUserClaims(r)
+		if err != nil {
+			respondError(w, http.StatusUnauthorized, "authentication required")
+			return
+		}
+
+		byHash := make(map[string][]*models.Evidence)
+		opts := store.ListOptions{PageSize: store.MaxPageSize, SortBy: "created_at", Order: "asc"}
+		for {
+			page, next, err := s.store.ListEvidence(r.Context(), claims.OrganizationID, nil, opts)
+			if err != nil {
+				s.logger.Error("failed to list evidence", "error", err)
+				respondError(w, http.StatusInternalServerError, "failed to get evidence")
+				return
+			}
+			for _, evidence := range page {
+				// Evidence finalized before content hashing has no hash to compare
+				if evidence.ContentHash != "" {
+					byHash[evidence.ContentHash] = append(byHash[evidence.ContentHash], evidence)
+				}
+			}
+			if next == "" {
+				break
+			}
+			opts.PageToken = next
+		}
+
+		groups := []duplicateGroup{}
+		for hash, evidence := range byHash {
+			if len(evidence) > 1 {
+				groups = append(groups, duplicateGroup{ContentHash: hash, Evidence: evidence})
+			}
+		}
+		sort.Slice(groups, func(i, j int) bool { return groups[i].ContentHash < groups[j].ContentHash })
+
+		respondJSON(w, http.StatusOK, response{Groups: groups})
+	}
+}
+
+// handleMergeDuplicateEvidence merges duplicate evidence into the evidence
+// being kept. The kept evidence takes over the duplicates' requirements and
+// the duplicates are soft deleted, so their audit history remains.
+func (s *Server) handleMergeDuplicateEvidence() http.HandlerFunc {
+	type request struct {
+		KeepID       string   `json:"keep_id"`
+		DuplicateIDs []string `json:"duplicate_ids"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, err := auth.GetUserClaims(r)
+		if err != nil {
+			respondError(w, http.StatusUnauthorized, "authentication required")
+			return
+		}
+
+		var req request
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondError(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+		if req.KeepID == "" || len(req.DuplicateIDs) == 0 {
+			respondError(w, http.StatusBadRequest, "keep_id and duplicate_ids are required")
+			return
+		}
+
+		keep, err := s.store.GetEvidence(r.Context(), claims.OrganizationID, req.KeepID)
+		if err != nil || keep.Status != "active" {
+			respondError(w, http.StatusNotFound, "evidence not found")
+			return
+		}
+		if keep.ContentHash == "" {
+			respondError(w, http.StatusBadRequest, "evidence has no content hash")
+			return
+		}
+
+		var duplicates []*models.Evidence
+		seen := map[string]bool{keep.ID: true}
+		for _, id := range req.DuplicateIDs {
+			if seen[id] {
+				continue
+			}
+			seen[id] = true
+
+			duplicate, err := s.store.GetEvidence(r.Context(), claims.OrganizationID, id)
+			if err != nil || duplicate.Status != "active" {
+				respondError(w, http.StatusNotFound, fmt.Sprintf("evidence %s not found", id))
+				return
+			}
+			if duplicate.ContentHash != keep.ContentHash {
+				respondError(w, http.StatusBadRequest, fmt.Sprintf("evidence %s does not have the same content", id))
+				return
+			}
+			duplicates = append(duplicates, duplicate)
+		}
+		if len(duplicates) == 0 {
+			respondError(w, http.StatusBadRequest, "no duplicates to merge")
+			return
+		}
+
+		oldRequirements := keep.RequirementIDs
+		mergedIDs := make([]string, 0, len(duplicates))
+		for _, duplicate := range duplicates {
+			keep.RequirementIDs = unionIDs(keep.RequirementIDs, duplicate.RequirementIDs)
+			mergedIDs = append(mergedIDs, duplicate.ID)
+		}
+
+		// Link the kept evidence first so no requirement loses its evidence
+		// if a later write fails
+		if err := s.store.UpdateEvidence(r.Context(), keep); err != nil {
+			if isVersionConflict(err) {
+				respondPreconditionFailed(w)
+				return
+			}
+			s.logger.Error("failed to update evidence", "error", err)
+			respondError(w, http.StatusInternalServerError, "failed to merge evidence")
+			return
+		}
+
+		for _, duplicate := range duplicates {
+			if err := s.store.DeleteEvidence(r.Context(), claims.OrganizationID, duplicate.ID, duplicate.Version); err != nil {
+				if isVersionConflict(err) {
+					respondPreconditionFailed(w)
+					return
+				}
+				s.logger.Error("failed to delete duplicate evidence", "error", err)
+				respondError(w, http.StatusInternalServerError, "failed to merge evidence")
+				return
+			}
+			s.unindexEvidence(duplicate.ID)
+
+			s.recordAudit(r.Context(), &models.AuditLog{
+				OrganizationID: claims.OrganizationID,
+				UserID:         claims.UID,
+				UserEmail:      claims.Email,
+				Action:         models.ActionEvidenceMerged,
+				ResourceType:   "evidence",
+				ResourceID:     duplicate.ID,
+				Description:    fmt.Sprintf("Merged duplicate evidence %s into %s", duplicate.Title, keep.Title),
+				IPAddress:      r.RemoteAddr,
+				UserAgent:      r.UserAgent(),
+				Metadata: map[string]interface{}{
+					"merged_into":     keep.ID,
+					"content_hash":    duplicate.ContentHash,
+					"requirement_ids": duplicate.RequirementIDs,
+				},
+			})
+		}
+
+		auditLog := &models.AuditLog{
+			OrganizationID: claims.OrganizationID,
+			UserID:         claims.UID,
+			UserEmail:      claims.Email,
+			Action:         models.ActionEvidenceUpdated,
+			ResourceType:   "evidence",
+			ResourceID:     keep.ID,
+			Description:    fmt.Sprintf("Merged %d duplicates into evidence: %s", len(duplicates), keep.Title),
+			Changes: map[string]interface{}{
+				"requirement_ids": map[string]interface{}{
+					"from": oldRequirements,
+					"to":   keep.RequirementIDs,
+				},
+			},
+			IPAddress: r.RemoteAddr,
+			UserAgent: r.UserAgent(),
+			Metadata: map[string]interface{}{
+				"merged_evidence_ids": mergedIDs,
+				"content_hash":        keep.ContentHash,
+			},
+		}
+		s.recordAudit(r.Context(), auditLog)
+
+		setETag(w, keep.Version)
+		respondJSON(w, http.StatusOK, keep)
+	}
+}
+
+// unionIDs returns ids followed by the entries of more it does not contain
+func unionIDs(ids, more []string) []string {
+	union := append([]string(nil), ids...)
+	for _, id := range more {
+		if !slices.Contains(union, id) {
+			union = append(union, id)
+		}
+	}
+	return union
+}
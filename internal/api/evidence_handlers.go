@@ -2,13 +2,17 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"slices"
+	"strings"
 	"time"
 
 	"cloud.google.com/go/storage"
 	"compliancesync-api/internal/auth"
 	"compliancesync-api/internal/models"
+	"compliancesync-api/internal/store"
 	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
 )
@@ -40,25 +44,8 @@ func (s *Server) handleGenerateUploadURL() http.HandlerFunc {
 			return
 		}
 
-		// Validate file size (25MB max)
-		if req.FileSize > 25*1024*1024 {
-			respondError(w, http.StatusBadRequest, "file size exceeds maximum of 25MB")
-			return
-		}
-
-		// Validate file type
-		allowedTypes := map[string]bool{
-			"application/pdf":  true,
-			"application/msword": true,
-			"application/vnd.openxmlformats-officedocument.wordprocessingml.document": true,
-			"application/vnd.ms-excel": true,
-			"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet": true,
-			"image/png": true,
-			"image/jpeg": true,
-		}
-
-		if !allowedTypes[req.FileType] {
-			respondError(w, http.StatusBadRequest, "unsupported file type")
+		if err := validateUploadFile(req.FileSize, req.FileType); err != nil {
+			respondError(w, http.StatusBadRequest, err.Error())
 			return
 		}
 
@@ -69,15 +56,7 @@ func (s *Server) handleGenerateUploadURL() http.HandlerFunc {
 		filePath := fmt.Sprintf("%s/evidence/%s-%s", claims.OrganizationID, evidenceID, req.FileName)
 
 		// Generate signed URL for upload
-		expiresAt := time.Now().Add(15 * time.Minute)
-		opts := &storage.SignedURLOptions{
-			Scheme:      storage.SigningSchemeV4,
-			Method:      "PUT",
-			Expires:     expiresAt,
-			ContentType: req.FileType,
-		}
-
-		url, err := storage.SignedURL(s.config.StorageBucket, filePath, opts)
+		url, expiresAt, err := s.signedUploadURL(filePath, req.FileType)
 		if err != nil {
 			s.logger.Error("failed to generate signed URL", "error", err)
 			respondError(w, http.StatusInternalServerError, "failed to generate upload URL")
@@ -118,6 +97,9 @@ func (s *Server) handleCreateEvidence() http.HandlerFunc {
 		Description    string    `json:"description"`
 		EvidenceDate   string    `json:"evidence_date"` // ISO 8601 format
 		RequirementIDs []string  `json:"requirement_ids"`
+		Tags           []string  `json:"tags"`
+		OnDuplicate    string    `json:"on_duplicate"` // Empty, link or keep
+		DuplicateOf    string    `json:"duplicate_of"` // Evidence to link with on_duplicate=link; defaults to the oldest match
 	}
 
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -133,6 +115,13 @@ func (s *Server) handleCreateEvidence() http.HandlerFunc {
 			return
 		}
 
+		switch req.OnDuplicate {
+		case onDuplicateReject, onDuplicateLink, onDuplicateKeep:
+		default:
+			respondError(w, http.StatusBadRequest, "on_duplicate must be link or keep")
+			return
+		}
+
 		// Parse evidence date
 		evidenceDate, err := time.Parse(time.RFC3339, req.EvidenceDate)
 		if err != nil {
@@ -140,6 +129,12 @@ func (s *Server) handleCreateEvidence() http.HandlerFunc {
 			return
 		}
 
+		requirementIDs, err := s.validateRequirementIDs(r, claims.OrganizationID, req.RequirementIDs)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
 		// Get existing evidence record
 		evidence, err := s.store.GetEvidence(r.Context(), claims.OrganizationID, req.EvidenceID)
 		if err != nil {
@@ -147,19 +142,110 @@ func (s *Server) handleCreateEvidence() http.HandlerFunc {
 			return
 		}
 
+		// Only pending uploads are finalized here. Completed evidence is
+		// changed through PUT /evidence/{evidenceID}, which requires If-Match.
+		if evidence.Status != "uploading" {
+			respondError(w, http.StatusConflict, "evidence upload has already been completed")
+			return
+		}
+
+		// Confirm the file landed in the bucket as declared and scan it
+		// before activating it
+		contentHash, err := s.verifyUpload(r.Context(), evidence.FileURL, evidence.FileSize, evidence.FileType)
+		if err != nil {
+			var uploadErr *uploadError
+			if errors.As(err, &uploadErr) {
+				respondError(w, http.StatusUnprocessableEntity, uploadErr.Error())
+				return
+			}
+			s.logger.Error("failed to verify evidence upload", "error", err)
+			respondError(w, http.StatusInternalServerError, "failed to verify evidence upload")
+			return
+		}
+		evidence.ContentHash = contentHash
+
+		duplicates, err := s.evidenceByContentHash(r.Context(), claims.OrganizationID, contentHash, evidence.ID)
+		if err != nil {
+			s.logger.Error("failed to look up duplicate evidence", "error", err)
+			respondError(w, http.StatusInternalServerError, "failed to complete evidence upload")
+			return
+		}
+
+		if len(duplicates) > 0 {
+			switch req.OnDuplicate {
+			case onDuplicateReject:
+				respondDuplicate(w, evidence, duplicates)
+				return
+			case onDuplicateLink:
+				existing := duplicates[0]
+				if req.DuplicateOf != "" {
+					existing = nil
+					for _, duplicate := range duplicates {
+						if duplicate.ID == req.DuplicateOf {
+							existing = duplicate
+						}
+					}
+					if existing == nil {
+						respondError(w, http.StatusBadRequest, "duplicate_of does not have the same content")
+						return
+					}
+				}
+
+				linked, err := s.linkDuplicateUpload(r, claims, evidence, existing, requirementIDs)
+				if err != nil {
+					if isVersionConflict(err) {
+						respondPreconditionFailed(w)
+						return
+					}
+					s.logger.Error("failed to link duplicate evidence", "error", err)
+					respondError(w, http.StatusInternalServerError, "failed to complete evidence upload")
+					return
+				}
+
+				setETag(w, linked.Version)
+				respondJSON(w, http.StatusOK, linked)
+				return
+			}
+		}
+
+		scanRecord, err := s.scanFile(r.Context(), evidence.FileURL, contentHash)
+		if err != nil {
+			s.respondScanFailed(w, err)
+			return
+		}
+
 		// Update evidence record
 		evidence.Title = req.Title
 		evidence.Description = req.Description
 		evidence.EvidenceDate = evidenceDate
-		evidence.RequirementIDs = req.RequirementIDs
+		evidence.RequirementIDs = requirementIDs
+		evidence.Tags = normalizeTags(req.Tags)
 		evidence.Source = models.SourceManualUpload
-		evidence.Status = "active"
 
-		if err := s.store.UpdateEvidence(r.Context(), evidence); err != nil {
+		// Finalization publishes the file as version 1
+		previousStatus := evidence.Status
+		evidence.Status = "active"
+		applyScan(evidence, scanRecord)
+		err = s.store.PublishEvidenceVersion(r.Context(), evidence, &models.EvidenceVersion{
+			OrganizationID: evidence.OrganizationID,
+			EvidenceID:     evidence.ID,
+			FileURL:        evidence.FileURL,
+			FileName:       evidence.FileName,
+			FileSize:       evidence.FileSize,
+			FileType:       evidence.FileType,
+			ContentHash:    evidence.ContentHash,
+			UploadedBy:     evidence.UploadedBy,
+		})
+		if err != nil {
+			if isVersionConflict(err) {
+				respondPreconditionFailed(w)
+				return
+			}
 			s.logger.Error("failed to update evidence", "error", err)
 			respondError(w, http.StatusInternalServerError, "failed to complete evidence upload")
 			return
 		}
+		s.indexEvidence(r.Context(), evidence, true)
 
 		// Create audit log
 		auditLog := &models.AuditLog{
@@ -172,9 +258,17 @@ func (s *Server) handleCreateEvidence() http.HandlerFunc {
 			Description:    fmt.Sprintf("Uploaded evidence: %s", evidence.Title),
 			IPAddress:      r.RemoteAddr,
 			UserAgent:      r.UserAgent(),
+			Metadata: map[string]interface{}{
+				"file_name":    evidence.FileName,
+				"file_size":    evidence.FileSize,
+				"file_type":    evidence.FileType,
+				"content_hash": evidence.ContentHash,
+			},
 		}
-		s.store.CreateAuditLog(r.Context(), auditLog)
+		s.recordAudit(r.Context(), auditLog)
+		s.auditScan(r, claims, evidence, previousStatus)
 
+		setETag(w, evidence.Version)
 		respondJSON(w, http.StatusCreated, evidence)
 	}
 }
@@ -193,15 +287,33 @@ func (s *Server) handleListEvidence() http.HandlerFunc {
 		if source := r.URL.Query().Get("source"); source != "" {
 			filters["source"] = models.EvidenceSource(source)
 		}
+		switch status := r.URL.Query().Get("status"); status {
+		case "", "active":
+		case "quarantined":
+			filters[store.EvidenceStatusFilter] = status
+		default:
+			respondError(w, http.StatusBadRequest, "status must be active or quarantined")
+			return
+		}
+
+		opts, err := parseListOptions(r)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, err.Error())
+			return
+		}
 
-		evidence, err := s.store.ListEvidence(r.Context(), claims.OrganizationID, filters)
+		evidence, nextPageToken, err := s.store.ListEvidence(r.Context(), claims.OrganizationID, filters, opts)
+		if isListOptionsError(err) {
+			respondError(w, http.StatusBadRequest, err.Error())
+			return
+		}
 		if err != nil {
 			s.logger.Error("failed to list evidence", "error", err)
 			respondError(w, http.StatusInternalServerError, "failed to get evidence")
 			return
 		}
 
-		respondJSON(w, http.StatusOK, evidence)
+		respondJSON(w, http.StatusOK, listResponse{Items: evidence, NextPageToken: nextPageToken})
 	}
 }
 
@@ -234,8 +346,9 @@ func (s *Server) handleGetEvidence() http.HandlerFunc {
 			IPAddress:      r.RemoteAddr,
 			UserAgent:      r.UserAgent(),
 		}
-		s.store.CreateAuditLog(r.Context(), auditLog)
+		s.recordAudit(r.Context(), auditLog)
 
+		setETag(w, evidence.Version)
 		respondJSON(w, http.StatusOK, evidence)
 	}
 }
@@ -246,6 +359,7 @@ func (s *Server) handleUpdateEvidence() http.HandlerFunc {
 		Title          string   `json:"title"`
 		Description    string   `json:"description"`
 		RequirementIDs []string `json:"requirement_ids"`
+		Tags           []string `json:"tags"`
 	}
 
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -262,23 +376,39 @@ func (s *Server) handleUpdateEvidence() http.HandlerFunc {
 			return
 		}
 
+		requirementIDs, err := s.validateRequirementIDs(r, claims.OrganizationID, req.RequirementIDs)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
 		evidence, err := s.store.GetEvidence(r.Context(), claims.OrganizationID, evidenceID)
 		if err != nil {
 			respondError(w, http.StatusNotFound, "evidence not found")
 			return
 		}
 
+		if !checkIfMatch(w, r, evidence.Version) {
+			return
+		}
+
 		// Update fields
 		oldRequirements := evidence.RequirementIDs
 		evidence.Title = req.Title
 		evidence.Description = req.Description
-		evidence.RequirementIDs = req.RequirementIDs
+		evidence.RequirementIDs = requirementIDs
+		evidence.Tags = normalizeTags(req.Tags)
 
 		if err := s.store.UpdateEvidence(r.Context(), evidence); err != nil {
+			if isVersionConflict(err) {
+				respondPreconditionFailed(w)
+				return
+			}
 			s.logger.Error("failed to update evidence", "error", err)
 			respondError(w, http.StatusInternalServerError, "failed to update evidence")
 			return
 		}
+		s.indexEvidence(r.Context(), evidence, false)
 
 		// Create audit log
 		auditLog := &models.AuditLog{
@@ -292,14 +422,15 @@ func (s *Server) handleUpdateEvidence() http.HandlerFunc {
 			Changes: map[string]interface{}{
 				"requirement_ids": map[string]interface{}{
 					"from": oldRequirements,
-					"to":   req.RequirementIDs,
+					"to":   requirementIDs,
 				},
 			},
 			IPAddress: r.RemoteAddr,
 			UserAgent: r.UserAgent(),
 		}
-		s.store.CreateAuditLog(r.Context(), auditLog)
+		s.recordAudit(r.Context(), auditLog)
 
+		setETag(w, evidence.Version)
 		respondJSON(w, http.StatusOK, evidence)
 	}
 }
@@ -321,12 +452,21 @@ func (s *Server) handleDeleteEvidence() http.HandlerFunc {
 			return
 		}
 
+		if !checkIfMatch(w, r, evidence.Version) {
+			return
+		}
+
 		// Soft delete
-		if err := s.store.DeleteEvidence(r.Context(), claims.OrganizationID, evidenceID); err != nil {
+		if err := s.store.DeleteEvidence(r.Context(), claims.OrganizationID, evidenceID, evidence.Version); err != nil {
+			if isVersionConflict(err) {
+				respondPreconditionFailed(w)
+				return
+			}
 			s.logger.Error("failed to delete evidence", "error", err)
 			respondError(w, http.StatusInternalServerError, "failed to delete evidence")
 			return
 		}
+		s.unindexEvidence(evidence.ID)
 
 		// Create audit log
 		auditLog := &models.AuditLog{
@@ -343,7 +483,7 @@ func (s *Server) handleDeleteEvidence() http.HandlerFunc {
 			IPAddress: r.RemoteAddr,
 			UserAgent: r.UserAgent(),
 		}
-		s.store.CreateAuditLog(r.Context(), auditLog)
+		s.recordAudit(r.Context(), auditLog)
 
 		respondJSON(w, http.StatusOK, map[string]string{"message": "evidence deleted successfully"})
 	}
@@ -370,16 +510,13 @@ func (s *Server) handleGenerateDownloadURL() http.HandlerFunc {
 			respondError(w, http.StatusNotFound, "evidence not found")
 			return
 		}
-
-		// Generate signed URL for download
-		expiresAt := time.Now().Add(1 * time.Hour)
-		opts := &storage.SignedURLOptions{
-			Scheme:  storage.SigningSchemeV4,
-			Method:  "GET",
-			Expires: expiresAt,
+		if evidence.Status == "quarantined" {
+			respondError(w, http.StatusForbidden, "evidence file is quarantined")
+			return
 		}
 
-		url, err := storage.SignedURL(s.config.StorageBucket, evidence.FileURL, opts)
+		// Generate signed URL for download
+		url, expiresAt, err := s.signedDownloadURL(evidence.FileURL)
 		if err != nil {
 			s.logger.Error("failed to generate download URL", "error", err)
 			respondError(w, http.StatusInternalServerError, "failed to generate download URL")
@@ -398,7 +535,7 @@ func (s *Server) handleGenerateDownloadURL() http.HandlerFunc {
 			IPAddress:      r.RemoteAddr,
 			UserAgent:      r.UserAgent(),
 		}
-		s.store.CreateAuditLog(r.Context(), auditLog)
+		s.recordAudit(r.Context(), auditLog)
 
 		respondJSON(w, http.StatusOK, response{
 			DownloadURL: url,
@@ -406,3 +543,90 @@ func (s *Server) handleGenerateDownloadURL() http.HandlerFunc {
 		})
 	}
 }
+
+// maxUploadSize is the largest evidence file accepted, 25MB
+const maxUploadSize = 25 * 1024 * 1024
+
+// allowedUploadTypes are the content types accepted for evidence files
+var allowedUploadTypes = map[string]bool{
+	"application/pdf":    true,
+	"application/msword": true,
+	"application/vnd.openxmlformats-officedocument.wordprocessingml.document": true,
+	"application/vnd.ms-excel": true,
+	"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet": true,
+	"image/png":  true,
+	"image/jpeg": true,
+}
+
+// validateUploadFile checks the declared size and content type of an
+// evidence file before an upload URL is issued for it
+func validateUploadFile(size int64, fileType string) error {
+	if size > maxUploadSize {
+		return errors.New("file size exceeds maximum of 25MB")
+	}
+	if !allowedUploadTypes[fileType] {
+		return errors.New("unsupported file type")
+	}
+	return nil
+}
+
+// signedUploadURL returns a 15-minute signed PUT URL for an object in the
+// storage bucket, and when it expires. The upload must send contentType.
+func (s *Server) signedUploadURL(objectPath, contentType string) (string, time.Time, error) {
+	expiresAt := time.Now().Add(15 * time.Minute)
+	opts := &storage.SignedURLOptions{
+		Scheme:      storage.SigningSchemeV4,
+		Method:      "PUT",
+		Expires:     expiresAt,
+		ContentType: contentType,
+	}
+
+	url, err := storage.SignedURL(s.config.StorageBucket, objectPath, opts)
+	return url, expiresAt, err
+}
+
+// signedDownloadURL returns a one-hour signed GET URL for an object in the
+// storage bucket, and when it expires
+func (s *Server) signedDownloadURL(objectPath string) (string, time.Time, error) {
+	expiresAt := time.Now().Add(1 * time.Hour)
+	opts := &storage.SignedURLOptions{
+		Scheme:  storage.SigningSchemeV4,
+		Method:  "GET",
+		Expires: expiresAt,
+	}
+
+	url, err := storage.SignedURL(s.config.StorageBucket, objectPath, opts)
+	return url, expiresAt, err
+}
+
+// normalizeTags trims tags and drops empty and repeated ones
+func normalizeTags(tags []string) []string {
+	var normalized []string
+	for _, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		if tag != "" && !slices.Contains(normalized, tag) {
+			normalized = append(normalized, tag)
+		}
+	}
+	return normalized
+}
+
+// validateRequirementIDs removes duplicate requirement IDs and checks that each
+// belongs to the organization, so evidence counts are never applied to a
+// requirement that does not exist
+func (s *Server) validateRequirementIDs(r *http.Request, orgID string, ids []string) ([]string, error) {
+	seen := make(map[string]bool, len(ids))
+	unique := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+
+		if _, err := s.store.GetRequirement(r.Context(), orgID, id); err != nil {
+			return nil, fmt.Errorf("requirement %s not found", id)
+		}
+		unique = append(unique, id)
+	}
+	return unique, nil
+}
@@ -0,0 +1,240 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"compliancesync-api/internal/auth"
+	"compliancesync-api/internal/models"
+	"compliancesync-api/internal/store"
+	"github.com/go-chi/chi/v5"
+)
+
+// scanFile scans an evidence file for malware with the configured scanner.
+// It returns nil without scanning when no scanner is configured.
+func (s *Server) scanFile(ctx context.Context, path, contentHash string) (*models.EvidenceScan, error) {
+	if s.scanner == nil {
+		return nil, nil
+	}
+
+	reader, err := s.objects.Open(ctx, path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open object: %w", err)
+	}
+	defer reader.Close()
+
+	result, err := s.scanner.Scan(ctx, reader)
+	if err != nil {
+		return nil, err
+	}
+
+	record := &models.EvidenceScan{
+		Verdict:     models.ScanClean,
+		Scanner:     s.scanner.Name(),
+		ContentHash: contentHash,
+		ScannedAt:   time.Now(),
+	}
+	if result.Infected {
+		record.Verdict = models.ScanInfected
+		record.Signature = result.Signature
+	}
+	return record, nil
+}
+
+// applyScan records a scan on evidence and sets its status from the verdict.
+// Infected evidence is quarantined, and quarantined evidence whose file now
+// scans clean is released.
+func applyScan(evidence *models.Evidence, record *models.EvidenceScan) {
+	if record == nil {
+		return
+	}
+	evidence.Scan = record
+	switch {
+	case record.Verdict == models.ScanInfected:
+		evidence.Status = "quarantined"
+	case evidence.Status == "quarantined":
+		evidence.Status = "active"
+	}
+}
+
+// respondScanFailed reports a file that could not be scanned. The upload is
+// left pending so the client can retry once the scanner is reachable.
+func (s *Server) respondScanFailed(w http.ResponseWriter, err error) {
+	s.logger.Error("failed to scan evidence file", "error", err)
+	respondError(w, http.StatusServiceUnavailable, "malware scan failed; try again later")
+}
+
+// auditScan records the latest scan of evidence in the audit log, with the
+// status change it caused, and alerts the organization's admins when
+// evidence is newly quarantined
+func (s *Server) auditScan(r *http.Request, claims *auth.UserClaims, evidence *models.Evidence, previousStatus string) {
+	scan := evidence.Scan
+	if scan == nil {
+		return
+	}
+
+	action := models.ActionEvidenceScanned
+	description := fmt.Sprintf("Scanned evidence: %s", evidence.Title)
+	if scan.Verdict == models.ScanInfected {
+		action = models.ActionEvidenceQuarantined
+		description = fmt.Sprintf("Quarantined evidence %s: %s found", evidence.Title, scan.Signature)
+	}
+
+	auditLog := &models.AuditLog{
+		OrganizationID: claims.OrganizationID,
+		UserID:         claims.UID,
+		UserEmail:      claims.Email,
+		Action:         action,
+		ResourceType:   "evidence",
+		ResourceID:     evidence.ID,
+		Description:    description,
+		IPAddress:      r.RemoteAddr,
+		UserAgent:      r.UserAgent(),
+		Metadata: map[string]interface{}{
+			"verdict":      scan.Verdict,
+			"signature":    scan.Signature,
+			"scanner":      scan.Scanner,
+			"content_hash": scan.ContentHash,
+			"file_version": evidence.FileVersion,
+		},
+	}
+	if previousStatus != evidence.Status {
+		auditLog.Changes = map[string]interface{}{
+			"status": map[string]interface{}{
+				"from": previousStatus,
+				"to":   evidence.Status,
+			},
+		}
+	}
+	s.recordAudit(r.Context(), auditLog)
+
+	if evidence.Status == "quarantined" && previousStatus != "quarantined" {
+		s.notifyQuarantine(r.Context(), evidence)
+	}
+}
+
+// notifyQuarantine emails the organization's admins about quarantined
+// evidence. Failures are logged; the quarantine itself has already happened.
+func (s *Server) notifyQuarantine(ctx context.Context, evidence *models.Evidence) {
+	emails, err := s.adminEmails(ctx, evidence.OrganizationID)
+	if err != nil {
+		s.logger.Error("failed to list organization admins", "organization_id", evidence.OrganizationID, "error", err)
+		return
+	}
+	for _, email := range emails {
+		s.sendQuarantineEmail(email, evidence)
+	}
+}
+
+// adminEmails returns the email addresses of the organization's active admin
+// users and of members holding the admin role
+func (s *Server) adminEmails(ctx context.Context, orgID string) ([]string, error) {
+	var emails []string
+	seen := make(map[string]bool)
+	add := func(email string) {
+		if !seen[email] {
+			seen[email] = true
+			emails = append(emails, email)
+		}
+	}
+
+	opts := store.ListOptions{PageSize: store.MaxPageSize}
+	for {
+		users, next, err := s.store.ListUsersByOrganization(ctx, orgID, opts)
+		if err != nil {
+			return nil, err
+		}
+		for _, user := range users {
+			if user.Role == models.RoleAdmin && user.Status == "active" {
+				add(user.Email)
+			}
+		}
+		if next == "" {
+			break
+		}
+		opts.PageToken = next
+	}
+
+	opts = store.ListOptions{PageSize: store.MaxPageSize}
+	for {
+		memberships, next, err := s.store.ListMemberships(ctx, orgID, opts)
+		if err != nil {
+			return nil, err
+		}
+		for _, membership := range memberships {
+			if membership.Role == models.RoleAdmin {
+				add(membership.Email)
+			}
+		}
+		if next == "" {
+			return emails, nil
+		}
+		opts.PageToken = next
+	}
+}
+
+// sendQuarantineEmail alerts an admin that an evidence file was found infected
+func (s *Server) sendQuarantineEmail(email string, evidence *models.Evidence) {
+	// In production, this would send an email via SendGrid
+	s.logger.Info("quarantine email queued", "evidence_id", evidence.ID, "signature", evidence.Scan.Signature)
+}
+
+// handleScanEvidence scans the current file of evidence again, such as after
+// the scanner's signatures are updated. Evidence found infected is
+// quarantined, and quarantined evidence that now scans clean is released.
+// Like other updates it requires If-Match.
+func (s *Server) handleScanEvidence() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, err := auth.GetUserClaims(r)
+		if err != nil {
+			respondError(w, http.StatusUnauthorized, "authentication required")
+			return
+		}
+
+		if s.scanner == nil {
+			respondError(w, http.StatusNotImplemented, "malware scanning is not configured")
+			return
+		}
+
+		evidenceID := chi.URLParam(r, "evidenceID")
+		evidence, err := s.store.GetEvidence(r.Context(), claims.OrganizationID, evidenceID)
+		if err != nil || (evidence.Status != "active" && evidence.Status != "quarantined") {
+			respondError(w, http.StatusNotFound, "evidence not found")
+			return
+		}
+		if evidence.FileURL == "" {
+			respondError(w, http.StatusBadRequest, "evidence has no file to scan")
+			return
+		}
+
+		if !checkIfMatch(w, r, evidence.Version) {
+			return
+		}
+
+		record, err := s.scanFile(r.Context(), evidence.FileURL, evidence.ContentHash)
+		if err != nil {
+			s.respondScanFailed(w, err)
+			return
+		}
+
+		previousStatus := evidence.Status
+		applyScan(evidence, record)
+
+		if err := s.store.UpdateEvidence(r.Context(), evidence); err != nil {
+			if isVersionConflict(err) {
+				respondPreconditionFailed(w)
+				return
+			}
+			s.logger.Error("failed to update evidence", "error", err)
+			respondError(w, http.StatusInternalServerError, "failed to record malware scan")
+			return
+		}
+		s.indexEvidence(r.Context(), evidence, false)
+		s.auditScan(r, claims, evidence, previousStatus)
+
+		setETag(w, evidence.Version)
+		respondJSON(w, http.StatusOK, evidence)
+	}
+}
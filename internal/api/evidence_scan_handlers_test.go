@@ -0,0 +1,229 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"compliancesync-api/internal/auth"
+	"compliancesync-api/internal/models"
+	"compliancesync-api/internal/scan"
+	"compliancesync-api/internal/search"
+	"compliancesync-api/internal/store"
+	"compliancesync-api/internal/store/storetest"
+	"github.com/go-chi/chi/v5"
+)
+
+// memoryObjects is an objectStore holding uploaded files in memory
+type memoryObjects map[string][]byte
+
+func (m memoryObjects) Stat(ctx context.Context, path string) (*objectInfo, error) {
+	data, ok := m[path]
+	if !ok {
+		return nil, errObjectNotFound
+	}
+	return &objectInfo{Size: int64(len(data)), ContentType: "text/plain"}, nil
+}
+
+func (m memoryObjects) Open(ctx context.Context, path string) (io.ReadCloser, error) {
+	data, ok := m[path]
+	if !ok {
+		return nil, errObjectNotFound
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (m memoryObjects) Delete(ctx context.Context, path string) error {
+	delete(m, path)
+	return nil
+}
+
+// newScanTestServer returns a server backed by the memory store, objects
+// and a scratch search index, scanning with scanner
+func newScanTestServer(t *testing.T, objects memoryObjects, scanner scan.Scanner) *Server {
+	t.Helper()
+	index, err := search.Open(filepath.Join(t.TempDir(), "search"))
+	if err != nil {
+		t.Fatalf("search.Open: %v", err)
+	}
+	t.Cleanup(func() { index.Close() })
+
+	return &Server{
+		store:   store.NewMemoryStore(),
+		objects: objects,
+		search:  index,
+		scanner: scanner,
+		logger:  slog.New(slog.NewTextHandler(io.Discard, nil)),
+		config:  &Config{},
+	}
+}
+
+// serve calls handler as an admin of the test organization, with the
+// evidenceID route parameter set when given
+func serve(handler http.HandlerFunc, method, evidenceID string, body interface{}) *httptest.ResponseRecorder {
+	var payload bytes.Buffer
+	if body != nil {
+		json.NewEncoder(&payload).Encode(body)
+	}
+	r := httptest.NewRequest(method, "/", &payload)
+
+	routeCtx := chi.NewRouteContext()
+	if evidenceID != "" {
+		routeCtx.URLParams.Add("evidenceID", evidenceID)
+	}
+	claims := &auth.UserClaims{UID: "user-1", Email: "admin@example.com", OrganizationID: storetest.OrgID, Role: string(models.RoleAdmin)}
+	ctx := context.WithValue(r.Context(), chi.RouteCtxKey, routeCtx)
+	ctx = context.WithValue(ctx, auth.UserContextKey, claims)
+
+	w := httptest.NewRecorder()
+	handler(w, r.WithContext(ctx))
+	return w
+}
+
+// finalizeUpload creates a pending upload of content linked to a new
+// requirement and finalizes it, returning the requirement, the pending
+// evidence and the response
+func finalizeUpload(t *testing.T, s *Server, objects memoryObjects, content string) (*models.Requirement, *models.Evidence, *httptest.ResponseRecorder) {
+	t.Helper()
+	req := storetest.NewRequirement(t, s.store, "Malware protection")
+
+	path := "organizations/" + storetest.OrgID + "/evidence/upload.txt"
+	objects[path] = []byte(content)
+	pending := storetest.NewUpload(t, s.store, path, int64(len(content)))
+
+	w := serve(s.handleCreateEvidence(), http.MethodPost, "", map[string]interface{}{
+		"evidence_id":     pending.ID,
+		"title":           "Antivirus report",
+		"evidence_date":   "2024-01-15T00:00:00Z",
+		"requirement_ids": []string{req.ID},
+	})
+	return req, pending, w
+}
+
+func TestFinalizeInfectedUploadIsQuarantined(t *testing.T) {
+	objects := memoryObjects{}
+	s := newScanTestServer(t, objects, &scan.Fake{})
+	ctx := context.Background()
+
+	req, pending, w := finalizeUpload(t, s, objects, "report\n"+scan.EICAR)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("finalize: status %d, body %s", w.Code, w.Body)
+	}
+
+	evidence, err := s.store.GetEvidence(ctx, storetest.OrgID, pending.ID)
+	if err != nil {
+		t.Fatalf("GetEvidence: %v", err)
+	}
+	if evidence.Status != "quarantined" {
+		t.Errorf("status = %q, want quarantined", evidence.Status)
+	}
+	if evidence.Scan == nil || evidence.Scan.Verdict != models.ScanInfected || evidence.Scan.Signature == "" {
+		t.Errorf("scan = %+v, want an infected verdict with a signature", evidence.Scan)
+	}
+
+	if count := storetest.EvidenceCount(t, s.store, req.ID); count != 0 {
+		t.Errorf("evidence_count = %d, want quarantined evidence left uncounted", count)
+	}
+
+	if w := serve(s.handleGenerateDownloadURL(), http.MethodGet, pending.ID, nil); w.Code != http.StatusForbidden {
+		t.Errorf("download-url: status %d, want %d", w.Code, http.StatusForbidden)
+	}
+
+	logs, _, err := s.store.ListAuditLogs(ctx, storetest.OrgID, store.AuditLogFilter{
+		Actions: []models.AuditAction{models.ActionEvidenceQuarantined},
+	}, store.ListOptions{})
+	if err != nil {
+		t.Fatalf("ListAuditLogs: %v", err)
+	}
+	if len(logs) != 1 || logs[0].ResourceID != pending.ID {
+		t.Errorf("got %d evidence_quarantined audit entries, want 1 for %s", len(logs), pending.ID)
+	}
+}
+
+func TestFinalizeCleanUploadIsActive(t *testing.T) {
+	objects := memoryObjects{}
+	s := newScanTestServer(t, objects, &scan.Fake{})
+
+	_, pending, w := finalizeUpload(t, s, objects, "quarterly antivirus report")
+	if w.Code != http.StatusCreated {
+		t.Fatalf("finalize: status %d, body %s", w.Code, w.Body)
+	}
+
+	evidence, err := s.store.GetEvidence(context.Background(), storetest.OrgID, pending.ID)
+	if err != nil {
+		t.Fatalf("GetEvidence: %v", err)
+	}
+	if evidence.Status != "active" {
+		t.Errorf("status = %q, want active", evidence.Status)
+	}
+	if evidence.Scan == nil || evidence.Scan.Verdict != models.ScanClean {
+		t.Errorf("scan = %+v, want a clean verdict", evidence.Scan)
+	}
+}
+
+func TestFinalizeUploadScanFailureLeavesItPending(t *testing.T) {
+	objects := memoryObjects{}
+	s := newScanTestServer(t, objects, &scan.Fake{Err: errors.New("clamd unreachable")})
+
+	_, pending, w := finalizeUpload(t, s, objects, "report\n"+scan.EICAR)
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("finalize: status %d, want %d", w.Code, http.StatusServiceUnavailable)
+	}
+
+	evidence, err := s.store.GetEvidence(context.Background(), storetest.OrgID, pending.ID)
+	if err != nil {
+		t.Fatalf("GetEvidence: %v", err)
+	}
+	if evidence.Status != "uploading" {
+		t.Errorf("status = %q, want the upload left pending", evidence.Status)
+	}
+}
+
+func TestScanEvidenceRequiresIfMatch(t *testing.T) {
+	objects := memoryObjects{}
+	s := newScanTestServer(t, objects, &scan.Fake{})
+
+	_, pending, w := finalizeUpload(t, s, objects, "quarterly antivirus report")
+	if w.Code != http.StatusCreated {
+		t.Fatalf("finalize: status %d, body %s", w.Code, w.Body)
+	}
+
+	if w := serve(s.handleScanEvidence(), http.MethodPost, pending.ID, nil); w.Code != http.StatusPreconditionRequired {
+		t.Errorf("scan without If-Match: status %d, want %d", w.Code, http.StatusPreconditionRequired)
+	}
+}
+
+func TestFinalizeCompletedUploadConflicts(t *testing.T) {
+	objects := memoryObjects{}
+	s := newScanTestServer(t, objects, &scan.Fake{})
+
+	req, pending, w := finalizeUpload(t, s, objects, "quarterly antivirus report")
+	if w.Code != http.StatusCreated {
+		t.Fatalf("finalize: status %d, body %s", w.Code, w.Body)
+	}
+
+	w = serve(s.handleCreateEvidence(), http.MethodPost, "", map[string]interface{}{
+		"evidence_id":     pending.ID,
+		"title":           "Replaced",
+		"evidence_date":   "2024-01-15T00:00:00Z",
+		"requirement_ids": []string{req.ID},
+	})
+	if w.Code != http.StatusConflict {
+		t.Fatalf("finalize again: status %d, want %d", w.Code, http.StatusConflict)
+	}
+
+	evidence, err := s.store.GetEvidence(context.Background(), storetest.OrgID, pending.ID)
+	if err != nil {
+		t.Fatalf("GetEvidence: %v", err)
+	}
+	if evidence.Title != "Antivirus report" {
+		t.Errorf("title = %q, want the completed evidence left unchanged", evidence.Title)
+	}
+}
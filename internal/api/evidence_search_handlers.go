@@ -0,0 +1,203 @@
+package api
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"compliancesync-api/internal/auth"
+	"compliancesync-api/internal/models"
+	"compliancesync-api/internal/search"
+	"compliancesync-api/internal/store"
+)
+
+// searchResult is an evidence item matching a search, with its relevance
+// score and highlighted fragments of the matching fields
+type searchResult struct {
+	Evidence   *models.Evidence    `json:"evidence"`
+	Score      float64             `json:"score"`
+	Highlights map[string][]string `json:"highlights,omitempty"`
+}
+
+// indexEvidence brings the search index up to date with an evidence item.
+// The text of its file is extracted again when fileChanged is set, and
+// otherwise kept from the index. Index failures are logged rather than
+// failing the change that triggered them; a reindex repairs the index.
+func (s *Server) indexEvidence(ctx context.Context, evidence *models.Evidence, fileChanged bool) {
+	if evidence.Status != "active" {
+		s.unindexEvidence(evidence.ID)
+		return
+	}
+
+	var content string
+	indexed := false
+	if !fileChanged {
+		var err error
+		if content, indexed, err = s.search.Content(evidence.ID); err != nil {
+			s.logger.Error("failed to read search index", "evidence_id", evidence.ID, "error", err)
+		}
+	}
+	if !indexed {
+		content = s.extractEvidenceText(ctx, evidence)
+	}
+
+	if err := s.search.Index(evidence, content); err != nil {
+		s.logger.Error("failed to index evidence", "evidence_id", evidence.ID, "error", err)
+	}
+}
+
+// unindexEvidence removes an evidence item from the search index
+func (s *Server) unindexEvidence(evidenceID string) {
+	if err := s.search.Delete(evidenceID); err != nil {
+		s.logger.Error("failed to remove evidence from search index", "evidence_id", evidenceID, "error", err)
+	}
+}
+
+// extractEvidenceText returns the text of an evidence file, or "" when its
+// type carries no extractable text or the file cannot be read
+func (s *Server) extractEvidenceText(ctx context.Context, evidence *models.Evidence) string {
+	fileType := mediaType(evidence.FileType)
+	if evidence.FileURL == "" || !search.Extractable(fileType) {
+		return ""
+	}
+
+	file, err := s.objects.Open(ctx, evidence.FileURL)
+	if err != nil {
+		s.logger.Warn("failed to open evidence file for indexing", "evidence_id", evidence.ID, "error", err)
+		return ""
+	}
+	defer file.Close()
+
+	text, err := search.ExtractText(file, fileType)
+	if err != nil {
+		s.logger.Warn("failed to extract evidence text", "evidence_id", evidence.ID, "error", err)
+		return ""
+	}
+	return text
+}
+
+// Search page tokens encode the offset of the next page of hits
+func encodeSearchPageToken(offset int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.Itoa(offset)))
+}
+
+func decodeSearchPageToken(token string) (int, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return 0, store.ErrInvalidPageToken
+	}
+	offset, err := strconv.Atoi(string(raw))
+	if err != nil || offset < 0 {
+		return 0, store.ErrInvalidPageToken
+	}
+	return offset, nil
+}
+
+// handleSearchEvidence implements STORY-014: Evidence List View and Search.
+// It ranks the organization's active evidence against q by title, tags, file
+// name, description and the text of PDF, DOCX and XLSX files.
+func (s *Server) handleSearchEvidence() http.HandlerFunc {
+	type response struct {
+		Items         []searchResult `json:"items"`
+		NextPageToken string         `json:"next_page_token,omitempty"`
+		Total         uint64         `json:"total"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, err := auth.GetUserClaims(r)
+		if err != nil {
+			respondError(w, http.StatusUnauthorized, "authentication required")
+			return
+		}
+
+		q := strings.TrimSpace(r.URL.Query().Get("q"))
+		if q == "" {
+			respondError(w, http.StatusBadRequest, "q is required")
+			return
+		}
+
+		opts, err := parseListOptions(r)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		offset := 0
+		if opts.PageToken != "" {
+			if offset, err = decodeSearchPageToken(opts.PageToken); err != nil {
+				respondError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+		}
+
+		results, err := s.search.Search(claims.OrganizationID, q, offset, opts.PageSize)
+		if err != nil {
+			s.logger.Error("failed to search evidence", "error", err)
+			respondError(w, http.StatusInternalServerError, "failed to search evidence")
+			return
+		}
+
+		items := make([]searchResult, 0, len(results.Hits))
+		for _, hit := range results.Hits {
+			// The store is authoritative; skip hits the index has not caught up on
+			evidence, err := s.store.GetEvidence(r.Context(), claims.OrganizationID, hit.EvidenceID)
+			if err != nil || evidence.Status != "active" {
+				continue
+			}
+			items = append(items, searchResult{Evidence: evidence, Score: hit.Score, Highlights: hit.Highlights})
+		}
+
+		var nextPageToken string
+		if next := offset + opts.PageSize; uint64(next) < results.Total {
+			nextPageToken = encodeSearchPageToken(next)
+		}
+
+		respondJSON(w, http.StatusOK, response{Items: items, NextPageToken: nextPageToken, Total: results.Total})
+	}
+}
+
+// handleReindexEvidence rebuilds the organization's part of the search index
+// from the store, extracting the text of every active evidence file again
+func (s *Server) handleReindexEvidence() http.HandlerFunc {
+	type response struct {
+		Indexed int `json:"indexed"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, err := auth.GetUserClaims(r)
+		if err != nil {
+			respondError(w, http.StatusUnauthorized, "authentication required")
+			return
+		}
+
+		if _, err := s.search.DeleteOrganization(claims.OrganizationID); err != nil {
+			s.logger.Error("failed to clear search index", "error", err)
+			respondError(w, http.StatusInternalServerError, "failed to reindex evidence")
+			return
+		}
+
+		indexed := 0
+		opts := store.ListOptions{PageSize: store.MaxPageSize}
+		for {
+			page, next, err := s.store.ListEvidence(r.Context(), claims.OrganizationID, nil, opts)
+			if err != nil {
+				s.logger.Error("failed to list evidence", "error", err)
+				respondError(w, http.StatusInternalServerError, "failed to reindex evidence")
+				return
+			}
+			for _, evidence := range page {
+				if evidence.Status == "active" {
+					s.indexEvidence(r.Context(), evidence, true)
+					indexed++
+				}
+			}
+			if next == "" {
+				break
+			}
+			opts.PageToken = next
+		}
+
+		respondJSON(w, http.StatusOK, response{Indexed: indexed})
+	}
+}
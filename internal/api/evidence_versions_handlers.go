@@ -0,0 +1,346 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"compliancesync-api/internal/auth"
+	"compliancesync-api/internal/models"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+// parseAsOf parses an as_of parameter. A YYYY-MM-DD date means the end of
+// that day, so a version that became current during it counts.
+func parseAsOf(value string) (time.Time, error) {
+	t, err := parseTimeParam(value, true)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if _, err := time.Parse("2006-01-02", value); err == nil {
+		t = t.Add(-time.Nanosecond)
+	}
+	return t, nil
+}
+
+// handleGenerateVersionUploadURL issues a signed URL for uploading a new
+// version of an evidence file
+func (s *Server) handleGenerateVersionUploadURL() http.HandlerFunc {
+	type request struct {
+		FileName string `json:"file_name"`
+		FileType string `json:"file_type"`
+		FileSize int64  `json:"file_size"`
+	}
+
+	type response struct {
+		UploadURL string `json:"upload_url"`
+		VersionID string `json:"version_id"`
+		ExpiresAt string `json:"expires_at"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, err := auth.GetUserClaims(r)
+		if err != nil {
+			respondError(w, http.StatusUnauthorized, "authentication required")
+			return
+		}
+
+		var req request
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondError(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+		if err := validateUploadFile(req.FileSize, req.FileType); err != nil {
+			respondError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		// Quarantined evidence takes new versions so a clean file can replace
+		// an infected one
+		evidenceID := chi.URLParam(r, "evidenceID")
+		evidence, err := s.store.GetEvidence(r.Context(), claims.OrganizationID, evidenceID)
+		if err != nil || (evidence.Status != "active" && evidence.Status != "quarantined") {
+			respondError(w, http.StatusNotFound, "evidence not found")
+			return
+		}
+
+		versionID := uuid.New().String()
+		filePath := fmt.Sprintf("%s/evidence/%s/versions/%s-%s", claims.OrganizationID, evidence.ID, versionID, req.FileName)
+
+		url, expiresAt, err := s.signedUploadURL(filePath, req.FileType)
+		if err != nil {
+			s.logger.Error("failed to generate signed URL", "error", err)
+			respondError(w, http.StatusInternalServerError, "failed to generate upload URL")
+			return
+		}
+
+		version := &models.EvidenceVersion{
+			ID:             versionID,
+			OrganizationID: claims.OrganizationID,
+			EvidenceID:     evidence.ID,
+			FileURL:        filePath,
+			FileName:       req.FileName,
+			FileSize:       req.FileSize,
+			FileType:       req.FileType,
+			Status:         "uploading",
+			UploadedBy:     claims.UID,
+		}
+		if err := s.store.CreateEvidenceVersion(r.Context(), version); err != nil {
+			s.logger.Error("failed to create evidence version", "error", err)
+			respondError(w, http.StatusInternalServerError, "failed to create evidence version")
+			return
+		}
+
+		respondJSON(w, http.StatusOK, response{
+			UploadURL: url,
+			VersionID: versionID,
+			ExpiresAt: expiresAt.Format(time.RFC3339),
+		})
+	}
+}
+
+// handleCreateEvidenceVersion verifies an uploaded file and makes it the
+// current version of the evidence. Requires If-Match on the evidence.
+func (s *Server) handleCreateEvidenceVersion() http.HandlerFunc {
+	type request struct {
+		VersionID string `json:"version_id"` // From version upload URL generation
+		Note      string `json:"note"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, err := auth.GetUserClaims(r)
+		if err != nil {
+			respondError(w, http.StatusUnauthorized, "authentication required")
+			return
+		}
+
+		var req request
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondError(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+
+		evidenceID := chi.URLParam(r, "evidenceID")
+		evidence, err := s.store.GetEvidence(r.Context(), claims.OrganizationID, evidenceID)
+		if err != nil || (evidence.Status != "active" && evidence.Status != "quarantined") {
+			respondError(w, http.StatusNotFound, "evidence not found")
+			return
+		}
+
+		if !checkIfMatch(w, r, evidence.Version) {
+			return
+		}
+
+		version, err := s.store.GetEvidenceVersion(r.Context(), claims.OrganizationID, evidence.ID, req.VersionID)
+		if err != nil {
+			respondError(w, http.StatusNotFound, "evidence version not found")
+			return
+		}
+		if version.Status != "uploading" {
+			respondError(w, http.StatusConflict, "evidence version has already been published")
+			return
+		}
+
+		contentHash, err := s.verifyUpload(r.Context(), version.FileURL, version.FileSize, version.FileType)
+		if err != nil {
+			var uploadErr *uploadError
+			if errors.As(err, &uploadErr) {
+				respondError(w, http.StatusUnprocessableEntity, uploadErr.Error())
+				return
+			}
+			s.logger.Error("failed to verify evidence upload", "error", err)
+			respondError(w, http.StatusInternalServerError, "failed to verify evidence upload")
+			return
+		}
+		if contentHash == evidence.ContentHash {
+			respondError(w, http.StatusConflict, "file is identical to the current version")
+			return
+		}
+
+		scanRecord, err := s.scanFile(r.Context(), version.FileURL, contentHash)
+		if err != nil {
+			s.respondScanFailed(w, err)
+			return
+		}
+
+		previousVersion := evidence.FileVersion
+		previousStatus := evidence.Status
+		version.ContentHash = contentHash
+		version.Note = req.Note
+		applyScan(evidence, scanRecord)
+
+		if err := s.store.PublishEvidenceVersion(r.Context(), evidence, version); err != nil {
+			if isVersionConflict(err) {
+				respondPreconditionFailed(w)
+				return
+			}
+			s.logger.Error("failed to publish evidence version", "error", err)
+			respondError(w, http.StatusInternalServerError, "failed to publish evidence version")
+			return
+		}
+		s.indexEvidence(r.Context(), evidence, true)
+
+		auditLog := &models.AuditLog{
+			OrganizationID: claims.OrganizationID,
+			UserID:         claims.UID,
+			UserEmail:      claims.Email,
+			Action:         models.ActionEvidenceVersionAdded,
+			ResourceType:   "evidence",
+			ResourceID:     evidence.ID,
+			Description:    fmt.Sprintf("Uploaded version %d of evidence: %s", version.Number, evidence.Title),
+			Changes: map[string]interface{}{
+				"file_version": map[string]interface{}{
+					"from": previousVersion,
+					"to":   version.Number,
+				},
+			},
+			IPAddress: r.RemoteAddr,
+			UserAgent: r.UserAgent(),
+			Metadata: map[string]interface{}{
+				"version_id":   version.ID,
+				"file_name":    version.FileName,
+				"file_size":    version.FileSize,
+				"file_type":    version.FileType,
+				"content_hash": version.ContentHash,
+				"note":         version.Note,
+			},
+		}
+		s.recordAudit(r.Context(), auditLog)
+		s.auditScan(r, claims, evidence, previousStatus)
+
+		setETag(w, evidence.Version)
+		respondJSON(w, http.StatusCreated, evidence)
+	}
+}
+
+// handleListEvidenceVersions lists the versions of an evidence file, oldest
+// first. With as_of it returns only the version current on that date.
+func (s *Server) handleListEvidenceVersions() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, err := auth.GetUserClaims(r)
+		if err != nil {
+			respondError(w, http.StatusUnauthorized, "authentication required")
+			return
+		}
+
+		var asOf time.Time
+		if value := r.URL.Query().Get("as_of"); value != "" {
+			if asOf, err = parseAsOf(value); err != nil {
+				respondError(w, http.StatusBadRequest, "invalid as_of: "+err.Error())
+				return
+			}
+		}
+
+		evidenceID := chi.URLParam(r, "evidenceID")
+		evidence, err := s.store.GetEvidence(r.Context(), claims.OrganizationID, evidenceID)
+		if err != nil || evidence.Status == "deleted" {
+			respondError(w, http.StatusNotFound, "evidence not found")
+			return
+		}
+
+		versions, err := s.store.ListEvidenceVersions(r.Context(), claims.OrganizationID, evidence.ID)
+		if err != nil {
+			s.logger.Error("failed to list evidence versions", "error", err)
+			respondError(w, http.StatusInternalServerError, "failed to get evidence versions")
+			return
+		}
+
+		if !asOf.IsZero() {
+			current := models.CurrentVersionAt(versions, asOf)
+			versions = []*models.EvidenceVersion{}
+			if current != nil {
+				versions = append(versions, current)
+			}
+		}
+		if versions == nil {
+			versions = []*models.EvidenceVersion{}
+		}
+
+		respondJSON(w, http.StatusOK, listResponse{Items: versions})
+	}
+}
+
+// handleGenerateVersionDownloadURL generates a signed URL for downloading a
+// specific version of an evidence file
+func (s *Server) handleGenerateVersionDownloadURL() http.HandlerFunc {
+	type response struct {
+		DownloadURL string `json:"download_url"`
+		ExpiresAt   string `json:"expires_at"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, err := auth.GetUserClaims(r)
+		if err != nil {
+			respondError(w, http.StatusUnauthorized, "authentication required")
+			return
+		}
+
+		number, err := strconv.Atoi(chi.URLParam(r, "number"))
+		if err != nil {
+			respondError(w, http.StatusBadRequest, "invalid version number")
+			return
+		}
+
+		evidenceID := chi.URLParam(r, "evidenceID")
+		evidence, err := s.store.GetEvidence(r.Context(), claims.OrganizationID, evidenceID)
+		if err != nil || evidence.Status == "deleted" {
+			respondError(w, http.StatusNotFound, "evidence not found")
+			return
+		}
+		if evidence.Status == "quarantined" {
+			respondError(w, http.StatusForbidden, "evidence file is quarantined")
+			return
+		}
+
+		versions, err := s.store.ListEvidenceVersions(r.Context(), claims.OrganizationID, evidence.ID)
+		if err != nil {
+			s.logger.Error("failed to list evidence versions", "error", err)
+			respondError(w, http.StatusInternalServerError, "failed to get evidence versions")
+			return
+		}
+
+		var version *models.EvidenceVersion
+		for _, v := range versions {
+			if v.Number == number {
+				version = v
+			}
+		}
+		if version == nil {
+			respondError(w, http.StatusNotFound, "evidence version not found")
+			return
+		}
+
+		url, expiresAt, err := s.signedDownloadURL(version.FileURL)
+		if err != nil {
+			s.logger.Error("failed to generate download URL", "error", err)
+			respondError(w, http.StatusInternalServerError, "failed to generate download URL")
+			return
+		}
+
+		auditLog := &models.AuditLog{
+			OrganizationID: claims.OrganizationID,
+			UserID:         claims.UID,
+			UserEmail:      claims.Email,
+			Action:         models.ActionEvidenceDownloaded,
+			ResourceType:   "evidence",
+			ResourceID:     evidence.ID,
+			Description:    fmt.Sprintf("Downloaded version %d of evidence: %s", version.Number, evidence.Title),
+			IPAddress:      r.RemoteAddr,
+			UserAgent:      r.UserAgent(),
+			Metadata: map[string]interface{}{
+				"file_version": version.Number,
+				"content_hash": version.ContentHash,
+			},
+		}
+		s.recordAudit(r.Context(), auditLog)
+
+		respondJSON(w, http.StatusOK, response{
+			DownloadURL: url,
+			ExpiresAt:   expiresAt.Format(time.RFC3339),
+		})
+	}
+}
@@ -1,13 +1,16 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"time"
 
 	"compliancesync-api/internal/auth"
 	"compliancesync-api/internal/models"
+	"compliancesync-api/internal/store"
 	"github.com/go-chi/chi/v5"
 	"golang.org/x/crypto/bcrypt"
 )
@@ -24,6 +27,7 @@ func (s *Server) handleRegister() http.HandlerFunc {
 		Industry         models.Industry `json:"industry"`
 		EmployeeCount    models.EmployeeCountRange `json:"employee_count"`
 		RegulatoryFramework models.RegulatoryFramework `json:"regulatory_framework"`
+		Partner          bool   `json:"partner"` // Register a partner firm that manages client organizations
 	}
 
 	type response struct {
@@ -54,6 +58,10 @@ func (s *Server) handleRegister() http.HandlerFunc {
 
 		// Create user in Firebase Auth
 		uid, err := s.authMiddleware.CreateUser(r.Context(), req.Email, req.Password, req.FullName)
+		if errors.Is(err, auth.ErrUnsupported) {
+			respondError(w, http.StatusNotImplemented, "registration is handled by your identity provider")
+			return
+		}
 		if err != nil {
 			s.logger.Error("failed to create firebase user", "error", err)
 			respondError(w, http.StatusInternalServerError, "failed to create user account")
@@ -66,6 +74,7 @@ func (s *Server) handleRegister() http.HandlerFunc {
 			Industry:            req.Industry,
 			EmployeeCount:       req.EmployeeCount,
 			RegulatoryFramework: req.RegulatoryFramework,
+			Partner:             req.Partner,
 			Subscription: models.Subscription{
 				Tier:   models.TierStarter,
 				Status: "trial",
@@ -121,7 +130,7 @@ func (s *Server) handleRegister() http.HandlerFunc {
 			IPAddress:      r.RemoteAddr,
 			UserAgent:      r.UserAgent(),
 		}
-		s.store.CreateAuditLog(r.Context(), auditLog)
+		s.recordAudit(r.Context(), auditLog)
 
 		respondJSON(w, http.StatusCreated, response{
 			Message:        "Registration successful. Please check your email to verify your account.",
@@ -149,7 +158,7 @@ func (s *Server) handlePasswordReset() http.HandlerFunc {
 		}
 
 		// Always return success message for security (don't reveal if email exists)
-		if err := s.authMiddleware.SendPasswordResetEmail(r.Context(), req.Email); err != nil {
+		if err := s.authMiddleware.SendPasswordResetEmail(r.Context(), req.Email); err != nil && !errors.Is(err, auth.ErrUnsupported) {
 			s.logger.Error("failed to send password reset email", "error", err)
 		}
 
@@ -238,6 +247,7 @@ func (s *Server) handleGetOrganization() http.HandlerFunc {
 			return
 		}
 
+		setETag(w, org.Version)
 		respondJSON(w, http.StatusOK, org)
 	}
 }
@@ -273,6 +283,10 @@ func (s *Server) handleUpdateOrganization() http.HandlerFunc {
 			return
 		}
 
+		if !checkIfMatch(w, r, org.Version) {
+			return
+		}
+
 		// Update fields
 		org.Name = req.Name
 		org.Industry = req.Industry
@@ -284,6 +298,10 @@ func (s *Server) handleUpdateOrganization() http.HandlerFunc {
 		org.UpdatedBy = claims.UID
 
 		if err := s.store.UpdateOrganization(r.Context(), org); err != nil {
+			if isVersionConflict(err) {
+				respondPreconditionFailed(w)
+				return
+			}
 			s.logger.Error("failed to update organization", "error", err)
 			respondError(w, http.StatusInternalServerError, "failed to update organization")
 			return
@@ -301,23 +319,25 @@ func (s *Server) handleUpdateOrganization() http.HandlerFunc {
 			IPAddress:      r.RemoteAddr,
 			UserAgent:      r.UserAgent(),
 		}
-		s.store.CreateAuditLog(r.Context(), auditLog)
+		s.recordAudit(r.Context(), auditLog)
 
+		setETag(w, org.Version)
 		respondJSON(w, http.StatusOK, org)
 	}
 }
 
+// dashboardMetrics summarizes an organization's compliance status
+type dashboardMetrics struct {
+	TotalRequirements     int `json:"total_requirements"`
+	CompliantRequirements int `json:"compliant_requirements"`
+	AtRiskRequirements    int `json:"at_risk_requirements"`
+	NonCompliantRequirements int `json:"non_compliant_requirements"`
+	TotalEvidence         int `json:"total_evidence"`
+	UpcomingDeadlines     []models.Requirement `json:"upcoming_deadlines"`
+}
+
 // handleGetDashboard implements STORY-008: Compliance Dashboard Overview
 func (s *Server) handleGetDashboard() http.HandlerFunc {
-	type dashboardMetrics struct {
-		TotalRequirements     int `json:"total_requirements"`
-		CompliantRequirements int `json:"compliant_requirements"`
-		AtRiskRequirements    int `json:"at_risk_requirements"`
-		NonCompliantRequirements int `json:"non_compliant_requirements"`
-		TotalEvidence         int `json:"total_evidence"`
-		UpcomingDeadlines     []models.Requirement `json:"upcoming_deadlines"`
-	}
-
 	return func(w http.ResponseWriter, r *http.Request) {
 		claims, err := auth.GetUserClaims(r)
 		if err != nil {
@@ -325,57 +345,67 @@ func (s *Server) handleGetDashboard() http.HandlerFunc {
 			return
 		}
 
-		// Get all requirements
-		requirements, err := s.store.ListRequirements(r.Context(), claims.OrganizationID)
+		metrics, err := s.computeDashboard(r.Context(), claims.OrganizationID)
 		if err != nil {
 			s.logger.Error("failed to list requirements", "error", err)
 			respondError(w, http.StatusInternalServerError, "failed to get dashboard data")
 			return
 		}
 
-		// Calculate metrics
-		metrics := dashboardMetrics{
-			TotalRequirements: len(requirements),
-		}
+		respondJSON(w, http.StatusOK, metrics)
+	}
+}
 
-		var upcomingDeadlines []models.Requirement
-		now := time.Now()
-		thirtyDaysFromNow := now.AddDate(0, 0, 30)
-
-		for _, req := range requirements {
-			// Update status based on evidence and due dates
-			req.Status = req.CalculateStatus()
-
-			switch req.Status {
-			case models.StatusCompliant:
-				metrics.CompliantRequirements++
-			case models.StatusAtRisk:
-				metrics.AtRiskRequirements++
-			case models.StatusNonCompliant:
-				metrics.NonCompliantRequirements++
-			}
+// computeDashboard calculates the dashboard metrics of an organization
+func (s *Server) computeDashboard(ctx context.Context, orgID string) (*dashboardMetrics, error) {
+	// Get all requirements
+	requirements, _, err := s.store.ListRequirements(ctx, orgID, store.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
 
-			// Check for upcoming deadlines
-			if req.NextDueDate != nil && req.NextDueDate.After(now) && req.NextDueDate.Before(thirtyDaysFromNow) {
-				upcomingDeadlines = append(upcomingDeadlines, *req)
-			}
-		}
+	// Calculate metrics
+	metrics := &dashboardMetrics{
+		TotalRequirements: len(requirements),
+	}
+
+	var upcomingDeadlines []models.Requirement
+	now := time.Now()
+	thirtyDaysFromNow := now.AddDate(0, 0, 30)
 
-		metrics.UpcomingDeadlines = upcomingDeadlines
+	for _, req := range requirements {
+		// Update status based on evidence and due dates
+		req.Status = req.CalculateStatus()
 
-		// Get total evidence count
-		evidence, err := s.store.ListEvidence(r.Context(), claims.OrganizationID, nil)
-		if err == nil {
-			metrics.TotalEvidence = len(evidence)
+		switch req.Status {
+		case models.StatusCompliant:
+			metrics.CompliantRequirements++
+		case models.StatusAtRisk:
+			metrics.AtRiskRequirements++
+		case models.StatusNonCompliant:
+			metrics.NonCompliantRequirements++
 		}
 
-		respondJSON(w, http.StatusOK, metrics)
+		// Check for upcoming deadlines
+		if req.NextDueDate != nil && req.NextDueDate.After(now) && req.NextDueDate.Before(thirtyDaysFromNow) {
+			upcomingDeadlines = append(upcomingDeadlines, *req)
+		}
+	}
+
+	metrics.UpcomingDeadlines = upcomingDeadlines
+
+	// Get total evidence count
+	evidence, _, err := s.store.ListEvidence(ctx, orgID, nil, store.ListOptions{})
+	if err == nil {
+		metrics.TotalEvidence = len(evidence)
 	}
+
+	return metrics, nil
 }
 
 // User management handlers
 
-// handleListUsers lists all users in the organization
+// handleListUsers lists users in the organization, one page at a time
 func (s *Server) handleListUsers() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		claims, err := auth.GetUserClaims(r)
@@ -384,23 +414,31 @@ func (s *Server) handleListUsers() http.HandlerFunc {
 			return
 		}
 
-		users, err := s.store.ListUsersByOrganization(r.Context(), claims.OrganizationID)
+		opts, err := parseListOptions(r)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		users, nextPageToken, err := s.store.ListUsersByOrganization(r.Context(), claims.OrganizationID, opts)
+		if isListOptionsError(err) {
+			respondError(w, http.StatusBadRequest, err.Error())
+			return
+		}
 		if err != nil {
 			s.logger.Error("failed to list users", "error", err)
 			respondError(w, http.StatusInternalServerError, "failed to list users")
 			return
 		}
 
-		respondJSON(w, http.StatusOK, users)
+		respondJSON(w, http.StatusOK, listResponse{Items: users, NextPageToken: nextPageToken})
 	}
 }
 
-// handleInviteUser implements STORY-032: Invite Users to Organization
-func (s *Server) handleInviteUser() http.HandlerFunc {
+// handleUpdateUserRole implements STORY-036: Manage Existing Users
+func (s *Server) handleUpdateUserRole() http.HandlerFunc {
 	type request struct {
-		Email   string           `json:"email"`
-		Role    models.UserRole  `json:"role"`
-		Message string           `json:"message"`
+		Role models.UserRole `json:"role"`
 	}
 
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -410,43 +448,46 @@ func (s *Server) handleInviteUser() http.HandlerFunc {
 			return
 		}
 
+		userID := chi.URLParam(r, "userID")
 		var req request
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 			respondError(w, http.StatusBadRequest, "invalid request body")
 			return
 		}
 
-		// Get organization to check user limits
-		org, err := s.store.GetOrganization(r.Context(), claims.OrganizationID)
-		if err != nil {
-			respondError(w, http.StatusInternalServerError, "failed to get organization")
+		// Custom roles are assigned as custom:<role-id>
+		if !s.isAssignableRole(r.Context(), claims.OrganizationID, req.Role) {
+			respondError(w, http.StatusBadRequest, invalidRoleMessage)
 			return
 		}
 
-		// Check user limit
-		users, err := s.store.ListUsersByOrganization(r.Context(), claims.OrganizationID)
+		user, err := s.store.GetUser(r.Context(), userID)
 		if err != nil {
-			respondError(w, http.StatusInternalServerError, "failed to check user limit")
+			respondError(w, http.StatusNotFound, "user not found")
+			return
+		}
+
+		// Verify user belongs to same organization
+		if user.OrganizationID != claims.OrganizationID {
+			respondError(w, http.StatusForbidden, "user not in your organization")
 			return
 		}
 
-		if len(users) >= org.Subscription.MaxUsers {
-			respondError(w, http.StatusForbidden, fmt.Sprintf("user limit reached. Please upgrade to add more users (current limit: %d)", org.Subscription.MaxUsers))
+		if err := s.changeUserRole(r, claims, user, req.Role); err != nil {
+			s.logger.Error("failed to update user role", "error", err)
+			respondError(w, http.StatusInternalServerError, "failed to update user role")
 			return
 		}
 
-		// In production, would create invitation and send email
-		// For now, return success
-		respondJSON(w, http.StatusOK, map[string]string{
-			"message": fmt.Sprintf("Invitation sent to %s", req.Email),
-		})
+		respondJSON(w, http.StatusOK, user)
 	}
 }
 
-// handleUpdateUserRole implements STORY-036: Manage Existing Users
-func (s *Server) handleUpdateUserRole() http.HandlerFunc {
+// handleUpdateUserStatus suspends or reactivates a user. Suspension takes
+// effect at once: the user's tokens and sessions are revoked.
+func (s *Server) handleUpdateUserStatus() http.HandlerFunc {
 	type request struct {
-		Role models.UserRole `json:"role"`
+		Status string `json:"status"`
 	}
 
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -462,9 +503,19 @@ func (s *Server) handleUpdateUserRole() http.HandlerFunc {
 			respondError(w, http.StatusBadRequest, "invalid request body")
 			return
 		}
+		if req.Status != "active" && req.Status != "inactive" {
+			respondError(w, http.StatusBadRequest, "status must be active or inactive")
+			return
+		}
+
+		// Prevent self-suspension
+		if userID == claims.UID && req.Status == "inactive" {
+			respondError(w, http.StatusBadRequest, "cannot deactivate your own account")
+			return
+		}
 
 		user, err := s.store.GetUser(r.Context(), userID)
-		if err != nil {
+		if err != nil || user.Status == "deleted" {
 			respondError(w, http.StatusNotFound, "user not found")
 			return
 		}
@@ -475,19 +526,16 @@ func (s *Server) handleUpdateUserRole() http.HandlerFunc {
 			return
 		}
 
-		user.Role = req.Role
-		if err := s.store.UpdateUser(r.Context(), user); err != nil {
-			s.logger.Error("failed to update user role", "error", err)
-			respondError(w, http.StatusInternalServerError, "failed to update user role")
+		if err := s.setUserActive(r, claims, user, req.Status == "active"); err != nil {
+			if errors.Is(err, store.ErrSeatLimitReached) {
+				respondError(w, http.StatusForbidden, "user limit reached. Upgrade your plan to reactivate this user")
+				return
+			}
+			s.logger.Error("failed to update user status", "error", err)
+			respondError(w, http.StatusInternalServerError, "failed to update user status")
 			return
 		}
 
-		// Update custom claims in Firebase
-		s.authMiddleware.SetCustomClaims(r.Context(), userID, map[string]interface{}{
-			"organizationId": user.OrganizationID,
-			"role":          string(user.Role),
-		})
-
 		respondJSON(w, http.StatusOK, user)
 	}
 }
@@ -510,7 +558,7 @@ func (s *Server) handleDeleteUser() http.HandlerFunc {
 		}
 
 		user, err := s.store.GetUser(r.Context(), userID)
-		if err != nil {
+		if err != nil || user.Status == "deleted" {
 			respondError(w, http.StatusNotFound, "user not found")
 			return
 		}
@@ -521,21 +569,175 @@ func (s *Server) handleDeleteUser() http.HandlerFunc {
 			return
 		}
 
-		// Delete from Firebase Auth
-		if err := s.authMiddleware.DeleteUser(r.Context(), userID); err != nil {
-			s.logger.Error("failed to delete firebase user", "error", err)
+		if err := s.deleteUser(r, claims, user); err != nil {
+			s.logger.Error("failed to delete user", "error", err)
 			respondError(w, http.StatusInternalServerError, "failed to delete user")
 			return
 		}
 
-		// Update user status in Firestore (soft delete)
-		user.Status = "inactive"
-		s.store.UpdateUser(r.Context(), user)
-
 		respondJSON(w, http.StatusOK, map[string]string{"message": "user deleted successfully"})
 	}
 }
 
+// changeUserRole assigns role to user, records the change in the audit log
+// and updates the user's custom claims in Firebase. A change revokes the
+// user's ID tokens and sessions, so the old role cannot be used; clients
+// get the new role by refreshing their ID token. Requests are authorized
+// by the stored role, so claims that fail to update grant nothing extra.
+func (s *Server) changeUserRole(r *http.Request, claims *auth.UserClaims, user *models.User, role models.UserRole) error {
+	oldRole := user.Role
+	user.Role = role
+	if role != oldRole {
+		now := time.Now()
+		user.TokensRevokedAt = &now
+	}
+	if err := s.store.UpdateUser(r.Context(), user); err != nil {
+		return err
+	}
+
+	// Create audit log
+	auditLog := &models.AuditLog{
+		OrganizationID: user.OrganizationID,
+		UserID:         claims.UID,
+		UserEmail:      claims.Email,
+		Action:         models.ActionUserUpdated,
+		ResourceType:   "user",
+		ResourceID:     user.UID,
+		Description:    fmt.Sprintf("Changed role of %s to %s", user.Email, user.Role),
+		Changes: map[string]interface{}{
+			"role": map[string]interface{}{
+				"from": oldRole,
+				"to":   user.Role,
+			},
+		},
+		IPAddress: r.RemoteAddr,
+		UserAgent: r.UserAgent(),
+	}
+	s.recordAudit(r.Context(), auditLog)
+
+	// Update custom claims in Firebase. Deactivated and deleted users have
+	// none, and get them back only when they are activated again.
+	if user.Status != "inactive" && user.Status != "deleted" {
+		if err := s.authMiddleware.SetCustomClaims(r.Context(), user.UID, map[string]interface{}{
+			"organizationId": user.OrganizationID,
+			"role":          string(user.Role),
+		}); err != nil && !errors.Is(err, auth.ErrUnsupported) {
+			return fmt.Errorf("failed to update custom claims: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// setUserActive activates or deactivates user and records the change in the
+// audit log. A deactivated user keeps their account but their ID tokens,
+// refresh tokens and sessions are revoked, and they lose their custom claims
+// in Firebase. Activating a user takes a seat and fails with
+// store.ErrSeatLimitReached when none is free.
+func (s *Server) setUserActive(r *http.Request, claims *auth.UserClaims, user *models.User, active bool) error {
+	oldStatus := user.Status
+	status := "inactive"
+	if active {
+		status = "active"
+	}
+	if oldStatus == status {
+		return nil
+	}
+
+	if !active {
+		now := time.Now()
+		user.TokensRevokedAt = &now
+	}
+	if err := s.store.SetUserStatus(r.Context(), user, status); err != nil {
+		return err
+	}
+	if !active {
+		if err := s.authMiddleware.RevokeTokens(r.Context(), user.UID); err != nil && !errors.Is(err, auth.ErrUnsupported) {
+			s.logger.Error("failed to revoke refresh tokens", "uid", user.UID, "error", err)
+		}
+	}
+
+	customClaims := map[string]interface{}{}
+	if active {
+		customClaims = map[string]interface{}{
+			"organizationId": user.OrganizationID,
+			"role":          string(user.Role),
+		}
+	}
+	if err := s.authMiddleware.SetCustomClaims(r.Context(), user.UID, customClaims); err != nil && !errors.Is(err, auth.ErrUnsupported) {
+		s.logger.Error("failed to update custom claims", "uid", user.UID, "error", err)
+	}
+
+	description := fmt.Sprintf("Deactivated %s", user.Email)
+	if active {
+		description = fmt.Sprintf("Activated %s", user.Email)
+	}
+
+	// Create audit log
+	auditLog := &models.AuditLog{
+		OrganizationID: user.OrganizationID,
+		UserID:         claims.UID,
+		UserEmail:      claims.Email,
+		Action:         models.ActionUserUpdated,
+		ResourceType:   "user",
+		ResourceID:     user.UID,
+		Description:    description,
+		Changes: map[string]interface{}{
+			"status": map[string]interface{}{
+				"from": oldStatus,
+				"to":   status,
+			},
+		},
+		IPAddress: r.RemoteAddr,
+		UserAgent: r.UserAgent(),
+	}
+	s.recordAudit(r.Context(), auditLog)
+
+	return nil
+}
+
+// deleteUser deletes user's Firebase account, marks the user deleted, which
+// frees their seat and revokes their sessions, and records the deletion in
+// the audit log
+func (s *Server) deleteUser(r *http.Request, claims *auth.UserClaims, user *models.User) error {
+	// Delete from Firebase Auth. External identity providers manage
+	// their own accounts, so only the soft delete below applies there.
+	if err := s.authMiddleware.DeleteUser(r.Context(), user.UID); err != nil && !errors.Is(err, auth.ErrUnsupported) {
+		return fmt.Errorf("failed to delete firebase user: %w", err)
+	}
+
+	// Soft delete, keeping the record for the audit trail
+	oldStatus := user.Status
+	now := time.Now()
+	user.TokensRevokedAt = &now
+	if err := s.store.SetUserStatus(r.Context(), user, "deleted"); err != nil {
+		return err
+	}
+	s.removeMemberships(r, claims, user)
+
+	// Create audit log
+	auditLog := &models.AuditLog{
+		OrganizationID: user.OrganizationID,
+		UserID:         claims.UID,
+		UserEmail:      claims.Email,
+		Action:         models.ActionUserDeleted,
+		ResourceType:   "user",
+		ResourceID:     user.UID,
+		Description:    fmt.Sprintf("Deleted %s", user.Email),
+		Changes: map[string]interface{}{
+			"status": map[string]interface{}{
+				"from": oldStatus,
+				"to":   user.Status,
+			},
+		},
+		IPAddress: r.RemoteAddr,
+		UserAgent: r.UserAgent(),
+	}
+	s.recordAudit(r.Context(), auditLog)
+
+	return nil
+}
+
 // Helper functions
 
 func isValidPassword(password string) bool {
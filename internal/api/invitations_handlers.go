@@ -0,0 +1,405 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"compliancesync-api/internal/auth"
+	"compliancesync-api/internal/models"
+	"compliancesync-api/internal/store"
+	"github.com/go-chi/chi/v5"
+)
+
+// invitationTTL is how long an invitation token stays valid after it is sent
+const invitationTTL = 7 * 24 * time.Hour
+
+// Invitation handlers
+
+// handleInviteUser implements STORY-032: Invite Users to Organization
+func (s *Server) handleInviteUser() http.HandlerFunc {
+	type request struct {
+		Email   string          `json:"email"`
+		Role    models.UserRole `json:"role"`
+		Message string          `json:"message"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, err := auth.GetUserClaims(r)
+		if err != nil {
+			respondError(w, http.StatusUnauthorized, "authentication required")
+			return
+		}
+
+		var req request
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondError(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+
+		req.Email = strings.TrimSpace(req.Email)
+		if !strings.Contains(req.Email, "@") {
+			respondError(w, http.StatusBadRequest, "a valid email is required")
+			return
+		}
+		if !s.isAssignableRole(r.Context(), claims.OrganizationID, req.Role) {
+			respondError(w, http.StatusBadRequest, invalidRoleMessage)
+			return
+		}
+
+		// Check if email already exists. Active users of other
+		// organizations accept the invitation as members.
+		existingUser, _ := s.store.GetUserByEmail(r.Context(), req.Email)
+		if existingUser != nil {
+			if existingUser.Status != "active" {
+				respondError(w, http.StatusConflict, "email already registered")
+				return
+			}
+			if s.belongsToOrganization(r.Context(), existingUser, claims.OrganizationID) {
+				respondError(w, http.StatusConflict, "user already belongs to this organization")
+				return
+			}
+		}
+
+		token, err := auth.GenerateInvitationToken()
+		if err != nil {
+			s.logger.Error("failed to generate invitation token", "error", err)
+			respondError(w, http.StatusInternalServerError, "failed to create invitation")
+			return
+		}
+
+		invitation := &models.Invitation{
+			Email:          req.Email,
+			OrganizationID: claims.OrganizationID,
+			Role:           req.Role,
+			InvitedBy:      claims.UID,
+			Message:        req.Message,
+			Token:          auth.HashInvitationToken(token),
+			ExpiresAt:      time.Now().Add(invitationTTL),
+		}
+
+		// The store checks the user limit, counting pending invitations, in
+		// the same transaction that saves the invitation
+		if err := s.store.CreateInvitation(r.Context(), invitation); err != nil {
+			s.respondInvitationError(w, err, "failed to create invitation")
+			return
+		}
+
+		s.sendInvitationEmail(invitation, token)
+
+		// Create audit log
+		auditLog := &models.AuditLog{
+			OrganizationID: claims.OrganizationID,
+			UserID:         claims.UID,
+			UserEmail:      claims.Email,
+			Action:         models.ActionInvitationCreated,
+			ResourceType:   "invitation",
+			ResourceID:     invitation.ID,
+			Description:    fmt.Sprintf("Invited %s as %s", invitation.Email, invitation.Role),
+			IPAddress:      r.RemoteAddr,
+			UserAgent:      r.UserAgent(),
+		}
+		s.recordAudit(r.Context(), auditLog)
+
+		respondJSON(w, http.StatusCreated, invitation)
+	}
+}
+
+// handleListInvitations lists the organization's invitations. Pending
+// invitations past their expiry are reported as expired.
+func (s *Server) handleListInvitations() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, err := auth.GetUserClaims(r)
+		if err != nil {
+			respondError(w, http.StatusUnauthorized, "authentication required")
+			return
+		}
+
+		opts, err := parseListOptions(r)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		invitations, nextPageToken, err := s.store.ListInvitations(r.Context(), claims.OrganizationID, opts)
+		if isListOptionsError(err) {
+			respondError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if err != nil {
+			s.logger.Error("failed to list invitations", "error", err)
+			respondError(w, http.StatusInternalServerError, "failed to list invitations")
+			return
+		}
+
+		now := time.Now()
+		for _, invitation := range invitations {
+			if invitation.IsExpired(now) {
+				invitation.Status = "expired"
+			}
+		}
+
+		respondJSON(w, http.StatusOK, listResponse{Items: invitations, NextPageToken: nextPageToken})
+	}
+}
+
+// handleResendInvitation issues a fresh token and expiry for a pending or
+// expired invitation. The previous token stops working.
+func (s *Server) handleResendInvitation() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, err := auth.GetUserClaims(r)
+		if err != nil {
+			respondError(w, http.StatusUnauthorized, "authentication required")
+			return
+		}
+
+		invitation, err := s.store.GetInvitation(r.Context(), claims.OrganizationID, chi.URLParam(r, "invitationID"))
+		if err != nil {
+			respondError(w, http.StatusNotFound, "invitation not found")
+			return
+		}
+
+		token, err := auth.GenerateInvitationToken()
+		if err != nil {
+			s.logger.Error("failed to generate invitation token", "error", err)
+			respondError(w, http.StatusInternalServerError, "failed to resend invitation")
+			return
+		}
+		invitation.Token = auth.HashInvitationToken(token)
+		invitation.ExpiresAt = time.Now().Add(invitationTTL)
+
+		if err := s.store.RenewInvitation(r.Context(), invitation); err != nil {
+			s.respondInvitationError(w, err, "failed to resend invitation")
+			return
+		}
+
+		s.sendInvitationEmail(invitation, token)
+
+		// Create audit log
+		auditLog := &models.AuditLog{
+			OrganizationID: claims.OrganizationID,
+			UserID:         claims.UID,
+			UserEmail:      claims.Email,
+			Action:         models.ActionInvitationResent,
+			ResourceType:   "invitation",
+			ResourceID:     invitation.ID,
+			Description:    fmt.Sprintf("Resent invitation to %s", invitation.Email),
+			IPAddress:      r.RemoteAddr,
+			UserAgent:      r.UserAgent(),
+		}
+		s.recordAudit(r.Context(), auditLog)
+
+		respondJSON(w, http.StatusOK, invitation)
+	}
+}
+
+// handleRevokeInvitation revokes a pending invitation, freeing its seat
+func (s *Server) handleRevokeInvitation() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, err := auth.GetUserClaims(r)
+		if err != nil {
+			respondError(w, http.StatusUnauthorized, "authentication required")
+			return
+		}
+
+		invitation, err := s.store.GetInvitation(r.Context(), claims.OrganizationID, chi.URLParam(r, "invitationID"))
+		if err != nil {
+			respondError(w, http.StatusNotFound, "invitation not found")
+			return
+		}
+
+		invitation.Status = "revoked"
+		if err := s.store.UpdateInvitation(r.Context(), invitation); err != nil {
+			s.respondInvitationError(w, err, "failed to revoke invitation")
+			return
+		}
+
+		// Create audit log
+		auditLog := &models.AuditLog{
+			OrganizationID: claims.OrganizationID,
+			UserID:         claims.UID,
+			UserEmail:      claims.Email,
+			Action:         models.ActionInvitationRevoked,
+			ResourceType:   "invitation",
+			ResourceID:     invitation.ID,
+			Description:    fmt.Sprintf("Revoked invitation to %s", invitation.Email),
+			IPAddress:      r.RemoteAddr,
+			UserAgent:      r.UserAgent(),
+		}
+		s.recordAudit(r.Context(), auditLog)
+
+		respondJSON(w, http.StatusOK, invitation)
+	}
+}
+
+// handleAcceptInvitation lets an invitee create their account with the
+// emailed token. The identity provider account, the user record, the
+// invitation status and the organization's active user count are all
+// updated, and the invited role is set as a custom claim.
+func (s *Server) handleAcceptInvitation() http.HandlerFunc {
+	type request struct {
+		Token    string `json:"token"`
+		FullName string `json:"full_name"`
+		Password string `json:"password"`
+	}
+
+	type response struct {
+		Message        string `json:"message"`
+		UserID         string `json:"user_id"`
+		OrganizationID string `json:"organization_id"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req request
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondError(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+
+		// Validate password requirements (8+ chars, 1 uppercase, 1 number, 1 special)
+		if !isValidPassword(req.Password) {
+			respondError(w, http.StatusBadRequest, "password must be at least 8 characters with 1 uppercase, 1 number, and 1 special character")
+			return
+		}
+
+		invitation, err := s.store.GetInvitationByToken(r.Context(), auth.HashInvitationToken(req.Token))
+		if err != nil {
+			respondError(w, http.StatusNotFound, "invitation not found")
+			return
+		}
+		if invitation.Status != "pending" {
+			respondError(w, http.StatusGone, "invitation is no longer valid")
+			return
+		}
+		if invitation.IsExpired(time.Now()) {
+			s.expireInvitation(r, invitation)
+			respondError(w, http.StatusGone, "invitation has expired; ask an administrator to resend it")
+			return
+		}
+
+		// Check if email already exists. Existing users join as members
+		// through POST /profile/organizations instead.
+		existingUser, _ := s.store.GetUserByEmail(r.Context(), invitation.Email)
+		if existingUser != nil {
+			respondError(w, http.StatusConflict, "email already registered; sign in and accept the invitation with POST /api/v1/profile/organizations")
+			return
+		}
+
+		// Create user in Firebase Auth
+		uid, err := s.authMiddleware.CreateUser(r.Context(), invitation.Email, req.Password, req.FullName)
+		if errors.Is(err, auth.ErrUnsupported) {
+			respondError(w, http.StatusNotImplemented, "accounts are created by your identity provider")
+			return
+		}
+		if err != nil {
+			s.logger.Error("failed to create firebase user", "error", err)
+			respondError(w, http.StatusInternalServerError, "failed to create user account")
+			return
+		}
+
+		user := &models.User{
+			UID:            uid,
+			Email:          invitation.Email,
+			FullName:       req.FullName,
+			OrganizationID: invitation.OrganizationID,
+			Role:           invitation.Role,
+		}
+
+		if err := s.store.AcceptInvitation(r.Context(), invitation, user); err != nil {
+			// Remove the new account so the invitee is not left half registered
+			if delErr := s.authMiddleware.DeleteUser(r.Context(), uid); delErr != nil {
+				s.logger.Error("failed to roll back firebase user", "user_id", uid, "error", delErr)
+			}
+			if errors.Is(err, store.ErrInvitationNotPending) {
+				respondError(w, http.StatusGone, "invitation is no longer valid")
+				return
+			}
+			s.logger.Error("failed to accept invitation", "error", err)
+			respondError(w, http.StatusInternalServerError, "failed to accept invitation")
+			return
+		}
+
+		// Set custom claims in Firebase
+		if err := s.authMiddleware.SetCustomClaims(r.Context(), uid, map[string]interface{}{
+			"organizationId": invitation.OrganizationID,
+			"role":           string(invitation.Role),
+		}); err != nil {
+			s.logger.Error("failed to set custom claims", "error", err)
+		}
+
+		// Create audit logs
+		s.recordAudit(r.Context(), &models.AuditLog{
+			OrganizationID: invitation.OrganizationID,
+			UserID:         uid,
+			UserEmail:      invitation.Email,
+			Action:         models.ActionInvitationAccepted,
+			ResourceType:   "invitation",
+			ResourceID:     invitation.ID,
+			Description:    fmt.Sprintf("%s accepted the invitation to join as %s", invitation.Email, invitation.Role),
+			IPAddress:      r.RemoteAddr,
+			UserAgent:      r.UserAgent(),
+		})
+		s.recordAudit(r.Context(), &models.AuditLog{
+			OrganizationID: invitation.OrganizationID,
+			UserID:         uid,
+			UserEmail:      invitation.Email,
+			Action:         models.ActionUserCreated,
+			ResourceType:   "user",
+			ResourceID:     uid,
+			Description:    fmt.Sprintf("User %s created from invitation %s", invitation.Email, invitation.ID),
+			IPAddress:      r.RemoteAddr,
+			UserAgent:      r.UserAgent(),
+		})
+
+		respondJSON(w, http.StatusCreated, response{
+			Message:        "Invitation accepted. You can now sign in.",
+			UserID:         uid,
+			OrganizationID: invitation.OrganizationID,
+		})
+	}
+}
+
+// expireInvitation records that a pending invitation was found past its expiry
+func (s *Server) expireInvitation(r *http.Request, invitation *models.Invitation) {
+	invitation.Status = "expired"
+	if err := s.store.UpdateInvitation(r.Context(), invitation); err != nil {
+		s.logger.Error("failed to expire invitation", "invitation_id", invitation.ID, "error", err)
+		return
+	}
+
+	auditLog := &models.AuditLog{
+		OrganizationID: invitation.OrganizationID,
+		UserEmail:      invitation.Email,
+		Action:         models.ActionInvitationExpired,
+		ResourceType:   "invitation",
+		ResourceID:     invitation.ID,
+		Description:    fmt.Sprintf("Expired invitation to %s was used", invitation.Email),
+		IPAddress:      r.RemoteAddr,
+		UserAgent:      r.UserAgent(),
+	}
+	s.recordAudit(r.Context(), auditLog)
+}
+
+// respondInvitationError maps invitation store errors to responses
+func (s *Server) respondInvitationError(w http.ResponseWriter, err error, message string) {
+	switch {
+	case errors.Is(err, store.ErrSeatLimitReached):
+		respondError(w, http.StatusForbidden, "user limit reached. Please upgrade or revoke a pending invitation to add more users")
+	case errors.Is(err, store.ErrInvitationExists):
+		respondError(w, http.StatusConflict, "a pending invitation already exists for this email")
+	case errors.Is(err, store.ErrInvitationNotPending):
+		respondError(w, http.StatusConflict, "invitation is no longer pending")
+	default:
+		s.logger.Error(message, "error", err)
+		respondError(w, http.StatusInternalServerError, message)
+	}
+}
+
+// sendInvitationEmail delivers the invitation token to the invitee
+func (s *Server) sendInvitationEmail(invitation *models.Invitation, token string) {
+	// In production, this would send an email via SendGrid
+	s.logger.Info("invitation email queued", "invitation_id", invitation.ID)
+}
@@ -0,0 +1,400 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"compliancesync-api/internal/auth"
+	"compliancesync-api/internal/models"
+	"compliancesync-api/internal/store"
+	"github.com/go-chi/chi/v5"
+)
+
+// organizationResponse is one of the organizations a user belongs to
+type organizationResponse struct {
+	OrganizationID string          `json:"organization_id"`
+	Name           string          `json:"name"`
+	Role           models.UserRole `json:"role"`
+	Own            bool            `json:"own"`       // The organization the user's account belongs to
+	Delegated      bool            `json:"delegated"` // A client of the user's partner organization
+	Current        bool            `json:"current"`   // The organization the request acts in
+}
+
+// Organization membership handlers
+
+// handleListProfileOrganizations lists the organizations the caller belongs
+// to: their own first, then those they are a member of in the order they
+// joined, then by name the clients of their own organization if it is a
+// partner. Any of them can be selected with the X-Organization-ID header.
+func (s *Server) handleListProfileOrganizations() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, err := auth.GetUserClaims(r)
+		if err != nil {
+			respondError(w, http.StatusUnauthorized, "authentication required")
+			return
+		}
+
+		user, err := s.store.GetUser(r.Context(), claims.UID)
+		if err != nil {
+			respondError(w, http.StatusNotFound, "user not found")
+			return
+		}
+
+		memberships, err := s.store.ListUserMemberships(r.Context(), user.UID)
+		if err != nil {
+			s.logger.Error("failed to list memberships", "error", err)
+			respondError(w, http.StatusInternalServerError, "failed to list organizations")
+			return
+		}
+
+		var items []organizationResponse
+		add := func(orgID string, role models.UserRole, own bool) {
+			org, err := s.store.GetOrganization(r.Context(), orgID)
+			if err != nil {
+				s.logger.Error("failed to get organization", "organization_id", orgID, "error", err)
+				return
+			}
+			items = append(items, organizationResponse{
+				OrganizationID: org.ID,
+				Name:           org.Name,
+				Role:           role,
+				Own:            own,
+				Current:        org.ID == claims.OrganizationID,
+			})
+		}
+
+		if user.OrganizationID != "" {
+			add(user.OrganizationID, user.Role, true)
+		}
+		for _, membership := range memberships {
+			add(membership.OrganizationID, membership.Role, false)
+		}
+
+		clients, err := s.partnerClients(r.Context(), user.OrganizationID)
+		if err != nil {
+			s.logger.Error("failed to list client organizations", "error", err)
+			respondError(w, http.StatusInternalServerError, "failed to list organizations")
+			return
+		}
+		for _, client := range clients {
+			items = append(items, organizationResponse{
+				OrganizationID: client.ID,
+				Name:           client.Name,
+				Role:           models.DelegatedRole(user.Role),
+				Delegated:      true,
+				Current:        client.ID == claims.OrganizationID,
+			})
+		}
+
+		respondJSON(w, http.StatusOK, listResponse{Items: items})
+	}
+}
+
+// handleJoinOrganization accepts an invitation for the caller's existing
+// account, making them a member of the inviting organization with the
+// invited role. The invitation must have been sent to the caller's email.
+func (s *Server) handleJoinOrganization() http.HandlerFunc {
+	type request struct {
+		Token string `json:"token"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, err := auth.GetUserClaims(r)
+		if err != nil {
+			respondError(w, http.StatusUnauthorized, "authentication required")
+			return
+		}
+
+		var req request
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondError(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+
+		user, err := s.store.GetUser(r.Context(), claims.UID)
+		if err != nil || user.Status != "active" {
+			respondError(w, http.StatusForbidden, "an active account is required to join an organization")
+			return
+		}
+
+		invitation, err := s.store.GetInvitationByToken(r.Context(), auth.HashInvitationToken(req.Token))
+		if err != nil {
+			respondError(w, http.StatusNotFound, "invitation not found")
+			return
+		}
+		if invitation.Status != "pending" {
+			respondError(w, http.StatusGone, "invitation is no longer valid")
+			return
+		}
+		if invitation.IsExpired(time.Now()) {
+			s.expireInvitation(r, invitation)
+			respondError(w, http.StatusGone, "invitation has expired; ask an administrator to resend it")
+			return
+		}
+		if !strings.EqualFold(invitation.Email, user.Email) {
+			respondError(w, http.StatusForbidden, "this invitation was sent to another email address")
+			return
+		}
+		if invitation.OrganizationID == user.OrganizationID {
+			respondError(w, http.StatusConflict, "you already belong to this organization")
+			return
+		}
+
+		membership := &models.Membership{UserID: user.UID, Email: user.Email}
+		if err := s.store.JoinOrganization(r.Context(), invitation, membership); err != nil {
+			switch {
+			case errors.Is(err, store.ErrInvitationNotPending):
+				respondError(w, http.StatusGone, "invitation is no longer valid")
+			case errors.Is(err, store.ErrAlreadyMember):
+				respondError(w, http.StatusConflict, "you already belong to this organization")
+			default:
+				s.logger.Error("failed to join organization", "error", err)
+				respondError(w, http.StatusInternalServerError, "failed to join organization")
+			}
+			return
+		}
+
+		// Create audit logs
+		s.recordAudit(r.Context(), &models.AuditLog{
+			OrganizationID: membership.OrganizationID,
+			UserID:         user.UID,
+			UserEmail:      user.Email,
+			Action:         models.ActionInvitationAccepted,
+			ResourceType:   "invitation",
+			ResourceID:     invitation.ID,
+			Description:    fmt.Sprintf("%s accepted the invitation to join as %s", user.Email, membership.Role),
+			IPAddress:      r.RemoteAddr,
+			UserAgent:      r.UserAgent(),
+		})
+		s.recordAudit(r.Context(), &models.AuditLog{
+			OrganizationID: membership.OrganizationID,
+			UserID:         user.UID,
+			UserEmail:      user.Email,
+			Action:         models.ActionMemberAdded,
+			ResourceType:   "membership",
+			ResourceID:     user.UID,
+			Description:    fmt.Sprintf("%s joined from organization %s as %s", user.Email, user.OrganizationID, membership.Role),
+			IPAddress:      r.RemoteAddr,
+			UserAgent:      r.UserAgent(),
+		})
+
+		respondJSON(w, http.StatusCreated, membership)
+	}
+}
+
+// handleLeaveOrganization ends the caller's membership in an organization.
+// Their own organization has no membership and cannot be left.
+func (s *Server) handleLeaveOrganization() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, err := auth.GetUserClaims(r)
+		if err != nil {
+			respondError(w, http.StatusUnauthorized, "authentication required")
+			return
+		}
+
+		orgID := chi.URLParam(r, "orgID")
+		membership, err := s.store.GetMembership(r.Context(), orgID, claims.UID)
+		if err != nil {
+			respondError(w, http.StatusNotFound, "membership not found")
+			return
+		}
+
+		if err := s.store.DeleteMembership(r.Context(), orgID, claims.UID); err != nil {
+			s.logger.Error("failed to delete membership", "error", err)
+			respondError(w, http.StatusInternalServerError, "failed to leave organization")
+			return
+		}
+
+		// Create audit log
+		s.recordAudit(r.Context(), &models.AuditLog{
+			OrganizationID: orgID,
+			UserID:         claims.UID,
+			UserEmail:      claims.Email,
+			Action:         models.ActionMemberRemoved,
+			ResourceType:   "membership",
+			ResourceID:     claims.UID,
+			Description:    fmt.Sprintf("%s left the organization", membership.Email),
+			IPAddress:      r.RemoteAddr,
+			UserAgent:      r.UserAgent(),
+		})
+
+		respondJSON(w, http.StatusOK, map[string]string{
+			"message": "Left organization",
+		})
+	}
+}
+
+// handleListMemberships lists the members of the organization whose
+// accounts belong to other organizations
+func (s *Server) handleListMemberships() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, err := auth.GetUserClaims(r)
+		if err != nil {
+			respondError(w, http.StatusUnauthorized, "authentication required")
+			return
+		}
+
+		opts, err := parseListOptions(r)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		memberships, nextPageToken, err := s.store.ListMemberships(r.Context(), claims.OrganizationID, opts)
+		if isListOptionsError(err) {
+			respondError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if err != nil {
+			s.logger.Error("failed to list memberships", "error", err)
+			respondError(w, http.StatusInternalServerError, "failed to list memberships")
+			return
+		}
+
+		respondJSON(w, http.StatusOK, listResponse{Items: memberships, NextPageToken: nextPageToken})
+	}
+}
+
+// handleUpdateMembershipRole changes a member's role in the organization.
+// It applies to their next request.
+func (s *Server) handleUpdateMembershipRole() http.HandlerFunc {
+	type request struct {
+		Role models.UserRole `json:"role"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, err := auth.GetUserClaims(r)
+		if err != nil {
+			respondError(w, http.StatusUnauthorized, "authentication required")
+			return
+		}
+
+		var req request
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondError(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+		if !s.isAssignableRole(r.Context(), claims.OrganizationID, req.Role) {
+			respondError(w, http.StatusBadRequest, invalidRoleMessage)
+			return
+		}
+
+		membership, err := s.store.GetMembership(r.Context(), claims.OrganizationID, chi.URLParam(r, "userID"))
+		if err != nil {
+			respondError(w, http.StatusNotFound, "membership not found")
+			return
+		}
+
+		oldRole := membership.Role
+		membership.Role = req.Role
+		if err := s.store.UpdateMembership(r.Context(), membership); err != nil {
+			s.logger.Error("failed to update membership", "error", err)
+			respondError(w, http.StatusInternalServerError, "failed to update membership")
+			return
+		}
+
+		// Create audit log
+		s.recordAudit(r.Context(), &models.AuditLog{
+			OrganizationID: claims.OrganizationID,
+			UserID:         claims.UID,
+			UserEmail:      claims.Email,
+			Action:         models.ActionMemberUpdated,
+			ResourceType:   "membership",
+			ResourceID:     membership.UserID,
+			Description:    fmt.Sprintf("Changed role of member %s to %s", membership.Email, membership.Role),
+			Changes: map[string]interface{}{
+				"role": map[string]interface{}{
+					"from": oldRole,
+					"to":   membership.Role,
+				},
+			},
+			IPAddress: r.RemoteAddr,
+			UserAgent: r.UserAgent(),
+		})
+
+		respondJSON(w, http.StatusOK, membership)
+	}
+}
+
+// handleRemoveMembership removes a member from the organization, freeing
+// their seat. Their account and other organizations are unaffected.
+func (s *Server) handleRemoveMembership() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, err := auth.GetUserClaims(r)
+		if err != nil {
+			respondError(w, http.StatusUnauthorized, "authentication required")
+			return
+		}
+
+		membership, err := s.store.GetMembership(r.Context(), claims.OrganizationID, chi.URLParam(r, "userID"))
+		if err != nil {
+			respondError(w, http.StatusNotFound, "membership not found")
+			return
+		}
+
+		if err := s.store.DeleteMembership(r.Context(), membership.OrganizationID, membership.UserID); err != nil {
+			s.logger.Error("failed to delete membership", "error", err)
+			respondError(w, http.StatusInternalServerError, "failed to remove member")
+			return
+		}
+
+		// Create audit log
+		s.recordAudit(r.Context(), &models.AuditLog{
+			OrganizationID: claims.OrganizationID,
+			UserID:         claims.UID,
+			UserEmail:      claims.Email,
+			Action:         models.ActionMemberRemoved,
+			ResourceType:   "membership",
+			ResourceID:     membership.UserID,
+			Description:    fmt.Sprintf("Removed member %s", membership.Email),
+			IPAddress:      r.RemoteAddr,
+			UserAgent:      r.UserAgent(),
+		})
+
+		respondJSON(w, http.StatusOK, map[string]string{
+			"message": "Member removed",
+		})
+	}
+}
+
+// removeMemberships ends a deleted user's memberships in other
+// organizations, freeing their seats there
+func (s *Server) removeMemberships(r *http.Request, claims *auth.UserClaims, user *models.User) {
+	memberships, err := s.store.ListUserMemberships(r.Context(), user.UID)
+	if err != nil {
+		s.logger.Error("failed to list memberships", "user_id", user.UID, "error", err)
+		return
+	}
+
+	for _, membership := range memberships {
+		if err := s.store.DeleteMembership(r.Context(), membership.OrganizationID, user.UID); err != nil {
+			s.logger.Error("failed to delete membership", "organization_id", membership.OrganizationID, "user_id", user.UID, "error", err)
+			continue
+		}
+
+		// Create audit log
+		s.recordAudit(r.Context(), &models.AuditLog{
+			OrganizationID: membership.OrganizationID,
+			UserID:         claims.UID,
+			UserEmail:      claims.Email,
+			Action:         models.ActionMemberRemoved,
+			ResourceType:   "membership",
+			ResourceID:     user.UID,
+			Description:    fmt.Sprintf("Removed member %s because their account was deleted", user.Email),
+			IPAddress:      r.RemoteAddr,
+			UserAgent:      r.UserAgent(),
+		})
+	}
+}
+
+// belongsToOrganization reports whether user's account belongs to orgID,
+// they are a member of it or it is a client of their partner organization
+func (s *Server) belongsToOrganization(ctx context.Context, user *models.User, orgID string) bool {
+	_, err := s.authMiddleware.OrganizationRole(ctx, user, orgID)
+	return err == nil
+}
@@ -0,0 +1,131 @@
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+
+	"cloud.google.com/go/storage"
+)
+
+// errObjectNotFound is returned for a file that has not been uploaded
+var errObjectNotFound = errors.New("object not found")
+
+// objectInfo describes a stored file
+type objectInfo struct {
+	Size        int64
+	ContentType string
+}
+
+// objectStore reads and removes the files clients upload with signed URLs.
+// Cloud Storage backs it in production.
+type objectStore interface {
+	// Stat returns the attributes of the object at path, or
+	// errObjectNotFound when there is none
+	Stat(ctx context.Context, path string) (*objectInfo, error)
+	// Open returns a reader for the content of the object at path
+	Open(ctx context.Context, path string) (io.ReadCloser, error)
+	// Delete removes the object at path; removing a missing object succeeds
+	Delete(ctx context.Context, path string) error
+}
+
+// gcsObjectStore reads objects from a Cloud Storage bucket
+type gcsObjectStore struct {
+	client *storage.Client
+	bucket string
+}
+
+// Stat returns the size and content type of an object
+func (g *gcsObjectStore) Stat(ctx context.Context, path string) (*objectInfo, error) {
+	attrs, err := g.client.Bucket(g.bucket).Object(path).Attrs(ctx)
+	if errors.Is(err, storage.ErrObjectNotExist) {
+		return nil, errObjectNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &objectInfo{Size: attrs.Size, ContentType: attrs.ContentType}, nil
+}
+
+// Open returns a reader for an object's content
+func (g *gcsObjectStore) Open(ctx context.Context, path string) (io.ReadCloser, error) {
+	reader, err := g.client.Bucket(g.bucket).Object(path).NewReader(ctx)
+	if errors.Is(err, storage.ErrObjectNotExist) {
+		return nil, errObjectNotFound
+	}
+	return reader, err
+}
+
+// Delete removes an object
+func (g *gcsObjectStore) Delete(ctx context.Context, path string) error {
+	err := g.client.Bucket(g.bucket).Object(path).Delete(ctx)
+	if errors.Is(err, storage.ErrObjectNotExist) {
+		return nil
+	}
+	return err
+}
+
+// uploadError explains why an uploaded file does not match what the client
+// declared when requesting the upload URL
+type uploadError struct {
+	msg string
+}
+
+func (e *uploadError) Error() string {
+	return e.msg
+}
+
+// verifyUpload checks that a pending evidence file exists in storage with the
+// size and content type declared for it, and returns the hex SHA-256 of its
+// content
+func (s *Server) verifyUpload(ctx context.Context, path string, size int64, fileType string) (string, error) {
+	info, err := s.objects.Stat(ctx, path)
+	if errors.Is(err, errObjectNotFound) {
+		return "", &uploadError{msg: "uploaded file not found"}
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read object attributes: %w", err)
+	}
+
+	if info.Size != size {
+		return "", &uploadError{msg: fmt.Sprintf("uploaded file is %d bytes, expected %d", info.Size, size)}
+	}
+	if mediaType(info.ContentType) != mediaType(fileType) {
+		return "", &uploadError{msg: fmt.Sprintf("uploaded file has content type %q, expected %q", info.ContentType, fileType)}
+	}
+
+	reader, err := s.objects.Open(ctx, path)
+	if errors.Is(err, errObjectNotFound) {
+		return "", &uploadError{msg: "uploaded file not found"}
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to open object: %w", err)
+	}
+	defer reader.Close()
+
+	hash := sha256.New()
+	n, err := io.Copy(hash, reader)
+	if err != nil {
+		return "", fmt.Errorf("failed to read object: %w", err)
+	}
+	// The object may have been overwritten between Stat and Open
+	if n != size {
+		return "", &uploadError{msg: fmt.Sprintf("uploaded file is %d bytes, expected %d", n, size)}
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// mediaType returns the lower-cased media type of a Content-Type value
+// without its parameters
+func mediaType(contentType string) string {
+	mt, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return contentType
+	}
+	return mt
+}
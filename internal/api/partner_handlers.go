@@ -0,0 +1,399 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+
+	"compliancesync-api/internal/auth"
+	"compliancesync-api/internal/models"
+)
+
+// portfolioClient is one client organization on the portfolio dashboard
+type portfolioClient struct {
+	OrganizationID      string                     `json:"organization_id"`
+	Name                string                     `json:"name"`
+	RegulatoryFramework models.RegulatoryFramework `json:"regulatory_framework"`
+	dashboardMetrics
+}
+
+// Partner handlers
+
+// handleGetPortfolioDashboard rolls up the dashboard metrics of every client
+// of the caller's partner organization. The totals list the upcoming
+// deadlines of all clients, soonest first; each requirement carries its
+// client's organization ID.
+func (s *Server) handleGetPortfolioDashboard() http.HandlerFunc {
+	type response struct {
+		ClientCount int               `json:"client_count"`
+		Totals      dashboardMetrics  `json:"totals"`
+		Clients     []portfolioClient `json:"clients"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, err := auth.GetUserClaims(r)
+		if err != nil {
+			respondError(w, http.StatusUnauthorized, "authentication required")
+			return
+		}
+
+		partner, ok := s.getPartner(w, r, claims)
+		if !ok {
+			return
+		}
+
+		clients, err := s.store.ListClientOrganizations(r.Context(), partner.ID)
+		if err != nil {
+			s.logger.Error("failed to list client organizations", "error", err)
+			respondError(w, http.StatusInternalServerError, "failed to get portfolio dashboard")
+			return
+		}
+
+		resp := response{ClientCount: len(clients), Clients: make([]portfolioClient, 0, len(clients))}
+		for _, client := range clients {
+			metrics, err := s.computeDashboard(r.Context(), client.ID)
+			if err != nil {
+				s.logger.Error("failed to get client dashboard", "organization_id", client.ID, "error", err)
+				respondError(w, http.StatusInternalServerError, "failed to get portfolio dashboard")
+				return
+			}
+
+			resp.Clients = append(resp.Clients, portfolioClient{
+				OrganizationID:      client.ID,
+				Name:                client.Name,
+				RegulatoryFramework: client.RegulatoryFramework,
+				dashboardMetrics:    *metrics,
+			})
+
+			resp.Totals.TotalRequirements += metrics.TotalRequirements
+			resp.Totals.CompliantRequirements += metrics.CompliantRequirements
+			resp.Totals.AtRiskRequirements += metrics.AtRiskRequirements
+			resp.Totals.NonCompliantRequirements += metrics.NonCompliantRequirements
+			resp.Totals.TotalEvidence += metrics.TotalEvidence
+			resp.Totals.UpcomingDeadlines = append(resp.Totals.UpcomingDeadlines, metrics.UpcomingDeadlines...)
+		}
+
+		deadlines := resp.Totals.UpcomingDeadlines
+		sort.SliceStable(deadlines, func(i, j int) bool { return deadlines[i].NextDueDate.Before(*deadlines[j].NextDueDate) })
+
+		respondJSON(w, http.StatusOK, resp)
+	}
+}
+
+// handleListClients lists the client organizations of the caller's partner
+// organization by name
+func (s *Server) handleListClients() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, err := auth.GetUserClaims(r)
+		if err != nil {
+			respondError(w, http.StatusUnauthorized, "authentication required")
+			return
+		}
+
+		partner, ok := s.getPartner(w, r, claims)
+		if !ok {
+			return
+		}
+
+		clients, err := s.store.ListClientOrganizations(r.Context(), partner.ID)
+		if err != nil {
+			s.logger.Error("failed to list client organizations", "error", err)
+			respondError(w, http.StatusInternalServerError, "failed to list clients")
+			return
+		}
+
+		respondJSON(w, http.StatusOK, listResponse{Items: clients})
+	}
+}
+
+// handleCreateClient creates a client organization managed by the caller's
+// partner organization and activates the partner's requirement baseline in
+// it. The client starts on a trial with no users; partner staff act in it
+// with their delegated role and it can invite its own users.
+func (s *Server) handleCreateClient() http.HandlerFunc {
+	type request struct {
+		Name                string                     `json:"name"`
+		Industry            models.Industry            `json:"industry"`
+		EmployeeCount       models.EmployeeCountRange  `json:"employee_count"`
+		RegulatoryFramework models.RegulatoryFramework `json:"regulatory_framework"`
+		Website             string                     `json:"website"`
+		Address             string                     `json:"address"`
+		Phone               string                     `json:"phone"`
+	}
+
+	type response struct {
+		Organization *models.Organization  `json:"organization"`
+		Requirements []*models.Requirement `json:"requirements"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, err := auth.GetUserClaims(r)
+		if err != nil {
+			respondError(w, http.StatusUnauthorized, "authentication required")
+			return
+		}
+
+		var req request
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondError(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+		if req.Name == "" || req.RegulatoryFramework == "" {
+			respondError(w, http.StatusBadRequest, "name and regulatory_framework are required")
+			return
+		}
+
+		partner, ok := s.getPartner(w, r, claims)
+		if !ok {
+			return
+		}
+
+		templates, err := s.baselineTemplates(r.Context(), partner, req.RegulatoryFramework)
+		if err != nil {
+			s.logger.Error("failed to get baseline templates", "error", err)
+			respondError(w, http.StatusInternalServerError, "failed to create client")
+			return
+		}
+
+		org := &models.Organization{
+			Name:                req.Name,
+			Industry:            req.Industry,
+			EmployeeCount:       req.EmployeeCount,
+			RegulatoryFramework: req.RegulatoryFramework,
+			Website:             req.Website,
+			Address:             req.Address,
+			Phone:               req.Phone,
+			Subscription: models.Subscription{
+				Tier:         models.TierStarter,
+				Status:       "trial",
+				MaxUsers:     models.GetMaxUsers(models.TierStarter),
+				MonthlyPrice: models.GetMonthlyPrice(models.TierStarter),
+			},
+		}
+		if err := s.store.CreateClientOrganization(r.Context(), partner.ID, org); err != nil {
+			s.logger.Error("failed to create client organization", "error", err)
+			respondError(w, http.StatusInternalServerError, "failed to create client")
+			return
+		}
+
+		// Create audit log
+		s.recordAudit(r.Context(), &models.AuditLog{
+			OrganizationID: org.ID,
+			UserID:         claims.UID,
+			UserEmail:      claims.Email,
+			Action:         models.ActionOrgCreated,
+			ResourceType:   "organization",
+			ResourceID:     org.ID,
+			Description:    fmt.Sprintf("Organization '%s' created by partner '%s'", org.Name, partner.Name),
+			Metadata: map[string]interface{}{
+				"partner_id": partner.ID,
+			},
+			IPAddress: r.RemoteAddr,
+			UserAgent: r.UserAgent(),
+		})
+
+		requirements := make([]*models.Requirement, 0, len(templates))
+		for _, template := range templates {
+			requirement := &models.Requirement{
+				OrganizationID: org.ID,
+				TemplateID:     template.ID,
+				Title:          template.Title,
+				Description:    template.Description,
+				Category:       template.Category,
+				Authority:      template.Authority,
+				EvidenceTypes:  template.EvidenceTypes,
+				Frequency:      template.Frequency,
+				ActivatedBy:    claims.UID,
+			}
+			if err := s.store.CreateRequirement(r.Context(), requirement); err != nil {
+				s.logger.Error("failed to create requirement", "organization_id", org.ID, "template_id", template.ID, "error", err)
+				respondError(w, http.StatusInternalServerError, "client created but failed to activate its baseline requirements")
+				return
+			}
+			requirements = append(requirements, requirement)
+
+			// Create audit log
+			s.recordAudit(r.Context(), &models.AuditLog{
+				OrganizationID: org.ID,
+				UserID:         claims.UID,
+				UserEmail:      claims.Email,
+				Action:         models.ActionRequirementActivated,
+				ResourceType:   "requirement",
+				ResourceID:     requirement.ID,
+				Description:    fmt.Sprintf("Activated requirement: %s", requirement.Title),
+				IPAddress:      r.RemoteAddr,
+				UserAgent:      r.UserAgent(),
+			})
+		}
+
+		// Create audit log
+		s.recordAudit(r.Context(), &models.AuditLog{
+			OrganizationID: partner.ID,
+			UserID:         claims.UID,
+			UserEmail:      claims.Email,
+			Action:         models.ActionClientCreated,
+			ResourceType:   "organization",
+			ResourceID:     org.ID,
+			Description:    fmt.Sprintf("Created client organization '%s' with %d baseline requirements", org.Name, len(requirements)),
+			IPAddress:      r.RemoteAddr,
+			UserAgent:      r.UserAgent(),
+		})
+
+		respondJSON(w, http.StatusCreated, response{Organization: org, Requirements: requirements})
+	}
+}
+
+// handleGetBaseline returns the requirement templates the caller's partner
+// organization activates in new clients. An empty baseline activates every
+// template of the client's regulatory framework.
+func (s *Server) handleGetBaseline() http.HandlerFunc {
+	type response struct {
+		TemplateIDs []string `json:"template_ids"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, err := auth.GetUserClaims(r)
+		if err != nil {
+			respondError(w, http.StatusUnauthorized, "authentication required")
+			return
+		}
+
+		partner, ok := s.getPartner(w, r, claims)
+		if !ok {
+			return
+		}
+
+		setETag(w, partner.Version)
+		respondJSON(w, http.StatusOK, response{TemplateIDs: append([]string{}, partner.BaselineTemplateIDs...)})
+	}
+}
+
+// handleUpdateBaseline replaces the partner's requirement baseline. It is
+// saved on the partner organization, so it needs the organization's ETag in
+// If-Match. Clients created earlier keep their requirements.
+func (s *Server) handleUpdateBaseline() http.HandlerFunc {
+	type request struct {
+		TemplateIDs []string `json:"template_ids"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, err := auth.GetUserClaims(r)
+		if err != nil {
+			respondError(w, http.StatusUnauthorized, "authentication required")
+			return
+		}
+
+		var req request
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondError(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+
+		partner, ok := s.getPartner(w, r, claims)
+		if !ok {
+			return
+		}
+
+		if !checkIfMatch(w, r, partner.Version) {
+			return
+		}
+
+		var templateIDs []string
+		seen := make(map[string]bool)
+		for _, id := range req.TemplateIDs {
+			if seen[id] {
+				continue
+			}
+			seen[id] = true
+			if _, err := s.store.GetRequirementTemplate(r.Context(), id); err != nil {
+				respondError(w, http.StatusBadRequest, fmt.Sprintf("requirement template not found: %s", id))
+				return
+			}
+			templateIDs = append(templateIDs, id)
+		}
+
+		partner.BaselineTemplateIDs = templateIDs
+		partner.UpdatedBy = claims.UID
+		if err := s.store.UpdateOrganization(r.Context(), partner); err != nil {
+			if isVersionConflict(err) {
+				respondPreconditionFailed(w)
+				return
+			}
+			s.logger.Error("failed to update baseline", "error", err)
+			respondError(w, http.StatusInternalServerError, "failed to update baseline")
+			return
+		}
+
+		// Create audit log
+		s.recordAudit(r.Context(), &models.AuditLog{
+			OrganizationID: partner.ID,
+			UserID:         claims.UID,
+			UserEmail:      claims.Email,
+			Action:         models.ActionBaselineUpdated,
+			ResourceType:   "organization",
+			ResourceID:     partner.ID,
+			Description:    fmt.Sprintf("Requirement baseline set to %d templates", len(templateIDs)),
+			Metadata: map[string]interface{}{
+				"template_ids": templateIDs,
+			},
+			IPAddress: r.RemoteAddr,
+			UserAgent: r.UserAgent(),
+		})
+
+		setETag(w, partner.Version)
+		respondJSON(w, http.StatusOK, map[string][]string{"template_ids": append([]string{}, templateIDs...)})
+	}
+}
+
+// getPartner returns the caller's organization, responding with 403 unless
+// it is a partner. Partner routes act in the partner's own organization,
+// never in a client selected with the X-Organization-ID header.
+func (s *Server) getPartner(w http.ResponseWriter, r *http.Request, claims *auth.UserClaims) (*models.Organization, bool) {
+	org, err := s.store.GetOrganization(r.Context(), claims.OrganizationID)
+	if err != nil {
+		respondError(w, http.StatusNotFound, "organization not found")
+		return nil, false
+	}
+	if !org.Partner {
+		respondError(w, http.StatusForbidden, "organization is not a partner account")
+		return nil, false
+	}
+	return org, true
+}
+
+// partnerClients lists the clients of orgID when it is a partner
+// organization, and nothing otherwise
+func (s *Server) partnerClients(ctx context.Context, orgID string) ([]*models.Organization, error) {
+	if orgID == "" {
+		return nil, nil
+	}
+	org, err := s.store.GetOrganization(ctx, orgID)
+	if err != nil || !org.Partner {
+		return nil, nil
+	}
+	return s.store.ListClientOrganizations(ctx, org.ID)
+}
+
+// baselineTemplates returns the requirement templates to activate in a new
+// client with the given regulatory framework: the active templates of the
+// partner's baseline for that framework, or every active template for it
+// when the partner has no baseline
+func (s *Server) baselineTemplates(ctx context.Context, partner *models.Organization, framework models.RegulatoryFramework) ([]*models.RequirementTemplate, error) {
+	if len(partner.BaselineTemplateIDs) == 0 {
+		return s.store.ListRequirementTemplates(ctx, framework)
+	}
+
+	var templates []*models.RequirementTemplate
+	for _, id := range partner.BaselineTemplateIDs {
+		template, err := s.store.GetRequirementTemplate(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if template.IsActive && template.RegulatoryFramework == framework {
+			templates = append(templates, template)
+		}
+	}
+	return templates, nil
+}
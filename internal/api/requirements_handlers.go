@@ -7,6 +7,7 @@ import (
 
 	"compliancesync-api/internal/auth"
 	"compliancesync-api/internal/models"
+	"compliancesync-api/internal/store"
 	"github.com/go-chi/chi/v5"
 )
 
@@ -97,13 +98,13 @@ func (s *Server) handleCreateRequirement() http.HandlerFunc {
 			IPAddress:      r.RemoteAddr,
 			UserAgent:      r.UserAgent(),
 		}
-		s.store.CreateAuditLog(r.Context(), auditLog)
+		s.recordAudit(r.Context(), auditLog)
 
 		respondJSON(w, http.StatusCreated, requirement)
 	}
 }
 
-// handleListRequirements lists all active requirements for the organization
+// handleListRequirements lists active requirements for the organization, one page at a time
 func (s *Server) handleListRequirements() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		claims, err := auth.GetUserClaims(r)
@@ -112,7 +113,17 @@ func (s *Server) handleListRequirements() http.HandlerFunc {
 			return
 		}
 
-		requirements, err := s.store.ListRequirements(r.Context(), claims.OrganizationID)
+		opts, err := parseListOptions(r)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		requirements, nextPageToken, err := s.store.ListRequirements(r.Context(), claims.OrganizationID, opts)
+		if isListOptionsError(err) {
+			respondError(w, http.StatusBadRequest, err.Error())
+			return
+		}
 		if err != nil {
 			s.logger.Error("failed to list requirements", "error", err)
 			respondError(w, http.StatusInternalServerError, "failed to get requirements")
@@ -124,7 +135,7 @@ func (s *Server) handleListRequirements() http.HandlerFunc {
 			req.Status = req.CalculateStatus()
 		}
 
-		respondJSON(w, http.StatusOK, requirements)
+		respondJSON(w, http.StatusOK, listResponse{Items: requirements, NextPageToken: nextPageToken})
 	}
 }
 
@@ -148,6 +159,7 @@ func (s *Server) handleGetRequirement() http.HandlerFunc {
 		// Update status
 		requirement.Status = requirement.CalculateStatus()
 
+		setETag(w, requirement.Version)
 		respondJSON(w, http.StatusOK, requirement)
 	}
 }
@@ -180,11 +192,19 @@ func (s *Server) handleUpdateRequirement() http.HandlerFunc {
 			return
 		}
 
+		if !checkIfMatch(w, r, requirement.Version) {
+			return
+		}
+
 		// Update fields
 		requirement.Notes = req.Notes
 		requirement.UpdatedBy = claims.UID
 
 		if err := s.store.UpdateRequirement(r.Context(), requirement); err != nil {
+			if isVersionConflict(err) {
+				respondPreconditionFailed(w)
+				return
+			}
 			s.logger.Error("failed to update requirement", "error", err)
 			respondError(w, http.StatusInternalServerError, "failed to update requirement")
 			return
@@ -202,8 +222,9 @@ func (s *Server) handleUpdateRequirement() http.HandlerFunc {
 			IPAddress:      r.RemoteAddr,
 			UserAgent:      r.UserAgent(),
 		}
-		s.store.CreateAuditLog(r.Context(), auditLog)
+		s.recordAudit(r.Context(), auditLog)
 
+		setETag(w, requirement.Version)
 		respondJSON(w, http.StatusOK, requirement)
 	}
 }
@@ -225,10 +246,18 @@ func (s *Server) handleDeactivateRequirement() http.HandlerFunc {
 			return
 		}
 
+		if !checkIfMatch(w, r, requirement.Version) {
+			return
+		}
+
 		requirement.IsActive = false
 		requirement.UpdatedBy = claims.UID
 
 		if err := s.store.UpdateRequirement(r.Context(), requirement); err != nil {
+			if isVersionConflict(err) {
+				respondPreconditionFailed(w)
+				return
+			}
 			s.logger.Error("failed to deactivate requirement", "error", err)
 			respondError(w, http.StatusInternalServerError, "failed to deactivate requirement")
 			return
@@ -246,8 +275,53 @@ func (s *Server) handleDeactivateRequirement() http.HandlerFunc {
 			IPAddress:      r.RemoteAddr,
 			UserAgent:      r.UserAgent(),
 		}
-		s.store.CreateAuditLog(r.Context(), auditLog)
+		s.recordAudit(r.Context(), auditLog)
 
 		respondJSON(w, http.StatusOK, map[string]string{"message": "requirement deactivated successfully"})
 	}
 }
+
+// handleReconcileEvidenceCounts recomputes requirement evidence counts from
+// active evidence and reports any drift that was corrected
+func (s *Server) handleReconcileEvidenceCounts() http.HandlerFunc {
+	type response struct {
+		Corrected []store.EvidenceCountDrift `json:"corrected"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, err := auth.GetUserClaims(r)
+		if err != nil {
+			respondError(w, http.StatusUnauthorized, "authentication required")
+			return
+		}
+
+		drift, err := s.store.ReconcileEvidenceCounts(r.Context(), claims.OrganizationID)
+		if err != nil {
+			s.logger.Error("failed to reconcile evidence counts", "error", err)
+			respondError(w, http.StatusInternalServerError, "failed to reconcile evidence counts")
+			return
+		}
+
+		if len(drift) > 0 {
+			auditLog := &models.AuditLog{
+				OrganizationID: claims.OrganizationID,
+				UserID:         claims.UID,
+				UserEmail:      claims.Email,
+				Action:         models.ActionEvidenceCountsReconciled,
+				ResourceType:   "requirement",
+				Description:    fmt.Sprintf("Corrected evidence counts for %d requirements", len(drift)),
+				Metadata: map[string]interface{}{
+					"corrected": drift,
+				},
+				IPAddress: r.RemoteAddr,
+				UserAgent: r.UserAgent(),
+			}
+			s.recordAudit(r.Context(), auditLog)
+		}
+
+		if drift == nil {
+			drift = []store.EvidenceCountDrift{}
+		}
+		respondJSON(w, http.StatusOK, response{Corrected: drift})
+	}
+}
@@ -0,0 +1,290 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"compliancesync-api/internal/auth"
+	"compliancesync-api/internal/models"
+	"compliancesync-api/internal/store"
+	"github.com/go-chi/chi/v5"
+)
+
+// Custom role handlers
+
+// roleRequest is the body for creating or replacing a custom role
+type roleRequest struct {
+	Name        string              `json:"name"`
+	Description string              `json:"description"`
+	Permissions []models.Permission `json:"permissions"`
+}
+
+// validate trims the request and checks every permission is defined
+func (req *roleRequest) validate() error {
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if len(req.Permissions) == 0 {
+		return fmt.Errorf("at least one permission is required")
+	}
+	for _, permission := range req.Permissions {
+		if !models.IsValidPermission(permission) {
+			return fmt.Errorf("unknown permission %q", permission)
+		}
+	}
+	return nil
+}
+
+// handleListRoles lists the organization's custom roles
+func (s *Server) handleListRoles() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, err := auth.GetUserClaims(r)
+		if err != nil {
+			respondError(w, http.StatusUnauthorized, "authentication required")
+			return
+		}
+
+		opts, err := parseListOptions(r)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		roles, nextPageToken, err := s.store.ListRoles(r.Context(), claims.OrganizationID, opts)
+		if isListOptionsError(err) {
+			respondError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if err != nil {
+			s.logger.Error("failed to list roles", "error", err)
+			respondError(w, http.StatusInternalServerError, "failed to list roles")
+			return
+		}
+
+		respondJSON(w, http.StatusOK, listResponse{Items: roles, NextPageToken: nextPageToken})
+	}
+}
+
+// handleCreateRole defines a new custom role
+func (s *Server) handleCreateRole() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, err := auth.GetUserClaims(r)
+		if err != nil {
+			respondError(w, http.StatusUnauthorized, "authentication required")
+			return
+		}
+
+		var req roleRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondError(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+		if err := req.validate(); err != nil {
+			respondError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		role := &models.Role{
+			OrganizationID: claims.OrganizationID,
+			Name:           req.Name,
+			Description:    req.Description,
+			Permissions:    req.Permissions,
+			CreatedBy:      claims.UID,
+			UpdatedBy:      claims.UID,
+		}
+
+		if err := s.store.CreateRole(r.Context(), role); err != nil {
+			s.logger.Error("failed to create role", "error", err)
+			respondError(w, http.StatusInternalServerError, "failed to create role")
+			return
+		}
+
+		// Create audit log
+		auditLog := &models.AuditLog{
+			OrganizationID: claims.OrganizationID,
+			UserID:         claims.UID,
+			UserEmail:      claims.Email,
+			Action:         models.ActionRoleCreated,
+			ResourceType:   "role",
+			ResourceID:     role.ID,
+			Description:    fmt.Sprintf("Created role: %s", role.Name),
+			Metadata: map[string]interface{}{
+				"permissions": role.Permissions,
+			},
+			IPAddress: r.RemoteAddr,
+			UserAgent: r.UserAgent(),
+		}
+		s.recordAudit(r.Context(), auditLog)
+
+		setETag(w, role.Version)
+		respondJSON(w, http.StatusCreated, role)
+	}
+}
+
+// handleGetRole retrieves a custom role
+func (s *Server) handleGetRole() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, err := auth.GetUserClaims(r)
+		if err != nil {
+			respondError(w, http.StatusUnauthorized, "authentication required")
+			return
+		}
+
+		role, err := s.store.GetRole(r.Context(), claims.OrganizationID, chi.URLParam(r, "roleID"))
+		if err != nil {
+			respondError(w, http.StatusNotFound, "role not found")
+			return
+		}
+
+		setETag(w, role.Version)
+		respondJSON(w, http.StatusOK, role)
+	}
+}
+
+// handleUpdateRole replaces a custom role's name, description and
+// permissions. Users assigned the role get the new permissions on their
+// next request.
+func (s *Server) handleUpdateRole() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, err := auth.GetUserClaims(r)
+		if err != nil {
+			respondError(w, http.StatusUnauthorized, "authentication required")
+			return
+		}
+
+		var req roleRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondError(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+		if err := req.validate(); err != nil {
+			respondError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		role, err := s.store.GetRole(r.Context(), claims.OrganizationID, chi.URLParam(r, "roleID"))
+		if err != nil {
+			respondError(w, http.StatusNotFound, "role not found")
+			return
+		}
+
+		if !checkIfMatch(w, r, role.Version) {
+			return
+		}
+
+		oldPermissions := role.Permissions
+		role.Name = req.Name
+		role.Description = req.Description
+		role.Permissions = req.Permissions
+		role.UpdatedBy = claims.UID
+
+		if err := s.store.UpdateRole(r.Context(), role); err != nil {
+			if isVersionConflict(err) {
+				respondPreconditionFailed(w)
+				return
+			}
+			s.logger.Error("failed to update role", "error", err)
+			respondError(w, http.StatusInternalServerError, "failed to update role")
+			return
+		}
+		s.authMiddleware.InvalidateRole(role.OrganizationID, role.ID)
+
+		// Create audit log
+		auditLog := &models.AuditLog{
+			OrganizationID: claims.OrganizationID,
+			UserID:         claims.UID,
+			UserEmail:      claims.Email,
+			Action:         models.ActionRoleUpdated,
+			ResourceType:   "role",
+			ResourceID:     role.ID,
+			Description:    fmt.Sprintf("Updated role: %s", role.Name),
+			Changes: map[string]interface{}{
+				"permissions": map[string]interface{}{
+					"from": oldPermissions,
+					"to":   role.Permissions,
+				},
+			},
+			IPAddress: r.RemoteAddr,
+			UserAgent: r.UserAgent(),
+		}
+		s.recordAudit(r.Context(), auditLog)
+
+		setETag(w, role.Version)
+		respondJSON(w, http.StatusOK, role)
+	}
+}
+
+// handleDeleteRole deletes a custom role that no user or pending invitation
+// is assigned to
+func (s *Server) handleDeleteRole() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, err := auth.GetUserClaims(r)
+		if err != nil {
+			respondError(w, http.StatusUnauthorized, "authentication required")
+			return
+		}
+
+		role, err := s.store.GetRole(r.Context(), claims.OrganizationID, chi.URLParam(r, "roleID"))
+		if err != nil {
+			respondError(w, http.StatusNotFound, "role not found")
+			return
+		}
+
+		if !checkIfMatch(w, r, role.Version) {
+			return
+		}
+
+		if err := s.store.DeleteRole(r.Context(), claims.OrganizationID, role.ID, role.Version); err != nil {
+			if isVersionConflict(err) {
+				respondPreconditionFailed(w)
+				return
+			}
+			if errors.Is(err, store.ErrRoleInUse) {
+				respondError(w, http.StatusConflict, "role is assigned to users or pending invitations; reassign them first")
+				return
+			}
+			s.logger.Error("failed to delete role", "error", err)
+			respondError(w, http.StatusInternalServerError, "failed to delete role")
+			return
+		}
+		s.authMiddleware.InvalidateRole(role.OrganizationID, role.ID)
+
+		// Create audit log
+		auditLog := &models.AuditLog{
+			OrganizationID: claims.OrganizationID,
+			UserID:         claims.UID,
+			UserEmail:      claims.Email,
+			Action:         models.ActionRoleDeleted,
+			ResourceType:   "role",
+			ResourceID:     role.ID,
+			Description:    fmt.Sprintf("Deleted role: %s", role.Name),
+			IPAddress:      r.RemoteAddr,
+			UserAgent:      r.UserAgent(),
+		}
+		s.recordAudit(r.Context(), auditLog)
+
+		respondJSON(w, http.StatusOK, map[string]string{"message": "role deleted successfully"})
+	}
+}
+
+// isAssignableRole reports whether role is a built-in role or assigns one of
+// the organization's custom roles
+func (s *Server) isAssignableRole(ctx context.Context, orgID string, role models.UserRole) bool {
+	if models.IsValidRole(role) {
+		return true
+	}
+	roleID, ok := role.CustomRoleID()
+	if !ok {
+		return false
+	}
+	_, err := s.store.GetRole(ctx, orgID, roleID)
+	return err == nil
+}
+
+// invalidRoleMessage is the 400 response for a role that cannot be assigned
+const invalidRoleMessage = "role must be admin, compliance_officer, viewer or custom:<role-id> for one of your organization's roles"
@@ -0,0 +1,1199 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"compliancesync-api/internal/auth"
+	"compliancesync-api/internal/models"
+	"compliancesync-api/internal/store"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+// SCIM 2.0 provisioning (RFC 7643 and RFC 7644). An identity provider
+// creates, updates, deactivates and deletes users through /scim/v2/Users
+// and assigns roles through /scim/v2/Groups, where each built-in or custom
+// role is a group and its members are the users holding that role.
+
+const (
+	scimContentType = "application/scim+json"
+	scimBasePath    = "/api/v1/scim/v2"
+
+	scimUserSchema     = "urn:ietf:params:scim:schemas:core:2.0:User"
+	scimGroupSchema    = "urn:ietf:params:scim:schemas:core:2.0:Group"
+	scimListSchema     = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	scimErrorSchema    = "urn:ietf:params:scim:api:messages:2.0:Error"
+	scimConfigSchema   = "urn:ietf:params:scim:schemas:core:2.0:ServiceProviderConfig"
+	scimResourceSchema = "urn:ietf:params:scim:schemas:core:2.0:ResourceType"
+
+	// scimDefaultCount is the page size when a list request has no count
+	scimDefaultCount = 100
+)
+
+// builtInGroupNames are the display names of the built-in role groups
+var builtInGroupNames = map[models.UserRole]string{
+	models.RoleAdmin:             "Admin",
+	models.RoleComplianceOfficer: "Compliance Officer",
+	models.RoleViewer:            "Viewer",
+}
+
+// scimFilterPattern matches the only filter form supported: attribute eq "value"
+var scimFilterPattern = regexp.MustCompile(`(?i)^\s*([a-z.]+)\s+eq\s+"((?:[^"\\]|\\.)*)"\s*$`)
+
+type scimMeta struct {
+	ResourceType string     `json:"resourceType"`
+	Created      *time.Time `json:"created,omitempty"`
+	LastModified *time.Time `json:"lastModified,omitempty"`
+	Location     string     `json:"location"`
+}
+
+type scimName struct {
+	Formatted  string `json:"formatted,omitempty"`
+	GivenName  string `json:"givenName,omitempty"`
+	FamilyName string `json:"familyName,omitempty"`
+}
+
+type scimMultiValue struct {
+	Value   string `json:"value"`
+	Display string `json:"display,omitempty"`
+	Type    string `json:"type,omitempty"`
+	Primary bool   `json:"primary,omitempty"`
+	Ref     string `json:"$ref,omitempty"`
+}
+
+type scimUser struct {
+	Schemas     []string         `json:"schemas"`
+	ID          string           `json:"id"`
+	UserName    string           `json:"userName"`
+	Name        *scimName        `json:"name,omitempty"`
+	DisplayName string           `json:"displayName,omitempty"`
+	Emails      []scimMultiValue `json:"emails"`
+	Active      bool             `json:"active"`
+	Groups      []scimMultiValue `json:"groups,omitempty"`
+	Meta        scimMeta         `json:"meta"`
+}
+
+type scimGroup struct {
+	Schemas     []string         `json:"schemas"`
+	ID          string           `json:"id"`
+	DisplayName string           `json:"displayName"`
+	Members     []scimMultiValue `json:"members,omitempty"`
+	Meta        scimMeta         `json:"meta"`
+}
+
+type scimListResponse struct {
+	Schemas      []string    `json:"schemas"`
+	TotalResults int         `json:"totalResults"`
+	StartIndex   int         `json:"startIndex"`
+	ItemsPerPage int         `json:"itemsPerPage"`
+	Resources    interface{} `json:"Resources"`
+}
+
+// scimBool is a boolean that also accepts the strings "true" and "false" in
+// any case, which some identity providers send for active
+type scimBool bool
+
+func (b *scimBool) UnmarshalJSON(data []byte) error {
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	switch v := v.(type) {
+	case bool:
+		*b = scimBool(v)
+	case string:
+		parsed, err := strconv.ParseBool(strings.ToLower(v))
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", v)
+		}
+		*b = scimBool(parsed)
+	default:
+		return fmt.Errorf("invalid boolean %s", data)
+	}
+	return nil
+}
+
+// scimUserAttributes are the user attributes a client can set. Attributes
+// that are not listed, such as addresses or phone numbers, are ignored.
+type scimUserAttributes struct {
+	UserName    *string          `json:"userName"`
+	Name        *scimName        `json:"name"`
+	DisplayName *string          `json:"displayName"`
+	Emails      []scimMultiValue `json:"emails"`
+	Active      *scimBool        `json:"active"`
+	Password    string           `json:"password"`
+}
+
+// fullName returns the display name, or the name built from its parts
+func (a *scimUserAttributes) fullName() string {
+	if a.DisplayName != nil && strings.TrimSpace(*a.DisplayName) != "" {
+		return strings.TrimSpace(*a.DisplayName)
+	}
+	if a.Name == nil {
+		return ""
+	}
+	if a.Name.Formatted != "" {
+		return strings.TrimSpace(a.Name.Formatted)
+	}
+	return strings.TrimSpace(a.Name.GivenName + " " + a.Name.FamilyName)
+}
+
+// email returns the lowercased userName, falling back to the primary email
+// when the userName is not an email address
+func (a *scimUserAttributes) email() string {
+	if a.UserName != nil && strings.Contains(*a.UserName, "@") {
+		return strings.ToLower(strings.TrimSpace(*a.UserName))
+	}
+	for _, email := range a.Emails {
+		if email.Primary && strings.Contains(email.Value, "@") {
+			return strings.ToLower(strings.TrimSpace(email.Value))
+		}
+	}
+	return ""
+}
+
+type scimPatchRequest struct {
+	Operations []scimPatchOperation `json:"Operations"`
+}
+
+type scimPatchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	Value json.RawMessage `json:"value"`
+}
+
+// scimError is a SCIM error response
+type scimError struct {
+	status   int
+	scimType string
+	detail   string
+}
+
+func respondSCIM(w http.ResponseWriter, status int, data interface{}) {
+	w.Header().Set("Content-Type", scimContentType)
+	w.WriteHeader(status)
+
+	if data != nil {
+		if err := jsonEncode(w, data); err != nil {
+			fmt.Printf("failed to encode SCIM response: %v\n", err)
+		}
+	}
+}
+
+func respondSCIMError(w http.ResponseWriter, e *scimError) {
+	body := map[string]interface{}{
+		"schemas": []string{scimErrorSchema},
+		"status":  strconv.Itoa(e.status),
+		"detail":  e.detail,
+	}
+	if e.scimType != "" {
+		body["scimType"] = e.scimType
+	}
+	respondSCIM(w, e.status, body)
+}
+
+// internalSCIMError logs err and returns a 500 error response
+func (s *Server) internalSCIMError(msg string, err error) *scimError {
+	s.logger.Error(msg, "error", err)
+	return &scimError{status: http.StatusInternalServerError, detail: msg}
+}
+
+// handleSCIMServiceProviderConfig describes the supported SCIM features
+func (s *Server) handleSCIMServiceProviderConfig() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		respondSCIM(w, http.StatusOK, map[string]interface{}{
+			"schemas":        []string{scimConfigSchema},
+			"patch":          map[string]bool{"supported": true},
+			"bulk":           map[string]interface{}{"supported": false, "maxOperations": 0, "maxPayloadSize": 0},
+			"filter":         map[string]interface{}{"supported": true, "maxResults": store.MaxPageSize},
+			"changePassword": map[string]bool{"supported": false},
+			"sort":           map[string]bool{"supported": false},
+			"etag":           map[string]bool{"supported": false},
+			"authenticationSchemes": []map[string]interface{}{{
+				"type":        "oauthbearertoken",
+				"name":        "API key",
+				"description": "An organization API key with the scim scope, sent as a bearer token",
+				"primary":     true,
+			}},
+			"meta": scimMeta{ResourceType: "ServiceProviderConfig", Location: s.scimLocation("ServiceProviderConfig")},
+		})
+	}
+}
+
+// handleSCIMResourceTypes lists the User and Group resource types
+func (s *Server) handleSCIMResourceTypes() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		resourceTypes := []map[string]interface{}{
+			{
+				"schemas":  []string{scimResourceSchema},
+				"id":       "User",
+				"name":     "User",
+				"endpoint": "/Users",
+				"schema":   scimUserSchema,
+				"meta":     scimMeta{ResourceType: "ResourceType", Location: s.scimLocation("ResourceTypes", "User")},
+			},
+			{
+				"schemas":  []string{scimResourceSchema},
+				"id":       "Group",
+				"name":     "Group",
+				"endpoint": "/Groups",
+				"schema":   scimGroupSchema,
+				"meta":     scimMeta{ResourceType: "ResourceType", Location: s.scimLocation("ResourceTypes", "Group")},
+			},
+		}
+		respondSCIM(w, http.StatusOK, scimListResponse{
+			Schemas:      []string{scimListSchema},
+			TotalResults: len(resourceTypes),
+			StartIndex:   1,
+			ItemsPerPage: len(resourceTypes),
+			Resources:    resourceTypes,
+		})
+	}
+}
+
+// handleSCIMListUsers lists the organization's users. Deleted users are not
+// listed. Supports the filters userName eq and id eq.
+func (s *Server) handleSCIMListUsers() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, err := auth.GetUserClaims(r)
+		if err != nil {
+			respondError(w, http.StatusUnauthorized, "authentication required")
+			return
+		}
+
+		attribute, value, scimErr := parseSCIMFilter(r.URL.Query().Get("filter"), "userName", "id")
+		if scimErr != nil {
+			respondSCIMError(w, scimErr)
+			return
+		}
+
+		users, err := s.scimUsers(r.Context(), claims.OrganizationID)
+		if err != nil {
+			respondSCIMError(w, s.internalSCIMError("failed to list users", err))
+			return
+		}
+		groupNames, err := s.scimGroupNames(r.Context(), claims.OrganizationID)
+		if err != nil {
+			respondSCIMError(w, s.internalSCIMError("failed to list roles", err))
+			return
+		}
+
+		var resources []scimUser
+		for _, user := range users {
+			switch attribute {
+			case "username":
+				if !strings.EqualFold(user.Email, value) {
+					continue
+				}
+			case "id":
+				if user.UID != value {
+					continue
+				}
+			}
+			resources = append(resources, s.scimUserResource(user, groupNames))
+		}
+
+		start, end, startIndex, scimErr := scimPage(r, len(resources))
+		if scimErr != nil {
+			respondSCIMError(w, scimErr)
+			return
+		}
+
+		respondSCIM(w, http.StatusOK, scimListResponse{
+			Schemas:      []string{scimListSchema},
+			TotalResults: len(resources),
+			StartIndex:   startIndex,
+			ItemsPerPage: end - start,
+			Resources:    append([]scimUser{}, resources[start:end]...),
+		})
+	}
+}
+
+// handleSCIMGetUser returns one user
+func (s *Server) handleSCIMGetUser() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, err := auth.GetUserClaims(r)
+		if err != nil {
+			respondError(w, http.StatusUnauthorized, "authentication required")
+			return
+		}
+
+		user, scimErr := s.scimUser(r.Context(), claims.OrganizationID, chi.URLParam(r, "userID"))
+		if scimErr != nil {
+			respondSCIMError(w, scimErr)
+			return
+		}
+
+		s.respondSCIMUser(w, r, http.StatusOK, user)
+	}
+}
+
+// handleSCIMCreateUser provisions a user with the SSO default role, or the
+// viewer role when single sign-on is not configured. Users sign in through
+// single sign-on unless a password is given, in which case a Firebase account
+// is created for them. A deleted user with the same email is restored.
+func (s *Server) handleSCIMCreateUser() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, err := auth.GetUserClaims(r)
+		if err != nil {
+			respondError(w, http.StatusUnauthorized, "authentication required")
+			return
+		}
+
+		var attrs scimUserAttributes
+		if err := json.NewDecoder(r.Body).Decode(&attrs); err != nil {
+			respondSCIMError(w, &scimError{status: http.StatusBadRequest, scimType: "invalidSyntax", detail: "invalid request body"})
+			return
+		}
+
+		email := attrs.email()
+		if email == "" {
+			respondSCIMError(w, &scimError{status: http.StatusBadRequest, scimType: "invalidValue", detail: "userName must be an email address"})
+			return
+		}
+
+		ctx := r.Context()
+		if existing := s.findUserByEmail(ctx, email); existing != nil {
+			if existing.OrganizationID != claims.OrganizationID || existing.Status != "deleted" {
+				respondSCIMError(w, &scimError{status: http.StatusConflict, scimType: "uniqueness", detail: "a user with this userName already exists"})
+				return
+			}
+
+			// Restore the deleted user, active unless asked otherwise
+			active := scimBool(true)
+			if attrs.Active == nil {
+				attrs.Active = &active
+			}
+			if scimErr := s.updateSCIMUser(r, claims, existing, &attrs); scimErr != nil {
+				respondSCIMError(w, scimErr)
+				return
+			}
+			s.respondSCIMUser(w, r, http.StatusCreated, existing)
+			return
+		}
+
+		role := models.RoleViewer
+		if config, err := s.store.GetSSOConfig(ctx, claims.OrganizationID); err == nil && config != nil &&
+			s.isAssignableRole(ctx, claims.OrganizationID, config.DefaultRole) {
+			role = config.DefaultRole
+		}
+
+		user := &models.User{
+			UID:            uuid.New().String(),
+			Email:          email,
+			FullName:       attrs.fullName(),
+			OrganizationID: claims.OrganizationID,
+			Role:           role,
+		}
+
+		// Create a Firebase account only for password sign-in
+		firebaseAccount := false
+		if attrs.Password != "" {
+			if !isValidPassword(attrs.Password) {
+				respondSCIMError(w, &scimError{status: http.StatusBadRequest, scimType: "invalidValue",
+					detail: "password must be at least 8 characters with uppercase, number, and special character"})
+				return
+			}
+			uid, err := s.authMiddleware.CreateUser(ctx, email, attrs.Password, user.FullName)
+			switch {
+			case errors.Is(err, auth.ErrUnsupported):
+			case err != nil:
+				respondSCIMError(w, s.internalSCIMError("failed to create user account", err))
+				return
+			default:
+				user.UID = uid
+				firebaseAccount = true
+			}
+		}
+
+		if err := s.store.ProvisionUser(ctx, user); err != nil {
+			if firebaseAccount {
+				s.authMiddleware.DeleteUser(ctx, user.UID)
+			}
+			if errors.Is(err, store.ErrSeatLimitReached) {
+				respondSCIMError(w, &scimError{status: http.StatusForbidden, detail: "user limit reached. Upgrade the plan to add more users"})
+				return
+			}
+			respondSCIMError(w, s.internalSCIMError("failed to create user", err))
+			return
+		}
+
+		if firebaseAccount {
+			if err := s.authMiddleware.SetCustomClaims(ctx, user.UID, map[string]interface{}{
+				"organizationId": user.OrganizationID,
+				"role":           string(user.Role),
+			}); err != nil {
+				s.logger.Error("failed to set custom claims", "uid", user.UID, "error", err)
+			}
+		}
+
+		// Create audit log
+		auditLog := &models.AuditLog{
+			OrganizationID: user.OrganizationID,
+			UserID:         claims.UID,
+			UserEmail:      claims.Email,
+			Action:         models.ActionUserCreated,
+			ResourceType:   "user",
+			ResourceID:     user.UID,
+			Description:    fmt.Sprintf("User %s provisioned as %s through SCIM", user.Email, user.Role),
+			Metadata: map[string]interface{}{
+				"source": "scim",
+			},
+			IPAddress: r.RemoteAddr,
+			UserAgent: r.UserAgent(),
+		}
+		s.recordAudit(ctx, auditLog)
+
+		// Users can be provisioned already deactivated
+		if attrs.Active != nil && !bool(*attrs.Active) {
+			if err := s.setUserActive(r, claims, user, false); err != nil {
+				respondSCIMError(w, s.internalSCIMError("failed to deactivate user", err))
+				return
+			}
+		}
+
+		s.respondSCIMUser(w, r, http.StatusCreated, user)
+	}
+}
+
+// handleSCIMReplaceUser updates a user from a full representation. Omitted
+// attributes are left unchanged.
+func (s *Server) handleSCIMReplaceUser() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, err := auth.GetUserClaims(r)
+		if err != nil {
+			respondError(w, http.StatusUnauthorized, "authentication required")
+			return
+		}
+
+		user, scimErr := s.scimUser(r.Context(), claims.OrganizationID, chi.URLParam(r, "userID"))
+		if scimErr != nil {
+			respondSCIMError(w, scimErr)
+			return
+		}
+
+		var attrs scimUserAttributes
+		if err := json.NewDecoder(r.Body).Decode(&attrs); err != nil {
+			respondSCIMError(w, &scimError{status: http.StatusBadRequest, scimType: "invalidSyntax", detail: "invalid request body"})
+			return
+		}
+
+		if scimErr := s.updateSCIMUser(r, claims, user, &attrs); scimErr != nil {
+			respondSCIMError(w, scimErr)
+			return
+		}
+
+		s.respondSCIMUser(w, r, http.StatusOK, user)
+	}
+}
+
+// handleSCIMPatchUser applies add and replace operations to active,
+// displayName and name. Other attributes are ignored.
+func (s *Server) handleSCIMPatchUser() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, err := auth.GetUserClaims(r)
+		if err != nil {
+			respondError(w, http.StatusUnauthorized, "authentication required")
+			return
+		}
+
+		user, scimErr := s.scimUser(r.Context(), claims.OrganizationID, chi.URLParam(r, "userID"))
+		if scimErr != nil {
+			respondSCIMError(w, scimErr)
+			return
+		}
+
+		var req scimPatchRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondSCIMError(w, &scimError{status: http.StatusBadRequest, scimType: "invalidSyntax", detail: "invalid request body"})
+			return
+		}
+
+		var attrs scimUserAttributes
+		for _, op := range req.Operations {
+			if scimErr := applySCIMUserOperation(&attrs, op); scimErr != nil {
+				respondSCIMError(w, scimErr)
+				return
+			}
+		}
+
+		if scimErr := s.updateSCIMUser(r, claims, user, &attrs); scimErr != nil {
+			respondSCIMError(w, scimErr)
+			return
+		}
+
+		s.respondSCIMUser(w, r, http.StatusOK, user)
+	}
+}
+
+// handleSCIMDeleteUser deletes a user the same way as handleDeleteUser
+func (s *Server) handleSCIMDeleteUser() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, err := auth.GetUserClaims(r)
+		if err != nil {
+			respondError(w, http.StatusUnauthorized, "authentication required")
+			return
+		}
+
+		user, scimErr := s.scimUser(r.Context(), claims.OrganizationID, chi.URLParam(r, "userID"))
+		if scimErr != nil {
+			respondSCIMError(w, scimErr)
+			return
+		}
+
+		// Prevent self-deletion
+		if user.UID == claims.UID {
+			respondSCIMError(w, &scimError{status: http.StatusBadRequest, detail: "cannot delete your own account"})
+			return
+		}
+
+		if err := s.deleteUser(r, claims, user); err != nil {
+			respondSCIMError(w, s.internalSCIMError("failed to delete user", err))
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// handleSCIMListGroups lists one group per built-in and custom role.
+// Supports the filters displayName eq and id eq, and excludedAttributes=members.
+func (s *Server) handleSCIMListGroups() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, err := auth.GetUserClaims(r)
+		if err != nil {
+			respondError(w, http.StatusUnauthorized, "authentication required")
+			return
+		}
+
+		attribute, value, scimErr := parseSCIMFilter(r.URL.Query().Get("filter"), "displayName", "id")
+		if scimErr != nil {
+			respondSCIMError(w, scimErr)
+			return
+		}
+
+		groups, err := s.scimGroups(r.Context(), claims.OrganizationID, !excludesMembers(r))
+		if err != nil {
+			respondSCIMError(w, s.internalSCIMError("failed to list groups", err))
+			return
+		}
+
+		var resources []scimGroup
+		for _, group := range groups {
+			switch attribute {
+			case "displayname":
+				if !strings.EqualFold(group.DisplayName, value) {
+					continue
+				}
+			case "id":
+				if group.ID != value {
+					continue
+				}
+			}
+			resources = append(resources, group)
+		}
+
+		start, end, startIndex, scimErr := scimPage(r, len(resources))
+		if scimErr != nil {
+			respondSCIMError(w, scimErr)
+			return
+		}
+
+		respondSCIM(w, http.StatusOK, scimListResponse{
+			Schemas:      []string{scimListSchema},
+			TotalResults: len(resources),
+			StartIndex:   startIndex,
+			ItemsPerPage: end - start,
+			Resources:    append([]scimGroup{}, resources[start:end]...),
+		})
+	}
+}
+
+// handleSCIMGetGroup returns one role's group
+func (s *Server) handleSCIMGetGroup() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, err := auth.GetUserClaims(r)
+		if err != nil {
+			respondError(w, http.StatusUnauthorized, "authentication required")
+			return
+		}
+
+		group, scimErr := s.scimGroup(r.Context(), claims.OrganizationID, chi.URLParam(r, "groupID"), !excludesMembers(r))
+		if scimErr != nil {
+			respondSCIMError(w, scimErr)
+			return
+		}
+
+		respondSCIM(w, http.StatusOK, group)
+	}
+}
+
+// handleSCIMReplaceGroup sets a group's members: listed users are given the
+// group's role and members that are not listed are given the fallback role
+func (s *Server) handleSCIMReplaceGroup() http.HandlerFunc {
+	type request struct {
+		Members []scimMultiValue `json:"members"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, err := auth.GetUserClaims(r)
+		if err != nil {
+			respondError(w, http.StatusUnauthorized, "authentication required")
+			return
+		}
+
+		group, scimErr := s.scimGroup(r.Context(), claims.OrganizationID, chi.URLParam(r, "groupID"), true)
+		if scimErr != nil {
+			respondSCIMError(w, scimErr)
+			return
+		}
+
+		var req request
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondSCIMError(w, &scimError{status: http.StatusBadRequest, scimType: "invalidSyntax", detail: "invalid request body"})
+			return
+		}
+
+		if scimErr := s.setSCIMGroupMembers(r, claims, group, memberIDs(req.Members)); scimErr != nil {
+			respondSCIMError(w, scimErr)
+			return
+		}
+
+		s.respondSCIMGroup(w, r, group.ID)
+	}
+}
+
+// handleSCIMPatchGroup adds, removes and replaces group members. Adding a
+// member gives them the group's role; removing one gives them the fallback
+// role. Changes to displayName are ignored.
+func (s *Server) handleSCIMPatchGroup() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, err := auth.GetUserClaims(r)
+		if err != nil {
+			respondError(w, http.StatusUnauthorized, "authentication required")
+			return
+		}
+
+		group, scimErr := s.scimGroup(r.Context(), claims.OrganizationID, chi.URLParam(r, "groupID"), true)
+		if scimErr != nil {
+			respondSCIMError(w, scimErr)
+			return
+		}
+
+		var req scimPatchRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondSCIMError(w, &scimError{status: http.StatusBadRequest, scimType: "invalidSyntax", detail: "invalid request body"})
+			return
+		}
+
+		members := memberIDs(group.Members)
+		for _, op := range req.Operations {
+			if members, scimErr = applySCIMGroupOperation(members, op); scimErr != nil {
+				respondSCIMError(w, scimErr)
+				return
+			}
+		}
+
+		if scimErr := s.setSCIMGroupMembers(r, claims, group, members); scimErr != nil {
+			respondSCIMError(w, scimErr)
+			return
+		}
+
+		s.respondSCIMGroup(w, r, group.ID)
+	}
+}
+
+// handleSCIMGroupNotSupported rejects creating and deleting groups, which
+// are managed as roles
+func (s *Server) handleSCIMGroupNotSupported() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		respondSCIMError(w, &scimError{status: http.StatusNotImplemented,
+			detail: "groups are the organization's roles; create and delete custom roles through /api/v1/roles"})
+	}
+}
+
+// updateSCIMUser applies changes to a user's name and active status. The
+// userName cannot be changed. Deactivation and reactivation go through
+// setUserActive, so they update Firebase claims, seats and the audit log.
+func (s *Server) updateSCIMUser(r *http.Request, claims *auth.UserClaims, user *models.User, attrs *scimUserAttributes) *scimError {
+	if attrs.UserName != nil && !strings.EqualFold(strings.TrimSpace(*attrs.UserName), user.Email) {
+		return &scimError{status: http.StatusBadRequest, scimType: "mutability", detail: "userName cannot be changed"}
+	}
+
+	if fullName := attrs.fullName(); fullName != "" && fullName != user.FullName {
+		oldName := user.FullName
+		user.FullName = fullName
+		if err := s.store.UpdateUser(r.Context(), user); err != nil {
+			return s.internalSCIMError("failed to update user", err)
+		}
+
+		// Create audit log
+		auditLog := &models.AuditLog{
+			OrganizationID: user.OrganizationID,
+			UserID:         claims.UID,
+			UserEmail:      claims.Email,
+			Action:         models.ActionUserUpdated,
+			ResourceType:   "user",
+			ResourceID:     user.UID,
+			Description:    fmt.Sprintf("Changed name of %s", user.Email),
+			Changes: map[string]interface{}{
+				"full_name": map[string]interface{}{
+					"from": oldName,
+					"to":   user.FullName,
+				},
+			},
+			IPAddress: r.RemoteAddr,
+			UserAgent: r.UserAgent(),
+		}
+		s.recordAudit(r.Context(), auditLog)
+	}
+
+	if attrs.Active == nil {
+		return nil
+	}
+	active := bool(*attrs.Active)
+	if !active && user.UID == claims.UID {
+		return &scimError{status: http.StatusBadRequest, detail: "cannot deactivate your own account"}
+	}
+	if err := s.setUserActive(r, claims, user, active); err != nil {
+		if errors.Is(err, store.ErrSeatLimitReached) {
+			return &scimError{status: http.StatusForbidden, detail: "user limit reached. Upgrade the plan to add more users"}
+		}
+		return s.internalSCIMError("failed to update user status", err)
+	}
+	return nil
+}
+
+// applySCIMUserOperation records one PATCH operation in attrs
+func applySCIMUserOperation(attrs *scimUserAttributes, op scimPatchOperation) *scimError {
+	switch strings.ToLower(op.Op) {
+	case "add", "replace":
+	case "remove":
+		// Nothing that can be set can be removed
+		return nil
+	default:
+		return &scimError{status: http.StatusBadRequest, scimType: "invalidSyntax", detail: fmt.Sprintf("unsupported op %q", op.Op)}
+	}
+
+	var target interface{}
+	switch strings.ToLower(op.Path) {
+	case "":
+		target = attrs
+	case "username":
+		target = &attrs.UserName
+	case "displayname":
+		target = &attrs.DisplayName
+	case "active":
+		target = &attrs.Active
+	case "name":
+		target = &attrs.Name
+	case "name.formatted", "name.givenname", "name.familyname":
+		if attrs.Name == nil {
+			attrs.Name = &scimName{}
+		}
+		switch strings.ToLower(op.Path) {
+		case "name.formatted":
+			target = &attrs.Name.Formatted
+		case "name.givenname":
+			target = &attrs.Name.GivenName
+		default:
+			target = &attrs.Name.FamilyName
+		}
+	default:
+		return nil
+	}
+
+	if err := json.Unmarshal(op.Value, target); err != nil {
+		return &scimError{status: http.StatusBadRequest, scimType: "invalidValue", detail: fmt.Sprintf("invalid value for %q", op.Path)}
+	}
+	return nil
+}
+
+// applySCIMGroupOperation applies one PATCH operation to a group's member IDs
+func applySCIMGroupOperation(members []string, op scimPatchOperation) ([]string, *scimError) {
+	path := strings.ToLower(strings.TrimSpace(op.Path))
+	invalidValue := &scimError{status: http.StatusBadRequest, scimType: "invalidValue", detail: "members must be a list of {\"value\": \"<user id>\"}"}
+
+	var values []scimMultiValue
+	switch {
+	case path == "members":
+		if len(op.Value) > 0 {
+			if err := json.Unmarshal(op.Value, &values); err != nil {
+				return nil, invalidValue
+			}
+		}
+	case path == "":
+		// A value object without a path, as in {"members": [...]}
+		var value struct {
+			Members *[]scimMultiValue `json:"members"`
+		}
+		if err := json.Unmarshal(op.Value, &value); err != nil {
+			return nil, invalidValue
+		}
+		if value.Members == nil {
+			return members, nil
+		}
+		values = *value.Members
+	case strings.HasPrefix(path, "members["):
+		// members[value eq "<user id>"] identifies one member to remove
+		inner := strings.TrimSuffix(strings.TrimPrefix(op.Path[len("members"):], "["), "]")
+		attribute, value, scimErr := parseSCIMFilter(inner, "value")
+		if scimErr != nil || attribute == "" || strings.ToLower(op.Op) != "remove" {
+			return nil, &scimError{status: http.StatusBadRequest, scimType: "invalidPath", detail: fmt.Sprintf("unsupported path %q", op.Path)}
+		}
+		values = []scimMultiValue{{Value: value}}
+	default:
+		// displayName and other attributes are not changed through SCIM
+		return members, nil
+	}
+
+	switch strings.ToLower(op.Op) {
+	case "add":
+		return append(members, memberIDs(values)...), nil
+	case "replace":
+		return memberIDs(values), nil
+	case "remove":
+		if path == "members" && len(values) == 0 {
+			return nil, nil
+		}
+		removed := make(map[string]bool)
+		for _, id := range memberIDs(values) {
+			removed[id] = true
+		}
+		var kept []string
+		for _, id := range members {
+			if !removed[id] {
+				kept = append(kept, id)
+			}
+		}
+		return kept, nil
+	default:
+		return nil, &scimError{status: http.StatusBadRequest, scimType: "invalidSyntax", detail: fmt.Sprintf("unsupported op %q", op.Op)}
+	}
+}
+
+// setSCIMGroupMembers gives the group's role to each listed user and the
+// fallback role to current members that are not listed
+func (s *Server) setSCIMGroupMembers(r *http.Request, claims *auth.UserClaims, group *scimGroup, members []string) *scimError {
+	ctx := r.Context()
+	role := models.UserRole(group.ID)
+
+	listed := make(map[string]bool)
+	var added []*models.User
+	for _, id := range members {
+		if listed[id] {
+			continue
+		}
+		listed[id] = true
+
+		user, scimErr := s.scimUser(ctx, claims.OrganizationID, id)
+		if scimErr != nil {
+			return &scimError{status: http.StatusBadRequest, scimType: "invalidValue", detail: fmt.Sprintf("user %q not found", id)}
+		}
+		if user.Role != role {
+			added = append(added, user)
+		}
+	}
+
+	for _, user := range added {
+		if err := s.changeUserRole(r, claims, user, role); err != nil {
+			return s.internalSCIMError("failed to update user role", err)
+		}
+	}
+
+	fallback := s.scimFallbackRole(ctx, claims.OrganizationID, role)
+	for _, member := range group.Members {
+		if listed[member.Value] || fallback == role {
+			continue
+		}
+		user, scimErr := s.scimUser(ctx, claims.OrganizationID, member.Value)
+		if scimErr != nil {
+			continue
+		}
+		if err := s.changeUserRole(r, claims, user, fallback); err != nil {
+			return s.internalSCIMError("failed to update user role", err)
+		}
+	}
+	return nil
+}
+
+// scimFallbackRole is the role given to users removed from the group for
+// role: the SSO default role, or viewer. Removing a user from the group for
+// the fallback role itself leaves their role unchanged.
+func (s *Server) scimFallbackRole(ctx context.Context, orgID string, role models.UserRole) models.UserRole {
+	if config, err := s.store.GetSSOConfig(ctx, orgID); err == nil && config != nil &&
+		config.DefaultRole != role && s.isAssignableRole(ctx, orgID, config.DefaultRole) {
+		return config.DefaultRole
+	}
+	return models.RoleViewer
+}
+
+// scimUser returns a user of the organization. Deleted users are not found.
+func (s *Server) scimUser(ctx context.Context, orgID, uid string) (*models.User, *scimError) {
+	user, err := s.store.GetUser(ctx, uid)
+	if err != nil || user.OrganizationID != orgID || user.Status == "deleted" {
+		return nil, &scimError{status: http.StatusNotFound, detail: "user not found"}
+	}
+	return user, nil
+}
+
+// scimUsers returns the organization's users that are not deleted
+func (s *Server) scimUsers(ctx context.Context, orgID string) ([]*models.User, error) {
+	var users []*models.User
+	opts := store.ListOptions{PageSize: store.MaxPageSize}
+	for {
+		page, next, err := s.store.ListUsersByOrganization(ctx, orgID, opts)
+		if err != nil {
+			return nil, err
+		}
+		for _, user := range page {
+			if user.Status != "deleted" {
+				users = append(users, user)
+			}
+		}
+		if next == "" {
+			return users, nil
+		}
+		opts.PageToken = next
+	}
+}
+
+// scimGroupNames returns the display name of every role's group
+func (s *Server) scimGroupNames(ctx context.Context, orgID string) (map[models.UserRole]string, error) {
+	groups, err := s.scimGroups(ctx, orgID, false)
+	if err != nil {
+		return nil, err
+	}
+	names := make(map[models.UserRole]string, len(groups))
+	for _, group := range groups {
+		names[models.UserRole(group.ID)] = group.DisplayName
+	}
+	return names, nil
+}
+
+// scimGroups returns a group for each built-in role, then each custom role.
+// Members are included when withMembers is set.
+func (s *Server) scimGroups(ctx context.Context, orgID string, withMembers bool) ([]scimGroup, error) {
+	groups := make([]scimGroup, 0, len(builtInGroupNames))
+	for _, role := range []models.UserRole{models.RoleAdmin, models.RoleComplianceOfficer, models.RoleViewer} {
+		groups = append(groups, s.scimGroupResource(role, builtInGroupNames[role], nil, nil))
+	}
+
+	opts := store.ListOptions{PageSize: store.MaxPageSize}
+	for {
+		roles, next, err := s.store.ListRoles(ctx, orgID, opts)
+		if err != nil {
+			return nil, err
+		}
+		for _, role := range roles {
+			created, updated := role.CreatedAt, role.UpdatedAt
+			groups = append(groups, s.scimGroupResource(role.UserRole(), role.Name, &created, &updated))
+		}
+		if next == "" {
+			break
+		}
+		opts.PageToken = next
+	}
+
+	if !withMembers {
+		return groups, nil
+	}
+
+	users, err := s.scimUsers(ctx, orgID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range groups {
+		for _, user := range users {
+			if string(user.Role) == groups[i].ID {
+				groups[i].Members = append(groups[i].Members, scimMultiValue{
+					Value:   user.UID,
+					Display: user.Email,
+					Ref:     s.scimLocation("Users", user.UID),
+				})
+			}
+		}
+	}
+	return groups, nil
+}
+
+// scimGroup returns one group by ID, which is the role it grants
+func (s *Server) scimGroup(ctx context.Context, orgID, groupID string, withMembers bool) (*scimGroup, *scimError) {
+	if unescaped, err := url.PathUnescape(groupID); err == nil {
+		groupID = unescaped
+	}
+
+	groups, err := s.scimGroups(ctx, orgID, withMembers)
+	if err != nil {
+		return nil, s.internalSCIMError("failed to get group", err)
+	}
+	for i := range groups {
+		if groups[i].ID == groupID {
+			return &groups[i], nil
+		}
+	}
+	return nil, &scimError{status: http.StatusNotFound, detail: "group not found"}
+}
+
+func (s *Server) scimGroupResource(role models.UserRole, displayName string, created, updated *time.Time) scimGroup {
+	return scimGroup{
+		Schemas:     []string{scimGroupSchema},
+		ID:          string(role),
+		DisplayName: displayName,
+		Meta: scimMeta{
+			ResourceType: "Group",
+			Created:      created,
+			LastModified: updated,
+			Location:     s.scimLocation("Groups", string(role)),
+		},
+	}
+}
+
+func (s *Server) scimUserResource(user *models.User, groupNames map[models.UserRole]string) scimUser {
+	created, updated := user.CreatedAt, user.UpdatedAt
+	resource := scimUser{
+		Schemas:     []string{scimUserSchema},
+		ID:          user.UID,
+		UserName:    user.Email,
+		DisplayName: user.FullName,
+		Emails:      []scimMultiValue{{Value: user.Email, Type: "work", Primary: true}},
+		Active:      user.Status == "active",
+		Groups: []scimMultiValue{{
+			Value:   string(user.Role),
+			Display: groupNames[user.Role],
+			Ref:     s.scimLocation("Groups", string(user.Role)),
+		}},
+		Meta: scimMeta{
+			ResourceType: "User",
+			Created:      &created,
+			LastModified: &updated,
+			Location:     s.scimLocation("Users", user.UID),
+		},
+	}
+	if user.FullName != "" {
+		resource.Name = &scimName{Formatted: user.FullName}
+	}
+	return resource
+}
+
+// respondSCIMUser writes user's representation, with a Location header
+func (s *Server) respondSCIMUser(w http.ResponseWriter, r *http.Request, status int, user *models.User) {
+	groupNames, err := s.scimGroupNames(r.Context(), user.OrganizationID)
+	if err != nil {
+		respondSCIMError(w, s.internalSCIMError("failed to list roles", err))
+		return
+	}
+
+	resource := s.scimUserResource(user, groupNames)
+	w.Header().Set("Location", resource.Meta.Location)
+	respondSCIM(w, status, resource)
+}
+
+// respondSCIMGroup writes the current representation of a group
+func (s *Server) respondSCIMGroup(w http.ResponseWriter, r *http.Request, groupID string) {
+	claims, _ := auth.GetUserClaims(r)
+	group, scimErr := s.scimGroup(r.Context(), claims.OrganizationID, groupID, true)
+	if scimErr != nil {
+		respondSCIMError(w, scimErr)
+		return
+	}
+	respondSCIM(w, http.StatusOK, group)
+}
+
+// scimLocation is the absolute URL of a SCIM resource
+func (s *Server) scimLocation(parts ...string) string {
+	location := strings.TrimSuffix(s.config.PublicURL, "/") + scimBasePath
+	for _, part := range parts {
+		location += "/" + url.PathEscape(part)
+	}
+	return location
+}
+
+// parseSCIMFilter parses a filter of the form attribute eq "value" and
+// returns the attribute, lowercased, and the value. attributes lists the
+// attributes that can be filtered on. An empty filter matches everything.
+func parseSCIMFilter(filter string, attributes ...string) (string, string, *scimError) {
+	if strings.TrimSpace(filter) == "" {
+		return "", "", nil
+	}
+
+	match := scimFilterPattern.FindStringSubmatch(filter)
+	if match != nil {
+		for _, attribute := range attributes {
+			if strings.EqualFold(match[1], attribute) {
+				value, err := strconv.Unquote(`"` + match[2] + `"`)
+				if err != nil {
+					break
+				}
+				return strings.ToLower(attribute), value, nil
+			}
+		}
+	}
+	return "", "", &scimError{status: http.StatusBadRequest, scimType: "invalidFilter",
+		detail: fmt.Sprintf("filter must be %s eq \"<value>\"", strings.Join(attributes, " or "))}
+}
+
+// scimPage reads startIndex and count and returns the bounds of the
+// requested page within total results, and the start index
+func scimPage(r *http.Request, total int) (int, int, int, *scimError) {
+	startIndex, count := 1, scimDefaultCount
+	if v := r.URL.Query().Get("startIndex"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return 0, 0, 0, &scimError{status: http.StatusBadRequest, scimType: "invalidValue", detail: "startIndex must be an integer"}
+		}
+		if n > 1 {
+			startIndex = n
+		}
+	}
+	if v := r.URL.Query().Get("count"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return 0, 0, 0, &scimError{status: http.StatusBadRequest, scimType: "invalidValue", detail: "count must be an integer"}
+		}
+		count = n
+		if count < 0 {
+			count = 0
+		}
+		if count > store.MaxPageSize {
+			count = store.MaxPageSize
+		}
+	}
+
+	start := startIndex - 1
+	if start > total {
+		start = total
+	}
+	end := start + count
+	if end > total {
+		end = total
+	}
+	return start, end, startIndex, nil
+}
+
+// excludesMembers reports whether the request asks for groups without members
+func excludesMembers(r *http.Request) bool {
+	for _, attribute := range strings.Split(r.URL.Query().Get("excludedAttributes"), ",") {
+		if strings.EqualFold(strings.TrimSpace(attribute), "members") {
+			return true
+		}
+	}
+	return false
+}
+
+func memberIDs(values []scimMultiValue) []string {
+	ids := make([]string, 0, len(values))
+	for _, value := range values {
+		ids = append(ids, value.Value)
+	}
+	return ids
+}
@@ -2,15 +2,25 @@ package api
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/subtle"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
+	"net"
 	"net/http"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 
 	"cloud.google.com/go/storage"
 	"compliancesync-api/internal/auth"
+	"compliancesync-api/internal/models"
+	"compliancesync-api/internal/scan"
+	"compliancesync-api/internal/search"
+	"compliancesync-api/internal/sso"
 	"compliancesync-api/internal/store"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
@@ -20,9 +30,15 @@ import (
 // Server represents the API server
 type Server struct {
 	router        *chi.Mux
-	store         *store.FirestoreStore
+	store         store.Store
 	authMiddleware *auth.AuthMiddleware
 	storageClient *storage.Client
+	objects       objectStore
+	search        *search.Index
+	scanner       scan.Scanner // nil when malware scanning is disabled
+	sso           *sso.Client
+	stateSigner   *sso.StateSigner
+	lookupTXT     func(ctx context.Context, name string) ([]string, error)
 	logger        *slog.Logger
 	config        *Config
 }
@@ -36,26 +52,47 @@ type Config struct {
 	StripeSecretKey     string
 	SendGridAPIKey      string
 	Environment         string
+	StoreBackend        string // firestore, sqlite, postgres or memory
+	DatabaseURL         string // SQLite path/URI or Postgres URL for the SQL backends
+	AuthProvider        string // firebase or jwt
+	JWTJWKSFile         string // JWKS file with RS256/ES256 keys for the jwt provider
+	JWTHS256Secret      string // Shared HS256 secret for the jwt provider
+	JWTIssuer           string // Required iss claim for the jwt provider, if set
+	JWTAudience         string // Required aud claim for the jwt provider, if set
+	PublicURL           string // Externally visible base URL, used in SSO redirect and SAML URLs
+	SSOStateSecret      string // HMAC secret for SSO sign-in state; shared by all instances
+	SSORedirectOrigins  string // Comma-separated origins SSO sign-in may return the browser to
+	DomainVerification  string // dns, or skip to verify SSO domains without DNS (development only)
+	SearchIndexPath     string // Directory of the local evidence search index; empty keeps it in memory
+	MalwareScanner      string // clamav, fake (tests and local development) or none
+	ClamAVAddress       string // clamd socket: unix:///path, tcp://host:port or host:port
+	WorkerSecret        string // Shared secret schedulers send in the X-Worker-Secret header
 }
 
-// NewServer creates a new API server
-func NewServer(ctx context.Context, config *Config) (*Server, error) {
+// WorkerSecretHeader carries Config.WorkerSecret on requests to protected
+// worker endpoints
+const WorkerSecretHeader = "X-Worker-Secret"
+
+// NewServer creates a new API server backed by the given store
+func NewServer(ctx context.Context, config *Config, st store.Store) (*Server, error) {
 	// Initialize logger
 	logger := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{
 		Level: slog.LevelInfo,
 	}))
 
-	// Initialize Firestore store
-	firestoreStore, err := store.NewFirestoreStore(ctx, config.ProjectID)
-	if err != nil {
-		return nil, fmt.Errorf("failed to initialize firestore store: %w", err)
-	}
-
 	// Initialize authentication middleware
-	authMW, err := auth.NewAuthMiddleware(ctx, config.ProjectID, config.FirebaseCredentials)
+	authenticator, err := auth.Open(ctx, config.AuthProvider, auth.Options{
+		ProjectID:       config.ProjectID,
+		CredentialsFile: config.FirebaseCredentials,
+		JWKSFile:        config.JWTJWKSFile,
+		HS256Secret:     config.JWTHS256Secret,
+		Issuer:          config.JWTIssuer,
+		Audience:        config.JWTAudience,
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to initialize auth middleware: %w", err)
+		return nil, fmt.Errorf("failed to initialize %s authenticator: %w", config.AuthProvider, err)
 	}
+	authMW := auth.NewAuthMiddleware(authenticator, st)
 
 	// Initialize Cloud Storage client
 	storageClient, err := storage.NewClient(ctx)
@@ -63,10 +100,51 @@ func NewServer(ctx context.Context, config *Config) (*Server, error) {
 		return nil, fmt.Errorf("failed to initialize storage client: %w", err)
 	}
 
+	// Initialize single sign-on. Without a configured secret, sign-ins in
+	// progress fail after a restart or on another instance.
+	stateSecret := []byte(config.SSOStateSecret)
+	if len(stateSecret) == 0 {
+		logger.Warn("SSO_STATE_SECRET is not set; using a random secret for this instance")
+		stateSecret = make([]byte, 32)
+		if _, err := rand.Read(stateSecret); err != nil {
+			return nil, fmt.Errorf("failed to generate SSO state secret: %w", err)
+		}
+	}
+
+	// Open the evidence search index. An in-memory index is empty after a
+	// restart until the organization's evidence is reindexed.
+	if config.SearchIndexPath == "" {
+		logger.Warn("SEARCH_INDEX_PATH is not set; keeping the evidence search index in memory")
+	}
+	searchIndex, err := search.Open(config.SearchIndexPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open search index: %w", err)
+	}
+
+	// Initialize malware scanning of uploaded evidence
+	scanner, err := scan.Open(config.MalwareScanner, config.ClamAVAddress)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize malware scanner: %w", err)
+	}
+	if scanner == nil {
+		logger.Warn("MALWARE_SCANNER is none; uploaded evidence is not scanned")
+	}
+	if clamav, ok := scanner.(*scan.ClamAV); ok {
+		if err := clamav.Ping(ctx); err != nil {
+			logger.Warn("clamd is not reachable; uploads fail until it is", "error", err)
+		}
+	}
+
 	server := &Server{
-		store:          firestoreStore,
+		store:          st,
 		authMiddleware: authMW,
 		storageClient:  storageClient,
+		objects:        &gcsObjectStore{client: storageClient, bucket: config.StorageBucket},
+		search:         searchIndex,
+		scanner:        scanner,
+		sso:            sso.NewClient(nil, st),
+		stateSigner:    sso.NewStateSigner(stateSecret),
+		lookupTXT:      net.DefaultResolver.LookupTXT,
 		logger:         logger,
 		config:         config,
 	}
@@ -92,8 +170,8 @@ func (s *Server) setupRoutes() *chi.Mux {
 	r.Use(cors.Handler(cors.Options{
 		AllowedOrigins:   []string{"https://*", "http://*"},
 		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS", "PATCH"},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
-		ExposedHeaders:   []string{"Link"},
+		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token", "If-Match", auth.OrganizationHeader},
+		ExposedHeaders:   []string{"Link", "ETag"},
 		AllowCredentials: true,
 		MaxAge:           300,
 	}))
@@ -107,16 +185,55 @@ func (s *Server) setupRoutes() *chi.Mux {
 		r.Route("/auth", func(r chi.Router) {
 			r.Post("/register", s.handleRegister())
 			r.Post("/password-reset", s.handlePasswordReset())
+			r.Post("/accept-invitation", s.handleAcceptInvitation())
+
+			// Single sign-on
+			r.Post("/sso/discover", s.handleSSODiscover())
+			r.Route("/sso/{orgID}", func(r chi.Router) {
+				r.Get("/login", s.handleSSOLogin())
+				r.Get("/oidc/callback", s.handleOIDCCallback())
+				r.Post("/saml/acs", s.handleSAMLACS())
+				r.Get("/saml/metadata", s.handleSAMLMetadata())
+			})
+
+			// Sessions (require an identity provider or session token)
+			r.Group(func(r chi.Router) {
+				r.Use(s.authMiddleware.Authenticate)
+				r.Use(s.authMiddleware.RequireUser)
+				r.Use(s.authMiddleware.RequireOrganization)
+				r.Post("/login", s.handleLogin())
+				r.Post("/logout", s.handleLogout())
+			})
 		})
 
-		// Protected routes (require authentication)
+		// Protected routes (require authentication). Every route below
+		// the profile and the auditor portal requires a permission from
+		// the registry in models/permission.go.
 		r.Group(func(r chi.Router) {
 			r.Use(s.authMiddleware.Authenticate)
 
 			// User profile
 			r.Route("/profile", func(r chi.Router) {
+				r.Use(s.authMiddleware.RequireUser)
 				r.Get("/", s.handleGetProfile())
 				r.Put("/", s.handleUpdateProfile())
+				r.Get("/sessions", s.handleListProfileSessions())
+				r.Get("/organizations", s.handleListProfileOrganizations())
+				r.Post("/organizations", s.handleJoinOrganization())
+				r.Delete("/organizations/{orgID}", s.handleLeaveOrganization())
+			})
+
+			// Auditor portal (read-only, auditor access tokens only)
+			r.Route("/auditor", func(r chi.Router) {
+				r.Use(s.authMiddleware.RequireAuditor)
+				r.Get("/grant", s.handleGetAuditorGrantInfo())
+				r.Get("/requirements", s.handleAuditorListRequirements())
+				r.Get("/requirements/{requirementID}", s.handleAuditorGetRequirement())
+				r.Get("/requirements/{requirementID}/evidence", s.handleAuditorListEvidence())
+				r.Get("/evidence/{evidenceID}", s.handleAuditorGetEvidence())
+				r.Get("/evidence/{evidenceID}/download-url", s.handleAuditorEvidenceDownloadURL())
+				r.Get("/reports", s.handleAuditorListReports())
+				r.Get("/reports/{reportID}/download-url", s.handleAuditorReportDownloadURL())
 			})
 
 			// Organization routes (require organization membership)
@@ -125,67 +242,146 @@ func (s *Server) setupRoutes() *chi.Mux {
 
 				// Organization management
 				r.Route("/organization", func(r chi.Router) {
-					r.Get("/", s.handleGetOrganization())
-					r.Put("/", s.requireAdmin(s.handleUpdateOrganization()))
-					r.Get("/dashboard", s.handleGetDashboard())
+					r.Get("/", s.requirePermission(models.PermissionViewOrganization, s.handleGetOrganization()))
+					r.Put("/", s.requirePermission(models.PermissionManageOrganization, s.handleUpdateOrganization()))
+					r.Get("/dashboard", s.requirePermission(models.PermissionViewDashboard, s.handleGetDashboard()))
+				})
+
+				// Partner portfolio
+				r.Route("/partner", func(r chi.Router) {
+					r.Get("/dashboard", s.requirePermission(models.PermissionViewPortfolio, s.handleGetPortfolioDashboard()))
+					r.Get("/clients", s.requirePermission(models.PermissionViewPortfolio, s.handleListClients()))
+					r.Post("/clients", s.requirePermission(models.PermissionManageClients, s.handleCreateClient()))
+					r.Get("/baseline", s.requirePermission(models.PermissionViewPortfolio, s.handleGetBaseline()))
+					r.Put("/baseline", s.requirePermission(models.PermissionManageClients, s.handleUpdateBaseline()))
 				})
 
 				// User management
 				r.Route("/users", func(r chi.Router) {
-					r.Get("/", s.handleListUsers())
-					r.Post("/invite", s.requireAdmin(s.handleInviteUser()))
-					r.Put("/{userID}/role", s.requireAdmin(s.handleUpdateUserRole()))
-					r.Delete("/{userID}", s.requireAdmin(s.handleDeleteUser()))
+					r.Get("/", s.requirePermission(models.PermissionViewUsers, s.handleListUsers()))
+					r.Post("/invite", s.requirePermission(models.PermissionManageUsers, s.handleInviteUser()))
+					r.Get("/invitations", s.requirePermission(models.PermissionManageUsers, s.handleListInvitations()))
+					r.Post("/invitations/{invitationID}/resend", s.requirePermission(models.PermissionManageUsers, s.handleResendInvitation()))
+					r.Delete("/invitations/{invitationID}", s.requirePermission(models.PermissionManageUsers, s.handleRevokeInvitation()))
+					r.Get("/memberships", s.requirePermission(models.PermissionViewUsers, s.handleListMemberships()))
+					r.Put("/memberships/{userID}/role", s.requirePermission(models.PermissionManageUsers, s.handleUpdateMembershipRole()))
+					r.Delete("/memberships/{userID}", s.requirePermission(models.PermissionManageUsers, s.handleRemoveMembership()))
+					r.Put("/{userID}/role", s.requirePermission(models.PermissionManageUsers, s.handleUpdateUserRole()))
+					r.Put("/{userID}/status", s.requirePermission(models.PermissionManageUsers, s.handleUpdateUserStatus()))
+					r.Get("/{userID}/sessions", s.requirePermission(models.PermissionManageUsers, s.handleListUserSessions()))
+					r.Delete("/{userID}", s.requirePermission(models.PermissionManageUsers, s.handleDeleteUser()))
+				})
+
+				// Custom roles
+				r.Route("/roles", func(r chi.Router) {
+					r.Get("/", s.requirePermission(models.PermissionViewUsers, s.handleListRoles()))
+					r.Post("/", s.requirePermission(models.PermissionManageRoles, s.handleCreateRole()))
+					r.Get("/{roleID}", s.requirePermission(models.PermissionViewUsers, s.handleGetRole()))
+					r.Put("/{roleID}", s.requirePermission(models.PermissionManageRoles, s.handleUpdateRole()))
+					r.Delete("/{roleID}", s.requirePermission(models.PermissionManageRoles, s.handleDeleteRole()))
+				})
+
+				// API keys
+				r.Route("/api-keys", func(r chi.Router) {
+					r.Get("/", s.requirePermission(models.PermissionManageAPIKeys, s.handleListAPIKeys()))
+					r.Post("/", s.requirePermission(models.PermissionManageAPIKeys, s.handleCreateAPIKey()))
+					r.Delete("/{keyID}", s.requirePermission(models.PermissionManageAPIKeys, s.handleRevokeAPIKey()))
+				})
+
+				// External auditor access
+				r.Route("/auditor-grants", func(r chi.Router) {
+					r.Get("/", s.requirePermission(models.PermissionManageAuditorAccess, s.handleListAuditorGrants()))
+					r.Post("/", s.requirePermission(models.PermissionManageAuditorAccess, s.handleCreateAuditorGrant()))
+					r.Delete("/{grantID}", s.requirePermission(models.PermissionManageAuditorAccess, s.handleRevokeAuditorGrant()))
+				})
+
+				// Single sign-on configuration
+				r.Route("/sso", func(r chi.Router) {
+					r.Get("/", s.requirePermission(models.PermissionManageSSO, s.handleGetSSOConfig()))
+					r.Put("/", s.requirePermission(models.PermissionManageSSO, s.handleUpdateSSOConfig()))
+					r.Get("/domains", s.requirePermission(models.PermissionManageSSO, s.handleListDomains()))
+					r.Post("/domains", s.requirePermission(models.PermissionManageSSO, s.handleCreateDomain()))
+					r.Post("/domains/{domainID}/verify", s.requirePermission(models.PermissionManageSSO, s.handleVerifyDomain()))
+					r.Delete("/domains/{domainID}", s.requirePermission(models.PermissionManageSSO, s.handleDeleteDomain()))
+				})
+
+				// SCIM 2.0 provisioning
+				r.Route("/scim/v2", func(r chi.Router) {
+					r.Get("/ServiceProviderConfig", s.requirePermission(models.PermissionProvisionUsers, s.handleSCIMServiceProviderConfig()))
+					r.Get("/ResourceTypes", s.requirePermission(models.PermissionProvisionUsers, s.handleSCIMResourceTypes()))
+					r.Get("/Users", s.requirePermission(models.PermissionProvisionUsers, s.handleSCIMListUsers()))
+					r.Post("/Users", s.requirePermission(models.PermissionProvisionUsers, s.handleSCIMCreateUser()))
+					r.Get("/Users/{userID}", s.requirePermission(models.PermissionProvisionUsers, s.handleSCIMGetUser()))
+					r.Put("/Users/{userID}", s.requirePermission(models.PermissionProvisionUsers, s.handleSCIMReplaceUser()))
+					r.Patch("/Users/{userID}", s.requirePermission(models.PermissionProvisionUsers, s.handleSCIMPatchUser()))
+					r.Delete("/Users/{userID}", s.requirePermission(models.PermissionProvisionUsers, s.handleSCIMDeleteUser()))
+					r.Get("/Groups", s.requirePermission(models.PermissionProvisionUsers, s.handleSCIMListGroups()))
+					r.Post("/Groups", s.requirePermission(models.PermissionProvisionUsers, s.handleSCIMGroupNotSupported()))
+					r.Get("/Groups/{groupID}", s.requirePermission(models.PermissionProvisionUsers, s.handleSCIMGetGroup()))
+					r.Put("/Groups/{groupID}", s.requirePermission(models.PermissionProvisionUsers, s.handleSCIMReplaceGroup()))
+					r.Patch("/Groups/{groupID}", s.requirePermission(models.PermissionProvisionUsers, s.handleSCIMPatchGroup()))
+					r.Delete("/Groups/{groupID}", s.requirePermission(models.PermissionProvisionUsers, s.handleSCIMGroupNotSupported()))
 				})
 
 				// Regulatory requirements
 				r.Route("/requirements", func(r chi.Router) {
-					r.Get("/", s.handleListRequirements())
-					r.Post("/", s.requireWrite(s.handleCreateRequirement()))
-					r.Get("/templates", s.handleListRequirementTemplates())
-					r.Get("/{requirementID}", s.handleGetRequirement())
-					r.Put("/{requirementID}", s.requireWrite(s.handleUpdateRequirement()))
-					r.Delete("/{requirementID}", s.requireWrite(s.handleDeactivateRequirement()))
+					r.Get("/", s.requirePermission(models.PermissionViewRequirements, s.handleListRequirements()))
+					r.Post("/", s.requirePermission(models.PermissionManageRequirements, s.handleCreateRequirement()))
+					r.Get("/templates", s.requirePermission(models.PermissionViewRequirements, s.handleListRequirementTemplates()))
+					r.Post("/reconcile-counts", s.requirePermission(models.PermissionReconcileEvidenceCounts, s.handleReconcileEvidenceCounts()))
+					r.Get("/{requirementID}", s.requirePermission(models.PermissionViewRequirements, s.handleGetRequirement()))
+					r.Put("/{requirementID}", s.requirePermission(models.PermissionManageRequirements, s.handleUpdateRequirement()))
+					r.Delete("/{requirementID}", s.requirePermission(models.PermissionManageRequirements, s.handleDeactivateRequirement()))
 				})
 
 				// Evidence management
 				r.Route("/evidence", func(r chi.Router) {
-					r.Get("/", s.handleListEvidence())
-					r.Post("/upload-url", s.requireWrite(s.handleGenerateUploadURL()))
-					r.Post("/", s.requireWrite(s.handleCreateEvidence()))
-					r.Get("/{evidenceID}", s.handleGetEvidence())
-					r.Put("/{evidenceID}", s.requireWrite(s.handleUpdateEvidence()))
-					r.Delete("/{evidenceID}", s.requireWrite(s.handleDeleteEvidence()))
-					r.Get("/{evidenceID}/download-url", s.handleGenerateDownloadURL())
+					r.Get("/", s.requirePermission(models.PermissionViewEvidence, s.handleListEvidence()))
+					r.Post("/upload-url", s.requirePermission(models.PermissionManageEvidence, s.handleGenerateUploadURL()))
+					r.Post("/", s.requirePermission(models.PermissionManageEvidence, s.handleCreateEvidence()))
+					r.Get("/search", s.requirePermission(models.PermissionViewEvidence, s.handleSearchEvidence()))
+					r.Post("/search/reindex", s.requirePermission(models.PermissionManageEvidence, s.handleReindexEvidence()))
+					r.Get("/duplicates", s.requirePermission(models.PermissionViewEvidence, s.handleListDuplicateEvidence()))
+					r.Post("/duplicates/merge", s.requirePermission(models.PermissionManageEvidence, s.handleMergeDuplicateEvidence()))
+					r.Get("/{evidenceID}", s.requirePermission(models.PermissionViewEvidence, s.handleGetEvidence()))
+					r.Put("/{evidenceID}", s.requirePermission(models.PermissionManageEvidence, s.handleUpdateEvidence()))
+					r.Delete("/{evidenceID}", s.requirePermission(models.PermissionManageEvidence, s.handleDeleteEvidence()))
+					r.Get("/{evidenceID}/download-url", s.requirePermission(models.PermissionViewEvidence, s.handleGenerateDownloadURL()))
+					r.Post("/{evidenceID}/scan", s.requirePermission(models.PermissionManageEvidence, s.handleScanEvidence()))
+					r.Get("/{evidenceID}/versions", s.requirePermission(models.PermissionViewEvidence, s.handleListEvidenceVersions()))
+					r.Post("/{evidenceID}/versions/upload-url", s.requirePermission(models.PermissionManageEvidence, s.handleGenerateVersionUploadURL()))
+					r.Post("/{evidenceID}/versions", s.requirePermission(models.PermissionManageEvidence, s.handleCreateEvidenceVersion()))
+					r.Get("/{evidenceID}/versions/{number}/download-url", s.requirePermission(models.PermissionViewEvidence, s.handleGenerateVersionDownloadURL()))
 				})
 
 				// Audit logs
 				r.Route("/audit-logs", func(r chi.Router) {
-					r.Get("/", s.handleListAuditLogs())
-					r.Get("/export", s.handleExportAuditLogs())
+					r.Get("/", s.requirePermission(models.PermissionViewAuditLog, s.handleListAuditLogs()))
+					r.Get("/export", s.requirePermission(models.PermissionViewAuditLog, s.handleExportAuditLogs()))
+					r.Get("/verify", s.requirePermission(models.PermissionVerifyAuditLog, s.handleVerifyAuditLogs()))
 				})
 
 				// Reports
 				r.Route("/reports", func(r chi.Router) {
-					r.Get("/", s.handleListReports())
-					r.Post("/", s.handleGenerateReport())
-					r.Get("/{reportID}", s.handleGetReport())
-					r.Get("/{reportID}/download-url", s.handleGetReportDownloadURL())
+					r.Get("/", s.requirePermission(models.PermissionViewReports, s.handleListReports()))
+					r.Post("/", s.requirePermission(models.PermissionGenerateReports, s.handleGenerateReport()))
+					r.Get("/{reportID}", s.requirePermission(models.PermissionViewReports, s.handleGetReport()))
+					r.Get("/{reportID}/download-url", s.requirePermission(models.PermissionViewReports, s.handleGetReportDownloadURL()))
 				})
 
 				// Integrations
 				r.Route("/integrations", func(r chi.Router) {
-					r.Get("/", s.handleListIntegrations())
-					r.Post("/google/connect", s.requireAdmin(s.handleConnectGoogle()))
-					r.Delete("/google/disconnect", s.requireAdmin(s.handleDisconnectGoogle()))
+					r.Get("/", s.requirePermission(models.PermissionViewOrganization, s.handleListIntegrations()))
+					r.Post("/google/connect", s.requirePermission(models.PermissionManageIntegrations, s.handleConnectGoogle()))
+					r.Delete("/google/disconnect", s.requirePermission(models.PermissionManageIntegrations, s.handleDisconnectGoogle()))
 				})
 
 				// Subscription management
 				r.Route("/subscription", func(r chi.Router) {
-					r.Get("/", s.handleGetSubscription())
-					r.Post("/", s.requireAdmin(s.handleCreateSubscription()))
-					r.Put("/", s.requireAdmin(s.handleUpdateSubscription()))
-					r.Post("/cancel", s.requireAdmin(s.handleCancelSubscription()))
+					r.Get("/", s.requirePermission(models.PermissionViewOrganization, s.handleGetSubscription()))
+					r.Post("/", s.requirePermission(models.PermissionManageBilling, s.handleCreateSubscription()))
+					r.Put("/", s.requirePermission(models.PermissionManageBilling, s.handleUpdateSubscription()))
+					r.Post("/cancel", s.requirePermission(models.PermissionManageBilling, s.handleCancelSubscription()))
 				})
 			})
 		})
@@ -196,6 +392,7 @@ func (s *Server) setupRoutes() *chi.Mux {
 		// Pub/Sub endpoints (protected by Cloud Run service-to-service auth in production)
 		r.Post("/workers/gmail-poll", s.handleGmailPoll())
 		r.Post("/workers/pdf-generate", s.handlePDFGenerate())
+		r.Post("/workers/reconcile-evidence-counts", s.requireWorkerSecret(s.handleReconcileEvidenceCountsWorker()))
 	})
 
 	return r
@@ -221,9 +418,9 @@ func (s *Server) Start() error {
 func (s *Server) Shutdown(ctx context.Context) error {
 	s.logger.Info("shutting down server")
 
-	// Close Firestore connection
+	// Close store connection
 	if err := s.store.Close(); err != nil {
-		s.logger.Error("failed to close firestore", "error", err)
+		s.logger.Error("failed to close store", "error", err)
 	}
 
 	// Close storage client
@@ -231,6 +428,11 @@ func (s *Server) Shutdown(ctx context.Context) error {
 		s.logger.Error("failed to close storage client", "error", err)
 	}
 
+	// Close search index
+	if err := s.search.Close(); err != nil {
+		s.logger.Error("failed to close search index", "error", err)
+	}
+
 	return nil
 }
 
@@ -246,42 +448,124 @@ func (s *Server) handleHealth() http.HandlerFunc {
 
 // Middleware helpers
 
-// requireAdmin is a middleware that requires admin role
-func (s *Server) requireAdmin(next http.HandlerFunc) http.HandlerFunc {
+// requirePermission wraps a handler with the RequirePermission middleware
+func (s *Server) requirePermission(permission models.Permission, next http.HandlerFunc) http.HandlerFunc {
+	return s.authMiddleware.RequirePermission(permission)(next).ServeHTTP
+}
+
+// requireWorkerSecret rejects worker requests that do not carry the
+// configured WorkerSecret in the WorkerSecretHeader. Without a secret
+// configured the worker is disabled.
+func (s *Server) requireWorkerSecret(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		claims, err := auth.GetUserClaims(r)
-		if err != nil {
-			respondError(w, http.StatusUnauthorized, "authentication required")
+		if s.config.WorkerSecret == "" {
+			respondError(w, http.StatusServiceUnavailable, "worker secret is not configured")
 			return
 		}
-
-		if claims.Role != "admin" {
-			respondError(w, http.StatusForbidden, "admin role required")
+		secret := r.Header.Get(WorkerSecretHeader)
+		if subtle.ConstantTimeCompare([]byte(secret), []byte(s.config.WorkerSecret)) != 1 {
+			respondError(w, http.StatusUnauthorized, "invalid worker secret")
 			return
 		}
-
-		next.ServeHTTP(w, r)
+		next(w, r)
 	}
 }
 
-// requireWrite is a middleware that requires write permissions (admin or compliance_officer)
-func (s *Server) requireWrite(next http.HandlerFunc) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		claims, err := auth.GetUserClaims(r)
-		if err != nil {
-			respondError(w, http.StatusUnauthorized, "authentication required")
-			return
+// Helper functions for paginated lists
+
+// listResponse is the envelope for paginated list endpoints
+type listResponse struct {
+	Items         interface{} `json:"items"`
+	NextPageToken string      `json:"next_page_token,omitempty"`
+}
+
+// parseListOptions reads page_size, page_token, sort_by and order from the query string
+func parseListOptions(r *http.Request) (store.ListOptions, error) {
+	query := r.URL.Query()
+	opts := store.ListOptions{
+		PageSize:  store.DefaultPageSize,
+		PageToken: query.Get("page_token"),
+		SortBy:    query.Get("sort_by"),
+		Order:     query.Get("order"),
+	}
+
+	if sizeStr := query.Get("page_size"); sizeStr != "" {
+		size, err := strconv.Atoi(sizeStr)
+		if err != nil || size <= 0 {
+			return opts, fmt.Errorf("page_size must be a positive integer")
 		}
+		opts.PageSize = size
+	}
+	if opts.PageSize > store.MaxPageSize {
+		opts.PageSize = store.MaxPageSize
+	}
 
-		if claims.Role != "admin" && claims.Role != "compliance_officer" {
-			respondError(w, http.StatusForbidden, "write permission required")
-			return
+	return opts, nil
+}
+
+// isListOptionsError reports whether a store error was caused by bad paging or sort input
+func isListOptionsError(err error) bool {
+	return errors.Is(err, store.ErrInvalidPageToken) || errors.Is(err, store.ErrInvalidSort)
+}
+
+// Helper functions for optimistic concurrency
+
+// etag formats a document version as a strong entity tag
+func etag(version int64) string {
+	return strconv.Quote(strconv.FormatInt(version, 10))
+}
+
+// setETag sets the ETag response header for a document version
+func setETag(w http.ResponseWriter, version int64) {
+	w.Header().Set("ETag", etag(version))
+}
+
+// checkIfMatch enforces the If-Match precondition on a write to a document at
+// the given version. It responds with 428 when the header is missing or 412
+// when no listed tag matches, and returns false in either case.
+func checkIfMatch(w http.ResponseWriter, r *http.Request, version int64) bool {
+	header := r.Header.Get("If-Match")
+	if header == "" {
+		respondError(w, http.StatusPreconditionRequired, "If-Match header is required")
+		return false
+	}
+	if strings.TrimSpace(header) == "*" {
+		return true
+	}
+
+	current := etag(version)
+	for _, tag := range strings.Split(header, ",") {
+		// If-Match uses strong comparison, so weak tags never match
+		if strings.TrimSpace(tag) == current {
+			return true
 		}
+	}
+
+	setETag(w, version)
+	respondPreconditionFailed(w)
+	return false
+}
 
-		next.ServeHTTP(w, r)
+// isVersionConflict reports whether a store write lost a race with another writer
+func isVersionConflict(err error) bool {
+	return errors.Is(err, store.ErrVersionConflict)
+}
+
+// recordAudit appends log to the organization's audit log. The change it
+// records has already been made, so a failed write is logged rather than
+// failing the request.
+func (s *Server) recordAudit(ctx context.Context, log *models.AuditLog) {
+	if err := s.store.CreateAuditLog(ctx, log); err != nil {
+		s.logger.Error("failed to create audit log", "org_id", log.OrganizationID, "action", log.Action,
+			"resource_type", log.ResourceType, "resource_id", log.ResourceID, "error", err)
 	}
 }
 
+// respondPreconditionFailed rejects a stale write
+func respondPreconditionFailed(w http.ResponseWriter) {
+	respondError(w, http.StatusPreconditionFailed, "resource has been modified; reload it and retry")
+}
+
 // Helper functions for JSON responses
 
 func respondJSON(w http.ResponseWriter, status int, data interface{}) {
@@ -0,0 +1,231 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"compliancesync-api/internal/auth"
+	"compliancesync-api/internal/models"
+	"github.com/go-chi/chi/v5"
+)
+
+// sessionResponse is a session along with whether it can still be used and
+// whether it is the one making the request
+type sessionResponse struct {
+	*models.Session
+	Active  bool `json:"active"`
+	Current bool `json:"current"`
+}
+
+// Session handlers
+
+// handleLogin exchanges an identity provider token for a session token in
+// the organization the request acts in, and records the sign-in in that
+// organization's audit log. The session lasts auth.SessionTTL and keeps the
+// identity provider's sign-in method.
+func (s *Server) handleLogin() http.HandlerFunc {
+	type response struct {
+		Token     string       `json:"token"`
+		ExpiresAt time.Time    `json:"expires_at"`
+		User      *models.User `json:"user"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, err := auth.GetUserClaims(r)
+		if err != nil {
+			respondError(w, http.StatusUnauthorized, "authentication required")
+			return
+		}
+
+		if claims.SessionID != "" {
+			respondError(w, http.StatusBadRequest, "sign in with an identity provider token, not a session token")
+			return
+		}
+
+		user, err := s.store.GetUser(r.Context(), claims.UID)
+		if err != nil || !s.belongsToOrganization(r.Context(), user, claims.OrganizationID) {
+			respondError(w, http.StatusForbidden, "organization membership required")
+			return
+		}
+		if user.Status != "active" {
+			respondError(w, http.StatusForbidden, "this account has been deactivated")
+			return
+		}
+
+		token, err := auth.GenerateSessionToken()
+		if err != nil {
+			s.logger.Error("failed to generate session token", "error", err)
+			respondError(w, http.StatusInternalServerError, "failed to sign in")
+			return
+		}
+
+		session := &models.Session{
+			UserID:         user.UID,
+			OrganizationID: claims.OrganizationID,
+			TokenHash:      auth.HashSessionToken(token),
+			AuthMethod:     claims.AuthMethod,
+			IPAddress:      r.RemoteAddr,
+			UserAgent:      r.UserAgent(),
+			ExpiresAt:      time.Now().Add(auth.SessionTTL),
+		}
+		if err := s.store.CreateSession(r.Context(), session); err != nil {
+			s.logger.Error("failed to create session", "error", err)
+			respondError(w, http.StatusInternalServerError, "failed to sign in")
+			return
+		}
+
+		if err := s.store.UpdateLastLogin(r.Context(), user.UID); err != nil {
+			s.logger.Error("failed to update last login", "error", err)
+		}
+
+		// Create audit log
+		s.recordAudit(r.Context(), &models.AuditLog{
+			OrganizationID: session.OrganizationID,
+			UserID:         user.UID,
+			UserEmail:      user.Email,
+			Action:         models.ActionLogin,
+			ResourceType:   "session",
+			ResourceID:     session.ID,
+			Description:    fmt.Sprintf("%s signed in", user.Email),
+			Metadata: map[string]interface{}{
+				"auth_method": session.AuthMethod,
+			},
+			IPAddress: r.RemoteAddr,
+			UserAgent: r.UserAgent(),
+		})
+
+		respondJSON(w, http.StatusOK, response{Token: token, ExpiresAt: session.ExpiresAt, User: user})
+	}
+}
+
+// handleLogout ends the caller's session and records the sign-out in the
+// audit log of the organization the session belongs to, whichever
+// organization the request selects. A session token stops working at once. An identity provider
+// token cannot be revoked here, so its sign-out is only recorded; the
+// client discards it.
+func (s *Server) handleLogout() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, err := auth.GetUserClaims(r)
+		if err != nil {
+			respondError(w, http.StatusUnauthorized, "authentication required")
+			return
+		}
+
+		orgID := claims.OrganizationID
+		resourceID := claims.UID
+		resourceType := "user"
+		if claims.SessionID != "" {
+			session, err := s.store.GetSession(r.Context(), claims.SessionOrgID, claims.SessionID)
+			if err != nil {
+				s.logger.Error("failed to get session", "error", err)
+				respondError(w, http.StatusInternalServerError, "failed to sign out")
+				return
+			}
+
+			now := time.Now()
+			session.RevokedAt = &now
+			if err := s.store.UpdateSession(r.Context(), session); err != nil {
+				s.logger.Error("failed to revoke session", "error", err)
+				respondError(w, http.StatusInternalServerError, "failed to sign out")
+				return
+			}
+			orgID = session.OrganizationID
+			resourceID = session.ID
+			resourceType = "session"
+		}
+
+		// Create audit log
+		s.recordAudit(r.Context(), &models.AuditLog{
+			OrganizationID: orgID,
+			UserID:         claims.UID,
+			UserEmail:      claims.Email,
+			Action:         models.ActionLogout,
+			ResourceType:   resourceType,
+			ResourceID:     resourceID,
+			Description:    fmt.Sprintf("%s signed out", claims.Email),
+			Metadata: map[string]interface{}{
+				"auth_method": claims.AuthMethod,
+			},
+			IPAddress: r.RemoteAddr,
+			UserAgent: r.UserAgent(),
+		})
+
+		respondJSON(w, http.StatusOK, map[string]string{
+			"message": "Signed out",
+		})
+	}
+}
+
+// handleListProfileSessions lists the caller's recent sessions, newest first
+func (s *Server) handleListProfileSessions() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, err := auth.GetUserClaims(r)
+		if err != nil {
+			respondError(w, http.StatusUnauthorized, "authentication required")
+			return
+		}
+
+		s.listSessions(w, r, claims, claims.UID)
+	}
+}
+
+// handleListUserSessions lists a user's recent sessions in the organization,
+// newest first, for its own users and members alike. The sessions of
+// deactivated and deleted users remain visible.
+func (s *Server) handleListUserSessions() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, err := auth.GetUserClaims(r)
+		if err != nil {
+			respondError(w, http.StatusUnauthorized, "authentication required")
+			return
+		}
+
+		user, err := s.store.GetUser(r.Context(), chi.URLParam(r, "userID"))
+		if err != nil {
+			respondError(w, http.StatusNotFound, "user not found")
+			return
+		}
+
+		// Verify user belongs to same organization
+		if !s.belongsToOrganization(r.Context(), user, claims.OrganizationID) {
+			respondError(w, http.StatusForbidden, "user not in your organization")
+			return
+		}
+
+		s.listSessions(w, r, claims, user.UID)
+	}
+}
+
+// listSessions responds with one page of a user's sessions in the caller's
+// organization
+func (s *Server) listSessions(w http.ResponseWriter, r *http.Request, claims *auth.UserClaims, userID string) {
+	opts, err := parseListOptions(r)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	sessions, nextPageToken, err := s.store.ListSessions(r.Context(), claims.OrganizationID, userID, opts)
+	if isListOptionsError(err) {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		s.logger.Error("failed to list sessions", "error", err)
+		respondError(w, http.StatusInternalServerError, "failed to list sessions")
+		return
+	}
+
+	now := time.Now()
+	items := make([]sessionResponse, 0, len(sessions))
+	for _, session := range sessions {
+		items = append(items, sessionResponse{
+			Session: session,
+			Active:  session.IsActive(now),
+			Current: session.ID == claims.SessionID,
+		})
+	}
+
+	respondJSON(w, http.StatusOK, listResponse{Items: items, NextPageToken: nextPageToken})
+}
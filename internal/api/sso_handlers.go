@@ -0,0 +1,1040 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"compliancesync-api/internal/auth"
+	"compliancesync-api/internal/models"
+	"compliancesync-api/internal/sso"
+	"compliancesync-api/internal/store"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+// ssoBindingCookie holds the nonce of a sign-in in progress, so a callback
+// is only accepted from the browser that started it
+const ssoBindingCookie = "compliancesync_sso"
+
+// ssoConfigResponse is an organization's SSO configuration along with the
+// values its administrator enters at the identity provider
+type ssoConfigResponse struct {
+	*models.SSOConfig
+	OIDCRedirectURL   string `json:"oidc_redirect_url"`
+	SAMLSPMetadataURL string `json:"saml_sp_metadata_url"` // Also the service provider entity ID
+	SAMLSPACSURL      string `json:"saml_sp_acs_url"`
+}
+
+// domainResponse is a domain claim along with the TXT record that verifies it
+type domainResponse struct {
+	*models.Domain
+	TXTRecordName  string `json:"txt_record_name"`
+	TXTRecordValue string `json:"txt_record_value"`
+}
+
+// SSO configuration handlers
+
+// handleGetSSOConfig returns the organization's SSO configuration. An
+// organization that has not configured SSO gets a disabled configuration at
+// version 0, which can be saved with If-Match: "0".
+func (s *Server) handleGetSSOConfig() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, err := auth.GetUserClaims(r)
+		if err != nil {
+			respondError(w, http.StatusUnauthorized, "authentication required")
+			return
+		}
+
+		config, err := s.store.GetSSOConfig(r.Context(), claims.OrganizationID)
+		if err != nil {
+			s.logger.Error("failed to get SSO config", "error", err)
+			respondError(w, http.StatusInternalServerError, "failed to get SSO configuration")
+			return
+		}
+		if config == nil {
+			config = &models.SSOConfig{OrganizationID: claims.OrganizationID}
+		}
+
+		setETag(w, config.Version)
+		respondJSON(w, http.StatusOK, s.newSSOConfigResponse(config))
+	}
+}
+
+// handleUpdateSSOConfig saves the organization's SSO configuration. OIDC
+// issuers are checked through their discovery document; SAML identity
+// providers are read from their metadata URL or given explicitly. Enabling
+// SSO requires the Business plan, and enforcing it requires a verified
+// domain so that users can still sign in.
+func (s *Server) handleUpdateSSOConfig() http.HandlerFunc {
+	type request struct {
+		Protocol            models.SSOProtocol `json:"protocol"`
+		Enabled             bool               `json:"enabled"`
+		Enforced            bool               `json:"enforced"`
+		DefaultRole         models.UserRole    `json:"default_role"`
+		OIDCIssuer          string             `json:"oidc_issuer"`
+		OIDCClientID        string             `json:"oidc_client_id"`
+		OIDCClientSecret    string             `json:"oidc_client_secret"` // Omit to keep the stored secret
+		SAMLMetadataURL     string             `json:"saml_metadata_url"`
+		SAMLIdPEntityID     string             `json:"saml_idp_entity_id"`
+		SAMLIdPSSOURL       string             `json:"saml_idp_sso_url"`
+		SAMLIdPCertificates []string           `json:"saml_idp_certificates"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, err := auth.GetUserClaims(r)
+		if err != nil {
+			respondError(w, http.StatusUnauthorized, "authentication required")
+			return
+		}
+
+		existing, err := s.store.GetSSOConfig(r.Context(), claims.OrganizationID)
+		if err != nil {
+			s.logger.Error("failed to get SSO config", "error", err)
+			respondError(w, http.StatusInternalServerError, "failed to update SSO configuration")
+			return
+		}
+		if existing == nil {
+			existing = &models.SSOConfig{OrganizationID: claims.OrganizationID}
+		}
+		if !checkIfMatch(w, r, existing.Version) {
+			return
+		}
+
+		var req request
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondError(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+
+		if req.Enforced && !req.Enabled {
+			respondError(w, http.StatusBadRequest, "SSO must be enabled to be enforced")
+			return
+		}
+		if req.DefaultRole == "" {
+			req.DefaultRole = models.RoleViewer
+		}
+		if !s.isAssignableRole(r.Context(), claims.OrganizationID, req.DefaultRole) {
+			respondError(w, http.StatusBadRequest, "default_role: "+invalidRoleMessage)
+			return
+		}
+
+		if req.Enabled {
+			org, err := s.store.GetOrganization(r.Context(), claims.OrganizationID)
+			if err != nil {
+				s.logger.Error("failed to get organization", "error", err)
+				respondError(w, http.StatusInternalServerError, "failed to update SSO configuration")
+				return
+			}
+			if org.Subscription.Tier != models.TierBusiness {
+				respondError(w, http.StatusForbidden, "single sign-on requires the Business plan")
+				return
+			}
+		}
+		if req.Enforced {
+			verified, err := s.hasVerifiedDomain(r.Context(), claims.OrganizationID, "")
+			if err != nil {
+				s.logger.Error("failed to list domains", "error", err)
+				respondError(w, http.StatusInternalServerError, "failed to update SSO configuration")
+				return
+			}
+			if !verified {
+				respondError(w, http.StatusBadRequest, "verify a domain before enforcing SSO")
+				return
+			}
+		}
+
+		config := &models.SSOConfig{
+			OrganizationID: claims.OrganizationID,
+			Protocol:       req.Protocol,
+			Enabled:        req.Enabled,
+			Enforced:       req.Enforced,
+			DefaultRole:    req.DefaultRole,
+			UpdatedBy:      claims.UID,
+			Version:        existing.Version,
+		}
+
+		switch req.Protocol {
+		case models.SSOProtocolOIDC:
+			if req.OIDCIssuer == "" || req.OIDCClientID == "" {
+				respondError(w, http.StatusBadRequest, "oidc_issuer and oidc_client_id are required")
+				return
+			}
+			if err := s.sso.DiscoverOIDC(r.Context(), req.OIDCIssuer); err != nil {
+				respondError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			config.OIDCIssuer = req.OIDCIssuer
+			config.OIDCClientID = req.OIDCClientID
+			config.OIDCClientSecret = req.OIDCClientSecret
+			if config.OIDCClientSecret == "" && existing.OIDCClientID == req.OIDCClientID {
+				config.OIDCClientSecret = existing.OIDCClientSecret
+			}
+
+		case models.SSOProtocolSAML:
+			if req.SAMLMetadataURL != "" {
+				metadata, err := s.sso.FetchSAMLMetadata(r.Context(), req.SAMLMetadataURL)
+				if err != nil {
+					respondError(w, http.StatusBadRequest, err.Error())
+					return
+				}
+				config.SAMLMetadataURL = req.SAMLMetadataURL
+				config.SAMLIdPEntityID = metadata.EntityID
+				config.SAMLIdPSSOURL = metadata.SSOURL
+				config.SAMLIdPCertificates = metadata.Certificates
+				break
+			}
+			if req.SAMLIdPEntityID == "" || req.SAMLIdPSSOURL == "" || len(req.SAMLIdPCertificates) == 0 {
+				respondError(w, http.StatusBadRequest, "saml_metadata_url, or saml_idp_entity_id, saml_idp_sso_url and saml_idp_certificates, are required")
+				return
+			}
+			if _, err := sso.ParseCertificates(req.SAMLIdPCertificates); err != nil {
+				respondError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			config.SAMLIdPEntityID = req.SAMLIdPEntityID
+			config.SAMLIdPSSOURL = req.SAMLIdPSSOURL
+			config.SAMLIdPCertificates = req.SAMLIdPCertificates
+
+		default:
+			respondError(w, http.StatusBadRequest, "protocol must be oidc or saml")
+			return
+		}
+
+		if err := s.store.SaveSSOConfig(r.Context(), config); err != nil {
+			if isVersionConflict(err) {
+				respondPreconditionFailed(w)
+				return
+			}
+			s.logger.Error("failed to save SSO config", "error", err)
+			respondError(w, http.StatusInternalServerError, "failed to update SSO configuration")
+			return
+		}
+		s.authMiddleware.InvalidateSSOConfig(claims.OrganizationID)
+
+		// Create audit log
+		auditLog := &models.AuditLog{
+			OrganizationID: claims.OrganizationID,
+			UserID:         claims.UID,
+			UserEmail:      claims.Email,
+			Action:         models.ActionSSOConfigUpdated,
+			ResourceType:   "sso_config",
+			ResourceID:     claims.OrganizationID,
+			Description:    fmt.Sprintf("Updated %s single sign-on configuration", config.Protocol),
+			Metadata: map[string]interface{}{
+				"protocol":     config.Protocol,
+				"enabled":      config.Enabled,
+				"enforced":     config.Enforced,
+				"default_role": config.DefaultRole,
+			},
+			IPAddress: r.RemoteAddr,
+			UserAgent: r.UserAgent(),
+		}
+		s.recordAudit(r.Context(), auditLog)
+
+		setETag(w, config.Version)
+		respondJSON(w, http.StatusOK, s.newSSOConfigResponse(config))
+	}
+}
+
+// Domain handlers
+
+// handleCreateDomain claims an email domain for the organization. The claim
+// stays pending until the returned TXT record is published and verified.
+func (s *Server) handleCreateDomain() http.HandlerFunc {
+	type request struct {
+		Name string `json:"name"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, err := auth.GetUserClaims(r)
+		if err != nil {
+			respondError(w, http.StatusUnauthorized, "authentication required")
+			return
+		}
+
+		var req request
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondError(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+
+		name := strings.TrimSuffix(strings.ToLower(strings.TrimSpace(req.Name)), ".")
+		if !isValidDomainName(name) {
+			respondError(w, http.StatusBadRequest, "a valid domain name such as example.com is required")
+			return
+		}
+
+		token, err := newVerificationToken()
+		if err != nil {
+			s.logger.Error("failed to generate verification token", "error", err)
+			respondError(w, http.StatusInternalServerError, "failed to add domain")
+			return
+		}
+
+		domain := &models.Domain{
+			OrganizationID:    claims.OrganizationID,
+			Name:              name,
+			VerificationToken: token,
+			CreatedBy:         claims.UID,
+		}
+
+		if err := s.store.CreateDomain(r.Context(), domain); err != nil {
+			if errors.Is(err, store.ErrDomainClaimed) {
+				respondError(w, http.StatusConflict, "domain has already been added or is verified by another organization")
+				return
+			}
+			s.logger.Error("failed to create domain", "error", err)
+			respondError(w, http.StatusInternalServerError, "failed to add domain")
+			return
+		}
+
+		// Create audit log
+		auditLog := &models.AuditLog{
+			OrganizationID: claims.OrganizationID,
+			UserID:         claims.UID,
+			UserEmail:      claims.Email,
+			Action:         models.ActionDomainAdded,
+			ResourceType:   "domain",
+			ResourceID:     domain.ID,
+			Description:    fmt.Sprintf("Added domain %s", domain.Name),
+			IPAddress:      r.RemoteAddr,
+			UserAgent:      r.UserAgent(),
+		}
+		s.recordAudit(r.Context(), auditLog)
+
+		respondJSON(w, http.StatusCreated, newDomainResponse(domain))
+	}
+}
+
+// handleListDomains lists the organization's domain claims
+func (s *Server) handleListDomains() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, err := auth.GetUserClaims(r)
+		if err != nil {
+			respondError(w, http.StatusUnauthorized, "authentication required")
+			return
+		}
+
+		opts, err := parseListOptions(r)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		domains, nextPageToken, err := s.store.ListDomains(r.Context(), claims.OrganizationID, opts)
+		if isListOptionsError(err) {
+			respondError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if err != nil {
+			s.logger.Error("failed to list domains", "error", err)
+			respondError(w, http.StatusInternalServerError, "failed to list domains")
+			return
+		}
+
+		items := make([]domainResponse, len(domains))
+		for i, domain := range domains {
+			items[i] = newDomainResponse(domain)
+		}
+
+		respondJSON(w, http.StatusOK, listResponse{Items: items, NextPageToken: nextPageToken})
+	}
+}
+
+// handleVerifyDomain checks the domain's TXT record and marks the claim
+// verified. Only one organization can hold a verified claim on a domain.
+func (s *Server) handleVerifyDomain() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, err := auth.GetUserClaims(r)
+		if err != nil {
+			respondError(w, http.StatusUnauthorized, "authentication required")
+			return
+		}
+
+		domain, err := s.store.GetDomain(r.Context(), claims.OrganizationID, chi.URLParam(r, "domainID"))
+		if err != nil {
+			respondError(w, http.StatusNotFound, "domain not found")
+			return
+		}
+		if domain.Status == "verified" {
+			respondError(w, http.StatusConflict, "domain is already verified")
+			return
+		}
+
+		if !s.skipDomainVerification() {
+			found, err := s.hasTXTRecord(r.Context(), domain)
+			if err != nil {
+				s.logger.Warn("TXT lookup failed", "domain", domain.Name, "error", err)
+			}
+			if !found {
+				respondError(w, http.StatusBadRequest,
+					fmt.Sprintf("TXT record %s with value %s was not found; DNS changes can take a while to propagate", domain.TXTRecordName(), domain.TXTRecordValue()))
+				return
+			}
+		}
+
+		if err := s.store.VerifyDomain(r.Context(), domain); err != nil {
+			if errors.Is(err, store.ErrDomainClaimed) {
+				respondError(w, http.StatusConflict, "domain is verified by another organization")
+				return
+			}
+			s.logger.Error("failed to verify domain", "error", err)
+			respondError(w, http.StatusInternalServerError, "failed to verify domain")
+			return
+		}
+
+		// Create audit log
+		auditLog := &models.AuditLog{
+			OrganizationID: claims.OrganizationID,
+			UserID:         claims.UID,
+			UserEmail:      claims.Email,
+			Action:         models.ActionDomainVerified,
+			ResourceType:   "domain",
+			ResourceID:     domain.ID,
+			Description:    fmt.Sprintf("Verified domain %s", domain.Name),
+			IPAddress:      r.RemoteAddr,
+			UserAgent:      r.UserAgent(),
+		}
+		s.recordAudit(r.Context(), auditLog)
+
+		respondJSON(w, http.StatusOK, newDomainResponse(domain))
+	}
+}
+
+// handleDeleteDomain removes a domain claim. The last verified domain
+// cannot be removed while SSO is enforced.
+func (s *Server) handleDeleteDomain() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, err := auth.GetUserClaims(r)
+		if err != nil {
+			respondError(w, http.StatusUnauthorized, "authentication required")
+			return
+		}
+
+		domain, err := s.store.GetDomain(r.Context(), claims.OrganizationID, chi.URLParam(r, "domainID"))
+		if err != nil {
+			respondError(w, http.StatusNotFound, "domain not found")
+			return
+		}
+
+		if domain.Status == "verified" {
+			config, err := s.store.GetSSOConfig(r.Context(), claims.OrganizationID)
+			if err != nil {
+				s.logger.Error("failed to get SSO config", "error", err)
+				respondError(w, http.StatusInternalServerError, "failed to remove domain")
+				return
+			}
+			if config != nil && config.Enforced {
+				others, err := s.hasVerifiedDomain(r.Context(), claims.OrganizationID, domain.ID)
+				if err != nil {
+					s.logger.Error("failed to list domains", "error", err)
+					respondError(w, http.StatusInternalServerError, "failed to remove domain")
+					return
+				}
+				if !others {
+					respondError(w, http.StatusConflict, "the last verified domain cannot be removed while SSO is enforced")
+					return
+				}
+			}
+		}
+
+		if err := s.store.DeleteDomain(r.Context(), claims.OrganizationID, domain.ID); err != nil {
+			s.logger.Error("failed to delete domain", "error", err)
+			respondError(w, http.StatusInternalServerError, "failed to remove domain")
+			return
+		}
+
+		// Create audit log
+		auditLog := &models.AuditLog{
+			OrganizationID: claims.OrganizationID,
+			UserID:         claims.UID,
+			UserEmail:      claims.Email,
+			Action:         models.ActionDomainRemoved,
+			ResourceType:   "domain",
+			ResourceID:     domain.ID,
+			Description:    fmt.Sprintf("Removed domain %s", domain.Name),
+			IPAddress:      r.RemoteAddr,
+			UserAgent:      r.UserAgent(),
+		}
+		s.recordAudit(r.Context(), auditLog)
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// SSO sign-in handlers (public)
+
+// handleSSODiscover finds the organization that signs in an email address
+// through SSO, so a login page can offer it before asking for a password
+func (s *Server) handleSSODiscover() http.HandlerFunc {
+	type request struct {
+		Email string `json:"email"`
+	}
+
+	type response struct {
+		OrganizationID string             `json:"organization_id"`
+		Protocol       models.SSOProtocol `json:"protocol"`
+		Enforced       bool               `json:"enforced"`
+		LoginURL       string             `json:"login_url"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req request
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondError(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+
+		name := models.EmailDomain(strings.TrimSpace(req.Email))
+		if name == "" {
+			respondError(w, http.StatusBadRequest, "a valid email is required")
+			return
+		}
+
+		domain, err := s.store.GetVerifiedDomain(r.Context(), name)
+		if err != nil {
+			respondError(w, http.StatusNotFound, "single sign-on is not available for this email address")
+			return
+		}
+		config, err := s.store.GetSSOConfig(r.Context(), domain.OrganizationID)
+		if err != nil {
+			s.logger.Error("failed to get SSO config", "error", err)
+			respondError(w, http.StatusInternalServerError, "failed to look up single sign-on")
+			return
+		}
+		if config == nil || !config.Enabled {
+			respondError(w, http.StatusNotFound, "single sign-on is not available for this email address")
+			return
+		}
+
+		respondJSON(w, http.StatusOK, response{
+			OrganizationID: domain.OrganizationID,
+			Protocol:       config.Protocol,
+			Enforced:       config.Enforced,
+			LoginURL:       s.ssoURL(domain.OrganizationID, "login"),
+		})
+	}
+}
+
+// handleSSOLogin starts a sign-in by redirecting the browser to the
+// organization's identity provider. return_to, if given, must be on one of
+// the configured redirect origins; the session token is appended to it as a
+// URL fragment once sign-in completes. Without it the callback responds with
+// JSON.
+func (s *Server) handleSSOLogin() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		orgID := chi.URLParam(r, "orgID")
+		config, ok := s.enabledSSOConfig(w, r, orgID)
+		if !ok {
+			return
+		}
+
+		returnTo := r.URL.Query().Get("return_to")
+		if returnTo != "" && !s.isAllowedRedirect(returnTo) {
+			respondError(w, http.StatusBadRequest, "return_to is not an allowed redirect origin")
+			return
+		}
+
+		nonce, err := sso.NewNonce()
+		if err != nil {
+			s.logger.Error("failed to generate SSO nonce", "error", err)
+			respondError(w, http.StatusInternalServerError, "failed to start sign-in")
+			return
+		}
+		state := sso.State{OrganizationID: orgID, Nonce: nonce, ReturnTo: returnTo}
+		now := time.Now()
+
+		var target string
+		switch config.Protocol {
+		case models.SSOProtocolOIDC:
+			signed, err := s.stateSigner.Sign(state, now)
+			if err == nil {
+				target, err = s.sso.OIDCAuthURL(r.Context(), config, s.ssoURL(orgID, "oidc/callback"),
+					signed, nonce, s.stateSigner.PKCEVerifier(nonce))
+			}
+			if err != nil {
+				s.logger.Error("failed to start OIDC sign-in", "organization_id", orgID, "error", err)
+				respondError(w, http.StatusBadGateway, "failed to reach the identity provider")
+				return
+			}
+
+		case models.SSOProtocolSAML:
+			state.RequestID, err = sso.NewRequestID()
+			if err != nil {
+				s.logger.Error("failed to generate SAML request ID", "error", err)
+				respondError(w, http.StatusInternalServerError, "failed to start sign-in")
+				return
+			}
+			// The signed state is longer than the 80 bytes SAML suggests for
+			// RelayState; identity providers in practice return it intact
+			signed, err := s.stateSigner.Sign(state, now)
+			if err == nil {
+				target, err = s.serviceProvider(orgID).AuthnRequestURL(identityProvider(config), state.RequestID, signed, now)
+			}
+			if err != nil {
+				s.logger.Error("failed to start SAML sign-in", "organization_id", orgID, "error", err)
+				respondError(w, http.StatusInternalServerError, "failed to start sign-in")
+				return
+			}
+
+		default:
+			respondError(w, http.StatusNotFound, "single sign-on is not enabled for this organization")
+			return
+		}
+
+		s.setSSOBinding(w, nonce, now.Add(sso.StateTTL))
+		http.Redirect(w, r, target, http.StatusFound)
+	}
+}
+
+// handleOIDCCallback completes an OIDC sign-in
+func (s *Server) handleOIDCCallback() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		orgID := chi.URLParam(r, "orgID")
+		query := r.URL.Query()
+
+		if query.Get("error") != "" {
+			respondError(w, http.StatusUnauthorized, "sign-in failed at the identity provider: "+query.Get("error"))
+			return
+		}
+
+		state, ok := s.checkSSOState(w, r, orgID, query.Get("state"), true)
+		if !ok {
+			return
+		}
+		config, ok := s.enabledSSOConfig(w, r, orgID)
+		if !ok {
+			return
+		}
+		if config.Protocol != models.SSOProtocolOIDC {
+			respondError(w, http.StatusBadRequest, "organization does not use OIDC")
+			return
+		}
+
+		identity, err := s.sso.OIDCExchange(r.Context(), config, s.ssoURL(orgID, "oidc/callback"),
+			query.Get("code"), state.Nonce, s.stateSigner.PKCEVerifier(state.Nonce))
+		if err != nil {
+			s.logger.Warn("OIDC sign-in rejected", "organization_id", orgID, "error", err)
+			respondError(w, http.StatusUnauthorized, "sign-in could not be verified")
+			return
+		}
+
+		s.completeSSOLogin(w, r, config, state, identity, models.AuthMethodOIDC)
+	}
+}
+
+// handleSAMLACS is the assertion consumer service: it completes a SAML
+// sign-in from the identity provider's HTTP-POST response. The browser
+// binding cookie can only be checked over HTTPS, where it is SameSite=None.
+func (s *Server) handleSAMLACS() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		orgID := chi.URLParam(r, "orgID")
+
+		r.Body = http.MaxBytesReader(w, r.Body, 2<<20)
+		if err := r.ParseForm(); err != nil {
+			respondError(w, http.StatusBadRequest, "invalid SAML response")
+			return
+		}
+
+		state, ok := s.checkSSOState(w, r, orgID, r.PostForm.Get("RelayState"), s.isHTTPS())
+		if !ok {
+			return
+		}
+		config, ok := s.enabledSSOConfig(w, r, orgID)
+		if !ok {
+			return
+		}
+		if config.Protocol != models.SSOProtocolSAML {
+			respondError(w, http.StatusBadRequest, "organization does not use SAML")
+			return
+		}
+
+		identity, err := s.sso.ParseSAMLResponse(r.Context(), s.serviceProvider(orgID), identityProvider(config),
+			r.PostForm.Get("SAMLResponse"), state.RequestID, time.Now())
+		if err != nil {
+			s.logger.Warn("SAML sign-in rejected", "organization_id", orgID, "error", err)
+			respondError(w, http.StatusUnauthorized, "sign-in could not be verified")
+			return
+		}
+
+		s.completeSSOLogin(w, r, config, state, identity, models.AuthMethodSAML)
+	}
+}
+
+// handleSAMLMetadata serves the service provider metadata for an
+// organization's identity provider
+func (s *Server) handleSAMLMetadata() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		orgID := chi.URLParam(r, "orgID")
+		if _, err := s.store.GetOrganization(r.Context(), orgID); err != nil {
+			respondError(w, http.StatusNotFound, "organization not found")
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/samlmetadata+xml")
+		w.WriteHeader(http.StatusOK)
+		w.Write(s.serviceProvider(orgID).Metadata())
+	}
+}
+
+// completeSSOLogin signs in a user the identity provider has vouched for.
+// The email domain must be verified by the organization. Existing users must
+// belong to it and be active; anyone else is provisioned with the default
+// role, subject to the plan's user limit. The user gets a session token.
+func (s *Server) completeSSOLogin(w http.ResponseWriter, r *http.Request, config *models.SSOConfig, state *sso.State, identity *sso.Identity, method string) {
+	type response struct {
+		Token     string       `json:"token"`
+		ExpiresAt time.Time    `json:"expires_at"`
+		User      *models.User `json:"user"`
+	}
+
+	ctx := r.Context()
+	orgID := config.OrganizationID
+	email := strings.ToLower(strings.TrimSpace(identity.Email))
+
+	domain, err := s.store.GetVerifiedDomain(ctx, models.EmailDomain(email))
+	if err != nil || domain.OrganizationID != orgID {
+		respondError(w, http.StatusForbidden, "your email domain is not verified for this organization")
+		return
+	}
+
+	org, err := s.store.GetOrganization(ctx, orgID)
+	if err != nil {
+		s.logger.Error("failed to get organization", "error", err)
+		respondError(w, http.StatusInternalServerError, "failed to complete sign-in")
+		return
+	}
+	if org.Subscription.Tier != models.TierBusiness {
+		respondError(w, http.StatusForbidden, "single sign-on requires the Business plan")
+		return
+	}
+
+	user := s.findUserByEmail(ctx, email, identity.Email)
+	if user != nil {
+		if !s.belongsToOrganization(ctx, user, orgID) {
+			respondError(w, http.StatusForbidden, "this account belongs to another organization")
+			return
+		}
+		if user.Status != "active" {
+			respondError(w, http.StatusForbidden, "this account has been deactivated")
+			return
+		}
+	} else {
+		// Just-in-time provisioning
+		if !s.isAssignableRole(ctx, orgID, config.DefaultRole) {
+			s.logger.Error("SSO default role is not assignable", "organization_id", orgID, "role", config.DefaultRole)
+			respondError(w, http.StatusForbidden, "single sign-on is misconfigured; contact your administrator")
+			return
+		}
+
+		user = &models.User{
+			UID:            uuid.New().String(),
+			Email:          email,
+			FullName:       identity.Name,
+			OrganizationID: orgID,
+			Role:           config.DefaultRole,
+			EmailVerified:  true,
+		}
+		if err := s.store.ProvisionUser(ctx, user); err != nil {
+			if errors.Is(err, store.ErrSeatLimitReached) {
+				respondError(w, http.StatusForbidden, "user limit reached. Ask an administrator to upgrade the plan")
+				return
+			}
+			s.logger.Error("failed to provision user", "error", err)
+			respondError(w, http.StatusInternalServerError, "failed to complete sign-in")
+			return
+		}
+
+		// Create audit log
+		s.recordAudit(ctx, &models.AuditLog{
+			OrganizationID: orgID,
+			UserID:         user.UID,
+			UserEmail:      user.Email,
+			Action:         models.ActionUserCreated,
+			ResourceType:   "user",
+			ResourceID:     user.UID,
+			Description:    fmt.Sprintf("User %s provisioned as %s through single sign-on", user.Email, user.Role),
+			Metadata: map[string]interface{}{
+				"auth_method": method,
+				"subject":     identity.Subject,
+			},
+			IPAddress: r.RemoteAddr,
+			UserAgent: r.UserAgent(),
+		})
+	}
+
+	token, err := auth.GenerateSessionToken()
+	if err != nil {
+		s.logger.Error("failed to generate session token", "error", err)
+		respondError(w, http.StatusInternalServerError, "failed to complete sign-in")
+		return
+	}
+
+	session := &models.Session{
+		UserID:         user.UID,
+		OrganizationID: orgID,
+		TokenHash:      auth.HashSessionToken(token),
+		AuthMethod:     method,
+		IPAddress:      r.RemoteAddr,
+		UserAgent:      r.UserAgent(),
+		ExpiresAt:      time.Now().Add(auth.SessionTTL),
+	}
+	if err := s.store.CreateSession(ctx, session); err != nil {
+		s.logger.Error("failed to create session", "error", err)
+		respondError(w, http.StatusInternalServerError, "failed to complete sign-in")
+		return
+	}
+
+	if err := s.store.UpdateLastLogin(ctx, user.UID); err != nil {
+		s.logger.Error("failed to update last login", "error", err)
+	}
+
+	// Create audit log
+	s.recordAudit(ctx, &models.AuditLog{
+		OrganizationID: orgID,
+		UserID:         user.UID,
+		UserEmail:      user.Email,
+		Action:         models.ActionLogin,
+		ResourceType:   "session",
+		ResourceID:     session.ID,
+		Description:    fmt.Sprintf("%s signed in through single sign-on", user.Email),
+		Metadata: map[string]interface{}{
+			"auth_method": method,
+		},
+		IPAddress: r.RemoteAddr,
+		UserAgent: r.UserAgent(),
+	})
+
+	s.clearSSOBinding(w)
+
+	if state.ReturnTo != "" {
+		fragment := url.Values{
+			"token":      {token},
+			"expires_at": {session.ExpiresAt.UTC().Format(time.RFC3339)},
+		}
+		http.Redirect(w, r, state.ReturnTo+"#"+fragment.Encode(), http.StatusSeeOther)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, response{Token: token, ExpiresAt: session.ExpiresAt, User: user})
+}
+
+// Helper functions for single sign-on
+
+// enabledSSOConfig loads an organization's SSO configuration, responding
+// with 404 and returning false if SSO is not enabled
+func (s *Server) enabledSSOConfig(w http.ResponseWriter, r *http.Request, orgID string) (*models.SSOConfig, bool) {
+	config, err := s.store.GetSSOConfig(r.Context(), orgID)
+	if err != nil {
+		s.logger.Error("failed to get SSO config", "error", err)
+		respondError(w, http.StatusInternalServerError, "failed to load single sign-on configuration")
+		return nil, false
+	}
+	if config == nil || !config.Enabled {
+		respondError(w, http.StatusNotFound, "single sign-on is not enabled for this organization")
+		return nil, false
+	}
+	return config, true
+}
+
+// checkSSOState verifies a callback's signed state against the organization
+// and, when bound, the browser's binding cookie. It responds with 400 and
+// returns false on failure.
+func (s *Server) checkSSOState(w http.ResponseWriter, r *http.Request, orgID, token string, bound bool) (*sso.State, bool) {
+	state, err := s.stateSigner.Verify(token)
+	if err != nil || state.OrganizationID != orgID {
+		respondError(w, http.StatusBadRequest, "sign-in request is invalid or has expired; start again")
+		return nil, false
+	}
+	if bound {
+		cookie, err := r.Cookie(ssoBindingCookie)
+		if err != nil || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(state.Nonce)) != 1 {
+			respondError(w, http.StatusBadRequest, "sign-in was started in another browser; start again")
+			return nil, false
+		}
+	}
+	return state, true
+}
+
+// setSSOBinding sets the cookie that ties a sign-in to the browser. Over
+// HTTPS it is SameSite=None so that it survives the identity provider's
+// cross-site POST back to the ACS URL.
+func (s *Server) setSSOBinding(w http.ResponseWriter, nonce string, expires time.Time) {
+	cookie := &http.Cookie{
+		Name:     ssoBindingCookie,
+		Value:    nonce,
+		Path:     "/api/v1/auth/sso",
+		Expires:  expires,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	}
+	if s.isHTTPS() {
+		cookie.Secure = true
+		cookie.SameSite = http.SameSiteNoneMode
+	}
+	http.SetCookie(w, cookie)
+}
+
+// clearSSOBinding removes the binding cookie once sign-in completes
+func (s *Server) clearSSOBinding(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     ssoBindingCookie,
+		Path:     "/api/v1/auth/sso",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   s.isHTTPS(),
+	})
+}
+
+// isHTTPS reports whether the API is served over HTTPS
+func (s *Server) isHTTPS() bool {
+	return strings.HasPrefix(s.config.PublicURL, "https://")
+}
+
+// isAllowedRedirect reports whether target is an absolute URL on one of
+// the configured redirect origins
+func (s *Server) isAllowedRedirect(target string) bool {
+	u, err := url.Parse(target)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" || u.User != nil {
+		return false
+	}
+	origin := u.Scheme + "://" + u.Host
+	for _, allowed := range strings.Split(s.config.SSORedirectOrigins, ",") {
+		if strings.TrimSuffix(strings.TrimSpace(allowed), "/") == origin {
+			return true
+		}
+	}
+	return false
+}
+
+// ssoURL is the public URL of an organization's SSO endpoint
+func (s *Server) ssoURL(orgID, path string) string {
+	return strings.TrimSuffix(s.config.PublicURL, "/") + "/api/v1/auth/sso/" + url.PathEscape(orgID) + "/" + path
+}
+
+// serviceProvider identifies the API to an organization's SAML identity
+// provider. The metadata URL doubles as the entity ID.
+func (s *Server) serviceProvider(orgID string) sso.ServiceProvider {
+	return sso.ServiceProvider{
+		EntityID: s.ssoURL(orgID, "saml/metadata"),
+		ACSURL:   s.ssoURL(orgID, "saml/acs"),
+	}
+}
+
+// identityProvider is the SAML identity provider of a configuration
+func identityProvider(config *models.SSOConfig) sso.IdentityProvider {
+	return sso.IdentityProvider{
+		EntityID:     config.SAMLIdPEntityID,
+		SSOURL:       config.SAMLIdPSSOURL,
+		Certificates: config.SAMLIdPCertificates,
+	}
+}
+
+// newSSOConfigResponse adds the service provider URLs to a configuration
+func (s *Server) newSSOConfigResponse(config *models.SSOConfig) ssoConfigResponse {
+	sp := s.serviceProvider(config.OrganizationID)
+	return ssoConfigResponse{
+		SSOConfig:         config,
+		OIDCRedirectURL:   s.ssoURL(config.OrganizationID, "oidc/callback"),
+		SAMLSPMetadataURL: sp.EntityID,
+		SAMLSPACSURL:      sp.ACSURL,
+	}
+}
+
+// findUserByEmail looks a user up by email address, trying each spelling in
+// turn. It returns nil when there is no such user.
+func (s *Server) findUserByEmail(ctx context.Context, emails ...string) *models.User {
+	for _, email := range emails {
+		if user, err := s.store.GetUserByEmail(ctx, email); err == nil && user != nil {
+			return user
+		}
+	}
+	return nil
+}
+
+// hasVerifiedDomain reports whether the organization has a verified domain
+// other than exceptID
+func (s *Server) hasVerifiedDomain(ctx context.Context, orgID, exceptID string) (bool, error) {
+	opts := store.ListOptions{PageSize: store.MaxPageSize}
+	for {
+		domains, next, err := s.store.ListDomains(ctx, orgID, opts)
+		if err != nil {
+			return false, err
+		}
+		for _, domain := range domains {
+			if domain.Status == "verified" && domain.ID != exceptID {
+				return true, nil
+			}
+		}
+		if next == "" {
+			return false, nil
+		}
+		opts.PageToken = next
+	}
+}
+
+// hasTXTRecord reports whether the domain's verification TXT record is
+// published
+func (s *Server) hasTXTRecord(ctx context.Context, domain *models.Domain) (bool, error) {
+	records, err := s.lookupTXT(ctx, domain.TXTRecordName())
+	if err != nil {
+		return false, err
+	}
+	for _, record := range records {
+		if strings.TrimSpace(record) == domain.TXTRecordValue() {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// skipDomainVerification reports whether domain claims are verified without
+// a DNS lookup, which is only honored in development
+func (s *Server) skipDomainVerification() bool {
+	return s.config.DomainVerification == "skip" && s.config.Environment == "development"
+}
+
+// newDomainResponse adds the verification TXT record to a domain claim
+func newDomainResponse(domain *models.Domain) domainResponse {
+	return domainResponse{
+		Domain:         domain,
+		TXTRecordName:  domain.TXTRecordName(),
+		TXTRecordValue: domain.TXTRecordValue(),
+	}
+}
+
+// isValidDomainName reports whether name looks like a registrable DNS name
+func isValidDomainName(name string) bool {
+	if len(name) > 253 || !strings.Contains(name, ".") {
+		return false
+	}
+	for _, label := range strings.Split(name, ".") {
+		if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for _, c := range label {
+			if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-') {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// newVerificationToken returns a random domain verification token
+func newVerificationToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
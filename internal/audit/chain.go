@@ -0,0 +1,114 @@
+// Package audit verifies and exports organization audit logs.
+package audit
+
+import (
+	"context"
+	"fmt"
+
+	"compliancesync-api/internal/store"
+)
+
+// verifyBatchSize is the number of entries read per store call while walking a chain
+const verifyBatchSize = 500
+
+// Reasons a chain link can fail verification
+const (
+	ReasonMissing          = "missing"            // No entry with the expected sequence
+	ReasonDuplicate        = "duplicate"          // More than one entry with the same sequence
+	ReasonHashMismatch     = "hash_mismatch"      // Entry content no longer matches its hash
+	ReasonPrevHashMismatch = "prev_hash_mismatch" // Entry does not link to the previous entry's hash
+	ReasonHeadMismatch     = "head_mismatch"      // Last entry does not match the recorded chain head
+)
+
+// ChainBreak describes the first link that failed verification
+type ChainBreak struct {
+	Sequence int64  `json:"sequence"`
+	EntryID  string `json:"entry_id,omitempty"`
+	Reason   string `json:"reason"`
+}
+
+// VerifyResult is the outcome of walking an organization's audit chain
+type VerifyResult struct {
+	OrganizationID string      `json:"organization_id"`
+	Valid          bool        `json:"valid"`
+	EntriesChecked int64       `json:"entries_checked"`
+	HeadSequence   int64       `json:"head_sequence"`
+	HeadHash       string      `json:"head_hash"`
+	Break          *ChainBreak `json:"break,omitempty"`
+}
+
+// VerifyChain walks the organization's audit log in sequence order,
+// recomputing each entry's hash and checking it links to its predecessor,
+// and stops at the first broken or missing link. Entries written before
+// chaining was introduced have sequence 0 and are not covered.
+func VerifyChain(ctx context.Context, st store.Store, orgID string) (*VerifyResult, error) {
+	head, err := st.GetAuditChainHead(ctx, orgID)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &VerifyResult{
+		OrganizationID: orgID,
+		HeadSequence:   head.Sequence,
+		HeadHash:       head.Hash,
+	}
+
+	var prevSequence int64
+	var prevHash, prevID string
+	for {
+		// Each batch after the first re-reads the last verified sequence so a
+		// second entry claiming it is caught even across batch boundaries
+		after := prevSequence
+		if after > 0 {
+			after--
+		}
+		batch, err := st.ListAuditLogsBySequence(ctx, orgID, after, verifyBatchSize)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read audit chain: %w", err)
+		}
+
+		progressed := false
+		for _, entry := range batch {
+			if entry.ID == prevID {
+				continue
+			}
+
+			switch {
+			case prevSequence > 0 && entry.Sequence == prevSequence:
+				result.Break = &ChainBreak{Sequence: entry.Sequence, EntryID: entry.ID, Reason: ReasonDuplicate}
+			case entry.Sequence != prevSequence+1:
+				result.Break = &ChainBreak{Sequence: prevSequence + 1, Reason: ReasonMissing}
+			case entry.Hash != entry.ComputeHash():
+				result.Break = &ChainBreak{Sequence: entry.Sequence, EntryID: entry.ID, Reason: ReasonHashMismatch}
+			case entry.PrevHash != prevHash:
+				result.Break = &ChainBreak{Sequence: entry.Sequence, EntryID: entry.ID, Reason: ReasonPrevHashMismatch}
+			}
+			if result.Break != nil {
+				return result, nil
+			}
+
+			result.EntriesChecked++
+			prevSequence = entry.Sequence
+			prevHash = entry.Hash
+			prevID = entry.ID
+			progressed = true
+		}
+
+		if len(batch) < verifyBatchSize || !progressed {
+			break
+		}
+	}
+
+	// Entries deleted from the end of the chain leave the head ahead of the
+	// last entry; a rewritten tail leaves it pointing at a different hash
+	switch {
+	case head.Sequence > prevSequence:
+		result.Break = &ChainBreak{Sequence: prevSequence + 1, Reason: ReasonMissing}
+	case head.Sequence != prevSequence || head.Hash != prevHash:
+		result.Break = &ChainBreak{Sequence: prevSequence, Reason: ReasonHeadMismatch}
+	default:
+		result.Valid = true
+	}
+
+	return result, nil
+}
@@ -0,0 +1,222 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+
+	"compliancesync-api/internal/models"
+	"compliancesync-api/internal/store"
+)
+
+// Format is a streaming audit log export format
+type Format string
+
+const (
+	FormatNDJSON Format = "ndjson" // One JSON-encoded models.AuditLog per line
+	FormatCEF    Format = "cef"    // ArcSight Common Event Format, one event per line
+)
+
+// CEF header fields identifying the event source
+const (
+	cefVendor  = "ComplianceSync"
+	cefProduct = "ComplianceSync API"
+	cefVersion = "1.0"
+)
+
+// ContentType returns the MIME type of an export in this format
+func (f Format) ContentType() string {
+	switch f {
+	case FormatNDJSON:
+		return "application/x-ndjson"
+	default:
+		return "text/plain; charset=utf-8"
+	}
+}
+
+// Extension returns the file extension of an export in this format
+func (f Format) Extension() string {
+	switch f {
+	case FormatNDJSON:
+		return "ndjson"
+	default:
+		return "cef"
+	}
+}
+
+// Encoder writes audit log entries to an export stream
+type Encoder interface {
+	Encode(log *models.AuditLog) error
+}
+
+// NewEncoder returns an encoder writing entries to w in the given format
+func NewEncoder(format Format, w io.Writer) (Encoder, error) {
+	switch format {
+	case FormatNDJSON:
+		return &ndjsonEncoder{enc: json.NewEncoder(w)}, nil
+	case FormatCEF:
+		return &cefEncoder{w: w}, nil
+	default:
+		return nil, fmt.Errorf("unsupported export format %q (expected csv, ndjson or cef)", format)
+	}
+}
+
+// streamPageSize is the number of entries read per store call while streaming
+const streamPageSize = store.MaxPageSize
+
+// Stream writes every entry matching filter to enc, oldest first, reading
+// one page at a time so exports are not capped by memory. afterPage, if not
+// nil, runs after each page is encoded and can flush the underlying writer;
+// an error from it stops the stream. Stream returns the number of entries
+// written.
+func Stream(ctx context.Context, st store.Store, orgID string, filter store.AuditLogFilter, enc Encoder, afterPage func() error) (int, error) {
+	opts := store.ListOptions{PageSize: streamPageSize, SortBy: "timestamp", Order: "asc"}
+
+	written := 0
+	for {
+		logs, nextPageToken, err := st.ListAuditLogs(ctx, orgID, filter, opts)
+		if err != nil {
+			return written, err
+		}
+
+		for _, log := range logs {
+			if err := enc.Encode(log); err != nil {
+				return written, err
+			}
+			written++
+		}
+
+		if afterPage != nil {
+			if err := afterPage(); err != nil {
+				return written, err
+			}
+		}
+
+		if nextPageToken == "" {
+			return written, nil
+		}
+		opts.PageToken = nextPageToken
+	}
+}
+
+// ndjsonEncoder writes entries as newline-delimited JSON
+type ndjsonEncoder struct {
+	enc *json.Encoder
+}
+
+func (e *ndjsonEncoder) Encode(log *models.AuditLog) error {
+	return e.enc.Encode(log)
+}
+
+// cefEncoder writes entries as CEF:0 events
+type cefEncoder struct {
+	w io.Writer
+}
+
+func (e *cefEncoder) Encode(log *models.AuditLog) error {
+	_, err := io.WriteString(e.w, CEFEvent(log)+"\n")
+	return err
+}
+
+// CEFEvent renders an entry as a single CEF:0 event without a trailing
+// newline. The action is the signature ID, and the chain sequence and hash
+// are carried in custom fields so the SIEM can detect gaps and replays.
+func CEFEvent(log *models.AuditLog) string {
+	var ext []string
+	add := func(key, value string) {
+		if value != "" {
+			ext = append(ext, key+"="+cefExtensionEscaper.Replace(value))
+		}
+	}
+
+	add("rt", strconv.FormatInt(log.Timestamp.UnixMilli(), 10))
+	add("externalId", log.ID)
+	add("suid", log.UserID)
+	add("suser", log.UserEmail)
+	add("src", clientIP(log.IPAddress))
+	add("requestClientApplication", log.UserAgent)
+	add("msg", log.Description)
+	custom := func(key, label, value string) {
+		if value != "" {
+			add(key+"Label", label)
+			add(key, value)
+		}
+	}
+	custom("cs1", "organizationId", log.OrganizationID)
+	custom("cs2", "resourceType", log.ResourceType)
+	custom("cs3", "resourceId", log.ResourceID)
+	custom("cs5", "actorType", string(log.ActorType))
+	if log.Sequence > 0 {
+		custom("cn1", "sequence", strconv.FormatInt(log.Sequence, 10))
+		custom("cs4", "hash", log.Hash)
+	}
+
+	return fmt.Sprintf("CEF:0|%s|%s|%s|%s|%s|%d|%s",
+		cefHeaderEscaper.Replace(cefVendor),
+		cefHeaderEscaper.Replace(cefProduct),
+		cefHeaderEscaper.Replace(cefVersion),
+		cefHeaderEscaper.Replace(string(log.Action)),
+		cefHeaderEscaper.Replace(actionName(log.Action)),
+		actionSeverity(log.Action),
+		strings.Join(ext, " "))
+}
+
+// CEF escaping rules: header fields escape pipes, extension values escape
+// equals signs, and both escape backslashes and cannot contain raw newlines
+var (
+	cefHeaderEscaper    = strings.NewReplacer(`\`, `\\`, "|", `\|`, "\r", " ", "\n", " ")
+	cefExtensionEscaper = strings.NewReplacer(`\`, `\\`, "=", `\=`, "\r", `\r`, "\n", `\n`)
+)
+
+// actionName turns an action into a human readable event name
+func actionName(action models.AuditAction) string {
+	name := strings.ReplaceAll(string(action), "_", " ")
+	if name == "" {
+		return name
+	}
+	return strings.ToUpper(name[:1]) + name[1:]
+}
+
+// actionSeverity rates an action on the CEF 0-10 scale. Malware findings
+// rank highest, and destructive and access-changing actions rank above
+// routine reads and edits.
+func actionSeverity(action models.AuditAction) int {
+	switch action {
+	case models.ActionEvidenceQuarantined:
+		return 9
+	case models.ActionUserDeleted, models.ActionEvidenceDeleted, models.ActionRequirementDeactivated,
+		models.ActionIntegrationDisconnected, models.ActionMemberRemoved:
+		return 7
+	case models.ActionUserCreated, models.ActionUserUpdated, models.ActionOrgUpdated,
+		models.ActionClientCreated, models.ActionBaselineUpdated,
+		models.ActionIntegrationConnected, models.ActionSubscriptionUpdated, models.ActionPaymentMethodUpdated,
+		models.ActionInvitationCreated, models.ActionInvitationRevoked, models.ActionInvitationAccepted,
+		models.ActionMemberAdded, models.ActionMemberUpdated,
+		models.ActionAPIKeyCreated, models.ActionAPIKeyRevoked,
+		models.ActionAuditorGrantCreated, models.ActionAuditorGrantRevoked,
+		models.ActionSSOConfigUpdated, models.ActionDomainAdded, models.ActionDomainVerified, models.ActionDomainRemoved,
+		models.ActionRoleCreated, models.ActionRoleUpdated, models.ActionRoleDeleted:
+		return 5
+	case models.ActionEvidenceViewed, models.ActionEvidenceDownloaded, models.ActionRequirementViewed,
+		models.ActionReportViewed, models.ActionReportDownloaded, models.ActionLogin, models.ActionLogout:
+		return 2
+	default:
+		return 3
+	}
+}
+
+// clientIP strips the port from a recorded remote address, returning "" if
+// what remains is not an IP address
+func clientIP(addr string) string {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		addr = host
+	}
+	if net.ParseIP(addr) == nil {
+		return ""
+	}
+	return addr
+}
@@ -0,0 +1,166 @@
+package audit
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"compliancesync-api/internal/models"
+)
+
+// Syslog defaults
+const (
+	defaultSyslogAppName  = "compliancesync"
+	defaultSyslogFacility = 13 // log audit
+	syslogDialTimeout     = 10 * time.Second
+	syslogWriteTimeout    = 30 * time.Second
+
+	// syslogSDID names the structured data element carrying entry fields.
+	// 32473 is the example enterprise number reserved by RFC 5612.
+	syslogSDID = "compliancesync@32473"
+)
+
+// SyslogConfig configures a SyslogSink
+type SyslogConfig struct {
+	Address  string      // host:port of the collector
+	TLS      *tls.Config // nil sends over plain TCP
+	Hostname string      // HOSTNAME field; defaults to the machine's hostname
+	AppName  string      // APP-NAME field; defaults to compliancesync
+	Facility int         // Syslog facility; defaults to 13 (log audit)
+}
+
+// SyslogSink delivers entries as RFC 5424 messages over TCP or TLS, framed
+// by octet counting (RFC 6587). The message body is the entry's CEF event
+// and the structured data repeats its ID, sequence and hash.
+type SyslogSink struct {
+	config SyslogConfig
+	conn   net.Conn
+}
+
+// NewSyslogSink creates a sink for the collector at config.Address. The
+// connection is opened on first write and reopened after a failure.
+func NewSyslogSink(config SyslogConfig) *SyslogSink {
+	if config.Hostname == "" {
+		config.Hostname, _ = os.Hostname()
+	}
+	if config.AppName == "" {
+		config.AppName = defaultSyslogAppName
+	}
+	if config.Facility == 0 {
+		config.Facility = defaultSyslogFacility
+	}
+	return &SyslogSink{config: config}
+}
+
+// Write sends every entry in logs. Any failure drops the connection so the
+// next write starts on a fresh one.
+func (s *SyslogSink) Write(ctx context.Context, logs []*models.AuditLog) error {
+	if s.conn == nil {
+		conn, err := s.dial(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to connect to syslog collector: %w", err)
+		}
+		s.conn = conn
+	}
+
+	deadline := time.Now().Add(syslogWriteTimeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	s.conn.SetWriteDeadline(deadline)
+
+	w := bufio.NewWriter(s.conn)
+	for _, log := range logs {
+		msg := SyslogMessage(log, s.config.Hostname, s.config.AppName, s.config.Facility)
+		if _, err := fmt.Fprintf(w, "%d %s", len(msg), msg); err != nil {
+			s.Close()
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		s.Close()
+		return err
+	}
+
+	return nil
+}
+
+// Close closes the connection to the collector
+func (s *SyslogSink) Close() error {
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn = nil
+	return err
+}
+
+func (s *SyslogSink) dial(ctx context.Context) (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: syslogDialTimeout}
+	if s.config.TLS != nil {
+		tlsDialer := &tls.Dialer{NetDialer: dialer, Config: s.config.TLS}
+		return tlsDialer.DialContext(ctx, "tcp", s.config.Address)
+	}
+	return dialer.DialContext(ctx, "tcp", s.config.Address)
+}
+
+// SyslogMessage renders an entry as an RFC 5424 message without framing
+func SyslogMessage(log *models.AuditLog, hostname, appName string, facility int) string {
+	pri := facility*8 + syslogSeverity(log.Action)
+
+	sd := fmt.Sprintf(`[%s id="%s" org="%s" seq="%s" hash="%s"]`, syslogSDID,
+		sdEscaper.Replace(log.ID),
+		sdEscaper.Replace(log.OrganizationID),
+		strconv.FormatInt(log.Sequence, 10),
+		sdEscaper.Replace(log.Hash))
+
+	return fmt.Sprintf("<%d>1 %s %s %s - %s %s %s",
+		pri,
+		log.Timestamp.UTC().Format("2006-01-02T15:04:05.000000Z07:00"),
+		syslogHeaderField(hostname, 255),
+		syslogHeaderField(appName, 48),
+		syslogHeaderField(string(log.Action), 32),
+		sd,
+		CEFEvent(log))
+}
+
+// sdEscaper escapes structured data parameter values
+var sdEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "]", `\]`)
+
+// syslogHeaderField reduces a header field to printable ASCII without
+// spaces, truncated to max characters, with "-" standing in for empty
+func syslogHeaderField(value string, max int) string {
+	field := strings.Map(func(r rune) rune {
+		if r < 33 || r > 126 {
+			return -1
+		}
+		return r
+	}, value)
+	if len(field) > max {
+		field = field[:max]
+	}
+	if field == "" {
+		return "-"
+	}
+	return field
+}
+
+// syslogSeverity maps an action's CEF severity onto syslog severities:
+// warning for destructive actions, notice for access changes and
+// informational otherwise
+func syslogSeverity(action models.AuditAction) int {
+	switch severity := actionSeverity(action); {
+	case severity >= 7:
+		return 4
+	case severity >= 5:
+		return 5
+	default:
+		return 6
+	}
+}
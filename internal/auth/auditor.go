@@ -0,0 +1,64 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"compliancesync-api/internal/models"
+)
+
+// AuditorTokenPrefix marks bearer tokens that belong to an auditor grant
+const AuditorTokenPrefix = "csa_"
+
+// auditorTouchInterval limits how often a grant's last-accessed time is written
+const auditorTouchInterval = time.Minute
+
+// AuditorGrantStore looks up auditor grants during authentication.
+// store.Store satisfies it.
+type AuditorGrantStore interface {
+	GetAuditorGrantByHash(ctx context.Context, tokenHash string) (*models.AuditorGrant, error)
+	TouchAuditorGrant(ctx context.Context, grantID string, accessedAt time.Time) error
+}
+
+// GenerateAuditorToken returns a new random auditor access token
+func GenerateAuditorToken() (string, error) {
+	return newToken(AuditorTokenPrefix)
+}
+
+// HashAuditorToken returns the stored form of an auditor access token
+func HashAuditorToken(token string) string {
+	return hashToken(token)
+}
+
+// verifyAuditorToken checks an auditor access token and returns claims for
+// the auditor. Revoked, expired and unknown grants all wrap ErrInvalidToken.
+func (am *AuthMiddleware) verifyAuditorToken(ctx context.Context, token string) (*UserClaims, error) {
+	grant, err := am.store.GetAuditorGrantByHash(ctx, HashAuditorToken(token))
+	if err != nil {
+		return nil, fmt.Errorf("%w: unknown auditor token", ErrInvalidToken)
+	}
+
+	now := time.Now()
+	if !grant.IsActive(now) {
+		return nil, fmt.Errorf("%w: auditor grant revoked or expired", ErrInvalidToken)
+	}
+
+	// Last-accessed tracking is best effort and never fails the request
+	if grant.LastAccessedAt == nil || now.Sub(*grant.LastAccessedAt) >= auditorTouchInterval {
+		am.store.TouchAuditorGrant(ctx, grant.ID, now)
+	}
+
+	return &UserClaims{
+		UID:            grant.PrincipalID(),
+		Email:          grant.AuditorEmail,
+		OrganizationID: grant.OrganizationID,
+		AuditorGrantID: grant.ID,
+	}, nil
+}
+
+// isAuditorToken reports whether a bearer token is an auditor access token
+func isAuditorToken(token string) bool {
+	return strings.HasPrefix(token, AuditorTokenPrefix)
+}
@@ -0,0 +1,101 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Errors returned by authenticators
+var (
+	// ErrInvalidToken means the bearer token failed verification or lacks a required claim
+	ErrInvalidToken = errors.New("invalid or expired token")
+	// ErrUnsupported means the authenticator cannot manage user accounts;
+	// the external identity provider owns them instead
+	ErrUnsupported = errors.New("not supported by this authentication provider")
+	// ErrUserInactive means the token is valid but its user has been
+	// deactivated or deleted
+	ErrUserInactive = errors.New("this account has been deactivated")
+)
+
+// Authenticator verifies bearer tokens. FirebaseAuthenticator is the
+// production implementation; JWTAuthenticator verifies tokens locally for
+// deployments without Firebase.
+type Authenticator interface {
+	// VerifyToken checks the token and returns the caller's claims. Any
+	// failure, including a missing claim, wraps ErrInvalidToken.
+	VerifyToken(ctx context.Context, token string) (*UserClaims, error)
+}
+
+// UserManager manages accounts in the identity provider. Authenticators that
+// do not implement it leave account management to an external provider.
+type UserManager interface {
+	CreateUser(ctx context.Context, email, password, displayName string) (string, error)
+	SetCustomClaims(ctx context.Context, uid string, claims map[string]interface{}) error
+	SendPasswordResetEmail(ctx context.Context, email string) error
+	SendEmailVerification(ctx context.Context, email string) error
+	DeleteUser(ctx context.Context, uid string) error
+	RevokeTokens(ctx context.Context, uid string) error
+}
+
+// Options configures the authenticator created by Open
+type Options struct {
+	ProjectID       string // Firebase project
+	CredentialsFile string // Firebase service account JSON; empty uses default credentials
+	JWKSFile        string // JWT: JWKS file with RS256/ES256 public keys
+	HS256Secret     string // JWT: shared HS256 secret
+	Issuer          string // JWT: required iss claim, if set
+	Audience        string // JWT: required aud claim, if set
+}
+
+// Compile-time checks that the implementations satisfy the interfaces
+var (
+	_ Authenticator = (*FirebaseAuthenticator)(nil)
+	_ UserManager   = (*FirebaseAuthenticator)(nil)
+	_ Authenticator = (*JWTAuthenticator)(nil)
+)
+
+// Open creates the authenticator for the named provider: firebase or jwt
+func Open(ctx context.Context, provider string, opts Options) (Authenticator, error) {
+	switch provider {
+	case "firebase":
+		return NewFirebaseAuthenticator(ctx, opts.ProjectID, opts.CredentialsFile)
+	case "jwt":
+		return NewJWTAuthenticator(opts)
+	default:
+		return nil, fmt.Errorf("unknown AUTH_PROVIDER %q (expected firebase or jwt)", provider)
+	}
+}
+
+// claimsFromToken maps verified token claims onto UserClaims. email is
+// required; a missing email_verified is treated as false, and the iat,
+// organizationId and role claims are optional.
+func claimsFromToken(uid string, tokenClaims map[string]interface{}) (*UserClaims, error) {
+	if uid == "" {
+		return nil, fmt.Errorf("%w: missing subject", ErrInvalidToken)
+	}
+
+	email, ok := tokenClaims["email"].(string)
+	if !ok || email == "" {
+		return nil, fmt.Errorf("%w: missing email claim", ErrInvalidToken)
+	}
+
+	claims := &UserClaims{UID: uid, Email: email}
+	if verified, ok := tokenClaims["email_verified"].(bool); ok {
+		claims.EmailVerified = verified
+	}
+	if iat, ok := tokenClaims["iat"].(float64); ok {
+		claims.IssuedAt = time.Unix(int64(iat), 0)
+	}
+
+	// Extract custom claims if they exist
+	if orgID, ok := tokenClaims["organizationId"].(string); ok {
+		claims.OrganizationID = orgID
+	}
+	if role, ok := tokenClaims["role"].(string); ok {
+		claims.Role = role
+	}
+
+	return claims, nil
+}
@@ -0,0 +1,13 @@
+package auth
+
+// GenerateInvitationToken returns a new random invitation token. Invitation
+// tokens are redeemed by the accept endpoints rather than sent as bearer
+// tokens, so they carry no prefix.
+func GenerateInvitationToken() (string, error) {
+	return newToken("")
+}
+
+// HashInvitationToken returns the stored form of an invitation token
+func HashInvitationToken(token string) string {
+	return hashToken(token)
+}
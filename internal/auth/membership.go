@@ -0,0 +1,65 @@
+package auth
+
+import (
+	"context"
+	"errors"
+
+	"compliancesync-api/internal/models"
+)
+
+// OrganizationHeader selects the organization a request acts in, for users
+// who belong to more than one. It names the user's own organization, one
+// they are a member of or a client of their partner organization; without
+// it, requests act in the organization of the token or session.
+const OrganizationHeader = "X-Organization-ID"
+
+// ErrNotMember is returned when a request selects an organization the caller
+// does not belong to
+var ErrNotMember = errors.New("not a member of this organization")
+
+// MembershipStore looks up a user's memberships in other organizations,
+// and the partner managing an organization, during authentication.
+// store.Store satisfies it.
+type MembershipStore interface {
+	GetMembership(ctx context.Context, orgID, userID string) (*models.Membership, error)
+	GetOrganization(ctx context.Context, orgID string) (*models.Organization, error)
+}
+
+// OrganizationRole returns the role user acts with in orgID: their stored
+// role in their own organization, their membership's role in one they
+// joined, or their delegated role in a client of their partner
+// organization (see models.DelegatedRole). Any other organization fails
+// with ErrNotMember.
+func (am *AuthMiddleware) OrganizationRole(ctx context.Context, user *models.User, orgID string) (models.UserRole, error) {
+	if user.OrganizationID == orgID {
+		return user.Role, nil
+	}
+	if membership, err := am.store.GetMembership(ctx, orgID, user.UID); err == nil {
+		return membership.Role, nil
+	}
+	if org, err := am.store.GetOrganization(ctx, orgID); err == nil && org.IsClientOf(user.OrganizationID) {
+		return models.DelegatedRole(user.Role), nil
+	}
+	return "", ErrNotMember
+}
+
+// switchOrganization points claims at orgID with the caller's role there,
+// as given by OrganizationRole. API keys and auditor tokens are bound to
+// one organization and cannot switch.
+func (am *AuthMiddleware) switchOrganization(ctx context.Context, claims *UserClaims, orgID string) error {
+	if claims.IsAPIKey() || claims.IsAuditor() {
+		return ErrNotMember
+	}
+
+	user, err := am.store.GetUser(ctx, claims.UID)
+	if err != nil {
+		return ErrNotMember
+	}
+	role, err := am.OrganizationRole(ctx, user, orgID)
+	if err != nil {
+		return err
+	}
+	claims.OrganizationID = orgID
+	claims.Role = string(role)
+	return nil
+}
@@ -2,13 +2,13 @@ package auth
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"strings"
+	"time"
 
-	firebase "firebase.google.com/go/v4"
-	"firebase.google.com/go/v4/auth"
-	"google.golang.org/api/option"
+	"compliancesync-api/internal/models"
 )
 
 // ContextKey is a custom type for context keys to avoid collisions
@@ -24,37 +24,61 @@ type UserClaims struct {
 	UID            string
 	Email          string
 	EmailVerified  bool
-	OrganizationID string // From custom claims
-	Role           string // From custom claims
+	OrganizationID string               // From custom claims
+	Role           string               // From custom claims
+	APIKeyID       string               // Set when the request authenticated with an API key
+	Scopes         []models.APIKeyScope // API key scopes; empty for users
+	AuditorGrantID string               // Set when the request authenticated with an auditor token
+	SessionID      string               // Set when the request authenticated with an API-issued session
+	SessionOrgID   string               // Organization the session belongs to, even when the request selects another
+	AuthMethod     string               // How the user signed in, e.g. password or sso_oidc
+	IssuedAt       time.Time            // When the identity provider issued the token; zero for other credentials
 }
 
-// AuthMiddleware provides JWT authentication using Firebase Identity Platform
-type AuthMiddleware struct {
-	authClient *auth.Client
+// IsAPIKey reports whether the claims belong to an API key rather than a user
+func (c *UserClaims) IsAPIKey() bool {
+	return c.APIKeyID != ""
 }
 
-// NewAuthMiddleware creates a new authentication middleware
-func NewAuthMiddleware(ctx context.Context, projectID string, credentialsFile string) (*AuthMiddleware, error) {
-	var opts []option.ClientOption
-	if credentialsFile != "" {
-		opts = append(opts, option.WithCredentialsFile(credentialsFile))
-	}
+// IsAuditor reports whether the claims belong to an external auditor
+func (c *UserClaims) IsAuditor() bool {
+	return c.AuditorGrantID != ""
+}
 
-	config := &firebase.Config{ProjectID: projectID}
-	app, err := firebase.NewApp(ctx, config, opts...)
-	if err != nil {
-		return nil, fmt.Errorf("failed to initialize firebase app: %w", err)
-	}
+// AuthStore is the persistence the middleware needs for API keys, auditor
+// grants, sessions, custom roles and sign-in policies. store.Store satisfies it.
+type AuthStore interface {
+	APIKeyStore
+	AuditorGrantStore
+	SessionStore
+	MembershipStore
+	RoleStore
+	SSOConfigStore
+}
 
-	authClient, err := app.Auth(ctx)
-	if err != nil {
-		return nil, fmt.Errorf("failed to initialize firebase auth: %w", err)
-	}
+// AuthMiddleware authenticates requests with the configured Authenticator,
+// or with an organization API key, auditor token or session token when the
+// bearer token is one
+type AuthMiddleware struct {
+	authenticator Authenticator
+	store         AuthStore
+	roleCache     roleCache
+	ssoCache      ssoCache
+}
 
-	return &AuthMiddleware{authClient: authClient}, nil
+// NewAuthMiddleware creates a new authentication middleware
+func NewAuthMiddleware(authenticator Authenticator, st AuthStore) *AuthMiddleware {
+	return &AuthMiddleware{authenticator: authenticator, store: st}
 }
 
-// Authenticate is a middleware that verifies JWT tokens from Firebase
+// Authenticate is a middleware that verifies bearer tokens. Tokens with the
+// API key, auditor token or session token prefix are checked against the
+// stored API keys, auditor grants or sessions instead of the identity
+// provider. Identity provider tokens are rejected when the user has been
+// deactivated or their tokens revoked. The OrganizationHeader switches the
+// request to another organization the user belongs to. Identity
+// provider tokens, the sessions exchanged for them and switched requests
+// are rejected when the organization enforces single sign-on.
 func (am *AuthMiddleware) Authenticate(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// Extract token from Authorization header
@@ -73,27 +97,60 @@ func (am *AuthMiddleware) Authenticate(next http.Handler) http.Handler {
 
 		token := parts[1]
 
-		// Verify the token
-		decodedToken, err := am.authClient.VerifyIDToken(r.Context(), token)
+		// Verify the token and extract claims
+		var claims *UserClaims
+		var err error
+		var fromIdentityProvider bool
+		switch {
+		case isAPIKey(token):
+			claims, err = am.verifyAPIKey(r.Context(), token)
+		case isAuditorToken(token):
+			claims, err = am.verifyAuditorToken(r.Context(), token)
+		case isSessionToken(token):
+			claims, err = am.verifySession(r.Context(), token)
+		default:
+			claims, err = am.authenticator.VerifyToken(r.Context(), token)
+			fromIdentityProvider = true
+		}
 		if err != nil {
 			respondError(w, http.StatusUnauthorized, "invalid or expired token")
 			return
 		}
 
-		// Extract claims
-		claims := &UserClaims{
-			UID:           decodedToken.UID,
-			Email:         decodedToken.Claims["email"].(string),
-			EmailVerified: decodedToken.Claims["email_verified"].(bool),
+		// Check the stored user for identity provider tokens
+		if fromIdentityProvider {
+			if err := am.checkUser(r.Context(), claims); err != nil {
+				if errors.Is(err, ErrUserInactive) {
+					respondError(w, http.StatusForbidden, err.Error())
+				} else {
+					respondError(w, http.StatusUnauthorized, "invalid or expired token")
+				}
+				return
+			}
 		}
 
-		// Extract custom claims if they exist
-		if orgID, ok := decodedToken.Claims["organizationId"].(string); ok {
-			claims.OrganizationID = orgID
+		// Switch to the organization the request selects
+		var switched bool
+		if orgID := r.Header.Get(OrganizationHeader); orgID != "" && orgID != claims.OrganizationID {
+			if err := am.switchOrganization(r.Context(), claims, orgID); err != nil {
+				respondError(w, http.StatusForbidden, err.Error())
+				return
+			}
+			switched = true
 		}
 
-		if role, ok := decodedToken.Claims["role"].(string); ok {
-			claims.Role = role
+		// Enforce single sign-on for identity provider tokens, for sessions
+		// that were not started through it and for switched requests, whose
+		// sign-in was at another organization
+		if fromIdentityProvider || switched || (claims.SessionID != "" && !models.IsSSOAuthMethod(claims.AuthMethod)) {
+			if err := am.checkSSOPolicy(r.Context(), claims); err != nil {
+				if errors.Is(err, ErrSSORequired) {
+					respondError(w, http.StatusForbidden, err.Error())
+				} else {
+					respondError(w, http.StatusServiceUnavailable, "failed to check sign-in policy")
+				}
+				return
+			}
 		}
 
 		// Store claims in request context
@@ -104,8 +161,63 @@ func (am *AuthMiddleware) Authenticate(next http.Handler) http.Handler {
 	})
 }
 
-// RequireRole is a middleware that checks if the user has a specific role
-func (am *AuthMiddleware) RequireRole(roles ...string) func(http.Handler) http.Handler {
+// checkUser checks identity provider claims against the stored user and
+// replaces their organization and role with the stored ones, so custom
+// claims that are stale or failed to update grant nothing. Tokens for a
+// deactivated or deleted user fail with ErrUserInactive, and tokens issued
+// before the user's tokens were revoked wrap ErrInvalidToken. Only tokens
+// without an organization, as during registration, may belong to a user who
+// is not stored.
+func (am *AuthMiddleware) checkUser(ctx context.Context, claims *UserClaims) error {
+	user, err := am.store.GetUser(ctx, claims.UID)
+	if err != nil {
+		if claims.OrganizationID == "" {
+			return nil
+		}
+		return fmt.Errorf("%w: unknown user", ErrInvalidToken)
+	}
+	if user.Status == "inactive" || user.Status == "deleted" {
+		return ErrUserInactive
+	}
+	if user.TokensRevoked(claims.IssuedAt) {
+		return fmt.Errorf("%w: token revoked", ErrInvalidToken)
+	}
+	claims.OrganizationID = user.OrganizationID
+	claims.Role = string(user.Role)
+	return nil
+}
+
+// HasPermission reports whether the caller is granted permission: by one of
+// the scopes for API keys, by the stored permission set for a custom role,
+// or by the permission registry for a built-in role. A custom role that
+// cannot be read grants nothing, and auditors, who are limited to the
+// auditor portal, are granted nothing.
+func (am *AuthMiddleware) HasPermission(ctx context.Context, claims *UserClaims, permission models.Permission) bool {
+	if claims.IsAuditor() {
+		return false
+	}
+	if claims.IsAPIKey() {
+		for _, scope := range claims.Scopes {
+			if models.ScopeHasPermission(scope, permission) {
+				return true
+			}
+		}
+		return false
+	}
+
+	role := models.UserRole(claims.Role)
+	if roleID, ok := role.CustomRoleID(); ok {
+		custom, err := am.customRole(ctx, claims.OrganizationID, roleID)
+		if err != nil {
+			return false
+		}
+		return custom.HasPermission(permission)
+	}
+	return models.RoleHasPermission(role, permission)
+}
+
+// RequirePermission is a middleware that checks if the caller is granted a permission
+func (am *AuthMiddleware) RequirePermission(permission models.Permission) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			claims, ok := r.Context().Value(UserContextKey).(*UserClaims)
@@ -114,17 +226,8 @@ func (am *AuthMiddleware) RequireRole(roles ...string) func(http.Handler) http.H
 				return
 			}
 
-			// Check if user has one of the required roles
-			hasRole := false
-			for _, role := range roles {
-				if claims.Role == role {
-					hasRole = true
-					break
-				}
-			}
-
-			if !hasRole {
-				respondError(w, http.StatusForbidden, "insufficient permissions")
+			if !am.HasPermission(r.Context(), claims, permission) {
+				respondError(w, http.StatusForbidden, fmt.Sprintf("%s permission required", permission))
 				return
 			}
 
@@ -133,6 +236,48 @@ func (am *AuthMiddleware) RequireRole(roles ...string) func(http.Handler) http.H
 	}
 }
 
+// RequireUser is a middleware that rejects API keys and auditors on routes
+// that act on the caller's own user account
+func (am *AuthMiddleware) RequireUser(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := r.Context().Value(UserContextKey).(*UserClaims)
+		if !ok {
+			respondError(w, http.StatusUnauthorized, "authentication required")
+			return
+		}
+
+		if claims.IsAPIKey() {
+			respondError(w, http.StatusForbidden, "API keys cannot access this endpoint")
+			return
+		}
+		if claims.IsAuditor() {
+			respondError(w, http.StatusForbidden, "auditors cannot access this endpoint")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RequireAuditor is a middleware that admits only auditor tokens, for the
+// auditor portal
+func (am *AuthMiddleware) RequireAuditor(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := r.Context().Value(UserContextKey).(*UserClaims)
+		if !ok {
+			respondError(w, http.StatusUnauthorized, "authentication required")
+			return
+		}
+
+		if !claims.IsAuditor() {
+			respondError(w, http.StatusForbidden, "auditor access token required")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
 // RequireOrganization is a middleware that ensures the user belongs to an organization
 func (am *AuthMiddleware) RequireOrganization(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -160,63 +305,69 @@ func GetUserClaims(r *http.Request) (*UserClaims, error) {
 	return claims, nil
 }
 
-// SetCustomClaims sets custom claims for a user in Firebase
+// userManager returns the authenticator's account management, or
+// ErrUnsupported when accounts live in an external identity provider
+func (am *AuthMiddleware) userManager() (UserManager, error) {
+	um, ok := am.authenticator.(UserManager)
+	if !ok {
+		return nil, ErrUnsupported
+	}
+	return um, nil
+}
+
+// SetCustomClaims sets custom claims for a user in the identity provider
 func (am *AuthMiddleware) SetCustomClaims(ctx context.Context, uid string, claims map[string]interface{}) error {
-	if err := am.authClient.SetCustomUserClaims(ctx, uid, claims); err != nil {
-		return fmt.Errorf("failed to set custom claims: %w", err)
+	um, err := am.userManager()
+	if err != nil {
+		return err
 	}
-	return nil
+	return um.SetCustomClaims(ctx, uid, claims)
 }
 
-// CreateUser creates a new user in Firebase Auth
+// CreateUser creates a new user in the identity provider
 func (am *AuthMiddleware) CreateUser(ctx context.Context, email, password, displayName string) (string, error) {
-	params := (&auth.UserToCreate{}).
-		Email(email).
-		Password(password).
-		DisplayName(displayName).
-		EmailVerified(false)
-
-	user, err := am.authClient.CreateUser(ctx, params)
+	um, err := am.userManager()
 	if err != nil {
-		return "", fmt.Errorf("failed to create user: %w", err)
+		return "", err
 	}
-
-	return user.UID, nil
+	return um.CreateUser(ctx, email, password, displayName)
 }
 
 // SendPasswordResetEmail sends a password reset email
 func (am *AuthMiddleware) SendPasswordResetEmail(ctx context.Context, email string) error {
-	link, err := am.authClient.PasswordResetLink(ctx, email)
+	um, err := am.userManager()
 	if err != nil {
-		return fmt.Errorf("failed to generate password reset link: %w", err)
+		return err
 	}
-
-	// In production, this would send an email via SendGrid
-	// For now, we'll just return the link (could be logged or returned to user in dev mode)
-	fmt.Printf("Password reset link for %s: %s\n", email, link)
-
-	return nil
+	return um.SendPasswordResetEmail(ctx, email)
 }
 
 // SendEmailVerification sends an email verification link
 func (am *AuthMiddleware) SendEmailVerification(ctx context.Context, email string) error {
-	link, err := am.authClient.EmailVerificationLink(ctx, email)
+	um, err := am.userManager()
 	if err != nil {
-		return fmt.Errorf("failed to generate email verification link: %w", err)
+		return err
 	}
-
-	// In production, this would send an email via SendGrid
-	fmt.Printf("Email verification link for %s: %s\n", email, link)
-
-	return nil
+	return um.SendEmailVerification(ctx, email)
 }
 
-// DeleteUser deletes a user from Firebase Auth
+// DeleteUser deletes a user from the identity provider
 func (am *AuthMiddleware) DeleteUser(ctx context.Context, uid string) error {
-	if err := am.authClient.DeleteUser(ctx, uid); err != nil {
-		return fmt.Errorf("failed to delete user: %w", err)
+	um, err := am.userManager()
+	if err != nil {
+		return err
 	}
-	return nil
+	return um.DeleteUser(ctx, uid)
+}
+
+// RevokeTokens revokes a user's refresh tokens in the identity provider, so
+// they cannot obtain new ID tokens without signing in again
+func (am *AuthMiddleware) RevokeTokens(ctx context.Context, uid string) error {
+	um, err := am.userManager()
+	if err != nil {
+		return err
+	}
+	return um.RevokeTokens(ctx, uid)
 }
 
 // Helper function to respond with JSON error
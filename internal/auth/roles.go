@@ -0,0 +1,85 @@
+package auth
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"compliancesync-api/internal/models"
+)
+
+// roleCacheTTL bounds how long a custom role's permissions are reused before
+// being read again, and so how long an edit made on another instance takes
+// to apply
+const roleCacheTTL = 30 * time.Second
+
+// RoleStore looks up custom roles during authorization. store.Store
+// satisfies it.
+type RoleStore interface {
+	GetRole(ctx context.Context, orgID, roleID string) (*models.Role, error)
+}
+
+// roleCache holds recently read custom roles, keyed by organization and role ID
+type roleCache struct {
+	mu      sync.Mutex
+	entries map[string]roleCacheEntry
+}
+
+type roleCacheEntry struct {
+	role    *models.Role
+	expires time.Time
+}
+
+func roleCacheKey(orgID, roleID string) string {
+	return orgID + "/" + roleID
+}
+
+func (c *roleCache) get(orgID, roleID string, now time.Time) (*models.Role, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[roleCacheKey(orgID, roleID)]
+	if !ok || !now.Before(entry.expires) {
+		return nil, false
+	}
+	return entry.role, true
+}
+
+func (c *roleCache) put(role *models.Role, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.entries == nil {
+		c.entries = make(map[string]roleCacheEntry)
+	}
+	c.entries[roleCacheKey(role.OrganizationID, role.ID)] = roleCacheEntry{role: role, expires: now.Add(roleCacheTTL)}
+}
+
+func (c *roleCache) remove(orgID, roleID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.entries, roleCacheKey(orgID, roleID))
+}
+
+// customRole returns the custom role the claims assign, reading it from the
+// store unless a recent copy is cached
+func (am *AuthMiddleware) customRole(ctx context.Context, orgID, roleID string) (*models.Role, error) {
+	now := time.Now()
+	if role, ok := am.roleCache.get(orgID, roleID, now); ok {
+		return role, nil
+	}
+
+	role, err := am.store.GetRole(ctx, orgID, roleID)
+	if err != nil {
+		return nil, err
+	}
+	am.roleCache.put(role, now)
+	return role, nil
+}
+
+// InvalidateRole drops a custom role from the permission cache so an edit or
+// deletion applies to this instance's next request
+func (am *AuthMiddleware) InvalidateRole(orgID, roleID string) {
+	am.roleCache.remove(orgID, roleID)
+}
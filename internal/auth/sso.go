@@ -0,0 +1,97 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"compliancesync-api/internal/models"
+)
+
+// ErrSSORequired means the organization only allows its users to sign in
+// through single sign-on
+var ErrSSORequired = errors.New("single sign-on is required for this organization")
+
+// ssoCacheTTL bounds how long an organization's sign-in policy is reused
+// before being read again
+const ssoCacheTTL = 30 * time.Second
+
+// SSOConfigStore looks up organizations' single sign-on configuration during
+// authentication. store.Store satisfies it.
+type SSOConfigStore interface {
+	// GetSSOConfig returns nil when the organization has not configured
+	// single sign-on
+	GetSSOConfig(ctx context.Context, orgID string) (*models.SSOConfig, error)
+}
+
+// ssoCache holds recently read single sign-on configurations, keyed by
+// organization ID. A nil configuration is cached too.
+type ssoCache struct {
+	mu      sync.Mutex
+	entries map[string]ssoCacheEntry
+}
+
+type ssoCacheEntry struct {
+	config  *models.SSOConfig
+	expires time.Time
+}
+
+func (c *ssoCache) get(orgID string, now time.Time) (*models.SSOConfig, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[orgID]
+	if !ok || !now.Before(entry.expires) {
+		return nil, false
+	}
+	return entry.config, true
+}
+
+func (c *ssoCache) put(orgID string, config *models.SSOConfig, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.entries == nil {
+		c.entries = make(map[string]ssoCacheEntry)
+	}
+	c.entries[orgID] = ssoCacheEntry{config: config, expires: now.Add(ssoCacheTTL)}
+}
+
+func (c *ssoCache) remove(orgID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.entries, orgID)
+}
+
+// checkSSOPolicy returns ErrSSORequired when the claims came from a sign-in
+// method other than single sign-on and the user's organization enforces it.
+// Built-in admins are exempt so a broken identity provider can be repaired.
+func (am *AuthMiddleware) checkSSOPolicy(ctx context.Context, claims *UserClaims) error {
+	if claims.OrganizationID == "" {
+		return nil
+	}
+
+	now := time.Now()
+	config, ok := am.ssoCache.get(claims.OrganizationID, now)
+	if !ok {
+		var err error
+		config, err = am.store.GetSSOConfig(ctx, claims.OrganizationID)
+		if err != nil {
+			return err
+		}
+		am.ssoCache.put(claims.OrganizationID, config, now)
+	}
+
+	if config != nil && config.RequiresSSO(models.UserRole(claims.Role)) {
+		return ErrSSORequired
+	}
+	return nil
+}
+
+// InvalidateSSOConfig drops an organization's sign-in policy from the cache
+// so a configuration change applies to this instance's next request
+func (am *AuthMiddleware) InvalidateSSOConfig(orgID string) {
+	am.ssoCache.remove(orgID)
+}
@@ -0,0 +1,80 @@
+package models
+
+import "time"
+
+// APIKeyScope grants an API key access to one resource, read or write
+type APIKeyScope string
+
+const (
+	ScopeRequirementsRead  APIKeyScope = "requirements:read"
+	ScopeRequirementsWrite APIKeyScope = "requirements:write"
+	ScopeEvidenceRead      APIKeyScope = "evidence:read"
+	ScopeEvidenceWrite     APIKeyScope = "evidence:write"
+	ScopeReportsRead       APIKeyScope = "reports:read"
+	ScopeReportsWrite      APIKeyScope = "reports:write"
+	ScopeAuditRead         APIKeyScope = "audit:read"
+	ScopeSCIM              APIKeyScope = "scim" // User provisioning from an identity provider
+)
+
+// IsValidAPIKeyScope reports whether scope is one of the defined scopes
+func IsValidAPIKeyScope(scope APIKeyScope) bool {
+	switch scope {
+	case ScopeRequirementsRead, ScopeRequirementsWrite, ScopeEvidenceRead, ScopeEvidenceWrite,
+		ScopeReportsRead, ScopeReportsWrite, ScopeAuditRead, ScopeSCIM:
+		return true
+	default:
+		return false
+	}
+}
+
+// APIKey is an organization-scoped credential for machine-to-machine access.
+// Only a hash of the key is stored; the key itself is shown once, when it is
+// created.
+type APIKey struct {
+	ID             string        `firestore:"id" json:"id"`
+	OrganizationID string        `firestore:"organization_id" json:"organization_id"`
+	Name           string        `firestore:"name" json:"name"`
+	Prefix         string        `firestore:"prefix" json:"prefix"` // Leading characters of the key, for identifying it
+	KeyHash        string        `firestore:"key_hash" json:"-"`    // SHA-256 of the key; not exposed in JSON
+	Scopes         []APIKeyScope `firestore:"scopes" json:"scopes"`
+	CreatedBy      string        `firestore:"created_by" json:"created_by"`
+	CreatedAt      time.Time     `firestore:"created_at" json:"created_at"`
+	ExpiresAt      *time.Time    `firestore:"expires_at,omitempty" json:"expires_at,omitempty"` // Never expires when nil
+	LastUsedAt     *time.Time    `firestore:"last_used_at,omitempty" json:"last_used_at,omitempty"`
+	RevokedAt      *time.Time    `firestore:"revoked_at,omitempty" json:"revoked_at,omitempty"`
+	RevokedBy      string        `firestore:"revoked_by,omitempty" json:"revoked_by,omitempty"`
+}
+
+// IsActive reports whether the key can still authenticate
+func (k *APIKey) IsActive(now time.Time) bool {
+	if k.RevokedAt != nil {
+		return false
+	}
+	return k.ExpiresAt == nil || now.Before(*k.ExpiresAt)
+}
+
+// HasScope reports whether the key was granted scope
+func (k *APIKey) HasScope(scope APIKeyScope) bool {
+	for _, s := range k.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// HasPermission reports whether any of the key's scopes grants permission
+func (k *APIKey) HasPermission(permission Permission) bool {
+	for _, s := range k.Scopes {
+		if ScopeHasPermission(s, permission) {
+			return true
+		}
+	}
+	return false
+}
+
+// PrincipalID is the user ID recorded for actions taken with the key, so
+// audit log entries attribute them to the key rather than a person
+func (k *APIKey) PrincipalID() string {
+	return apiKeyPrincipalPrefix + k.ID
+}
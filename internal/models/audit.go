@@ -1,6 +1,12 @@
 package models
 
-import "time"
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"time"
+)
 
 // AuditAction represents the type of action performed
 type AuditAction string
@@ -11,23 +17,82 @@ const (
 	ActionUserCreated        AuditAction = "user_created"
 	ActionUserUpdated        AuditAction = "user_updated"
 	ActionUserDeleted        AuditAction = "user_deleted"
+	ActionInvitationCreated  AuditAction = "invitation_created"
+	ActionInvitationResent   AuditAction = "invitation_resent"
+	ActionInvitationRevoked  AuditAction = "invitation_revoked"
+	ActionInvitationExpired  AuditAction = "invitation_expired"
+	ActionInvitationAccepted AuditAction = "invitation_accepted"
+	ActionMemberAdded        AuditAction = "member_added"
+	ActionMemberUpdated      AuditAction = "member_updated"
+	ActionMemberRemoved      AuditAction = "member_removed"
+	ActionRoleCreated        AuditAction = "role_created"
+	ActionRoleUpdated        AuditAction = "role_updated"
+	ActionRoleDeleted        AuditAction = "role_deleted"
+	ActionAPIKeyCreated      AuditAction = "api_key_created"
+	ActionAPIKeyRevoked      AuditAction = "api_key_revoked"
+	ActionAuditorGrantCreated AuditAction = "auditor_grant_created"
+	ActionAuditorGrantRevoked AuditAction = "auditor_grant_revoked"
+	ActionSSOConfigUpdated   AuditAction = "sso_config_updated"
+	ActionDomainAdded        AuditAction = "domain_added"
+	ActionDomainVerified     AuditAction = "domain_verified"
+	ActionDomainRemoved      AuditAction = "domain_removed"
 	ActionOrgCreated         AuditAction = "organization_created"
 	ActionOrgUpdated         AuditAction = "organization_updated"
+	ActionClientCreated      AuditAction = "client_created"
+	ActionBaselineUpdated    AuditAction = "baseline_updated"
 	ActionRequirementActivated AuditAction = "requirement_activated"
 	ActionRequirementUpdated AuditAction = "requirement_updated"
+	ActionRequirementViewed  AuditAction = "requirement_viewed"
 	ActionRequirementDeactivated AuditAction = "requirement_deactivated"
 	ActionEvidenceCreated    AuditAction = "evidence_created"
 	ActionEvidenceUpdated    AuditAction = "evidence_updated"
 	ActionEvidenceDeleted    AuditAction = "evidence_deleted"
 	ActionEvidenceViewed     AuditAction = "evidence_viewed"
 	ActionEvidenceDownloaded AuditAction = "evidence_downloaded"
+	ActionEvidenceMerged     AuditAction = "evidence_merged"
+	ActionEvidenceVersionAdded AuditAction = "evidence_version_added"
+	ActionEvidenceScanned    AuditAction = "evidence_scanned"
+	ActionEvidenceQuarantined AuditAction = "evidence_quarantined"
+	ActionEvidenceCountsReconciled AuditAction = "evidence_counts_reconciled"
 	ActionReportGenerated    AuditAction = "report_generated"
+	ActionReportViewed       AuditAction = "report_viewed"
+	ActionReportDownloaded   AuditAction = "report_downloaded"
 	ActionIntegrationConnected AuditAction = "integration_connected"
 	ActionIntegrationDisconnected AuditAction = "integration_disconnected"
 	ActionSubscriptionUpdated AuditAction = "subscription_updated"
 	ActionPaymentMethodUpdated AuditAction = "payment_method_updated"
 )
 
+// ActorType is the kind of principal that performed an audited action
+type ActorType string
+
+const (
+	ActorUser    ActorType = "user"
+	ActorAPIKey  ActorType = "api_key"
+	ActorAuditor ActorType = "auditor"
+	ActorSystem  ActorType = "system" // Background workers; no user ID
+)
+
+// Principals that are not users are recorded with a prefixed user ID
+const (
+	apiKeyPrincipalPrefix  = "apikey:"
+	auditorPrincipalPrefix = "auditor:"
+)
+
+// ActorTypeOf returns the kind of principal a recorded user ID belongs to
+func ActorTypeOf(userID string) ActorType {
+	switch {
+	case userID == "":
+		return ActorSystem
+	case strings.HasPrefix(userID, apiKeyPrincipalPrefix):
+		return ActorAPIKey
+	case strings.HasPrefix(userID, auditorPrincipalPrefix):
+		return ActorAuditor
+	default:
+		return ActorUser
+	}
+}
+
 // AuditLog represents an immutable audit log entry
 type AuditLog struct {
 	ID             string      `firestore:"id" json:"id"`
@@ -35,6 +100,7 @@ type AuditLog struct {
 	Timestamp      time.Time   `firestore:"timestamp" json:"timestamp"` // Server timestamp
 	UserID         string      `firestore:"user_id" json:"user_id"`
 	UserEmail      string      `firestore:"user_email" json:"user_email"`
+	ActorType      ActorType   `firestore:"actor_type,omitempty" json:"actor_type,omitempty"` // Empty on entries recorded before actor types
 	Action         AuditAction `firestore:"action" json:"action"`
 	ResourceType   string      `firestore:"resource_type" json:"resource_type"` // requirement, evidence, user, etc.
 	ResourceID     string      `firestore:"resource_id,omitempty" json:"resource_id,omitempty"`
@@ -43,6 +109,89 @@ type AuditLog struct {
 	IPAddress      string      `firestore:"ip_address,omitempty" json:"ip_address,omitempty"`
 	UserAgent      string      `firestore:"user_agent,omitempty" json:"user_agent,omitempty"`
 	Metadata       map[string]interface{} `firestore:"metadata,omitempty" json:"metadata,omitempty"`
+	Sequence       int64       `firestore:"sequence" json:"sequence"` // Position in the organization's hash chain, starting at 1
+	PrevHash       string      `firestore:"prev_hash" json:"prev_hash"` // Hash of the previous entry; empty for the first
+	Hash           string      `firestore:"hash" json:"hash"` // ComputeHash of this entry
+}
+
+// Chain makes the entry the successor of the entry with the given sequence
+// and hash. Stores call it just before persisting, once ID is set. The
+// timestamp and the Changes and Metadata maps are first normalized to the
+// form every backend returns them in, so the hash still verifies after a
+// round trip through storage. An unset actor type is derived from UserID.
+func (l *AuditLog) Chain(prevSequence int64, prevHash string) {
+	if l.ActorType == "" {
+		l.ActorType = ActorTypeOf(l.UserID)
+	}
+	l.Timestamp = l.Timestamp.UTC().Truncate(time.Microsecond)
+	l.Changes = canonicalJSON(l.Changes)
+	l.Metadata = canonicalJSON(l.Metadata)
+	l.Sequence = prevSequence + 1
+	l.PrevHash = prevHash
+	l.Hash = l.ComputeHash()
+}
+
+// ComputeHash returns the hex SHA-256 of the entry's content and PrevHash
+func (l *AuditLog) ComputeHash() string {
+	input := struct {
+		ID             string      `json:"id"`
+		OrganizationID string      `json:"organization_id"`
+		Sequence       int64       `json:"sequence"`
+		Timestamp      string      `json:"timestamp"`
+		UserID         string      `json:"user_id"`
+		UserEmail      string      `json:"user_email"`
+		ActorType      ActorType   `json:"actor_type,omitempty"` // Omitted when empty so older entries still verify
+		Action         AuditAction `json:"action"`
+		ResourceType   string      `json:"resource_type"`
+		ResourceID     string      `json:"resource_id"`
+		Description    string      `json:"description"`
+		Changes        map[string]interface{} `json:"changes"`
+		IPAddress      string      `json:"ip_address"`
+		UserAgent      string      `json:"user_agent"`
+		Metadata       map[string]interface{} `json:"metadata"`
+		PrevHash       string      `json:"prev_hash"`
+	}{
+		ID:             l.ID,
+		OrganizationID: l.OrganizationID,
+		Sequence:       l.Sequence,
+		Timestamp:      l.Timestamp.UTC().Format(time.RFC3339Nano),
+		UserID:         l.UserID,
+		UserEmail:      l.UserEmail,
+		ActorType:      l.ActorType,
+		Action:         l.Action,
+		ResourceType:   l.ResourceType,
+		ResourceID:     l.ResourceID,
+		Description:    l.Description,
+		Changes:        canonicalJSON(l.Changes),
+		IPAddress:      l.IPAddress,
+		UserAgent:      l.UserAgent,
+		Metadata:       canonicalJSON(l.Metadata),
+		PrevHash:       l.PrevHash,
+	}
+
+	data, _ := json.Marshal(input)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// canonicalJSON converts a map to the generic form it decodes to from JSON,
+// so structs, typed slices, times and integer kinds become the maps,
+// []interface{}, strings and float64 values a backend hands back. Empty maps
+// are treated as absent because backends drop them.
+func canonicalJSON(m map[string]interface{}) map[string]interface{} {
+	if len(m) == 0 {
+		return nil
+	}
+
+	data, err := json.Marshal(m)
+	if err != nil {
+		return nil
+	}
+	var v map[string]interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return nil
+	}
+	return v
 }
 
 // Report represents a generated compliance report
@@ -53,6 +202,7 @@ type Report struct {
 	Description    string    `firestore:"description,omitempty" json:"description,omitempty"`
 	Type           string    `firestore:"type" json:"type"` // requirement_detail, comprehensive
 	RequirementIDs []string  `firestore:"requirement_ids" json:"requirement_ids"`
+	AsOf           *time.Time `firestore:"as_of,omitempty" json:"as_of,omitempty"` // Evidence files are shown at the version current on this date; nil means the latest
 	Status         string    `firestore:"status" json:"status"` // pending, generating, completed, failed
 	FileURL        string    `firestore:"file_url,omitempty" json:"file_url,omitempty"` // Cloud Storage path
 	GeneratedBy    string    `firestore:"generated_by" json:"generated_by"`
@@ -0,0 +1,76 @@
+package models
+
+import "time"
+
+// AuditorGrant gives an external auditor or regulator time-boxed, read-only
+// access to a subset of an organization's requirements, the evidence dated
+// within a window that supports them, and selected reports. Auditors are not
+// users and do not hold a seat. Only a hash of the access token is stored;
+// the token itself is sent to the auditor when the grant is created.
+type AuditorGrant struct {
+	ID             string     `firestore:"id" json:"id"`
+	OrganizationID string     `firestore:"organization_id" json:"organization_id"`
+	AuditorEmail   string     `firestore:"auditor_email" json:"auditor_email"`
+	AuditorName    string     `firestore:"auditor_name,omitempty" json:"auditor_name,omitempty"`
+	Purpose        string     `firestore:"purpose,omitempty" json:"purpose,omitempty"` // e.g. the examination or engagement
+	RequirementIDs []string   `firestore:"requirement_ids" json:"requirement_ids"`
+	ReportIDs      []string   `firestore:"report_ids" json:"report_ids"`
+	WindowStart    time.Time  `firestore:"window_start" json:"window_start"` // Inclusive lower bound on evidence date
+	WindowEnd      time.Time  `firestore:"window_end" json:"window_end"`     // Exclusive upper bound on evidence date
+	ExpiresAt      time.Time  `firestore:"expires_at" json:"expires_at"`
+	TokenHash      string     `firestore:"token_hash" json:"-"` // SHA-256 of the access token; not exposed in JSON
+	CreatedBy      string     `firestore:"created_by" json:"created_by"`
+	CreatedAt      time.Time  `firestore:"created_at" json:"created_at"`
+	LastAccessedAt *time.Time `firestore:"last_accessed_at,omitempty" json:"last_accessed_at,omitempty"`
+	RevokedAt      *time.Time `firestore:"revoked_at,omitempty" json:"revoked_at,omitempty"`
+	RevokedBy      string     `firestore:"revoked_by,omitempty" json:"revoked_by,omitempty"`
+}
+
+// IsActive reports whether the grant can still authenticate
+func (g *AuditorGrant) IsActive(now time.Time) bool {
+	return g.RevokedAt == nil && now.Before(g.ExpiresAt)
+}
+
+// CoversRequirement reports whether the requirement is part of the grant
+func (g *AuditorGrant) CoversRequirement(requirementID string) bool {
+	return containsString(g.RequirementIDs, requirementID)
+}
+
+// CoversReport reports whether the report was shared with the auditor
+func (g *AuditorGrant) CoversReport(reportID string) bool {
+	return containsString(g.ReportIDs, reportID)
+}
+
+// CoversEvidence reports whether the auditor may see an evidence item: it
+// must be active, dated within the window and support a granted requirement
+func (g *AuditorGrant) CoversEvidence(e *Evidence) bool {
+	if e.Status != "active" || !g.InWindow(e.EvidenceDate) {
+		return false
+	}
+	for _, id := range e.RequirementIDs {
+		if g.CoversRequirement(id) {
+			return true
+		}
+	}
+	return false
+}
+
+// InWindow reports whether t falls within the grant's evidence date window
+func (g *AuditorGrant) InWindow(t time.Time) bool {
+	return !t.Before(g.WindowStart) && t.Before(g.WindowEnd)
+}
+
+// PrincipalID is the user ID recorded for actions taken under the grant, so
+// audit log entries attribute them to the auditor rather than a user
+func (g *AuditorGrant) PrincipalID() string {
+	return auditorPrincipalPrefix + g.ID
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -27,13 +27,66 @@ type Evidence struct {
 	FileName       string         `firestore:"file_name,omitempty" json:"file_name,omitempty"`
 	FileSize       int64          `firestore:"file_size,omitempty" json:"file_size,omitempty"`
 	FileType       string         `firestore:"file_type,omitempty" json:"file_type,omitempty"`
+	ContentHash    string         `firestore:"content_hash,omitempty" json:"content_hash,omitempty"` // Hex SHA-256 of the file, computed when the upload is finalized
+	FileVersion    int            `firestore:"file_version,omitempty" json:"file_version,omitempty"` // Number of the current EvidenceVersion; 0 for files finalized before versioning
 	ExternalLink   string         `firestore:"external_link,omitempty" json:"external_link,omitempty"` // Link to source (Gmail, Drive, etc.)
 	Metadata       map[string]interface{} `firestore:"metadata,omitempty" json:"metadata,omitempty"` // Additional metadata based on source
+	Tags           []string       `firestore:"tags,omitempty" json:"tags,omitempty"` // Free-form labels used in search
 	RequirementIDs []string       `firestore:"requirement_ids" json:"requirement_ids"` // Associated requirements
 	UploadedBy     string         `firestore:"uploaded_by" json:"uploaded_by"` // User UID
 	CreatedAt      time.Time      `firestore:"created_at" json:"created_at"`
 	UpdatedAt      time.Time      `firestore:"updated_at" json:"updated_at"`
-	Status         string         `firestore:"status" json:"status"` // uploading, active, deleted
+	Scan           *EvidenceScan  `firestore:"scan,omitempty" json:"scan,omitempty"` // Malware scan of the current file; nil when not scanned
+	Status         string         `firestore:"status" json:"status"` // uploading, active, quarantined, deleted
+	Version        int64          `firestore:"version" json:"version"` // Incremented on every write; exposed as the ETag
+}
+
+// Malware scan verdicts
+const (
+	ScanClean    = "clean"
+	ScanInfected = "infected"
+)
+
+// EvidenceScan records a malware scan of an evidence file. Evidence whose
+// file is infected is quarantined: it counts toward no requirement and
+// cannot be downloaded.
+type EvidenceScan struct {
+	Verdict     string    `firestore:"verdict" json:"verdict"` // clean or infected
+	Signature   string    `firestore:"signature,omitempty" json:"signature,omitempty"` // Malware found in an infected file
+	Scanner     string    `firestore:"scanner" json:"scanner"` // clamav or fake
+	ContentHash string    `firestore:"content_hash" json:"content_hash"` // Hash of the scanned file
+	ScannedAt   time.Time `firestore:"scanned_at" json:"scanned_at"`
+}
+
+// EvidenceVersion is one revision of an evidence item's file. The file
+// fields of Evidence always describe its current version.
+type EvidenceVersion struct {
+	ID             string     `firestore:"id" json:"id"`
+	OrganizationID string     `firestore:"organization_id" json:"organization_id"`
+	EvidenceID     string     `firestore:"evidence_id" json:"evidence_id"`
+	Number         int        `firestore:"number" json:"number"` // 1 for the original file; 0 while uploading
+	FileURL        string     `firestore:"file_url" json:"file_url"` // Cloud Storage path
+	FileName       string     `firestore:"file_name" json:"file_name"`
+	FileSize       int64      `firestore:"file_size" json:"file_size"`
+	FileType       string     `firestore:"file_type" json:"file_type"`
+	ContentHash    string     `firestore:"content_hash,omitempty" json:"content_hash,omitempty"`
+	Note           string     `firestore:"note,omitempty" json:"note,omitempty"` // What changed in this revision
+	Status         string     `firestore:"status" json:"status"` // uploading, active
+	UploadedBy     string     `firestore:"uploaded_by" json:"uploaded_by"` // User UID
+	CreatedAt      time.Time  `firestore:"created_at" json:"created_at"`
+	CurrentFrom    *time.Time `firestore:"current_from,omitempty" json:"current_from,omitempty"` // When it became the current version
+}
+
+// CurrentVersionAt returns the version that was current at t from versions
+// ordered by number, or nil when none was yet
+func CurrentVersionAt(versions []*EvidenceVersion, t time.Time) *EvidenceVersion {
+	var current *EvidenceVersion
+	for _, v := range versions {
+		if v.CurrentFrom != nil && !v.CurrentFrom.After(t) {
+			current = v
+		}
+	}
+	return current
 }
 
 // EvidenceCaptureRule represents a rule for automatically capturing evidence
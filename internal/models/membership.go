@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+// Membership gives a user a role in an organization other than the one their
+// account belongs to, such as a consultant serving several client firms. The
+// account's own organization and role stay on User; a membership takes a seat
+// in the organization it belongs to.
+type Membership struct {
+	ID             string    `firestore:"id" json:"id"` // See MembershipID
+	UserID         string    `firestore:"user_id" json:"user_id"`
+	OrganizationID string    `firestore:"organization_id" json:"organization_id"`
+	Email          string    `firestore:"email" json:"email"`
+	Role           UserRole  `firestore:"role" json:"role"`
+	InvitationID   string    `firestore:"invitation_id" json:"invitation_id"`
+	CreatedAt      time.Time `firestore:"created_at" json:"created_at"`
+	UpdatedAt      time.Time `firestore:"updated_at" json:"updated_at"`
+}
+
+// MembershipID returns the ID of a user's membership in an organization, so
+// a user has at most one membership per organization
+func MembershipID(orgID, userID string) string {
+	return orgID + "_" + userID
+}
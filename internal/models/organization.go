@@ -52,10 +52,20 @@ type Organization struct {
 	Address              string              `firestore:"address,omitempty" json:"address,omitempty"`
 	Phone                string              `firestore:"phone,omitempty" json:"phone,omitempty"`
 	Subscription         Subscription        `firestore:"subscription" json:"subscription"`
+	Partner              bool                `firestore:"partner" json:"partner"` // Manages a portfolio of client organizations
+	PartnerID            string              `firestore:"partner_id,omitempty" json:"partner_id,omitempty"` // The partner managing this client organization
+	BaselineTemplateIDs  []string            `firestore:"baseline_template_ids,omitempty" json:"baseline_template_ids,omitempty"` // Partners only: requirement templates activated in new clients
 	CreatedAt            time.Time           `firestore:"created_at" json:"created_at"`
 	UpdatedAt            time.Time           `firestore:"updated_at" json:"updated_at"`
 	UpdatedBy            string              `firestore:"updated_by,omitempty" json:"updated_by,omitempty"`
 	ActiveUserCount      int                 `firestore:"active_user_count" json:"active_user_count"`
+	Version              int64               `firestore:"version" json:"version"` // Incremented on every write; exposed as the ETag
+}
+
+// IsClientOf reports whether the organization is a client managed by the
+// partner organization partnerID
+func (o *Organization) IsClientOf(partnerID string) bool {
+	return partnerID != "" && o.PartnerID == partnerID
 }
 
 // Subscription represents an organization's subscription details
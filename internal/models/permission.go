@@ -0,0 +1,104 @@
+package models
+
+// Permission names an action that a role or API key can be authorized to
+// perform. Every protected route requires exactly one permission.
+type Permission string
+
+const (
+	PermissionViewOrganization        Permission = "view_organization"
+	PermissionManageOrganization      Permission = "manage_organization"
+	PermissionViewDashboard           Permission = "view_dashboard"
+	PermissionViewUsers               Permission = "view_users"
+	PermissionManageUsers             Permission = "manage_users"
+	PermissionProvisionUsers          Permission = "provision_users"
+	PermissionManageRoles             Permission = "manage_roles"
+	PermissionManageAPIKeys           Permission = "manage_api_keys"
+	PermissionManageAuditorAccess     Permission = "manage_auditor_access"
+	PermissionManageSSO               Permission = "manage_sso"
+	PermissionViewRequirements        Permission = "view_requirements"
+	PermissionManageRequirements      Permission = "manage_requirements"
+	PermissionReconcileEvidenceCounts Permission = "reconcile_evidence_counts"
+	PermissionViewEvidence            Permission = "view_evidence"
+	PermissionManageEvidence          Permission = "manage_evidence"
+	PermissionViewAuditLog            Permission = "view_audit_log"
+	PermissionVerifyAuditLog          Permission = "verify_audit_log"
+	PermissionViewReports             Permission = "view_reports"
+	PermissionGenerateReports         Permission = "generate_reports"
+	PermissionManageBilling           Permission = "manage_billing"
+	PermissionManageIntegrations      Permission = "manage_integrations"
+	PermissionViewPortfolio           Permission = "view_portfolio"
+	PermissionManageClients           Permission = "manage_clients"
+)
+
+// AllPermissions lists every defined permission
+var AllPermissions = []Permission{
+	PermissionViewOrganization, PermissionManageOrganization, PermissionViewDashboard,
+	PermissionViewUsers, PermissionManageUsers, PermissionProvisionUsers, PermissionManageRoles, PermissionManageAPIKeys,
+	PermissionManageAuditorAccess, PermissionManageSSO,
+	PermissionViewRequirements, PermissionManageRequirements, PermissionReconcileEvidenceCounts,
+	PermissionViewEvidence, PermissionManageEvidence,
+	PermissionViewAuditLog, PermissionVerifyAuditLog,
+	PermissionViewReports, PermissionGenerateReports,
+	PermissionManageBilling, PermissionManageIntegrations,
+	PermissionViewPortfolio, PermissionManageClients,
+}
+
+// viewerPermissions are the read-only permissions every role holds
+var viewerPermissions = []Permission{
+	PermissionViewOrganization, PermissionViewDashboard, PermissionViewUsers,
+	PermissionViewRequirements, PermissionViewEvidence, PermissionViewAuditLog,
+	PermissionViewReports, PermissionGenerateReports, PermissionViewPortfolio,
+}
+
+// rolePermissions is the permission registry: the permissions granted to
+// each built-in role. Custom roles carry their own permission set in Role;
+// any other role has no permissions.
+var rolePermissions = map[UserRole][]Permission{
+	RoleAdmin: AllPermissions,
+	RoleComplianceOfficer: append(append([]Permission(nil), viewerPermissions...),
+		PermissionManageRequirements, PermissionManageEvidence),
+	RoleViewer: viewerPermissions,
+}
+
+// scopePermissions maps each API key scope to the permissions it grants.
+// Permissions not listed here cannot be exercised with an API key.
+var scopePermissions = map[APIKeyScope][]Permission{
+	ScopeRequirementsRead:  {PermissionViewRequirements},
+	ScopeRequirementsWrite: {PermissionManageRequirements},
+	ScopeEvidenceRead:      {PermissionViewEvidence},
+	ScopeEvidenceWrite:     {PermissionManageEvidence},
+	ScopeReportsRead:       {PermissionViewReports},
+	ScopeReportsWrite:      {PermissionGenerateReports},
+	ScopeAuditRead:         {PermissionViewAuditLog},
+	ScopeSCIM:              {PermissionProvisionUsers},
+}
+
+// IsValidPermission reports whether permission is one of the defined permissions
+func IsValidPermission(permission Permission) bool {
+	return containsPermission(AllPermissions, permission)
+}
+
+// RolePermissions returns the permissions granted to role
+func RolePermissions(role UserRole) []Permission {
+	return append([]Permission(nil), rolePermissions[role]...)
+}
+
+// RoleHasPermission reports whether a built-in role is granted permission.
+// It is always false for custom roles, whose permissions are stored in Role.
+func RoleHasPermission(role UserRole, permission Permission) bool {
+	return containsPermission(rolePermissions[role], permission)
+}
+
+// ScopeHasPermission reports whether an API key scope grants permission
+func ScopeHasPermission(scope APIKeyScope, permission Permission) bool {
+	return containsPermission(scopePermissions[scope], permission)
+}
+
+func containsPermission(permissions []Permission, permission Permission) bool {
+	for _, p := range permissions {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,82 @@
+package models
+
+import "testing"
+
+func TestRoleHasPermission(t *testing.T) {
+	tests := []struct {
+		role       UserRole
+		permission Permission
+		want       bool
+	}{
+		{RoleAdmin, PermissionManageOrganization, true},
+		{RoleAdmin, PermissionManageAPIKeys, true},
+		{RoleAdmin, PermissionManageSSO, true},
+		{RoleAdmin, PermissionManageClients, true},
+		{RoleComplianceOfficer, PermissionViewEvidence, true},
+		{RoleComplianceOfficer, PermissionManageEvidence, true},
+		{RoleComplianceOfficer, PermissionManageRequirements, true},
+		{RoleComplianceOfficer, PermissionGenerateReports, true},
+		{RoleComplianceOfficer, PermissionManageUsers, false},
+		{RoleComplianceOfficer, PermissionVerifyAuditLog, false},
+		{RoleComplianceOfficer, PermissionManageRoles, false},
+		{RoleViewer, PermissionViewRequirements, true},
+		{RoleViewer, PermissionViewAuditLog, true},
+		{RoleViewer, PermissionGenerateReports, true},
+		{RoleViewer, PermissionManageEvidence, false},
+		{RoleViewer, PermissionManageRequirements, false},
+		{RoleViewer, PermissionManageBilling, false},
+		{UserRole("custom-role-id"), PermissionViewEvidence, false},
+		{UserRole(""), PermissionViewOrganization, false},
+	}
+
+	for _, tt := range tests {
+		if got := RoleHasPermission(tt.role, tt.permission); got != tt.want {
+			t.Errorf("RoleHasPermission(%q, %q) = %v, want %v", tt.role, tt.permission, got, tt.want)
+		}
+	}
+}
+
+func TestAdminHasEveryPermission(t *testing.T) {
+	for _, permission := range AllPermissions {
+		if !RoleHasPermission(RoleAdmin, permission) {
+			t.Errorf("admin lacks %q", permission)
+		}
+	}
+}
+
+func TestScopeHasPermission(t *testing.T) {
+	tests := []struct {
+		scope      APIKeyScope
+		permission Permission
+		want       bool
+	}{
+		{ScopeRequirementsRead, PermissionViewRequirements, true},
+		{ScopeRequirementsRead, PermissionManageRequirements, false},
+		{ScopeRequirementsWrite, PermissionManageRequirements, true},
+		{ScopeRequirementsWrite, PermissionViewRequirements, false},
+		{ScopeEvidenceRead, PermissionViewEvidence, true},
+		{ScopeEvidenceRead, PermissionManageEvidence, false},
+		{ScopeEvidenceWrite, PermissionManageEvidence, true},
+		{ScopeReportsRead, PermissionViewReports, true},
+		{ScopeReportsWrite, PermissionGenerateReports, true},
+		{ScopeAuditRead, PermissionViewAuditLog, true},
+		{ScopeAuditRead, PermissionVerifyAuditLog, false},
+		{ScopeSCIM, PermissionProvisionUsers, true},
+		{ScopeSCIM, PermissionManageUsers, false},
+		{APIKeyScope("admin"), PermissionManageOrganization, false},
+	}
+
+	for _, tt := range tests {
+		if got := ScopeHasPermission(tt.scope, tt.permission); got != tt.want {
+			t.Errorf("ScopeHasPermission(%q, %q) = %v, want %v", tt.scope, tt.permission, got, tt.want)
+		}
+	}
+}
+
+func TestRolePermissionsReturnsCopy(t *testing.T) {
+	permissions := RolePermissions(RoleViewer)
+	permissions[0] = PermissionManageBilling
+	if RoleHasPermission(RoleViewer, PermissionManageBilling) {
+		t.Error("changing the returned slice granted a permission to the role")
+	}
+}
@@ -77,6 +77,7 @@ type Requirement struct {
 	UpdatedAt           time.Time            `firestore:"updated_at" json:"updated_at"`
 	UpdatedBy           string               `firestore:"updated_by,omitempty" json:"updated_by,omitempty"`
 	IsActive            bool                 `firestore:"is_active" json:"is_active"`
+	Version             int64                `firestore:"version" json:"version"` // Incremented on every write; exposed as the ETag
 }
 
 // CalculateStatus determines the compliance status based on evidence and due dates
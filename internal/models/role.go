@@ -0,0 +1,47 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// customRolePrefix marks UserRole values that assign an organization's
+// custom role rather than a built-in one
+const customRolePrefix = "custom:"
+
+// CustomRole returns the UserRole value that assigns the custom role roleID.
+// It is what users, invitations and the role custom claim store.
+func CustomRole(roleID string) UserRole {
+	return UserRole(customRolePrefix + roleID)
+}
+
+// CustomRoleID returns the ID of the custom role that r assigns, if any
+func (r UserRole) CustomRoleID() (string, bool) {
+	id, ok := strings.CutPrefix(string(r), customRolePrefix)
+	return id, ok && id != ""
+}
+
+// Role is a custom role defined by an organization: a named set of
+// permissions that admins can assign to users alongside the built-in roles
+type Role struct {
+	ID             string       `firestore:"id" json:"id"`
+	OrganizationID string       `firestore:"organization_id" json:"organization_id"`
+	Name           string       `firestore:"name" json:"name"`
+	Description    string       `firestore:"description,omitempty" json:"description,omitempty"`
+	Permissions    []Permission `firestore:"permissions" json:"permissions"`
+	CreatedBy      string       `firestore:"created_by" json:"created_by"`
+	CreatedAt      time.Time    `firestore:"created_at" json:"created_at"`
+	UpdatedBy      string       `firestore:"updated_by" json:"updated_by"`
+	UpdatedAt      time.Time    `firestore:"updated_at" json:"updated_at"`
+	Version        int64        `firestore:"version" json:"version"` // Incremented on every write; used for optimistic concurrency
+}
+
+// UserRole returns the value that assigns this role to a user
+func (r *Role) UserRole() UserRole {
+	return CustomRole(r.ID)
+}
+
+// HasPermission reports whether the role grants permission
+func (r *Role) HasPermission(permission Permission) bool {
+	return containsPermission(r.Permissions, permission)
+}
@@ -0,0 +1,43 @@
+package models
+
+import "time"
+
+// Session methods record how a session was started. Sessions exchanged for
+// an identity provider token keep the provider's sign-in method, such as
+// password or google.com.
+const (
+	AuthMethodOIDC = "sso_oidc"
+	AuthMethodSAML = "sso_saml"
+	AuthMethodJWT  = "jwt"
+)
+
+// IsSSOAuthMethod reports whether a sign-in method is single sign-on
+func IsSSOAuthMethod(method string) bool {
+	return method == AuthMethodOIDC || method == AuthMethodSAML
+}
+
+// Session is a sign-in issued by the API itself, after single sign-on or in
+// exchange for an identity provider token. The bearer token is shown once;
+// only its hash is stored.
+type Session struct {
+	ID             string     `firestore:"id" json:"id"`
+	UserID         string     `firestore:"user_id" json:"user_id"`
+	OrganizationID string     `firestore:"organization_id" json:"organization_id"`
+	TokenHash      string     `firestore:"token_hash" json:"-"` // SHA-256 of the session token; not exposed in JSON
+	AuthMethod     string     `firestore:"auth_method" json:"auth_method"`
+	IPAddress      string     `firestore:"ip_address,omitempty" json:"ip_address,omitempty"`
+	UserAgent      string     `firestore:"user_agent,omitempty" json:"user_agent,omitempty"`
+	CreatedAt      time.Time  `firestore:"created_at" json:"created_at"`
+	ExpiresAt      time.Time  `firestore:"expires_at" json:"expires_at"`
+	RevokedAt      *time.Time `firestore:"revoked_at,omitempty" json:"revoked_at,omitempty"`
+}
+
+// IsActive reports whether the session can still authenticate
+func (s *Session) IsActive(now time.Time) bool {
+	return s.RevokedAt == nil && now.Before(s.ExpiresAt)
+}
+
+// IsSSO reports whether the session was started through single sign-on
+func (s *Session) IsSSO() bool {
+	return IsSSOAuthMethod(s.AuthMethod)
+}
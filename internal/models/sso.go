@@ -0,0 +1,84 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// SSOProtocol is the protocol an organization's identity provider speaks
+type SSOProtocol string
+
+const (
+	SSOProtocolOIDC SSOProtocol = "oidc"
+	SSOProtocolSAML SSOProtocol = "saml"
+)
+
+// SSOConfig is an organization's single sign-on identity provider. Users
+// signing in through it for the first time are provisioned with DefaultRole,
+// provided their email domain is one of the organization's verified domains.
+type SSOConfig struct {
+	OrganizationID string      `firestore:"organization_id" json:"organization_id"`
+	Protocol       SSOProtocol `firestore:"protocol" json:"protocol"`
+	Enabled        bool        `firestore:"enabled" json:"enabled"`
+	Enforced       bool        `firestore:"enforced" json:"enforced"` // Reject other sign-in methods for non-admin users
+	DefaultRole    UserRole    `firestore:"default_role" json:"default_role"`
+
+	// OIDC: the issuer's discovery document supplies the endpoints and keys
+	OIDCIssuer       string `firestore:"oidc_issuer,omitempty" json:"oidc_issuer,omitempty"`
+	OIDCClientID     string `firestore:"oidc_client_id,omitempty" json:"oidc_client_id,omitempty"`
+	OIDCClientSecret string `firestore:"oidc_client_secret,omitempty" json:"-"` // Write-only; not exposed in JSON
+
+	// SAML: parsed from the identity provider's metadata
+	SAMLMetadataURL     string   `firestore:"saml_metadata_url,omitempty" json:"saml_metadata_url,omitempty"`
+	SAMLIdPEntityID     string   `firestore:"saml_idp_entity_id,omitempty" json:"saml_idp_entity_id,omitempty"`
+	SAMLIdPSSOURL       string   `firestore:"saml_idp_sso_url,omitempty" json:"saml_idp_sso_url,omitempty"`
+	SAMLIdPCertificates []string `firestore:"saml_idp_certificates,omitempty" json:"saml_idp_certificates,omitempty"` // Base64 DER signing certificates
+
+	UpdatedBy string    `firestore:"updated_by" json:"updated_by"`
+	UpdatedAt time.Time `firestore:"updated_at" json:"updated_at"`
+	Version   int64     `firestore:"version" json:"version"` // Incremented on every write; exposed as the ETag
+}
+
+// RequiresSSO reports whether users of the organization in role must sign in
+// through SSO. Built-in admins are exempt so a broken identity provider
+// configuration can still be repaired.
+func (c *SSOConfig) RequiresSSO(role UserRole) bool {
+	return c.Enabled && c.Enforced && role != RoleAdmin
+}
+
+// Domain is an email domain an organization has claimed. Once verified
+// through a DNS TXT record, single sign-on provisions users with addresses
+// in the domain.
+type Domain struct {
+	ID                string     `firestore:"id" json:"id"`
+	OrganizationID    string     `firestore:"organization_id" json:"organization_id"`
+	Name              string     `firestore:"name" json:"name"` // Lowercase, e.g. example.com
+	VerificationToken string     `firestore:"verification_token" json:"verification_token"`
+	Status            string     `firestore:"status" json:"status"` // pending, verified
+	CreatedBy         string     `firestore:"created_by" json:"created_by"`
+	CreatedAt         time.Time  `firestore:"created_at" json:"created_at"`
+	VerifiedAt        *time.Time `firestore:"verified_at,omitempty" json:"verified_at,omitempty"`
+}
+
+// domainTXTPrefix names the TXT record that proves control of a domain
+const domainTXTPrefix = "_compliancesync-challenge."
+
+// TXTRecordName is the DNS name the verification TXT record is published at
+func (d *Domain) TXTRecordName() string {
+	return domainTXTPrefix + d.Name
+}
+
+// TXTRecordValue is the content the verification TXT record must have
+func (d *Domain) TXTRecordValue() string {
+	return "compliancesync-verification=" + d.VerificationToken
+}
+
+// EmailDomain returns the lowercase domain part of an email address, or ""
+// if there is none
+func EmailDomain(email string) string {
+	at := strings.LastIndex(email, "@")
+	if at < 0 || at == len(email)-1 {
+		return ""
+	}
+	return strings.ToLower(email[at+1:])
+}
@@ -11,55 +11,84 @@ const (
 	RoleViewer           UserRole = "viewer"
 )
 
+// IsValidRole reports whether role is one of the built-in user roles
+func IsValidRole(role UserRole) bool {
+	return role == RoleAdmin || role == RoleComplianceOfficer || role == RoleViewer
+}
+
+// DelegatedRole returns the role a partner's staff member holding role acts
+// with in the partner's client organizations. Built-in roles carry over. A
+// custom role is defined by the partner organization alone, so it acts as
+// a viewer.
+func DelegatedRole(role UserRole) UserRole {
+	if IsValidRole(role) {
+		return role
+	}
+	return RoleViewer
+}
+
 // User represents a user account
 type User struct {
 	UID              string    `firestore:"uid" json:"uid"` // Firebase Auth UID
 	Email            string    `firestore:"email" json:"email"`
 	FullName         string    `firestore:"full_name" json:"full_name"`
 	OrganizationID   string    `firestore:"organization_id" json:"organization_id"`
-	Role             UserRole  `firestore:"role" json:"role"`
-	Status           string    `firestore:"status" json:"status"` // active, pending, inactive
+	Role             UserRole  `firestore:"role" json:"role"` // Built-in role, or custom:<role-id> for a custom role
+	Status           string    `firestore:"status" json:"status"` // active, pending, inactive, deleted
 	EmailVerified    bool      `firestore:"email_verified" json:"email_verified"`
 	CreatedAt        time.Time `firestore:"created_at" json:"created_at"`
 	UpdatedAt        time.Time `firestore:"updated_at" json:"updated_at"`
 	LastLoginAt      *time.Time `firestore:"last_login_at,omitempty" json:"last_login_at,omitempty"`
+	TokensRevokedAt  *time.Time `firestore:"tokens_revoked_at,omitempty" json:"tokens_revoked_at,omitempty"` // ID tokens and sessions issued earlier are rejected
+}
+
+// TokensRevoked reports whether an ID token or session issued at issuedAt
+// has been revoked. ID tokens carry their issue time in whole seconds, so
+// revocation covers every credential issued in the second it happened in,
+// including ones issued just after it.
+func (u *User) TokensRevoked(issuedAt time.Time) bool {
+	return u.TokensRevokedAt != nil && !issuedAt.Truncate(time.Second).After(*u.TokensRevokedAt)
 }
 
-// Invitation represents a pending user invitation
+// Invitation represents an invitation for someone to join an organization.
+// Pending invitations that have not expired hold a seat against the
+// subscription's user limit.
 type Invitation struct {
-	ID             string    `firestore:"id" json:"id"`
-	Email          string    `firestore:"email" json:"email"`
-	OrganizationID string    `firestore:"organization_id" json:"organization_id"`
-	Role           UserRole  `firestore:"role" json:"role"`
-	InvitedBy      string    `firestore:"invited_by" json:"invited_by"`
-	Message        string    `firestore:"message,omitempty" json:"message,omitempty"`
-	Token          string    `firestore:"token" json:"-"` // Not exposed in JSON
-	Status         string    `firestore:"status" json:"status"` // pending, accepted, expired, revoked
-	CreatedAt      time.Time `firestore:"created_at" json:"created_at"`
-	ExpiresAt      time.Time `firestore:"expires_at" json:"expires_at"`
+	ID             string     `firestore:"id" json:"id"`
+	Email          string     `firestore:"email" json:"email"`
+	OrganizationID string     `firestore:"organization_id" json:"organization_id"`
+	Role           UserRole   `firestore:"role" json:"role"`
+	InvitedBy      string     `firestore:"invited_by" json:"invited_by"`
+	Message        string     `firestore:"message,omitempty" json:"message,omitempty"`
+	Token          string     `firestore:"token" json:"-"` // SHA-256 of the emailed token; not exposed in JSON
+	Status         string     `firestore:"status" json:"status"` // pending, accepted, expired, revoked
+	CreatedAt      time.Time  `firestore:"created_at" json:"created_at"`
+	ExpiresAt      time.Time  `firestore:"expires_at" json:"expires_at"`
+	SentAt         time.Time  `firestore:"sent_at" json:"sent_at"` // Last time the token was (re)sent
+	AcceptedAt     *time.Time `firestore:"accepted_at,omitempty" json:"accepted_at,omitempty"`
+	AcceptedBy     string     `firestore:"accepted_by,omitempty" json:"accepted_by,omitempty"` // UID of the user created on acceptance
 }
 
-// HasPermission checks if a user has permission for a specific action
-func (u *User) HasPermission(action string) bool {
-	switch u.Role {
-	case RoleAdmin:
-		return true // Admins have all permissions
-	case RoleComplianceOfficer:
-		// Compliance officers can do most things except manage users and org settings
-		return action != "manage_users" && action != "manage_billing" && action != "manage_integrations"
-	case RoleViewer:
-		// Viewers can only read
-		return action == "view_dashboard" || action == "view_requirements" ||
-		       action == "view_evidence" || action == "view_audit_log" ||
-		       action == "generate_reports"
-	default:
-		return false
-	}
+// IsExpired reports whether a pending invitation has passed its expiry.
+// Expiry is not written back until someone tries to use the invitation.
+func (i *Invitation) IsExpired(now time.Time) bool {
+	return i.Status == "pending" && !now.Before(i.ExpiresAt)
+}
+
+// HoldsSeat reports whether the invitation counts toward the user limit
+func (i *Invitation) HoldsSeat(now time.Time) bool {
+	return i.Status == "pending" && !i.IsExpired(now)
+}
+
+// HasPermission checks if a user's built-in role grants permission. Users
+// with a custom role need the Role itself; see Role.HasPermission.
+func (u *User) HasPermission(permission Permission) bool {
+	return RoleHasPermission(u.Role, permission)
 }
 
-// CanWrite checks if a user has write permissions
+// CanWrite checks if a user can manage requirements and evidence
 func (u *User) CanWrite() bool {
-	return u.Role == RoleAdmin || u.Role == RoleComplianceOfficer
+	return u.HasPermission(PermissionManageEvidence)
 }
 
 // IsAdmin checks if a user is an admin
@@ -0,0 +1,33 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestUserTokensRevoked(t *testing.T) {
+	revokedAt := time.Date(2024, 3, 1, 12, 0, 0, 600*int(time.Millisecond), time.UTC)
+	user := &User{TokensRevokedAt: &revokedAt}
+
+	tests := []struct {
+		name     string
+		issuedAt time.Time
+		want     bool
+	}{
+		{"earlier second", revokedAt.Add(-time.Second), true},
+		{"same second, before", revokedAt.Add(-100 * time.Millisecond), true},
+		{"same second, after", revokedAt.Add(100 * time.Millisecond), true},
+		{"ID token in the same second", revokedAt.Truncate(time.Second), true},
+		{"next second", revokedAt.Truncate(time.Second).Add(time.Second), false},
+	}
+
+	for _, tt := range tests {
+		if got := user.TokensRevoked(tt.issuedAt); got != tt.want {
+			t.Errorf("%s: TokensRevoked(%v) = %v, want %v", tt.name, tt.issuedAt, got, tt.want)
+		}
+	}
+
+	if (&User{}).TokensRevoked(revokedAt) {
+		t.Error("TokensRevoked without a revocation = true, want false")
+	}
+}
@@ -0,0 +1,161 @@
+package scan
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+// clamChunkSize is the size of the chunks content is streamed to clamd in
+const clamChunkSize = 64 << 10
+
+// clamTimeout bounds a scan when the context has no deadline
+const clamTimeout = 2 * time.Minute
+
+// ClamAV scans files with a clamd daemon, streaming their content over the
+// clamd socket protocol with the INSTREAM command
+type ClamAV struct {
+	network string // unix or tcp
+	address string
+}
+
+// NewClamAV returns a scanner for the clamd daemon at address, given as
+// unix:///path/to/clamd.sock, tcp://host:port or host:port
+func NewClamAV(address string) (*ClamAV, error) {
+	switch {
+	case strings.HasPrefix(address, "unix://"):
+		return &ClamAV{network: "unix", address: strings.TrimPrefix(address, "unix://")}, nil
+	case strings.HasPrefix(address, "tcp://"):
+		return &ClamAV{network: "tcp", address: strings.TrimPrefix(address, "tcp://")}, nil
+	case strings.Contains(address, "://") || address == "":
+		return nil, fmt.Errorf("invalid clamd address %q", address)
+	default:
+		return &ClamAV{network: "tcp", address: address}, nil
+	}
+}
+
+// Name identifies ClamAV in scan records
+func (c *ClamAV) Name() string {
+	return "clamav"
+}
+
+// Ping checks that clamd is reachable and responding
+func (c *ClamAV) Ping(ctx context.Context) error {
+	conn, err := c.dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := io.WriteString(conn, "zPING\x00"); err != nil {
+		return fmt.Errorf("failed to send to clamd: %w", err)
+	}
+	reply, err := readClamReply(conn)
+	if err != nil {
+		return err
+	}
+	if reply != "PONG" {
+		return fmt.Errorf("unexpected clamd reply %q", reply)
+	}
+	return nil
+}
+
+// Scan streams r to clamd and returns its verdict. Content larger than
+// clamd's StreamMaxLength fails to scan.
+func (c *ClamAV) Scan(ctx context.Context, r io.Reader) (Result, error) {
+	conn, err := c.dial(ctx)
+	if err != nil {
+		return Result{}, err
+	}
+	defer conn.Close()
+
+	// Unblock reads and writes when the request is cancelled
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	if _, err := io.WriteString(conn, "zINSTREAM\x00"); err != nil {
+		return Result{}, fmt.Errorf("failed to send to clamd: %w", err)
+	}
+
+	// Each chunk is prefixed with its length as a 4-byte big-endian integer,
+	// and a zero length ends the stream
+	buf := make([]byte, 4+clamChunkSize)
+	for {
+		n, readErr := io.ReadFull(r, buf[4:])
+		if n > 0 {
+			binary.BigEndian.PutUint32(buf[:4], uint32(n))
+			if _, err := conn.Write(buf[:4+n]); err != nil {
+				// clamd replies and closes the connection when the stream
+				// exceeds its size limit
+				if reply, replyErr := readClamReply(conn); replyErr == nil {
+					return parseClamReply(reply)
+				}
+				return Result{}, fmt.Errorf("failed to send to clamd: %w", err)
+			}
+		}
+		if readErr == io.EOF || readErr == io.ErrUnexpectedEOF {
+			break
+		}
+		if readErr != nil {
+			return Result{}, fmt.Errorf("failed to read file: %w", readErr)
+		}
+	}
+	if _, err := conn.Write([]byte{0, 0, 0, 0}); err != nil {
+		return Result{}, fmt.Errorf("failed to send to clamd: %w", err)
+	}
+
+	reply, err := readClamReply(conn)
+	if err != nil {
+		return Result{}, err
+	}
+	return parseClamReply(reply)
+}
+
+// dial connects to clamd, bounding the connection by the context deadline
+func (c *ClamAV) dial(ctx context.Context) (net.Conn, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, c.network, c.address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to clamd: %w", err)
+	}
+
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(clamTimeout)
+	}
+	if err := conn.SetDeadline(deadline); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to connect to clamd: %w", err)
+	}
+	return conn, nil
+}
+
+// readClamReply reads one NUL-terminated reply to a z-prefixed command
+func readClamReply(conn net.Conn) (string, error) {
+	reply, err := bufio.NewReader(conn).ReadString(0)
+	if err != nil && (err != io.EOF || reply == "") {
+		return "", fmt.Errorf("failed to read clamd reply: %w", err)
+	}
+	return strings.TrimSpace(strings.TrimSuffix(reply, "\x00")), nil
+}
+
+// parseClamReply interprets an INSTREAM reply: "stream: OK",
+// "stream: <signature> FOUND" or "<reason> ERROR"
+func parseClamReply(reply string) (Result, error) {
+	switch {
+	case reply == "stream: OK":
+		return Result{}, nil
+	case strings.HasSuffix(reply, " FOUND"):
+		signature := strings.TrimSuffix(strings.TrimPrefix(reply, "stream: "), " FOUND")
+		return Result{Infected: true, Signature: signature}, nil
+	case strings.HasSuffix(reply, " ERROR"):
+		return Result{}, fmt.Errorf("clamd failed to scan: %s", strings.TrimSuffix(reply, " ERROR"))
+	default:
+		return Result{}, fmt.Errorf("unexpected clamd reply %q", reply)
+	}
+}
@@ -0,0 +1,47 @@
+package scan
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+)
+
+// EICAR is the industry-standard antivirus test file. Every scanner,
+// including Fake, reports content containing it as infected.
+const EICAR = `X5O!P%@AP[4\PZX54(P^)7CC)7}$EICAR-STANDARD-ANTIVIRUS-TEST-FILE!$H+H*`
+
+// eicarSignature is the name clamd gives the EICAR test file
+const eicarSignature = "Win.Test.EICAR_HDB-1"
+
+// Fake is a Scanner for tests and local development. It reports content
+// containing EICAR as infected and everything else as clean, unless
+// Signature or Err overrides the verdict for every file.
+type Fake struct {
+	Signature string // When set, every file is reported infected with this signature
+	Err       error  // When set, every scan fails with this error
+}
+
+// Name identifies the fake scanner in scan records
+func (f *Fake) Name() string {
+	return "fake"
+}
+
+// Scan reads r and returns the fake verdict
+func (f *Fake) Scan(ctx context.Context, r io.Reader) (Result, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return Result{}, fmt.Errorf("failed to read file: %w", err)
+	}
+
+	switch {
+	case f.Err != nil:
+		return Result{}, f.Err
+	case f.Signature != "":
+		return Result{Infected: true, Signature: f.Signature}, nil
+	case bytes.Contains(data, []byte(EICAR)):
+		return Result{Infected: true, Signature: eicarSignature}, nil
+	default:
+		return Result{}, nil
+	}
+}
@@ -0,0 +1,40 @@
+// Package scan checks uploaded evidence files for malware. Open selects the
+// scanner from configuration: a clamd daemon in production, or a fake for
+// tests and local development.
+package scan
+
+import (
+	"context"
+	"fmt"
+	"io"
+)
+
+// Result is the outcome of scanning one file
+type Result struct {
+	Infected  bool
+	Signature string // Name of the malware found in an infected file
+}
+
+// Scanner checks file content for malware
+type Scanner interface {
+	// Name identifies the scanner in scan records, such as clamav
+	Name() string
+	// Scan reads r to the end and reports whether it is infected. An error
+	// means the content could not be scanned, not that it is unsafe.
+	Scan(ctx context.Context, r io.Reader) (Result, error)
+}
+
+// Open returns the scanner for backend: clamav, reaching clamd at address,
+// or fake. none returns a nil Scanner, which disables scanning.
+func Open(backend, address string) (Scanner, error) {
+	switch backend {
+	case "clamav":
+		return NewClamAV(address)
+	case "fake":
+		return &Fake{}, nil
+	case "none":
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unknown MALWARE_SCANNER %q (expected clamav, fake or none)", backend)
+	}
+}
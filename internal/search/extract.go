@@ -0,0 +1,369 @@
+package search
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/zlib"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Content types whose text ExtractText can read
+const (
+	TypePDF  = "application/pdf"
+	TypeDOCX = "application/vnd.openxmlformats-officedocument.wordprocessingml.document"
+	TypeXLSX = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+)
+
+// MaxContentLength caps the extracted text kept for one file, in bytes
+const MaxContentLength = 1 << 20
+
+// maxFileSize caps how much of a file is read for extraction
+const maxFileSize = 25 << 20
+
+// ErrUnsupportedType is returned by ExtractText for content types it cannot read
+var ErrUnsupportedType = errors.New("unsupported content type for text extraction")
+
+// Extractable reports whether ExtractText can read files of contentType
+func Extractable(contentType string) bool {
+	switch contentType {
+	case TypePDF, TypeDOCX, TypeXLSX:
+		return true
+	}
+	return false
+}
+
+// ExtractText returns the text content of a PDF, DOCX or XLSX file, truncated
+// to MaxContentLength. PDF extraction is best effort: it reads the text
+// operators of each content stream, so text drawn with embedded font
+// encodings or as images is not found.
+func ExtractText(r io.Reader, contentType string) (string, error) {
+	if !Extractable(contentType) {
+		return "", ErrUnsupportedType
+	}
+
+	data, err := io.ReadAll(io.LimitReader(r, maxFileSize))
+	if err != nil {
+		return "", fmt.Errorf("failed to read file: %w", err)
+	}
+
+	var text string
+	switch contentType {
+	case TypePDF:
+		text = extractPDF(data)
+	case TypeDOCX:
+		text, err = extractOOXML(data, func(name string) bool { return name == "word/document.xml" }, "p")
+	case TypeXLSX:
+		text, err = extractOOXML(data, func(name string) bool {
+			return name == "xl/sharedStrings.xml" || (path.Dir(name) == "xl/worksheets" && path.Ext(name) == ".xml")
+		}, "si")
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return truncate(text, MaxContentLength), nil
+}
+
+// extractOOXML collects the text runs (<t> elements) of the matching parts
+// of an Office Open XML package, ending a line at each block element
+func extractOOXML(data []byte, match func(name string) bool, block string) (string, error) {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return "", fmt.Errorf("failed to open document: %w", err)
+	}
+
+	// Zip order is arbitrary; sort so worksheets are read in a stable order
+	files := append([]*zip.File(nil), archive.File...)
+	sort.Slice(files, func(i, j int) bool { return files[i].Name < files[j].Name })
+
+	// Parts are compressed, so bound how much is inflated across them. A
+	// part cut short by the limit keeps the text read before it.
+	var text strings.Builder
+	budget := int64(maxFileSize)
+	for _, file := range files {
+		if !match(file.Name) {
+			continue
+		}
+		rc, err := file.Open()
+		if err != nil {
+			return "", fmt.Errorf("failed to open %s: %w", file.Name, err)
+		}
+		part := &io.LimitedReader{R: rc, N: budget}
+		err = collectXMLText(part, block, &text)
+		rc.Close()
+		budget = part.N
+		if budget <= 0 {
+			break
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to parse %s: %w", file.Name, err)
+		}
+		if text.Len() >= MaxContentLength {
+			break
+		}
+	}
+
+	return text.String(), nil
+}
+
+// collectXMLText appends the character data of every <t> element to text,
+// stopping once text holds MaxContentLength bytes
+func collectXMLText(r io.Reader, block string, text *strings.Builder) error {
+	decoder := xml.NewDecoder(r)
+	inText := false
+	for text.Len() < MaxContentLength {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			if t.Name.Local == "t" {
+				inText = true
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "t":
+				inText = false
+				text.WriteByte(' ')
+			case block, "row":
+				text.WriteByte('\n')
+			}
+		case xml.CharData:
+			if inText {
+				text.Write(t)
+			}
+		}
+	}
+	return nil
+}
+
+// extractPDF returns the strings shown by the text operators of every
+// content stream in a PDF, inflating FlateDecode streams
+func extractPDF(data []byte) string {
+	var text strings.Builder
+	rest := data
+	for text.Len() < MaxContentLength {
+		start := bytes.Index(rest, []byte("stream"))
+		if start < 0 {
+			break
+		}
+		dict := rest[:start]
+		if i := bytes.LastIndex(dict, []byte("<<")); i >= 0 {
+			dict = dict[i:]
+		}
+
+		body := rest[start+len("stream"):]
+		body = bytes.TrimLeft(body, "\r\n")
+		end := bytes.Index(body, []byte("endstream"))
+		if end < 0 {
+			break
+		}
+		content := body[:end]
+		rest = body[end+len("endstream"):]
+
+		if bytes.Contains(dict, []byte("/FlateDecode")) {
+			inflated, err := io.ReadAll(io.LimitReader(inflate(content), maxFileSize))
+			if err != nil && len(inflated) == 0 {
+				continue
+			}
+			content = inflated
+		} else if bytes.Contains(dict, []byte("/Filter")) {
+			// Images and other encodings carry no text
+			continue
+		}
+
+		showPDFText(content, &text)
+	}
+	return text.String()
+}
+
+func inflate(data []byte) io.Reader {
+	r, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return bytes.NewReader(nil)
+	}
+	return r
+}
+
+// showPDFText appends the literal and hex strings inside the BT/ET text
+// objects of a content stream. Words end at each show or positioning
+// operator and at wide gaps in TJ arrays; lines end with the text object.
+func showPDFText(content []byte, text *strings.Builder) {
+	inText := false
+	for i := 0; i < len(content); i++ {
+		c := content[i]
+		switch {
+		case c == '(' && inText:
+			s, n := readPDFLiteral(content[i:])
+			appendPrintable(text, s)
+			i += n - 1
+		case c == '<' && inText && i+1 < len(content) && content[i+1] != '<':
+			s, n := readPDFHex(content[i:])
+			appendPrintable(text, s)
+			i += n - 1
+		case (c == '-' || (c >= '0' && c <= '9')) && inText:
+			// A TJ adjustment of more than a fifth of an em is a word gap
+			j := i + 1
+			for j < len(content) && (content[j] == '.' || (content[j] >= '0' && content[j] <= '9')) {
+				j++
+			}
+			if c == '-' && j-i > 3 {
+				text.WriteByte(' ')
+			}
+			i = j - 1
+		case c == 'B' && isPDFOperator(content, i, "BT"):
+			inText = true
+			i++
+		case c == 'E' && isPDFOperator(content, i, "ET"):
+			if inText {
+				text.WriteByte('\n')
+			}
+			inText = false
+			i++
+		case c == 'T' && inText && i+1 < len(content) && strings.IndexByte("jJdDm*", content[i+1]) >= 0 && isPDFOperator(content, i, string(content[i:i+2])):
+			text.WriteByte(' ')
+			i++
+		}
+	}
+}
+
+// isPDFOperator reports whether the operator op stands alone at content[i]
+func isPDFOperator(content []byte, i int, op string) bool {
+	if !bytes.HasPrefix(content[i:], []byte(op)) {
+		return false
+	}
+	return isPDFDelimited(content, i, len(op))
+}
+
+// isPDFDelimited reports whether the n-byte token at i stands alone
+func isPDFDelimited(content []byte, i, n int) bool {
+	before := i == 0 || isPDFDelimiter(content[i-1])
+	after := i+n >= len(content) || isPDFDelimiter(content[i+n])
+	return before && after
+}
+
+// isPDFDelimiter reports whether c is white space or a delimiter, which end
+// a PDF token
+func isPDFDelimiter(c byte) bool {
+	return strings.IndexByte(" \n\r\t\f\x00()<>[]{}/%", c) >= 0
+}
+
+// readPDFLiteral decodes a (literal) string starting at data[0], returning
+// it and the number of bytes consumed
+func readPDFLiteral(data []byte) (string, int) {
+	var s []byte
+	depth := 0
+	for i := 0; i < len(data); i++ {
+		c := data[i]
+		switch c {
+		case '(':
+			if depth > 0 {
+				s = append(s, c)
+			}
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return string(s), i + 1
+			}
+			s = append(s, c)
+		case '\\':
+			i++
+			if i >= len(data) {
+				return string(s), i
+			}
+			switch e := data[i]; e {
+			case 'n':
+				s = append(s, '\n')
+			case 'r', 't', 'b', 'f':
+				s = append(s, ' ')
+			case '\r', '\n':
+				// Line continuation
+			default:
+				if e >= '0' && e <= '7' {
+					v, j := 0, 0
+					for ; j < 3 && i+j < len(data) && data[i+j] >= '0' && data[i+j] <= '7'; j++ {
+						v = v*8 + int(data[i+j]-'0')
+					}
+					s = append(s, byte(v))
+					i += j - 1
+				} else {
+					s = append(s, e)
+				}
+			}
+		default:
+			s = append(s, c)
+		}
+	}
+	return string(s), len(data)
+}
+
+// readPDFHex decodes a <hex> string starting at data[0], returning it and
+// the number of bytes consumed
+func readPDFHex(data []byte) (string, int) {
+	end := bytes.IndexByte(data, '>')
+	if end < 0 {
+		return "", len(data)
+	}
+
+	var digits []byte
+	for _, c := range data[1:end] {
+		if unicode.Is(unicode.ASCII_Hex_Digit, rune(c)) {
+			digits = append(digits, c)
+		}
+	}
+	if len(digits)%2 == 1 {
+		digits = append(digits, '0')
+	}
+
+	s := make([]byte, len(digits)/2)
+	for i := range s {
+		s[i] = hexValue(digits[2*i])<<4 | hexValue(digits[2*i+1])
+	}
+	return string(s), end + 1
+}
+
+func hexValue(c byte) byte {
+	switch {
+	case c >= 'a':
+		return c - 'a' + 10
+	case c >= 'A':
+		return c - 'A' + 10
+	default:
+		return c - '0'
+	}
+}
+
+// appendPrintable appends the printable Latin-1 characters of s. Strings
+// with two-byte glyph codes decode to control bytes, which are dropped.
+func appendPrintable(text *strings.Builder, s string) {
+	for i := 0; i < len(s); i++ {
+		if r := rune(s[i]); unicode.IsPrint(r) || r == '\n' {
+			text.WriteRune(r)
+		}
+	}
+}
+
+// truncate cuts s to at most n bytes without splitting a UTF-8 sequence
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
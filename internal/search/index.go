@@ -0,0 +1,233 @@
+// Package search maintains a local full-text index of evidence. Each
+// document holds an evidence item's metadata and the text extracted from its
+// file, and every query is restricted to one organization.
+package search
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"strings"
+
+	"compliancesync-api/internal/models"
+	"github.com/blevesearch/bleve/v2"
+	"github.com/blevesearch/bleve/v2/analysis/analyzer/keyword"
+	"github.com/blevesearch/bleve/v2/analysis/lang/en"
+	"github.com/blevesearch/bleve/v2/mapping"
+	"github.com/blevesearch/bleve/v2/search/query"
+)
+
+// Indexed fields, with the boost a match in each adds to the score
+var fieldBoosts = map[string]float64{
+	"title":       4,
+	"tags":        3,
+	"file_name":   2,
+	"description": 1.5,
+	"content":     1,
+}
+
+// document is the indexed form of an evidence item
+type document struct {
+	OrganizationID string   `json:"organization_id"`
+	Title          string   `json:"title"`
+	Description    string   `json:"description"`
+	FileName       string   `json:"file_name"`
+	Tags           []string `json:"tags"`
+	Content        string   `json:"content"`
+}
+
+// Hit is an evidence item matching a search, with highlighted fragments of
+// the matching fields keyed by field name
+type Hit struct {
+	EvidenceID string              `json:"evidence_id"`
+	Score      float64             `json:"score"`
+	Highlights map[string][]string `json:"highlights,omitempty"`
+}
+
+// Results is one page of search hits
+type Results struct {
+	Total uint64
+	Hits  []Hit
+}
+
+// Index is a full-text index of evidence stored on local disk, or in memory
+type Index struct {
+	index bleve.Index
+}
+
+// Open opens the index at path, creating it when it does not exist. An
+// empty path keeps the index in memory, so it starts empty on every run.
+func Open(path string) (*Index, error) {
+	if path == "" {
+		index, err := bleve.NewMemOnly(newMapping())
+		if err != nil {
+			return nil, fmt.Errorf("failed to create search index: %w", err)
+		}
+		return &Index{index: index}, nil
+	}
+
+	index, err := bleve.Open(path)
+	if errors.Is(err, bleve.ErrorIndexPathDoesNotExist) {
+		index, err = bleve.New(path, newMapping())
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open search index %s: %w", path, err)
+	}
+	return &Index{index: index}, nil
+}
+
+// newMapping indexes the organization ID as a single keyword and the other
+// fields as English text. Text fields are stored with term vectors so
+// matches can be highlighted.
+func newMapping() mapping.IndexMapping {
+	orgField := bleve.NewTextFieldMapping()
+	orgField.Analyzer = keyword.Name
+	orgField.IncludeInAll = false
+
+	doc := bleve.NewDocumentStaticMapping()
+	doc.AddFieldMappingsAt("organization_id", orgField)
+	for field := range fieldBoosts {
+		text := bleve.NewTextFieldMapping()
+		text.Analyzer = en.AnalyzerName
+		text.Store = true
+		text.IncludeTermVectors = true
+		doc.AddFieldMappingsAt(field, text)
+	}
+
+	indexMapping := bleve.NewIndexMapping()
+	indexMapping.DefaultMapping = doc
+	return indexMapping
+}
+
+// Close releases the index
+func (i *Index) Close() error {
+	return i.index.Close()
+}
+
+// Index adds or replaces the document for an evidence item. content is the
+// text extracted from its current file, if any.
+func (i *Index) Index(evidence *models.Evidence, content string) error {
+	doc := document{
+		OrganizationID: evidence.OrganizationID,
+		Title:          evidence.Title,
+		Description:    evidence.Description,
+		FileName:       evidence.FileName,
+		Tags:           evidence.Tags,
+		Content:        content,
+	}
+	if err := i.index.Index(evidence.ID, doc); err != nil {
+		return fmt.Errorf("failed to index evidence %s: %w", evidence.ID, err)
+	}
+	return nil
+}
+
+// Content returns the text indexed for an evidence item's file, reporting
+// whether the item is in the index
+func (i *Index) Content(evidenceID string) (string, bool, error) {
+	req := bleve.NewSearchRequest(bleve.NewDocIDQuery([]string{evidenceID}))
+	req.Fields = []string{"content"}
+	res, err := i.index.Search(req)
+	if err != nil {
+		return "", false, fmt.Errorf("failed to read indexed evidence %s: %w", evidenceID, err)
+	}
+	if len(res.Hits) == 0 {
+		return "", false, nil
+	}
+	content, _ := res.Hits[0].Fields["content"].(string)
+	return content, true, nil
+}
+
+// Delete removes an evidence item from the index
+func (i *Index) Delete(evidenceID string) error {
+	if err := i.index.Delete(evidenceID); err != nil {
+		return fmt.Errorf("failed to remove evidence %s from index: %w", evidenceID, err)
+	}
+	return nil
+}
+
+// DeleteOrganization removes every document of an organization, returning
+// how many were removed
+func (i *Index) DeleteOrganization(orgID string) (int, error) {
+	removed := 0
+	for {
+		req := bleve.NewSearchRequestOptions(orgQuery(orgID), 1000, 0, false)
+		res, err := i.index.Search(req)
+		if err != nil {
+			return removed, fmt.Errorf("failed to list indexed evidence: %w", err)
+		}
+		if len(res.Hits) == 0 {
+			return removed, nil
+		}
+
+		batch := i.index.NewBatch()
+		for _, hit := range res.Hits {
+			batch.Delete(hit.ID)
+		}
+		if err := i.index.Batch(batch); err != nil {
+			return removed, fmt.Errorf("failed to remove indexed evidence: %w", err)
+		}
+		removed += len(res.Hits)
+	}
+}
+
+// Search ranks the organization's evidence against text, returning size hits
+// starting at offset from. Highlights are HTML with matches in <mark> tags.
+func (i *Index) Search(orgID, text string, from, size int) (*Results, error) {
+	fields := make([]query.Query, 0, len(fieldBoosts))
+	for field, boost := range fieldBoosts {
+		match := bleve.NewMatchQuery(text)
+		match.SetField(field)
+		match.SetBoost(boost)
+		fields = append(fields, match)
+	}
+
+	req := bleve.NewSearchRequestOptions(
+		bleve.NewConjunctionQuery(orgQuery(orgID), bleve.NewDisjunctionQuery(fields...)),
+		size, from, false)
+	req.Fields = []string{"organization_id"}
+	req.Highlight = bleve.NewHighlightWithStyle("html")
+	for field := range fieldBoosts {
+		req.Highlight.AddField(field)
+	}
+
+	res, err := i.index.Search(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search evidence: %w", err)
+	}
+
+	results := &Results{Total: res.Total, Hits: make([]Hit, 0, len(res.Hits))}
+	for _, match := range res.Hits {
+		// Defense in depth: never return another organization's document
+		if org, _ := match.Fields["organization_id"].(string); org != orgID {
+			continue
+		}
+		results.Hits = append(results.Hits, Hit{
+			EvidenceID: match.ID,
+			Score:      match.Score,
+			Highlights: escapeFragments(match.Fragments),
+		})
+	}
+	return results, nil
+}
+
+// markTags are the tags the html highlighter wraps matches in
+var markTags = strings.NewReplacer("&lt;mark&gt;", "<mark>", "&lt;/mark&gt;", "</mark>")
+
+// escapeFragments HTML-escapes highlighted fragments, which the highlighter
+// copies verbatim from the indexed text, keeping only the <mark> tags
+func escapeFragments(fragments map[string][]string) map[string][]string {
+	escaped := make(map[string][]string, len(fragments))
+	for field, list := range fragments {
+		for _, fragment := range list {
+			escaped[field] = append(escaped[field], markTags.Replace(html.EscapeString(fragment)))
+		}
+	}
+	return escaped
+}
+
+// orgQuery matches the documents of one organization
+func orgQuery(orgID string) query.Query {
+	q := bleve.NewTermQuery(orgID)
+	q.SetField("organization_id")
+	return q
+}
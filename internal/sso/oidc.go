@@ -0,0 +1,186 @@
+package sso
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"compliancesync-api/internal/models"
+	"github.com/MicahParks/keyfunc"
+	"github.com/golang-jwt/jwt/v4"
+	"golang.org/x/oauth2"
+)
+
+// oidcDiscoveryTTL bounds how long a provider's discovery document is reused
+// before it is fetched again
+const oidcDiscoveryTTL = time.Hour
+
+// oidcProvider is a provider's discovery document and signing keys
+type oidcProvider struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+
+	jwks    *keyfunc.JWKS
+	expires time.Time
+}
+
+// DiscoverOIDC checks that issuer publishes a usable discovery document and
+// signing keys, so a configuration can be validated before it is saved
+func (c *Client) DiscoverOIDC(ctx context.Context, issuer string) error {
+	_, err := c.oidcProvider(ctx, issuer)
+	return err
+}
+
+// OIDCAuthURL returns the identity provider URL that starts an authorization
+// code flow with PKCE for the organization's configuration
+func (c *Client) OIDCAuthURL(ctx context.Context, config *models.SSOConfig, redirectURL, state, nonce, verifier string) (string, error) {
+	provider, err := c.oidcProvider(ctx, config.OIDCIssuer)
+	if err != nil {
+		return "", err
+	}
+
+	return provider.oauth2Config(config, redirectURL).AuthCodeURL(state,
+		oauth2.S256ChallengeOption(verifier),
+		oauth2.SetAuthURLParam("nonce", nonce)), nil
+}
+
+// OIDCExchange redeems an authorization code and verifies the returned ID
+// token's signature, issuer, audience, expiry and nonce. An email claim is
+// required, and an email_verified claim, when present, must be true.
+func (c *Client) OIDCExchange(ctx context.Context, config *models.SSOConfig, redirectURL, code, nonce, verifier string) (*Identity, error) {
+	provider, err := c.oidcProvider(ctx, config.OIDCIssuer)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx = context.WithValue(ctx, oauth2.HTTPClient, c.httpClient)
+	token, err := provider.oauth2Config(config, redirectURL).Exchange(ctx, code, oauth2.VerifierOption(verifier))
+	if err != nil {
+		return nil, fmt.Errorf("%w: code exchange failed: %v", ErrInvalidResponse, err)
+	}
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok || rawIDToken == "" {
+		return nil, fmt.Errorf("%w: token response has no id_token", ErrInvalidResponse)
+	}
+
+	parser := jwt.NewParser(jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "ES256", "ES384", "PS256"}))
+	var claims jwt.MapClaims
+	if _, err := parser.ParseWithClaims(rawIDToken, &claims, provider.jwks.Keyfunc); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidResponse, err)
+	}
+
+	// ParseWithClaims only checks exp, iat and nbf when present
+	if _, ok := claims["exp"]; !ok {
+		return nil, fmt.Errorf("%w: ID token has no exp claim", ErrInvalidResponse)
+	}
+	if !claims.VerifyIssuer(provider.Issuer, true) {
+		return nil, fmt.Errorf("%w: unexpected ID token issuer", ErrInvalidResponse)
+	}
+	if !claims.VerifyAudience(config.OIDCClientID, true) {
+		return nil, fmt.Errorf("%w: unexpected ID token audience", ErrInvalidResponse)
+	}
+	tokenNonce, _ := claims["nonce"].(string)
+	if subtle.ConstantTimeCompare([]byte(tokenNonce), []byte(nonce)) != 1 {
+		return nil, fmt.Errorf("%w: ID token nonce does not match", ErrInvalidResponse)
+	}
+
+	identity := &Identity{}
+	identity.Subject, _ = claims["sub"].(string)
+	identity.Email, _ = claims["email"].(string)
+	identity.Name, _ = claims["name"].(string)
+	if identity.Subject == "" || identity.Email == "" {
+		return nil, fmt.Errorf("%w: ID token has no sub or email claim", ErrInvalidResponse)
+	}
+
+	// Providers send email_verified as a boolean or, occasionally, a string
+	switch verified := claims["email_verified"].(type) {
+	case nil:
+	case bool:
+		if !verified {
+			return nil, fmt.Errorf("%w: email address is not verified", ErrInvalidResponse)
+		}
+	case string:
+		if verified != "true" {
+			return nil, fmt.Errorf("%w: email address is not verified", ErrInvalidResponse)
+		}
+	default:
+		return nil, fmt.Errorf("%w: malformed email_verified claim", ErrInvalidResponse)
+	}
+
+	return identity, nil
+}
+
+// oauth2Config is the authorization code flow for a configuration
+func (p *oidcProvider) oauth2Config(config *models.SSOConfig, redirectURL string) *oauth2.Config {
+	return &oauth2.Config{
+		ClientID:     config.OIDCClientID,
+		ClientSecret: config.OIDCClientSecret,
+		Endpoint: oauth2.Endpoint{
+			AuthURL:  p.AuthorizationEndpoint,
+			TokenURL: p.TokenEndpoint,
+		},
+		RedirectURL: redirectURL,
+		Scopes:      []string{"openid", "email", "profile"},
+	}
+}
+
+// oidcProvider returns the issuer's discovery document and signing keys,
+// fetching them unless a recent copy is cached. Keys are refetched when a
+// token names a key ID that is not cached, which follows key rotation.
+func (c *Client) oidcProvider(ctx context.Context, issuer string) (*oidcProvider, error) {
+	now := time.Now()
+
+	c.mu.Lock()
+	cached, ok := c.providers[issuer]
+	c.mu.Unlock()
+	if ok && now.Before(cached.expires) {
+		return cached, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet,
+		strings.TrimSuffix(issuer, "/")+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid OIDC issuer: %w", err)
+	}
+	body, err := c.fetch(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch OIDC discovery document: %w", err)
+	}
+
+	var provider oidcProvider
+	if err := json.Unmarshal(body, &provider); err != nil {
+		return nil, fmt.Errorf("failed to parse OIDC discovery document: %w", err)
+	}
+	if provider.Issuer != issuer {
+		return nil, fmt.Errorf("OIDC discovery document is for issuer %q, not %q", provider.Issuer, issuer)
+	}
+	if provider.AuthorizationEndpoint == "" || provider.TokenEndpoint == "" || provider.JWKSURI == "" {
+		return nil, fmt.Errorf("OIDC discovery document is missing an endpoint")
+	}
+
+	provider.jwks, err = keyfunc.Get(provider.JWKSURI, keyfunc.Options{
+		Client:            c.httpClient,
+		RefreshRateLimit:  time.Minute,
+		RefreshTimeout:    10 * time.Second,
+		RefreshUnknownKID: true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch OIDC signing keys: %w", err)
+	}
+	provider.expires = now.Add(oidcDiscoveryTTL)
+
+	c.mu.Lock()
+	if old, ok := c.providers[issuer]; ok {
+		old.jwks.EndBackground()
+	}
+	c.providers[issuer] = &provider
+	c.mu.Unlock()
+
+	return &provider, nil
+}
@@ -0,0 +1,426 @@
+package sso
+
+import (
+	"bytes"
+	"compress/flate"
+	"context"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/beevik/etree"
+)
+
+// SAML protocol identifiers
+const (
+	bindingRedirect  = "urn:oasis:names:tc:SAML:2.0:bindings:HTTP-Redirect"
+	bindingPOST      = "urn:oasis:names:tc:SAML:2.0:bindings:HTTP-POST"
+	statusSuccess    = "urn:oasis:names:tc:SAML:2.0:status:Success"
+	nameIDEmail      = "urn:oasis:names:tc:SAML:1.1:nameid-format:emailAddress"
+	confirmBearer    = "urn:oasis:names:tc:SAML:2.0:cm:bearer"
+	samlTimeLayout   = "2006-01-02T15:04:05Z"
+	samlMaxClockSkew = 2 * time.Minute
+)
+
+// Attribute names identity providers commonly use for the user's email
+// address and display name
+var (
+	samlEmailAttributes = []string{
+		"email", "mail", "emailaddress",
+		"http://schemas.xmlsoap.org/ws/2005/05/identity/claims/emailaddress",
+		"urn:oid:0.9.2342.19200300.100.1.3",
+	}
+	samlNameAttributes = []string{
+		"name", "displayname",
+		"http://schemas.xmlsoap.org/ws/2005/05/identity/claims/name",
+		"urn:oid:2.16.840.1.113730.3.1.241",
+	}
+)
+
+// SAMLMetadata is what the API needs from an identity provider's metadata
+type SAMLMetadata struct {
+	EntityID     string
+	SSOURL       string   // HTTP-Redirect single sign-on endpoint
+	Certificates []string // Base64 DER signing certificates
+}
+
+// FetchSAMLMetadata downloads and parses an identity provider's metadata
+func (c *Client) FetchSAMLMetadata(ctx context.Context, metadataURL string) (*SAMLMetadata, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, metadataURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid SAML metadata URL: %w", err)
+	}
+	body, err := c.fetch(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch SAML metadata: %w", err)
+	}
+	return ParseSAMLMetadata(body)
+}
+
+// ParseSAMLMetadata reads the entity ID, HTTP-Redirect single sign-on
+// endpoint and signing certificates from an EntityDescriptor
+func ParseSAMLMetadata(data []byte) (*SAMLMetadata, error) {
+	root, err := parseXML(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse SAML metadata: %w", err)
+	}
+	if !isElement(root, nsMetadata, "EntityDescriptor") {
+		return nil, errors.New("SAML metadata is not an EntityDescriptor")
+	}
+	idp := childElement(root, nsMetadata, "IDPSSODescriptor")
+	if idp == nil {
+		return nil, errors.New("SAML metadata has no IDPSSODescriptor")
+	}
+
+	metadata := &SAMLMetadata{EntityID: attrValue(root, "entityID")}
+	for _, sso := range childElements(idp, nsMetadata, "SingleSignOnService") {
+		if attrValue(sso, "Binding") == bindingRedirect {
+			metadata.SSOURL = attrValue(sso, "Location")
+			break
+		}
+	}
+	for _, kd := range childElements(idp, nsMetadata, "KeyDescriptor") {
+		if use := attrValue(kd, "use"); use != "" && use != "signing" {
+			continue
+		}
+		keyInfo := childElement(kd, nsDSig, "KeyInfo")
+		if keyInfo == nil {
+			continue
+		}
+		for _, data := range childElements(keyInfo, nsDSig, "X509Data") {
+			for _, cert := range childElements(data, nsDSig, "X509Certificate") {
+				metadata.Certificates = append(metadata.Certificates, strings.Join(strings.Fields(elementText(cert)), ""))
+			}
+		}
+	}
+
+	if metadata.EntityID == "" || metadata.SSOURL == "" || len(metadata.Certificates) == 0 {
+		return nil, errors.New("SAML metadata needs an entity ID, an HTTP-Redirect SSO endpoint and a signing certificate")
+	}
+	if _, err := ParseCertificates(metadata.Certificates); err != nil {
+		return nil, err
+	}
+	return metadata, nil
+}
+
+// ParseCertificates decodes base64 DER certificates, as found in metadata
+func ParseCertificates(encoded []string) ([]*x509.Certificate, error) {
+	certs := make([]*x509.Certificate, 0, len(encoded))
+	for _, enc := range encoded {
+		der, err := decodeBase64(enc)
+		if err != nil {
+			return nil, fmt.Errorf("invalid certificate encoding: %w", err)
+		}
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			return nil, fmt.Errorf("invalid certificate: %w", err)
+		}
+		certs = append(certs, cert)
+	}
+	return certs, nil
+}
+
+// ServiceProvider identifies the API to one organization's identity provider
+type ServiceProvider struct {
+	EntityID string // Audience the identity provider must assert
+	ACSURL   string // Assertion consumer service; receives HTTP-POST responses
+}
+
+// IdentityProvider is the trusted half of an organization's SAML configuration
+type IdentityProvider struct {
+	EntityID     string
+	SSOURL       string
+	Certificates []string
+}
+
+// NewRequestID returns a random AuthnRequest ID. XML IDs may not start with
+// a digit, hence the prefix.
+func NewRequestID() (string, error) {
+	b := make([]byte, 20)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "_" + hex.EncodeToString(b), nil
+}
+
+// Metadata returns the service provider metadata administrators load into
+// their identity provider
+func (sp ServiceProvider) Metadata() []byte {
+	var b bytes.Buffer
+	b.WriteString(xml.Header)
+	b.WriteString(`<md:EntityDescriptor xmlns:md="` + nsMetadata + `" entityID="` + escapeAttr(sp.EntityID) + `">`)
+	b.WriteString(`<md:SPSSODescriptor AuthnRequestsSigned="false" WantAssertionsSigned="true" ` +
+		`protocolSupportEnumeration="urn:oasis:names:tc:SAML:2.0:protocol">`)
+	b.WriteString(`<md:NameIDFormat>` + nameIDEmail + `</md:NameIDFormat>`)
+	b.WriteString(`<md:AssertionConsumerService Binding="` + bindingPOST + `" Location="` +
+		escapeAttr(sp.ACSURL) + `" index="0" isDefault="true"/>`)
+	b.WriteString(`</md:SPSSODescriptor></md:EntityDescriptor>`)
+	return b.Bytes()
+}
+
+// AuthnRequestURL returns the identity provider URL that starts a sign-in
+// with the HTTP-Redirect binding. The response comes back by HTTP-POST to
+// the ACS URL with relayState.
+func (sp ServiceProvider) AuthnRequestURL(idp IdentityProvider, requestID, relayState string, now time.Time) (string, error) {
+	request := `<samlp:AuthnRequest xmlns:samlp="` + nsSAMLP + `" xmlns:saml="` + nsSAML + `"` +
+		` ID="` + escapeAttr(requestID) + `" Version="2.0"` +
+		` IssueInstant="` + now.UTC().Format(samlTimeLayout) + `"` +
+		` Destination="` + escapeAttr(idp.SSOURL) + `"` +
+		` AssertionConsumerServiceURL="` + escapeAttr(sp.ACSURL) + `"` +
+		` ProtocolBinding="` + bindingPOST + `">` +
+		`<saml:Issuer>` + escapeText(sp.EntityID) + `</saml:Issuer>` +
+		`<samlp:NameIDPolicy Format="` + nameIDEmail + `" AllowCreate="true"/>` +
+		`</samlp:AuthnRequest>`
+
+	var deflated bytes.Buffer
+	w, err := flate.NewWriter(&deflated, flate.BestCompression)
+	if err != nil {
+		return "", err
+	}
+	if _, err := w.Write([]byte(request)); err != nil {
+		return "", err
+	}
+	if err := w.Close(); err != nil {
+		return "", err
+	}
+
+	target, err := url.Parse(idp.SSOURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid SAML SSO URL: %w", err)
+	}
+	query := target.Query()
+	query.Set("SAMLRequest", base64.StdEncoding.EncodeToString(deflated.Bytes()))
+	query.Set("RelayState", relayState)
+	target.RawQuery = query.Encode()
+	return target.String(), nil
+}
+
+// ParseSAMLResponse validates a base64 SAMLResponse posted to the ACS URL
+// and returns the asserted identity. The response must answer requestID,
+// and either it or its single assertion must be signed by one of the
+// identity provider's certificates; only signed content is read. The
+// assertion is claimed in the AssertionStore, so it is accepted only once.
+// Encrypted assertions and unsolicited (IdP-initiated) responses are not
+// supported.
+func (c *Client) ParseSAMLResponse(ctx context.Context, sp ServiceProvider, idp IdentityProvider, encoded, requestID string, now time.Time) (*Identity, error) {
+	identity, err := c.parseSAMLResponse(ctx, sp, idp, encoded, requestID, now)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidResponse, err)
+	}
+	return identity, nil
+}
+
+func (c *Client) parseSAMLResponse(ctx context.Context, sp ServiceProvider, idp IdentityProvider, encoded, requestID string, now time.Time) (*Identity, error) {
+	data, err := decodeBase64(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("invalid SAMLResponse encoding: %w", err)
+	}
+	if len(data) > maxDocumentSize {
+		return nil, errors.New("SAMLResponse is too large")
+	}
+	certs, err := ParseCertificates(idp.Certificates)
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := parseXML(data)
+	if err != nil {
+		return nil, err
+	}
+	if !isElement(response, nsSAMLP, "Response") {
+		return nil, errors.New("document is not a SAML Response")
+	}
+
+	// Duplicate IDs would let a signature reference resolve to a different
+	// element than the one read
+	ids := make(map[string]bool)
+	var duplicate bool
+	walkElements(response, func(el *etree.Element) {
+		if id := attrValue(el, "ID"); id != "" {
+			duplicate = duplicate || ids[id]
+			ids[id] = true
+		}
+	})
+	if duplicate {
+		return nil, errors.New("document contains duplicate IDs")
+	}
+
+	// The response or its assertion must be signed. Identity data is read
+	// only from the signed copies verifyEnvelopedSignature returns.
+	if childElement(response, nsSAML, "EncryptedAssertion") != nil {
+		return nil, errors.New("encrypted assertions are not supported")
+	}
+	signedResponse, err := verifyEnvelopedSignature(response, certs, now)
+	switch {
+	case err == nil:
+		response = signedResponse
+	case err != errNotSigned:
+		return nil, fmt.Errorf("response signature: %w", err)
+	}
+	assertions := childElements(response, nsSAML, "Assertion")
+	if len(assertions) != 1 {
+		return nil, errors.New("response must contain exactly one assertion")
+	}
+	assertion, err := verifyEnvelopedSignature(assertions[0], certs, now)
+	switch {
+	case err == errNotSigned && signedResponse != nil:
+		assertion = assertions[0]
+	case err == errNotSigned:
+		return nil, errors.New("neither the response nor the assertion is signed")
+	case err != nil:
+		return nil, fmt.Errorf("assertion signature: %w", err)
+	}
+
+	// Response
+	if status := childElement(response, nsSAMLP, "Status"); status == nil ||
+		childElement(status, nsSAMLP, "StatusCode") == nil ||
+		attrValue(childElement(status, nsSAMLP, "StatusCode"), "Value") != statusSuccess {
+		return nil, errors.New("identity provider did not report success")
+	}
+	if dest := attrValue(response, "Destination"); dest != "" && dest != sp.ACSURL {
+		return nil, errors.New("response destination does not match the ACS URL")
+	}
+	if attrValue(response, "InResponseTo") != requestID {
+		return nil, errors.New("response does not answer this sign-in request")
+	}
+	if issuer := childElement(response, nsSAML, "Issuer"); issuer != nil && elementText(issuer) != idp.EntityID {
+		return nil, errors.New("unexpected response issuer")
+	}
+
+	// Assertion
+	if issuer := childElement(assertion, nsSAML, "Issuer"); issuer == nil || elementText(issuer) != idp.EntityID {
+		return nil, errors.New("unexpected assertion issuer")
+	}
+	expires, err := checkConditions(assertion, sp, now)
+	if err != nil {
+		return nil, err
+	}
+	subject := childElement(assertion, nsSAML, "Subject")
+	if subject == nil {
+		return nil, errors.New("assertion has no subject")
+	}
+	if err := checkSubjectConfirmation(subject, sp, requestID, now); err != nil {
+		return nil, err
+	}
+
+	identity := &Identity{}
+	if nameID := childElement(subject, nsSAML, "NameID"); nameID != nil {
+		identity.Subject = elementText(nameID)
+		if attrValue(nameID, "Format") == nameIDEmail {
+			identity.Email = elementText(nameID)
+		}
+	}
+	attributes := assertionAttributes(assertion)
+	if identity.Email == "" {
+		identity.Email = firstAttribute(attributes, samlEmailAttributes)
+	}
+	identity.Name = firstAttribute(attributes, samlNameAttributes)
+	if identity.Subject == "" || identity.Email == "" {
+		return nil, errors.New("assertion has no NameID or email address")
+	}
+
+	assertionID := attrValue(assertion, "ID")
+	if assertionID == "" {
+		return nil, errors.New("assertion has no ID")
+	}
+	if err := c.assertions.ClaimSAMLAssertion(ctx, idp.EntityID, assertionID, expires.Add(samlMaxClockSkew)); err != nil {
+		return nil, fmt.Errorf("failed to claim assertion: %w", err)
+	}
+
+	return identity, nil
+}
+
+// checkConditions enforces the assertion's validity window and requires the
+// service provider among its audiences. It returns when the assertion expires.
+func checkConditions(assertion *etree.Element, sp ServiceProvider, now time.Time) (time.Time, error) {
+	conditions := childElement(assertion, nsSAML, "Conditions")
+	if conditions == nil {
+		return time.Time{}, errors.New("assertion has no conditions")
+	}
+
+	notBefore, err := parseSAMLTime(attrValue(conditions, "NotBefore"))
+	if err == nil && now.Add(samlMaxClockSkew).Before(notBefore) {
+		return time.Time{}, errors.New("assertion is not yet valid")
+	}
+	notOnOrAfter, err := parseSAMLTime(attrValue(conditions, "NotOnOrAfter"))
+	if err != nil {
+		return time.Time{}, errors.New("assertion has no valid NotOnOrAfter")
+	}
+	if !now.Add(-samlMaxClockSkew).Before(notOnOrAfter) {
+		return time.Time{}, errors.New("assertion has expired")
+	}
+
+	var audienceOK bool
+	for _, restriction := range childElements(conditions, nsSAML, "AudienceRestriction") {
+		for _, audience := range childElements(restriction, nsSAML, "Audience") {
+			audienceOK = audienceOK || elementText(audience) == sp.EntityID
+		}
+	}
+	if !audienceOK {
+		return time.Time{}, errors.New("assertion is not addressed to this service provider")
+	}
+
+	return notOnOrAfter, nil
+}
+
+// checkSubjectConfirmation requires a bearer confirmation for this ACS URL
+// and request that has not expired
+func checkSubjectConfirmation(subject *etree.Element, sp ServiceProvider, requestID string, now time.Time) error {
+	for _, confirmation := range childElements(subject, nsSAML, "SubjectConfirmation") {
+		if attrValue(confirmation, "Method") != confirmBearer {
+			continue
+		}
+		data := childElement(confirmation, nsSAML, "SubjectConfirmationData")
+		if data == nil || attrValue(data, "Recipient") != sp.ACSURL {
+			continue
+		}
+		if irt := attrValue(data, "InResponseTo"); irt != "" && irt != requestID {
+			continue
+		}
+		notOnOrAfter, err := parseSAMLTime(attrValue(data, "NotOnOrAfter"))
+		if err != nil || !now.Add(-samlMaxClockSkew).Before(notOnOrAfter) {
+			continue
+		}
+		return nil
+	}
+	return errors.New("assertion has no valid bearer subject confirmation")
+}
+
+// assertionAttributes returns the assertion's attribute values keyed by
+// lowercase attribute name
+func assertionAttributes(assertion *etree.Element) map[string]string {
+	attributes := make(map[string]string)
+	for _, statement := range childElements(assertion, nsSAML, "AttributeStatement") {
+		for _, attr := range childElements(statement, nsSAML, "Attribute") {
+			if value := childElement(attr, nsSAML, "AttributeValue"); value != nil {
+				attributes[strings.ToLower(attrValue(attr, "Name"))] = elementText(value)
+			}
+		}
+	}
+	return attributes
+}
+
+func firstAttribute(attributes map[string]string, names []string) string {
+	for _, name := range names {
+		if value := attributes[strings.ToLower(name)]; value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// parseSAMLTime parses an xs:dateTime, which SAML requires to be in UTC
+func parseSAMLTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, errors.New("missing time")
+	}
+	return time.Parse(time.RFC3339Nano, value)
+}
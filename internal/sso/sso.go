@@ -0,0 +1,75 @@
+// Package sso signs organization users in through their own identity
+// provider, over OpenID Connect or SAML 2.0. It validates what the identity
+// provider asserts and returns the user's Identity; provisioning users and
+// issuing sessions is left to the caller.
+package sso
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrInvalidResponse means an identity provider's response failed validation
+var ErrInvalidResponse = errors.New("invalid identity provider response")
+
+// maxDocumentSize bounds discovery documents, metadata and SAML responses
+const maxDocumentSize = 1 << 20
+
+// Identity is a user as asserted by an identity provider
+type Identity struct {
+	Subject string // Stable identifier at the identity provider
+	Email   string
+	Name    string
+}
+
+// AssertionStore records accepted SAML assertions. It is shared by every
+// API instance, so a captured response cannot be replayed against any of
+// them. store.Store satisfies it.
+type AssertionStore interface {
+	// ClaimSAMLAssertion records an identity provider's assertion until it
+	// expires, failing if it was already recorded
+	ClaimSAMLAssertion(ctx context.Context, issuer, assertionID string, expiresAt time.Time) error
+}
+
+// Client talks to identity providers. It caches OIDC discovery documents and
+// signing keys, and claims accepted SAML assertions in its AssertionStore.
+type Client struct {
+	httpClient *http.Client
+	assertions AssertionStore
+
+	mu        sync.Mutex
+	providers map[string]*oidcProvider // issuer -> provider
+}
+
+// NewClient creates a client that makes requests with httpClient, or with a
+// client with a 10 second timeout when nil, and claims SAML assertions in
+// assertions
+func NewClient(httpClient *http.Client, assertions AssertionStore) *Client {
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: 10 * time.Second}
+	}
+	return &Client{
+		httpClient: httpClient,
+		assertions: assertions,
+		providers:  make(map[string]*oidcProvider),
+	}
+}
+
+// fetch retrieves a document from an identity provider
+func (c *Client) fetch(req *http.Request) ([]byte, error) {
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s returned status %d", req.URL, resp.StatusCode)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, maxDocumentSize))
+}
@@ -0,0 +1,241 @@
+package sso
+
+import (
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/beevik/etree"
+	dsig "github.com/russellhaering/goxmldsig"
+	"github.com/russellhaering/goxmldsig/etreeutils"
+)
+
+// XML namespaces used by SAML messages and their signatures
+const (
+	nsDSig     = dsig.Namespace
+	nsSAML     = "urn:oasis:names:tc:SAML:2.0:assertion"
+	nsSAMLP    = "urn:oasis:names:tc:SAML:2.0:protocol"
+	nsMetadata = "urn:oasis:names:tc:SAML:2.0:metadata"
+)
+
+// Signature and digest algorithms accepted. goxmldsig also verifies SHA-1,
+// which is refused here.
+var (
+	signatureMethods = map[string]bool{
+		dsig.RSASHA256SignatureMethod: true,
+		dsig.RSASHA512SignatureMethod: true,
+	}
+	digestMethods = map[string]bool{
+		"http://www.w3.org/2001/04/xmlenc#sha256": true,
+		"http://www.w3.org/2001/04/xmlenc#sha512": true,
+	}
+)
+
+// errNotSigned means an element carries no enveloped signature
+var errNotSigned = errors.New("element is not signed")
+
+// parseXML parses a document and returns its root element
+func parseXML(data []byte) (*etree.Element, error) {
+	doc, err := parseDocument(data)
+	if err != nil {
+		return nil, err
+	}
+	return doc.Root(), nil
+}
+
+// parseDocument parses a document with a root element. Document type
+// declarations are rejected so entity expansion cannot be abused.
+func parseDocument(data []byte) (*etree.Document, error) {
+	doc := etree.NewDocument()
+	if err := doc.ReadFromBytes(data); err != nil {
+		return nil, err
+	}
+	for _, token := range doc.Child {
+		if _, ok := token.(*etree.Directive); ok {
+			return nil, errors.New("document type declarations are not allowed")
+		}
+	}
+	if doc.Root() == nil {
+		return nil, errors.New("document has no root element")
+	}
+	return doc, nil
+}
+
+// isElement reports whether el has the given namespace and local name
+func isElement(el *etree.Element, space, local string) bool {
+	return el.Tag == local && el.NamespaceURI() == space
+}
+
+// attrValue returns the value of an unprefixed attribute of el
+func attrValue(el *etree.Element, name string) string {
+	for _, a := range el.Attr {
+		if a.Space == "" && a.Key == name {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+// childElement returns the first child element of el with the given name,
+// or nil
+func childElement(el *etree.Element, space, local string) *etree.Element {
+	for _, c := range el.ChildElements() {
+		if isElement(c, space, local) {
+			return c
+		}
+	}
+	return nil
+}
+
+// childElements returns the child elements of el with the given name
+func childElements(el *etree.Element, space, local string) []*etree.Element {
+	var els []*etree.Element
+	for _, c := range el.ChildElements() {
+		if isElement(c, space, local) {
+			els = append(els, c)
+		}
+	}
+	return els
+}
+
+// elementText returns the element's character data, trimmed
+func elementText(el *etree.Element) string {
+	return strings.TrimSpace(el.Text())
+}
+
+// walkElements calls fn for el and each of its descendants
+func walkElements(el *etree.Element, fn func(*etree.Element)) {
+	fn(el)
+	for _, c := range el.ChildElements() {
+		walkElements(c, fn)
+	}
+}
+
+var (
+	textEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", "\r", "&#xD;")
+	attrEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", `"`, "&quot;",
+		"\t", "&#x9;", "\n", "&#xA;", "\r", "&#xD;")
+)
+
+func escapeText(s string) string { return textEscaper.Replace(s) }
+func escapeAttr(s string) string { return attrEscaper.Replace(s) }
+
+// verifyEnvelopedSignature checks the enveloped signature that is a direct
+// child of el against the trusted certificates with goxmldsig, and returns
+// the signed content: a copy of el without its signature. Only that copy is
+// covered by the signature, so callers must read from it rather than el.
+// The signature must have a single SHA-2 reference to el itself, and the
+// certificate must be valid at now.
+func verifyEnvelopedSignature(el *etree.Element, certs []*x509.Certificate, now time.Time) (*etree.Element, error) {
+	sigs := childElements(el, nsDSig, "Signature")
+	if len(sigs) == 0 {
+		return nil, errNotSigned
+	}
+	if len(sigs) > 1 {
+		return nil, errors.New("element has more than one signature")
+	}
+
+	id := attrValue(el, "ID")
+	if id == "" {
+		return nil, errors.New("signed element has no ID")
+	}
+
+	signedInfo := childElement(sigs[0], nsDSig, "SignedInfo")
+	if signedInfo == nil {
+		return nil, errors.New("signature has no SignedInfo")
+	}
+	if method := childElement(signedInfo, nsDSig, "SignatureMethod"); method == nil || !signatureMethods[attrValue(method, "Algorithm")] {
+		return nil, errors.New("unsupported signature method")
+	}
+	refs := childElements(signedInfo, nsDSig, "Reference")
+	if len(refs) != 1 {
+		return nil, errors.New("signature must have exactly one reference")
+	}
+	if attrValue(refs[0], "URI") != "#"+id {
+		return nil, errors.New("signature reference does not cover the signed element")
+	}
+	if method := childElement(refs[0], nsDSig, "DigestMethod"); method == nil || !digestMethods[attrValue(method, "Algorithm")] {
+		return nil, errors.New("unsupported digest method")
+	}
+
+	// Detach el with the namespaces it inherits, so the signed copy can be
+	// canonicalized and read on its own
+	nsCtx, err := etreeutils.NSBuildParentContext(el)
+	if err != nil {
+		return nil, err
+	}
+	detached, err := etreeutils.NSDetatch(nsCtx, el)
+	if err != nil {
+		return nil, err
+	}
+
+	validator := dsig.NewDefaultValidationContext(&dsig.MemoryX509CertificateStore{Roots: certs})
+	validator.Clock = dsig.NewFakeClockAt(now)
+	signed, err := validator.Validate(detached)
+	if err != nil {
+		return nil, fmt.Errorf("signature does not verify: %w", err)
+	}
+	return signed, nil
+}
+
+// decodeBase64 decodes standard base64 that may be wrapped across lines
+func decodeBase64(s string) ([]byte, error) {
+	return base64.StdEncoding.DecodeString(strings.Join(strings.Fields(s), ""))
+}
+
+// SignEnveloped adds an enveloped RSA-SHA256 signature to the element of doc
+// with the given ID, placed after the element's Issuer as SAML requires, and
+// returns the signed document. It exists for the mock identity provider; the
+// API only verifies signatures.
+func SignEnveloped(doc []byte, id string, key *rsa.PrivateKey, certDER []byte) ([]byte, error) {
+	parsed, err := parseDocument(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	var el *etree.Element
+	walkElements(parsed.Root(), func(e *etree.Element) {
+		if el == nil && attrValue(e, "ID") == id {
+			el = e
+		}
+	})
+	if el == nil {
+		return nil, fmt.Errorf("no element with ID %s", id)
+	}
+
+	nsCtx, err := etreeutils.NSBuildParentContext(el)
+	if err != nil {
+		return nil, err
+	}
+	detached, err := etreeutils.NSDetatch(nsCtx, el)
+	if err != nil {
+		return nil, err
+	}
+
+	signer := dsig.NewDefaultSigningContext(dsig.TLSCertKeyStore(tls.Certificate{
+		Certificate: [][]byte{certDER},
+		PrivateKey:  key,
+	}))
+	signer.Canonicalizer = dsig.MakeC14N10ExclusiveCanonicalizerWithPrefixList("")
+	if err := signer.SetSignatureMethod(dsig.RSASHA256SignatureMethod); err != nil {
+		return nil, err
+	}
+	sig, err := signer.ConstructSignature(detached, true)
+	if err != nil {
+		return nil, err
+	}
+
+	// Insert the signature after the Issuer, or first when there is none
+	pos := 0
+	if issuer := childElement(el, nsSAML, "Issuer"); issuer != nil {
+		pos = issuer.Index() + 1
+	}
+	el.InsertChildAt(pos, sig)
+
+	return parsed.WriteToBytes()
+}
@@ -0,0 +1,294 @@
+package sso
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	testAssertionID = "_assertion1"
+	testRequestID   = "_request1"
+	testIdPEntityID = "https://idp.example.com/metadata"
+	testEmail       = "user@example.com"
+)
+
+var testSP = ServiceProvider{
+	EntityID: "https://api.example.com/saml/metadata",
+	ACSURL:   "https://api.example.com/saml/acs",
+}
+
+// testAssertions is an AssertionStore that never expires claims
+type testAssertions map[string]bool
+
+func (a testAssertions) ClaimSAMLAssertion(ctx context.Context, issuer, assertionID string, expiresAt time.Time) error {
+	key := issuer + " " + assertionID
+	if a[key] {
+		return errors.New("assertion has already been used")
+	}
+	a[key] = true
+	return nil
+}
+
+// testSigner is an identity provider signing key and its certificate
+type testSigner struct {
+	key     *rsa.PrivateKey
+	certDER []byte
+	cert    *x509.Certificate
+}
+
+func newTestSigner(t *testing.T) *testSigner {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "test-idp"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+	certDER, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("failed to create certificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(certDER)
+	if err != nil {
+		t.Fatalf("failed to parse certificate: %v", err)
+	}
+	return &testSigner{key: key, certDER: certDER, cert: cert}
+}
+
+// testResponse returns an unsigned SAML response to testRequestID with one
+// assertion for testEmail
+func testResponse(now time.Time) string {
+	ts := func(d time.Duration) string { return now.Add(d).UTC().Format(samlTimeLayout) }
+	return `<samlp:Response xmlns:samlp="` + nsSAMLP + `" xmlns:saml="` + nsSAML + `"` +
+		` ID="_response1" Version="2.0" IssueInstant="` + ts(0) + `"` +
+		` Destination="` + testSP.ACSURL + `" InResponseTo="` + testRequestID + `">` +
+		`<saml:Issuer>` + testIdPEntityID + `</saml:Issuer>` +
+		`<samlp:Status><samlp:StatusCode Value="` + statusSuccess + `"/></samlp:Status>` +
+		`<saml:Assertion ID="` + testAssertionID + `" Version="2.0" IssueInstant="` + ts(0) + `">` +
+		`<saml:Issuer>` + testIdPEntityID + `</saml:Issuer>` +
+		`<saml:Subject><saml:NameID Format="` + nameIDEmail + `">` + testEmail + `</saml:NameID>` +
+		`<saml:SubjectConfirmation Method="` + confirmBearer + `">` +
+		`<saml:SubjectConfirmationData InResponseTo="` + testRequestID + `"` +
+		` NotOnOrAfter="` + ts(5*time.Minute) + `" Recipient="` + testSP.ACSURL + `"/>` +
+		`</saml:SubjectConfirmation></saml:Subject>` +
+		`<saml:Conditions NotBefore="` + ts(-time.Minute) + `" NotOnOrAfter="` + ts(5*time.Minute) + `">` +
+		`<saml:AudienceRestriction><saml:Audience>` + testSP.EntityID + `</saml:Audience></saml:AudienceRestriction>` +
+		`</saml:Conditions>` +
+		`</saml:Assertion></samlp:Response>`
+}
+
+// signedTestResponse returns testResponse with its assertion signed by signer
+func signedTestResponse(t *testing.T, signer *testSigner, now time.Time) string {
+	t.Helper()
+	signed, err := SignEnveloped([]byte(testResponse(now)), testAssertionID, signer.key, signer.certDER)
+	if err != nil {
+		t.Fatalf("SignEnveloped: %v", err)
+	}
+	return string(signed)
+}
+
+// between returns the first substring of s from start through end
+func between(t *testing.T, s, start, end string) string {
+	t.Helper()
+	i := strings.Index(s, start)
+	j := strings.Index(s, end)
+	if i < 0 || j < i {
+		t.Fatalf("document has no %s...%s", start, end)
+	}
+	return s[i : j+len(end)]
+}
+
+func TestVerifyEnvelopedSignature(t *testing.T) {
+	signer := newTestSigner(t)
+	other := newTestSigner(t)
+	now := time.Now()
+	signed := signedTestResponse(t, signer, now)
+
+	otherDigest := sha256.Sum256([]byte("other content"))
+	signature := between(t, signed, "<ds:Signature", "</ds:Signature>")
+
+	tests := []struct {
+		name    string
+		doc     string
+		certs   []*x509.Certificate
+		at      time.Duration // Verification time after now
+		wantErr string
+	}{
+		{
+			name:  "valid",
+			doc:   signed,
+			certs: []*x509.Certificate{signer.cert},
+		},
+		{
+			name:  "second trusted certificate",
+			doc:   signed,
+			certs: []*x509.Certificate{other.cert, signer.cert},
+		},
+		{
+			name:    "untrusted certificate",
+			doc:     signed,
+			certs:   []*x509.Certificate{other.cert},
+			wantErr: "signature does not verify",
+		},
+		{
+			name:    "tampered content",
+			doc:     strings.Replace(signed, testEmail, "attacker@example.com", 1),
+			certs:   []*x509.Certificate{signer.cert},
+			wantErr: "signature does not verify",
+		},
+		{
+			name: "tampered digest",
+			doc: strings.Replace(signed, between(t, signed, "<ds:DigestValue>", "</ds:DigestValue>"),
+				"<ds:DigestValue>"+base64.StdEncoding.EncodeToString(otherDigest[:])+"</ds:DigestValue>", 1),
+			certs:   []*x509.Certificate{signer.cert},
+			wantErr: "signature does not verify",
+		},
+		{
+			name:    "expired certificate",
+			doc:     signed,
+			certs:   []*x509.Certificate{signer.cert},
+			at:      2 * time.Hour,
+			wantErr: "signature does not verify",
+		},
+		{
+			name:    "SHA-1 signature method",
+			doc:     strings.Replace(signed, "xmldsig-more#rsa-sha256", "xmldsig#rsa-sha1", 1),
+			certs:   []*x509.Certificate{signer.cert},
+			wantErr: "unsupported signature method",
+		},
+		{
+			name:    "wrong reference URI",
+			doc:     strings.Replace(signed, `URI="#`+testAssertionID+`"`, `URI="#_response1"`, 1),
+			certs:   []*x509.Certificate{signer.cert},
+			wantErr: "reference does not cover the signed element",
+		},
+		{
+			name:    "signed element renamed",
+			doc:     strings.Replace(signed, `ID="`+testAssertionID+`"`, `ID="_assertion2"`, 1),
+			certs:   []*x509.Certificate{signer.cert},
+			wantErr: "reference does not cover the signed element",
+		},
+		{
+			name:    "duplicate signature",
+			doc:     strings.Replace(signed, signature, signature+signature, 1),
+			certs:   []*x509.Certificate{signer.cert},
+			wantErr: "more than one signature",
+		},
+		{
+			name:    "unsigned",
+			doc:     testResponse(now),
+			certs:   []*x509.Certificate{signer.cert},
+			wantErr: errNotSigned.Error(),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root, err := parseXML([]byte(tt.doc))
+			if err != nil {
+				t.Fatalf("parseXML: %v", err)
+			}
+			assertion := childElement(root, nsSAML, "Assertion")
+			if assertion == nil {
+				t.Fatal("response has no assertion")
+			}
+
+			signed, err := verifyEnvelopedSignature(assertion, tt.certs, now.Add(tt.at))
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Errorf("verifyEnvelopedSignature: %v", err)
+			case tt.wantErr == "" && childElement(signed, nsDSig, "Signature") != nil:
+				t.Error("verifyEnvelopedSignature returned the element with its signature")
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Errorf("verifyEnvelopedSignature = %v, want error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseSAMLResponseSignature(t *testing.T) {
+	signer := newTestSigner(t)
+	now := time.Now()
+	signed := signedTestResponse(t, signer, now)
+	idp := IdentityProvider{
+		EntityID:     testIdPEntityID,
+		Certificates: []string{base64.StdEncoding.EncodeToString(signer.certDER)},
+	}
+
+	// Wrapping: the signed assertion is moved out of the way and an
+	// unsigned one with the same ID and another subject takes its place
+	assertion := between(t, signed, "<saml:Assertion", "</saml:Assertion>")
+	signature := between(t, assertion, "<ds:Signature", "</ds:Signature>")
+	forged := strings.NewReplacer(signature, "", testEmail, "attacker@example.com").Replace(assertion)
+	wrapped := strings.Replace(signed, assertion,
+		"<samlp:Extensions>"+assertion+"</samlp:Extensions>"+forged, 1)
+
+	tests := []struct {
+		name    string
+		doc     string
+		wantErr string
+	}{
+		{name: "valid", doc: signed},
+		{name: "wrapped assertion", doc: wrapped, wantErr: "duplicate IDs"},
+		{name: "unsigned", doc: testResponse(now), wantErr: "neither the response nor the assertion is signed"},
+		{
+			name:    "tampered assertion",
+			doc:     strings.Replace(signed, testEmail, "attacker@example.com", 1),
+			wantErr: "signature does not verify",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := NewClient(nil, testAssertions{})
+			encoded := base64.StdEncoding.EncodeToString([]byte(tt.doc))
+			identity, err := client.ParseSAMLResponse(context.Background(), testSP, idp, encoded, testRequestID, now)
+
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("ParseSAMLResponse: %v", err)
+				}
+				if identity.Email != testEmail {
+					t.Errorf("email = %q, want %q", identity.Email, testEmail)
+				}
+				return
+			}
+			if !errors.Is(err, ErrInvalidResponse) || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ParseSAMLResponse = %v, want ErrInvalidResponse containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseSAMLResponseRejectsReplay(t *testing.T) {
+	signer := newTestSigner(t)
+	now := time.Now()
+	idp := IdentityProvider{
+		EntityID:     testIdPEntityID,
+		Certificates: []string{base64.StdEncoding.EncodeToString(signer.certDER)},
+	}
+	encoded := base64.StdEncoding.EncodeToString([]byte(signedTestResponse(t, signer, now)))
+
+	client := NewClient(nil, testAssertions{})
+	if _, err := client.ParseSAMLResponse(context.Background(), testSP, idp, encoded, testRequestID, now); err != nil {
+		t.Fatalf("first ParseSAMLResponse: %v", err)
+	}
+	if _, err := client.ParseSAMLResponse(context.Background(), testSP, idp, encoded, testRequestID, now); !errors.Is(err, ErrInvalidResponse) {
+		t.Errorf("replayed ParseSAMLResponse = %v, want ErrInvalidResponse", err)
+	}
+}
@@ -0,0 +1,8 @@
+package store
+
+// AuditChainHead records the last entry of an organization's audit log hash
+// chain. The next entry gets Sequence+1 and links to Hash.
+type AuditChainHead struct {
+	Sequence int64  `firestore:"sequence" json:"sequence"`
+	Hash     string `firestore:"hash" json:"hash"`
+}
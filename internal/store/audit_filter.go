@@ -0,0 +1,78 @@
+package store
+
+import (
+	"strings"
+	"time"
+
+	"compliancesync-api/internal/models"
+)
+
+// Free-text audit log search is evaluated after fetching on backends without
+// substring queries. Entries are fetched in batches and a single call scans at
+// least auditSearchScanLimit entries (or ten pages' worth) before returning.
+const (
+	auditSearchBatchSize = 500
+	auditSearchScanLimit = 5000
+)
+
+// MaxAuditLogActions is the most actions one filter may match. Firestore
+// serves multiple actions with an "in" query, which accepts at most 30 values.
+const MaxAuditLogActions = 30
+
+// AuditLogFilter narrows ListAuditLogs. Zero-valued fields do not filter.
+type AuditLogFilter struct {
+	UserID       string
+	ActorType    models.ActorType
+	Actions      []models.AuditAction // Matches any of these actions
+	ResourceType string
+	ResourceID   string
+	From         time.Time // Inclusive lower bound on Timestamp
+	To           time.Time // Exclusive upper bound on Timestamp
+	Search       string    // Case-insensitive substring of Description or UserEmail
+}
+
+// matches reports whether log passes every filter
+func (f AuditLogFilter) matches(log *models.AuditLog) bool {
+	if f.UserID != "" && log.UserID != f.UserID {
+		return false
+	}
+	if f.ActorType != "" && log.ActorType != f.ActorType {
+		return false
+	}
+	if len(f.Actions) > 0 && !f.hasAction(log.Action) {
+		return false
+	}
+	if f.ResourceType != "" && log.ResourceType != f.ResourceType {
+		return false
+	}
+	if f.ResourceID != "" && log.ResourceID != f.ResourceID {
+		return false
+	}
+	if !f.From.IsZero() && log.Timestamp.Before(f.From) {
+		return false
+	}
+	if !f.To.IsZero() && !log.Timestamp.Before(f.To) {
+		return false
+	}
+	return f.matchesSearch(log)
+}
+
+func (f AuditLogFilter) hasAction(action models.AuditAction) bool {
+	for _, a := range f.Actions {
+		if a == action {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesSearch applies the free-text part of the filter, which backends
+// without substring queries evaluate after fetching
+func (f AuditLogFilter) matchesSearch(log *models.AuditLog) bool {
+	if f.Search == "" {
+		return true
+	}
+	needle := strings.ToLower(f.Search)
+	return strings.Contains(strings.ToLower(log.Description), needle) ||
+		strings.Contains(strings.ToLower(log.UserEmail), needle)
+}
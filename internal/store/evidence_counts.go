@@ -0,0 +1,46 @@
+package store
+
+import "compliancesync-api/internal/models"
+
+// EvidenceCountDrift describes a requirement whose stored evidence_count did
+// not match its active evidence and was corrected by ReconcileEvidenceCounts
+type EvidenceCountDrift struct {
+	RequirementID string `json:"requirement_id"`
+	Title         string `json:"title"`
+	StoredCount   int    `json:"stored_count"`
+	ActualCount   int    `json:"actual_count"`
+}
+
+// countedRequirementIDs returns the requirements an evidence item counts
+// toward. Only active evidence is counted; uploading and deleted items are not.
+func countedRequirementIDs(evidence *models.Evidence) map[string]bool {
+	counted := make(map[string]bool)
+	if evidence == nil || evidence.Status != "active" {
+		return counted
+	}
+	for _, reqID := range evidence.RequirementIDs {
+		counted[reqID] = true
+	}
+	return counted
+}
+
+// evidenceCountDeltas returns the per-requirement evidence_count change caused
+// by replacing before with after. Either may be nil.
+func evidenceCountDeltas(before, after *models.Evidence) map[string]int {
+	deltas := make(map[string]int)
+	oldCounted := countedRequirementIDs(before)
+	newCounted := countedRequirementIDs(after)
+
+	for reqID := range newCounted {
+		if !oldCounted[reqID] {
+			deltas[reqID]++
+		}
+	}
+	for reqID := range oldCounted {
+		if !newCounted[reqID] {
+			deltas[reqID]--
+		}
+	}
+
+	return deltas
+}
@@ -0,0 +1,72 @@
+package store
+
+import (
+	"sort"
+	"time"
+
+	"compliancesync-api/internal/models"
+)
+
+// legacyEvidenceVersion describes the file of finalized evidence uploaded
+// before versioning as its version 1, or returns nil for other evidence. The
+// version takes the evidence ID as its own.
+func legacyEvidenceVersion(evidence *models.Evidence) *models.EvidenceVersion {
+	if evidence == nil || evidence.FileVersion != 0 || evidence.FileURL == "" {
+		return nil
+	}
+	if evidence.Status != "active" && evidence.Status != "quarantined" {
+		return nil
+	}
+
+	currentFrom := evidence.CreatedAt
+	return &models.EvidenceVersion{
+		ID:             evidence.ID,
+		OrganizationID: evidence.OrganizationID,
+		EvidenceID:     evidence.ID,
+		Number:         1,
+		FileURL:        evidence.FileURL,
+		FileName:       evidence.FileName,
+		FileSize:       evidence.FileSize,
+		FileType:       evidence.FileType,
+		ContentHash:    evidence.ContentHash,
+		Status:         "active",
+		UploadedBy:     evidence.UploadedBy,
+		CreatedAt:      evidence.CreatedAt,
+		CurrentFrom:    &currentFrom,
+	}
+}
+
+// publishEvidenceVersion numbers version as the successor of the current
+// file of before, the stored evidence, and makes it evidence's current file.
+// It returns the versions to write: version, preceded by the legacy version
+// 1 when before was finalized without one.
+func publishEvidenceVersion(before, evidence *models.Evidence, version *models.EvidenceVersion) []*models.EvidenceVersion {
+	var writes []*models.EvidenceVersion
+	number := 1
+	if before != nil {
+		number = before.FileVersion + 1
+	}
+	if legacy := legacyEvidenceVersion(before); legacy != nil {
+		writes = append(writes, legacy)
+		number = 2
+	}
+
+	now := time.Now()
+	version.Number = number
+	version.Status = "active"
+	version.CurrentFrom = &now
+
+	evidence.FileVersion = number
+	evidence.FileURL = version.FileURL
+	evidence.FileName = version.FileName
+	evidence.FileSize = version.FileSize
+	evidence.FileType = version.FileType
+	evidence.ContentHash = version.ContentHash
+
+	return append(writes, version)
+}
+
+// sortEvidenceVersions orders versions by number
+func sortEvidenceVersions(versions []*models.EvidenceVersion) {
+	sort.Slice(versions, func(i, j int) bool { return versions[i].Number < versions[j].Number })
+}
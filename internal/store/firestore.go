@@ -2,6 +2,8 @@ package store
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"time"
 
@@ -9,6 +11,8 @@ import (
 	"compliancesync-api/internal/models"
 	"github.com/google/uuid"
 	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 // FirestoreStore implements the Store interface using Firestore
@@ -39,6 +43,7 @@ func (s *FirestoreStore) CreateOrganization(ctx context.Context, org *models.Org
 	org.CreatedAt = time.Now()
 	org.UpdatedAt = time.Now()
 	org.ActiveUserCount = 1 // Creator is the first user
+	org.Version = 1
 
 	_, err := s.client.Collection("organizations").Doc(org.ID).Set(ctx, org)
 	if err != nil {
@@ -63,113 +68,1326 @@ func (s *FirestoreStore) GetOrganization(ctx context.Context, orgID string) (*mo
 	return &org, nil
 }
 
-// UpdateOrganization updates an organization
+// UpdateOrganization updates an organization, failing with ErrVersionConflict
+// if it changed since org was read
 func (s *FirestoreStore) UpdateOrganization(ctx context.Context, org *models.Organization) error {
 	org.UpdatedAt = time.Now()
 
-	_, err := s.client.Collection("organizations").Doc(org.ID).Set(ctx, org)
+	err := s.setVersioned(ctx, s.client.Collection("organizations").Doc(org.ID), org, &org.Version)
 	if err != nil {
 		return fmt.Errorf("failed to update organization: %w", err)
 	}
 
-	return nil
+	return nil
+}
+
+// CreateClientOrganization creates an organization managed by a partner,
+// with no users
+func (s *FirestoreStore) CreateClientOrganization(ctx context.Context, partnerID string, org *models.Organization) error {
+	org.ID = uuid.New().String()
+	org.PartnerID = partnerID
+	org.CreatedAt = time.Now()
+	org.UpdatedAt = time.Now()
+	org.ActiveUserCount = 0
+	org.Version = 1
+
+	_, err := s.client.Collection("organizations").Doc(org.ID).Set(ctx, org)
+	if err != nil {
+		return fmt.Errorf("failed to create client organization: %w", err)
+	}
+
+	return nil
+}
+
+// ListClientOrganizations lists a partner's client organizations by name
+func (s *FirestoreStore) ListClientOrganizations(ctx context.Context, partnerID string) ([]*models.Organization, error) {
+	iter := s.client.Collection("organizations").
+		Where("partner_id", "==", partnerID).
+		OrderBy("name", firestore.Asc).
+		Documents(ctx)
+
+	var orgs []*models.Organization
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to iterate client organizations: %w", err)
+		}
+
+		var org models.Organization
+		if err := doc.DataTo(&org); err != nil {
+			return nil, fmt.Errorf("failed to parse organization: %w", err)
+		}
+		orgs = append(orgs, &org)
+	}
+
+	return orgs, nil
+}
+
+// User methods
+
+// CreateUser creates a new user
+func (s *FirestoreStore) CreateUser(ctx context.Context, user *models.User) error {
+	user.CreatedAt = time.Now()
+	user.UpdatedAt = time.Now()
+	user.Status = "active"
+
+	_, err := s.client.Collection("users").Doc(user.UID).Set(ctx, user)
+	if err != nil {
+		return fmt.Errorf("failed to create user: %w", err)
+	}
+
+	return nil
+}
+
+// GetUser retrieves a user by UID
+func (s *FirestoreStore) GetUser(ctx context.Context, uid string) (*models.User, error) {
+	doc, err := s.client.Collection("users").Doc(uid).Get(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	var user models.User
+	if err := doc.DataTo(&user); err != nil {
+		return nil, fmt.Errorf("failed to parse user: %w", err)
+	}
+
+	return &user, nil
+}
+
+// GetUserByEmail retrieves a user by email
+func (s *FirestoreStore) GetUserByEmail(ctx context.Context, email string) (*models.User, error) {
+	iter := s.client.Collection("users").Where("email", "==", email).Limit(1).Documents(ctx)
+	doc, err := iter.Next()
+	if err == iterator.Done {
+		return nil, fmt.Errorf("user not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query user: %w", err)
+	}
+
+	var user models.User
+	if err := doc.DataTo(&user); err != nil {
+		return nil, fmt.Errorf("failed to parse user: %w", err)
+	}
+
+	return &user, nil
+}
+
+// UpdateUser updates a user
+func (s *FirestoreStore) UpdateUser(ctx context.Context, user *models.User) error {
+	user.UpdatedAt = time.Now()
+
+	_, err := s.client.Collection("users").Doc(user.UID).Set(ctx, user)
+	if err != nil {
+		return fmt.Errorf("failed to update user: %w", err)
+	}
+
+	return nil
+}
+
+// ListUsersByOrganization lists users in an organization, one page at a time
+func (s *FirestoreStore) ListUsersByOrganization(ctx context.Context, orgID string, opts ListOptions) ([]*models.User, string, error) {
+	q, err := userSort.resolve(opts)
+	if err != nil {
+		return nil, "", err
+	}
+
+	query := s.client.Collection("users").Where("organization_id", "==", orgID)
+	iter := applyPage(query, q).Documents(ctx)
+
+	var users []*models.User
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to iterate users: %w", err)
+		}
+
+		var user models.User
+		if err := doc.DataTo(&user); err != nil {
+			return nil, "", fmt.Errorf("failed to parse user: %w", err)
+		}
+		users = append(users, &user)
+	}
+
+	users, next := trimPage(q, users, func(u *models.User) string { return u.UID })
+	return users, next, nil
+}
+
+// UpdateLastLogin updates the last login timestamp for a user
+func (s *FirestoreStore) UpdateLastLogin(ctx context.Context, uid string) error {
+	now := time.Now()
+	_, err := s.client.Collection("users").Doc(uid).Update(ctx, []firestore.Update{
+		{Path: "last_login_at", Value: now},
+		{Path: "updated_at", Value: now},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update last login: %w", err)
+	}
+
+	return nil
+}
+
+// ProvisionUser creates a user without an invitation and adds them to the
+// organization's active user count in one transaction
+func (s *FirestoreStore) ProvisionUser(ctx context.Context, user *models.User) error {
+	userRef := s.client.Collection("users").Doc(user.UID)
+	orgRef := s.client.Collection("organizations").Doc(user.OrganizationID)
+
+	err := s.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		now := time.Now()
+
+		org, invitations, err := s.seatUsageTx(tx, user.OrganizationID)
+		if err != nil {
+			return err
+		}
+		if err := checkProvisionSeat(org, invitations, user.Email, now); err != nil {
+			return err
+		}
+
+		user.CreatedAt = now
+		user.UpdatedAt = now
+		user.Status = "active"
+
+		if err := tx.Create(userRef, user); err != nil {
+			return err
+		}
+		return tx.Update(orgRef, []firestore.Update{
+			{Path: "active_user_count", Value: firestore.Increment(1)},
+			{Path: "updated_at", Value: now},
+			{Path: "version", Value: org.Version + 1},
+		})
+	})
+	if err != nil {
+		return fmt.Errorf("failed to provision user: %w", err)
+	}
+
+	return nil
+}
+
+// SetUserStatus saves a user with a new status, taking or releasing a seat
+// in the same transaction
+func (s *FirestoreStore) SetUserStatus(ctx context.Context, user *models.User, status string) error {
+	userRef := s.client.Collection("users").Doc(user.UID)
+	orgRef := s.client.Collection("organizations").Doc(user.OrganizationID)
+
+	err := s.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		now := time.Now()
+
+		snap, err := tx.Get(userRef)
+		if err != nil {
+			return err
+		}
+		var stored models.User
+		if err := snap.DataTo(&stored); err != nil {
+			return err
+		}
+
+		org, invitations, err := s.seatUsageTx(tx, user.OrganizationID)
+		if err != nil {
+			return err
+		}
+		delta := activeUserDelta(stored.Status, status)
+		if delta > 0 {
+			if err := checkProvisionSeat(org, invitations, user.Email, now); err != nil {
+				return err
+			}
+		}
+
+		user.Status = status
+		user.UpdatedAt = now
+
+		if err := tx.Set(userRef, user); err != nil {
+			return err
+		}
+		if delta == 0 {
+			return nil
+		}
+		return tx.Update(orgRef, []firestore.Update{
+			{Path: "active_user_count", Value: firestore.Increment(delta)},
+			{Path: "updated_at", Value: now},
+			{Path: "version", Value: org.Version + 1},
+		})
+	})
+	if err != nil {
+		return fmt.Errorf("failed to set user status: %w", err)
+	}
+
+	return nil
+}
+
+// Invitation methods
+
+// CreateInvitation stores a new pending invitation, failing with
+// ErrSeatLimitReached when the organization has no free seat or
+// ErrInvitationExists when the email already has a pending invitation
+func (s *FirestoreStore) CreateInvitation(ctx context.Context, inv *models.Invitation) error {
+	inv.ID = uuid.New().String()
+	inv.CreatedAt = time.Now()
+	inv.SentAt = inv.CreatedAt
+	inv.Status = "pending"
+
+	err := s.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		if err := s.checkInvitationSeatTx(tx, inv); err != nil {
+			return err
+		}
+		return tx.Create(s.client.Collection("invitations").Doc(inv.ID), inv)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create invitation: %w", err)
+	}
+
+	return nil
+}
+
+// GetInvitation retrieves an invitation by ID
+func (s *FirestoreStore) GetInvitation(ctx context.Context, orgID, invitationID string) (*models.Invitation, error) {
+	doc, err := s.client.Collection("invitations").Doc(invitationID).Get(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get invitation: %w", err)
+	}
+
+	var inv models.Invitation
+	if err := doc.DataTo(&inv); err != nil {
+		return nil, fmt.Errorf("failed to parse invitation: %w", err)
+	}
+	if inv.OrganizationID != orgID {
+		return nil, fmt.Errorf("failed to get invitation: %s not found", invitationID)
+	}
+
+	return &inv, nil
+}
+
+// GetInvitationByToken retrieves an invitation by the hash of its token
+func (s *FirestoreStore) GetInvitationByToken(ctx context.Context, tokenHash string) (*models.Invitation, error) {
+	iter := s.client.Collection("invitations").Where("token", "==", tokenHash).Limit(1).Documents(ctx)
+	doc, err := iter.Next()
+	if err == iterator.Done {
+		return nil, fmt.Errorf("invitation not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query invitation: %w", err)
+	}
+
+	var inv models.Invitation
+	if err := doc.DataTo(&inv); err != nil {
+		return nil, fmt.Errorf("failed to parse invitation: %w", err)
+	}
+
+	return &inv, nil
+}
+
+// ListInvitations lists an organization's invitations, one page at a time
+func (s *FirestoreStore) ListInvitations(ctx context.Context, orgID string, opts ListOptions) ([]*models.Invitation, string, error) {
+	q, err := invitationSort.resolve(opts)
+	if err != nil {
+		return nil, "", err
+	}
+
+	query := s.client.Collection("invitations").Where("organization_id", "==", orgID)
+	iter := applyPage(query, q).Documents(ctx)
+
+	var invitations []*models.Invitation
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to iterate invitations: %w", err)
+		}
+
+		var inv models.Invitation
+		if err := doc.DataTo(&inv); err != nil {
+			return nil, "", fmt.Errorf("failed to parse invitation: %w", err)
+		}
+		invitations = append(invitations, &inv)
+	}
+
+	invitations, next := trimPage(q, invitations, func(i *models.Invitation) string { return i.ID })
+	return invitations, next, nil
+}
+
+// RenewInvitation saves a new token and expiry for a pending (possibly
+// expired) invitation. The seat check is repeated because an expired
+// invitation no longer holds a seat.
+func (s *FirestoreStore) RenewInvitation(ctx context.Context, inv *models.Invitation) error {
+	ref := s.client.Collection("invitations").Doc(inv.ID)
+	inv.SentAt = time.Now()
+	inv.Status = "pending"
+
+	err := s.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		if _, err := s.getPendingInvitationTx(tx, ref); err != nil {
+			return err
+		}
+		if err := s.checkInvitationSeatTx(tx, inv); err != nil {
+			return err
+		}
+		return tx.Set(ref, inv)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to renew invitation: %w", err)
+	}
+
+	return nil
+}
+
+// UpdateInvitation saves a status change to a pending invitation, failing
+// with ErrInvitationNotPending if it was accepted or revoked in the meantime
+func (s *FirestoreStore) UpdateInvitation(ctx context.Context, inv *models.Invitation) error {
+	ref := s.client.Collection("invitations").Doc(inv.ID)
+
+	err := s.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		if _, err := s.getPendingInvitationTx(tx, ref); err != nil {
+			return err
+		}
+		return tx.Set(ref, inv)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update invitation: %w", err)
+	}
+
+	return nil
+}
+
+// AcceptInvitation marks a pending invitation accepted, creates the invited
+// user and adds them to the organization's active user count in one
+// transaction
+func (s *FirestoreStore) AcceptInvitation(ctx context.Context, inv *models.Invitation, user *models.User) error {
+	ref := s.client.Collection("invitations").Doc(inv.ID)
+	userRef := s.client.Collection("users").Doc(user.UID)
+
+	err := s.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		now := time.Now()
+
+		stored, err := s.getPendingInvitationTx(tx, ref)
+		if err != nil {
+			return err
+		}
+		if stored.IsExpired(now) {
+			return ErrInvitationNotPending
+		}
+
+		orgRef := s.client.Collection("organizations").Doc(stored.OrganizationID)
+		snap, err := tx.Get(orgRef)
+		if err != nil {
+			return err
+		}
+		var org models.Organization
+		if err := snap.DataTo(&org); err != nil {
+			return err
+		}
+
+		user.CreatedAt = now
+		user.UpdatedAt = now
+		user.Status = "active"
+
+		*inv = *stored
+		inv.Status = "accepted"
+		inv.AcceptedAt = &now
+		inv.AcceptedBy = user.UID
+
+		if err := tx.Create(userRef, user); err != nil {
+			return err
+		}
+		if err := tx.Set(ref, inv); err != nil {
+			return err
+		}
+		return tx.Update(orgRef, []firestore.Update{
+			{Path: "active_user_count", Value: firestore.Increment(1)},
+			{Path: "updated_at", Value: now},
+			{Path: "version", Value: org.Version + 1},
+		})
+	})
+	if err != nil {
+		return fmt.Errorf("failed to accept invitation: %w", err)
+	}
+
+	return nil
+}
+
+// getPendingInvitationTx reads an invitation inside a transaction, failing
+// with ErrInvitationNotPending unless its status is pending
+func (s *FirestoreStore) getPendingInvitationTx(tx *firestore.Transaction, ref *firestore.DocumentRef) (*models.Invitation, error) {
+	snap, err := tx.Get(ref)
+	if err != nil {
+		return nil, err
+	}
+
+	var inv models.Invitation
+	if err := snap.DataTo(&inv); err != nil {
+		return nil, err
+	}
+	if inv.Status != "pending" {
+		return nil, ErrInvitationNotPending
+	}
+
+	return &inv, nil
+}
+
+// checkInvitationSeatTx runs checkInvitationSeat inside a transaction. Reading
+// the organization and its pending invitations makes a concurrent invite or
+// acceptance abort and retry the transaction.
+func (s *FirestoreStore) checkInvitationSeatTx(tx *firestore.Transaction, inv *models.Invitation) error {
+	org, invitations, err := s.seatUsageTx(tx, inv.OrganizationID)
+	if err != nil {
+		return err
+	}
+	return checkInvitationSeat(org, invitations, inv, time.Now())
+}
+
+// seatUsageTx reads an organization and its pending invitations for seat
+// accounting inside a transaction
+func (s *FirestoreStore) seatUsageTx(tx *firestore.Transaction, orgID string) (*models.Organization, []*models.Invitation, error) {
+	snap, err := tx.Get(s.client.Collection("organizations").Doc(orgID))
+	if err != nil {
+		return nil, nil, err
+	}
+	var org models.Organization
+	if err := snap.DataTo(&org); err != nil {
+		return nil, nil, err
+	}
+
+	query := s.client.Collection("invitations").
+		Where("organization_id", "==", orgID).
+		Where("status", "==", "pending")
+	docs, err := tx.Documents(query).GetAll()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	invitations := make([]*models.Invitation, 0, len(docs))
+	for _, doc := range docs {
+		var inv models.Invitation
+		if err := doc.DataTo(&inv); err != nil {
+			return nil, nil, err
+		}
+		invitations = append(invitations, &inv)
+	}
+
+	return &org, invitations, nil
+}
+
+// Membership methods
+
+// JoinOrganization accepts an invitation for an existing user, creating their
+// membership in the invitation's organization
+func (s *FirestoreStore) JoinOrganization(ctx context.Context, inv *models.Invitation, membership *models.Membership) error {
+	ref := s.client.Collection("invitations").Doc(inv.ID)
+
+	err := s.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		now := time.Now()
+
+		stored, err := s.getPendingInvitationTx(tx, ref)
+		if err != nil {
+			return err
+		}
+		if stored.IsExpired(now) {
+			return ErrInvitationNotPending
+		}
+
+		orgRef := s.client.Collection("organizations").Doc(stored.OrganizationID)
+		snap, err := tx.Get(orgRef)
+		if err != nil {
+			return err
+		}
+		var org models.Organization
+		if err := snap.DataTo(&org); err != nil {
+			return err
+		}
+
+		membershipRef := s.client.Collection("memberships").Doc(models.MembershipID(stored.OrganizationID, membership.UserID))
+		if _, err := tx.Get(membershipRef); err == nil {
+			return ErrAlreadyMember
+		} else if status.Code(err) != codes.NotFound {
+			return err
+		}
+
+		membership.ID = membershipRef.ID
+		membership.OrganizationID = stored.OrganizationID
+		membership.Role = stored.Role
+		membership.InvitationID = stored.ID
+		membership.CreatedAt = now
+		membership.UpdatedAt = now
+
+		*inv = *stored
+		inv.Status = "accepted"
+		inv.AcceptedAt = &now
+		inv.AcceptedBy = membership.UserID
+
+		if err := tx.Create(membershipRef, membership); err != nil {
+			return err
+		}
+		if err := tx.Set(ref, inv); err != nil {
+			return err
+		}
+		return tx.Update(orgRef, []firestore.Update{
+			{Path: "active_user_count", Value: firestore.Increment(1)},
+			{Path: "updated_at", Value: now},
+			{Path: "version", Value: org.Version + 1},
+		})
+	})
+	if err != nil {
+		return fmt.Errorf("failed to join organization: %w", err)
+	}
+
+	return nil
+}
+
+// GetMembership retrieves a user's membership in an organization
+func (s *FirestoreStore) GetMembership(ctx context.Context, orgID, userID string) (*models.Membership, error) {
+	doc, err := s.client.Collection("memberships").Doc(models.MembershipID(orgID, userID)).Get(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get membership: %w", err)
+	}
+
+	var membership models.Membership
+	if err := doc.DataTo(&membership); err != nil {
+		return nil, fmt.Errorf("failed to parse membership: %w", err)
+	}
+
+	return &membership, nil
+}
+
+// ListMemberships lists the memberships in an organization, one page at a time
+func (s *FirestoreStore) ListMemberships(ctx context.Context, orgID string, opts ListOptions) ([]*models.Membership, string, error) {
+	q, err := membershipSort.resolve(opts)
+	if err != nil {
+		return nil, "", err
+	}
+
+	query := s.client.Collection("memberships").Where("organization_id", "==", orgID)
+	iter := applyPage(query, q).Documents(ctx)
+
+	var memberships []*models.Membership
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to iterate memberships: %w", err)
+		}
+
+		var membership models.Membership
+		if err := doc.DataTo(&membership); err != nil {
+			return nil, "", fmt.Errorf("failed to parse membership: %w", err)
+		}
+		memberships = append(memberships, &membership)
+	}
+
+	memberships, next := trimPage(q, memberships, func(m *models.Membership) string { return m.ID })
+	return memberships, next, nil
+}
+
+// ListUserMemberships lists a user's memberships in all organizations
+func (s *FirestoreStore) ListUserMemberships(ctx context.Context, userID string) ([]*models.Membership, error) {
+	iter := s.client.Collection("memberships").
+		Where("user_id", "==", userID).
+		OrderBy("created_at", firestore.Asc).
+		Documents(ctx)
+
+	var memberships []*models.Membership
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to iterate memberships: %w", err)
+		}
+
+		var membership models.Membership
+		if err := doc.DataTo(&membership); err != nil {
+			return nil, fmt.Errorf("failed to parse membership: %w", err)
+		}
+		memberships = append(memberships, &membership)
+	}
+
+	return memberships, nil
+}
+
+// UpdateMembership saves changes to a membership
+func (s *FirestoreStore) UpdateMembership(ctx context.Context, membership *models.Membership) error {
+	membership.UpdatedAt = time.Now()
+
+	_, err := s.client.Collection("memberships").Doc(membership.ID).Set(ctx, membership)
+	if err != nil {
+		return fmt.Errorf("failed to update membership: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteMembership removes a user's membership in an organization and frees
+// its seat
+func (s *FirestoreStore) DeleteMembership(ctx context.Context, orgID, userID string) error {
+	ref := s.client.Collection("memberships").Doc(models.MembershipID(orgID, userID))
+	orgRef := s.client.Collection("organizations").Doc(orgID)
+
+	err := s.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		if _, err := tx.Get(ref); err != nil {
+			return err
+		}
+		snap, err := tx.Get(orgRef)
+		if err != nil {
+			return err
+		}
+		var org models.Organization
+		if err := snap.DataTo(&org); err != nil {
+			return err
+		}
+
+		if err := tx.Delete(ref); err != nil {
+			return err
+		}
+		return tx.Update(orgRef, []firestore.Update{
+			{Path: "active_user_count", Value: firestore.Increment(-1)},
+			{Path: "updated_at", Value: time.Now()},
+			{Path: "version", Value: org.Version + 1},
+		})
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete membership: %w", err)
+	}
+
+	return nil
+}
+
+// Custom role methods
+
+// CreateRole creates a new custom role
+func (s *FirestoreStore) CreateRole(ctx context.Context, role *models.Role) error {
+	role.ID = uuid.New().String()
+	role.CreatedAt = time.Now()
+	role.UpdatedAt = role.CreatedAt
+	role.Version = 1
+
+	_, err := s.roleRef(role.OrganizationID, role.ID).Set(ctx, role)
+	if err != nil {
+		return fmt.Errorf("failed to create role: %w", err)
+	}
+
+	return nil
+}
+
+// GetRole retrieves a custom role by ID
+func (s *FirestoreStore) GetRole(ctx context.Context, orgID, roleID string) (*models.Role, error) {
+	doc, err := s.roleRef(orgID, roleID).Get(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get role: %w", err)
+	}
+
+	var role models.Role
+	if err := doc.DataTo(&role); err != nil {
+		return nil, fmt.Errorf("failed to parse role: %w", err)
+	}
+
+	return &role, nil
+}
+
+// ListRoles lists an organization's custom roles, one page at a time
+func (s *FirestoreStore) ListRoles(ctx context.Context, orgID string, opts ListOptions) ([]*models.Role, string, error) {
+	q, err := roleSort.resolve(opts)
+	if err != nil {
+		return nil, "", err
+	}
+
+	query := s.client.Collection("organizations").Doc(orgID).Collection("roles").Query
+	iter := applyPage(query, q).Documents(ctx)
+
+	var roles []*models.Role
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to iterate roles: %w", err)
+		}
+
+		var role models.Role
+		if err := doc.DataTo(&role); err != nil {
+			return nil, "", fmt.Errorf("failed to parse role: %w", err)
+		}
+		roles = append(roles, &role)
+	}
+
+	roles, next := trimPage(q, roles, func(r *models.Role) string { return r.ID })
+	return roles, next, nil
+}
+
+// UpdateRole updates a custom role
+func (s *FirestoreStore) UpdateRole(ctx context.Context, role *models.Role) error {
+	role.UpdatedAt = time.Now()
+
+	err := s.setVersioned(ctx, s.roleRef(role.OrganizationID, role.ID), role, &role.Version)
+	if err != nil {
+		return fmt.Errorf("failed to update role: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteRole deletes a custom role, failing with ErrRoleInUse while any user
+// or pending invitation is assigned to it
+func (s *FirestoreStore) DeleteRole(ctx context.Context, orgID, roleID string, version int64) error {
+	err := s.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		ref := s.roleRef(orgID, roleID)
+		snap, err := tx.Get(ref)
+		if err != nil {
+			return err
+		}
+		var role models.Role
+		if err := snap.DataTo(&role); err != nil {
+			return err
+		}
+		if err := checkVersion(role.Version, version); err != nil {
+			return err
+		}
+
+		assigned := string(role.UserRole())
+		users, err := tx.Documents(s.client.Collection("users").
+			Where("organization_id", "==", orgID).Where("role", "==", assigned).Limit(1)).GetAll()
+		if err != nil {
+			return err
+		}
+		invitations, err := tx.Documents(s.client.Collection("invitations").
+			Where("organization_id", "==", orgID).Where("role", "==", assigned).
+			Where("status", "==", "pending").Limit(1)).GetAll()
+		if err != nil {
+			return err
+		}
+		memberships, err := tx.Documents(s.client.Collection("memberships").
+			Where("organization_id", "==", orgID).Where("role", "==", assigned).Limit(1)).GetAll()
+		if err != nil {
+			return err
+		}
+		if len(users) > 0 || len(invitations) > 0 || len(memberships) > 0 {
+			return ErrRoleInUse
+		}
+
+		return tx.Delete(ref)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete role: %w", err)
+	}
+
+	return nil
+}
+
+func (s *FirestoreStore) roleRef(orgID, roleID string) *firestore.DocumentRef {
+	return s.client.Collection("organizations").Doc(orgID).Collection("roles").Doc(roleID)
+}
+
+// API key methods
+
+// CreateAPIKey stores a new API key
+func (s *FirestoreStore) CreateAPIKey(ctx context.Context, key *models.APIKey) error {
+	key.ID = uuid.New().String()
+	key.CreatedAt = time.Now()
+
+	_, err := s.client.Collection("api_keys").Doc(key.ID).Set(ctx, key)
+	if err != nil {
+		return fmt.Errorf("failed to create API key: %w", err)
+	}
+
+	return nil
+}
+
+// GetAPIKey retrieves an API key by ID
+func (s *FirestoreStore) GetAPIKey(ctx context.Context, orgID, keyID string) (*models.APIKey, error) {
+	doc, err := s.client.Collection("api_keys").Doc(keyID).Get(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get API key: %w", err)
+	}
+
+	var key models.APIKey
+	if err := doc.DataTo(&key); err != nil {
+		return nil, fmt.Errorf("failed to parse API key: %w", err)
+	}
+	if key.OrganizationID != orgID {
+		return nil, fmt.Errorf("failed to get API key: %s not found", keyID)
+	}
+
+	return &key, nil
+}
+
+// GetAPIKeyByHash retrieves an API key by the hash of the key
+func (s *FirestoreStore) GetAPIKeyByHash(ctx context.Context, keyHash string) (*models.APIKey, error) {
+	iter := s.client.Collection("api_keys").Where("key_hash", "==", keyHash).Limit(1).Documents(ctx)
+	doc, err := iter.Next()
+	if err == iterator.Done {
+		return nil, fmt.Errorf("API key not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query API key: %w", err)
+	}
+
+	var key models.APIKey
+	if err := doc.DataTo(&key); err != nil {
+		return nil, fmt.Errorf("failed to parse API key: %w", err)
+	}
+
+	return &key, nil
+}
+
+// ListAPIKeys lists an organization's API keys, one page at a time
+func (s *FirestoreStore) ListAPIKeys(ctx context.Context, orgID string, opts ListOptions) ([]*models.APIKey, string, error) {
+	q, err := apiKeySort.resolve(opts)
+	if err != nil {
+		return nil, "", err
+	}
+
+	query := s.client.Collection("api_keys").Where("organization_id", "==", orgID)
+	iter := applyPage(query, q).Documents(ctx)
+
+	var keys []*models.APIKey
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to iterate API keys: %w", err)
+		}
+
+		var key models.APIKey
+		if err := doc.DataTo(&key); err != nil {
+			return nil, "", fmt.Errorf("failed to parse API key: %w", err)
+		}
+		keys = append(keys, &key)
+	}
+
+	keys, next := trimPage(q, keys, func(k *models.APIKey) string { return k.ID })
+	return keys, next, nil
+}
+
+// UpdateAPIKey saves changes to an API key
+func (s *FirestoreStore) UpdateAPIKey(ctx context.Context, key *models.APIKey) error {
+	_, err := s.client.Collection("api_keys").Doc(key.ID).Set(ctx, key)
+	if err != nil {
+		return fmt.Errorf("failed to update API key: %w", err)
+	}
+
+	return nil
+}
+
+// TouchAPIKey records when an API key was last used
+func (s *FirestoreStore) TouchAPIKey(ctx context.Context, keyID string, usedAt time.Time) error {
+	_, err := s.client.Collection("api_keys").Doc(keyID).Update(ctx, []firestore.Update{
+		{Path: "last_used_at", Value: usedAt},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update API key: %w", err)
+	}
+
+	return nil
+}
+
+// Auditor grant methods
+
+// CreateAuditorGrant stores a new auditor grant
+func (s *FirestoreStore) CreateAuditorGrant(ctx context.Context, grant *models.AuditorGrant) error {
+	grant.ID = uuid.New().String()
+	grant.CreatedAt = time.Now()
+
+	_, err := s.client.Collection("auditor_grants").Doc(grant.ID).Set(ctx, grant)
+	if err != nil {
+		return fmt.Errorf("failed to create auditor grant: %w", err)
+	}
+
+	return nil
+}
+
+// GetAuditorGrant retrieves an auditor grant by ID
+func (s *FirestoreStore) GetAuditorGrant(ctx context.Context, orgID, grantID string) (*models.AuditorGrant, error) {
+	doc, err := s.client.Collection("auditor_grants").Doc(grantID).Get(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get auditor grant: %w", err)
+	}
+
+	var grant models.AuditorGrant
+	if err := doc.DataTo(&grant); err != nil {
+		return nil, fmt.Errorf("failed to parse auditor grant: %w", err)
+	}
+	if grant.OrganizationID != orgID {
+		return nil, fmt.Errorf("failed to get auditor grant: %s not found", grantID)
+	}
+
+	return &grant, nil
+}
+
+// GetAuditorGrantByHash retrieves an auditor grant by the hash of its token
+func (s *FirestoreStore) GetAuditorGrantByHash(ctx context.Context, tokenHash string) (*models.AuditorGrant, error) {
+	iter := s.client.Collection("auditor_grants").Where("token_hash", "==", tokenHash).Limit(1).Documents(ctx)
+	doc, err := iter.Next()
+	if err == iterator.Done {
+		return nil, fmt.Errorf("auditor grant not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query auditor grant: %w", err)
+	}
+
+	var grant models.AuditorGrant
+	if err := doc.DataTo(&grant); err != nil {
+		return nil, fmt.Errorf("failed to parse auditor grant: %w", err)
+	}
+
+	return &grant, nil
+}
+
+// ListAuditorGrants lists an organization's auditor grants, one page at a time
+func (s *FirestoreStore) ListAuditorGrants(ctx context.Context, orgID string, opts ListOptions) ([]*models.AuditorGrant, string, error) {
+	q, err := auditorGrantSort.resolve(opts)
+	if err != nil {
+		return nil, "", err
+	}
+
+	query := s.client.Collection("auditor_grants").Where("organization_id", "==", orgID)
+	iter := applyPage(query, q).Documents(ctx)
+
+	var grants []*models.AuditorGrant
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to iterate auditor grants: %w", err)
+		}
+
+		var grant models.AuditorGrant
+		if err := doc.DataTo(&grant); err != nil {
+			return nil, "", fmt.Errorf("failed to parse auditor grant: %w", err)
+		}
+		grants = append(grants, &grant)
+	}
+
+	grants, next := trimPage(q, grants, func(g *models.AuditorGrant) string { return g.ID })
+	return grants, next, nil
+}
+
+// UpdateAuditorGrant saves changes to an auditor grant
+func (s *FirestoreStore) UpdateAuditorGrant(ctx context.Context, grant *models.AuditorGrant) error {
+	_, err := s.client.Collection("auditor_grants").Doc(grant.ID).Set(ctx, grant)
+	if err != nil {
+		return fmt.Errorf("failed to update auditor grant: %w", err)
+	}
+
+	return nil
+}
+
+// TouchAuditorGrant records when an auditor grant was last used
+func (s *FirestoreStore) TouchAuditorGrant(ctx context.Context, grantID string, accessedAt time.Time) error {
+	_, err := s.client.Collection("auditor_grants").Doc(grantID).Update(ctx, []firestore.Update{
+		{Path: "last_accessed_at", Value: accessedAt},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update auditor grant: %w", err)
+	}
+
+	return nil
+}
+
+// Single sign-on methods
+
+// GetSSOConfig retrieves an organization's single sign-on configuration, or
+// nil if it has none
+func (s *FirestoreStore) GetSSOConfig(ctx context.Context, orgID string) (*models.SSOConfig, error) {
+	doc, err := s.client.Collection("sso_configs").Doc(orgID).Get(ctx)
+	if status.Code(err) == codes.NotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get SSO config: %w", err)
+	}
+
+	var config models.SSOConfig
+	if err := doc.DataTo(&config); err != nil {
+		return nil, fmt.Errorf("failed to parse SSO config: %w", err)
+	}
+
+	return &config, nil
+}
+
+// SaveSSOConfig creates or replaces an organization's single sign-on
+// configuration, failing with ErrVersionConflict if it changed since config
+// was read. A new configuration has version 0.
+func (s *FirestoreStore) SaveSSOConfig(ctx context.Context, config *models.SSOConfig) error {
+	config.UpdatedAt = time.Now()
+
+	err := s.setVersioned(ctx, s.client.Collection("sso_configs").Doc(config.OrganizationID), config, &config.Version)
+	if err != nil {
+		return fmt.Errorf("failed to save SSO config: %w", err)
+	}
+
+	return nil
+}
+
+// CreateDomain stores a new pending domain claim, failing with
+// ErrDomainClaimed if the organization already claimed the name or another
+// organization verified it
+func (s *FirestoreStore) CreateDomain(ctx context.Context, domain *models.Domain) error {
+	domain.ID = uuid.New().String()
+	domain.CreatedAt = time.Now()
+	domain.Status = "pending"
+
+	err := s.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		if err := s.checkDomainClaimTx(tx, domain); err != nil {
+			return err
+		}
+		return tx.Create(s.client.Collection("domains").Doc(domain.ID), domain)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create domain: %w", err)
+	}
+
+	return nil
+}
+
+// GetDomain retrieves a domain claim by ID
+func (s *FirestoreStore) GetDomain(ctx context.Context, orgID, domainID string) (*models.Domain, error) {
+	doc, err := s.client.Collection("domains").Doc(domainID).Get(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get domain: %w", err)
+	}
+
+	var domain models.Domain
+	if err := doc.DataTo(&domain); err != nil {
+		return nil, fmt.Errorf("failed to parse domain: %w", err)
+	}
+	if domain.OrganizationID != orgID {
+		return nil, fmt.Errorf("failed to get domain: %s not found", domainID)
+	}
+
+	return &domain, nil
+}
+
+// GetVerifiedDomain retrieves the verified claim on a domain name
+func (s *FirestoreStore) GetVerifiedDomain(ctx context.Context, name string) (*models.Domain, error) {
+	iter := s.client.Collection("domains").
+		Where("name", "==", name).
+		Where("status", "==", "verified").
+		Limit(1).Documents(ctx)
+	doc, err := iter.Next()
+	if err == iterator.Done {
+		return nil, fmt.Errorf("domain not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query domain: %w", err)
+	}
+
+	var domain models.Domain
+	if err := doc.DataTo(&domain); err != nil {
+		return nil, fmt.Errorf("failed to parse domain: %w", err)
+	}
+
+	return &domain, nil
+}
+
+// ListDomains lists an organization's domain claims, one page at a time
+func (s *FirestoreStore) ListDomains(ctx context.Context, orgID string, opts ListOptions) ([]*models.Domain, string, error) {
+	q, err := domainSort.resolve(opts)
+	if err != nil {
+		return nil, "", err
+	}
+
+	query := s.client.Collection("domains").Where("organization_id", "==", orgID)
+	iter := applyPage(query, q).Documents(ctx)
+
+	var domains []*models.Domain
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to iterate domains: %w", err)
+		}
+
+		var domain models.Domain
+		if err := doc.DataTo(&domain); err != nil {
+			return nil, "", fmt.Errorf("failed to parse domain: %w", err)
+		}
+		domains = append(domains, &domain)
+	}
+
+	domains, next := trimPage(q, domains, func(d *models.Domain) string { return d.ID })
+	return domains, next, nil
+}
+
+// VerifyDomain marks a domain claim verified, failing with ErrDomainClaimed
+// if another organization verified the name first
+func (s *FirestoreStore) VerifyDomain(ctx context.Context, domain *models.Domain) error {
+	ref := s.client.Collection("domains").Doc(domain.ID)
+
+	err := s.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		if err := s.checkDomainClaimTx(tx, domain); err != nil {
+			return err
+		}
+
+		now := time.Now()
+		domain.Status = "verified"
+		domain.VerifiedAt = &now
+		return tx.Set(ref, domain)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to verify domain: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteDomain removes a domain claim
+func (s *FirestoreStore) DeleteDomain(ctx context.Context, orgID, domainID string) error {
+	if _, err := s.GetDomain(ctx, orgID, domainID); err != nil {
+		return fmt.Errorf("failed to delete domain: %w", err)
+	}
+
+	_, err := s.client.Collection("domains").Doc(domainID).Delete(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to delete domain: %w", err)
+	}
+
+	return nil
+}
+
+// ClaimSAMLAssertion creates a document for the assertion, keyed by a hash
+// of the issuer and assertion ID since either may contain slashes. A TTL
+// policy on expires_at removes it once it expires.
+func (s *FirestoreStore) ClaimSAMLAssertion(ctx context.Context, issuer, assertionID string, expiresAt time.Time) error {
+	sum := sha256.Sum256([]byte(issuer + "\n" + assertionID))
+	_, err := s.client.Collection("saml_assertions").Doc(hex.EncodeToString(sum[:])).Create(ctx, map[string]interface{}{
+		"issuer":       issuer,
+		"assertion_id": assertionID,
+		"expires_at":   expiresAt,
+	})
+	if status.Code(err) == codes.AlreadyExists {
+		return ErrAssertionReplayed
+	}
+	if err != nil {
+		return fmt.Errorf("failed to claim SAML assertion: %w", err)
+	}
+
+	return nil
+}
+
+// checkDomainClaimTx runs checkDomainClaim inside a transaction against the
+// stored claims on the same name
+func (s *FirestoreStore) checkDomainClaimTx(tx *firestore.Transaction, domain *models.Domain) error {
+	docs, err := tx.Documents(s.client.Collection("domains").Where("name", "==", domain.Name)).GetAll()
+	if err != nil {
+		return err
+	}
+
+	existing := make([]*models.Domain, 0, len(docs))
+	for _, doc := range docs {
+		var other models.Domain
+		if err := doc.DataTo(&other); err != nil {
+			return err
+		}
+		existing = append(existing, &other)
+	}
+
+	return checkDomainClaim(domain, existing)
 }
 
-// User methods
+// Session methods
 
-// CreateUser creates a new user
-func (s *FirestoreStore) CreateUser(ctx context.Context, user *models.User) error {
-	user.CreatedAt = time.Now()
-	user.UpdatedAt = time.Now()
-	user.Status = "active"
+// CreateSession stores a new session
+func (s *FirestoreStore) CreateSession(ctx context.Context, session *models.Session) error {
+	session.ID = uuid.New().String()
+	session.CreatedAt = time.Now()
 
-	_, err := s.client.Collection("users").Doc(user.UID).Set(ctx, user)
+	_, err := s.client.Collection("sessions").Doc(session.ID).Set(ctx, session)
 	if err != nil {
-		return fmt.Errorf("failed to create user: %w", err)
+		return fmt.Errorf("failed to create session: %w", err)
 	}
 
 	return nil
 }
 
-// GetUser retrieves a user by UID
-func (s *FirestoreStore) GetUser(ctx context.Context, uid string) (*models.User, error) {
-	doc, err := s.client.Collection("users").Doc(uid).Get(ctx)
+// GetSession retrieves a session in an organization by ID
+func (s *FirestoreStore) GetSession(ctx context.Context, orgID, sessionID string) (*models.Session, error) {
+	doc, err := s.client.Collection("sessions").Doc(sessionID).Get(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get user: %w", err)
+		return nil, fmt.Errorf("failed to get session: %w", err)
 	}
 
-	var user models.User
-	if err := doc.DataTo(&user); err != nil {
-		return nil, fmt.Errorf("failed to parse user: %w", err)
+	var session models.Session
+	if err := doc.DataTo(&session); err != nil {
+		return nil, fmt.Errorf("failed to parse session: %w", err)
+	}
+	if session.OrganizationID != orgID {
+		return nil, fmt.Errorf("failed to get session: %s not found", sessionID)
 	}
 
-	return &user, nil
+	return &session, nil
 }
 
-// GetUserByEmail retrieves a user by email
-func (s *FirestoreStore) GetUserByEmail(ctx context.Context, email string) (*models.User, error) {
-	iter := s.client.Collection("users").Where("email", "==", email).Limit(1).Documents(ctx)
+// GetSessionByHash retrieves a session by the hash of its token
+func (s *FirestoreStore) GetSessionByHash(ctx context.Context, tokenHash string) (*models.Session, error) {
+	iter := s.client.Collection("sessions").Where("token_hash", "==", tokenHash).Limit(1).Documents(ctx)
 	doc, err := iter.Next()
 	if err == iterator.Done {
-		return nil, fmt.Errorf("user not found")
+		return nil, fmt.Errorf("session not found")
 	}
 	if err != nil {
-		return nil, fmt.Errorf("failed to query user: %w", err)
+		return nil, fmt.Errorf("failed to query session: %w", err)
 	}
 
-	var user models.User
-	if err := doc.DataTo(&user); err != nil {
-		return nil, fmt.Errorf("failed to parse user: %w", err)
+	var session models.Session
+	if err := doc.DataTo(&session); err != nil {
+		return nil, fmt.Errorf("failed to parse session: %w", err)
 	}
 
-	return &user, nil
+	return &session, nil
 }
 
-// UpdateUser updates a user
-func (s *FirestoreStore) UpdateUser(ctx context.Context, user *models.User) error {
-	user.UpdatedAt = time.Now()
-
-	_, err := s.client.Collection("users").Doc(user.UID).Set(ctx, user)
+// ListSessions lists a user's sessions in an organization, one page at a time
+func (s *FirestoreStore) ListSessions(ctx context.Context, orgID, userID string, opts ListOptions) ([]*models.Session, string, error) {
+	q, err := sessionSort.resolve(opts)
 	if err != nil {
-		return fmt.Errorf("failed to update user: %w", err)
+		return nil, "", err
 	}
 
-	return nil
-}
-
-// ListUsersByOrganization lists all users in an organization
-func (s *FirestoreStore) ListUsersByOrganization(ctx context.Context, orgID string) ([]*models.User, error) {
-	iter := s.client.Collection("users").Where("organization_id", "==", orgID).Documents(ctx)
+	query := s.client.Collection("sessions").
+		Where("organization_id", "==", orgID).
+		Where("user_id", "==", userID)
+	iter := applyPage(query, q).Documents(ctx)
 
-	var users []*models.User
+	var sessions []*models.Session
 	for {
 		doc, err := iter.Next()
 		if err == iterator.Done {
 			break
 		}
 		if err != nil {
-			return nil, fmt.Errorf("failed to iterate users: %w", err)
+			return nil, "", fmt.Errorf("failed to iterate sessions: %w", err)
 		}
 
-		var user models.User
-		if err := doc.DataTo(&user); err != nil {
-			return nil, fmt.Errorf("failed to parse user: %w", err)
+		var session models.Session
+		if err := doc.DataTo(&session); err != nil {
+			return nil, "", fmt.Errorf("failed to parse session: %w", err)
 		}
-		users = append(users, &user)
+		sessions = append(sessions, &session)
 	}
 
-	return users, nil
+	sessions, next := trimPage(q, sessions, func(s *models.Session) string { return s.ID })
+	return sessions, next, nil
 }
 
-// UpdateLastLogin updates the last login timestamp for a user
-func (s *FirestoreStore) UpdateLastLogin(ctx context.Context, uid string) error {
-	now := time.Now()
-	_, err := s.client.Collection("users").Doc(uid).Update(ctx, []firestore.Update{
-		{Path: "last_login_at", Value: now},
-		{Path: "updated_at", Value: now},
-	})
+// UpdateSession saves changes to a session
+func (s *FirestoreStore) UpdateSession(ctx context.Context, session *models.Session) error {
+	_, err := s.client.Collection("sessions").Doc(session.ID).Set(ctx, session)
 	if err != nil {
-		return fmt.Errorf("failed to update last login: %w", err)
+		return fmt.Errorf("failed to update session: %w", err)
 	}
 
 	return nil
@@ -185,6 +1403,7 @@ func (s *FirestoreStore) CreateRequirement(ctx context.Context, req *models.Requ
 	req.Status = models.StatusNotStarted
 	req.EvidenceCount = 0
 	req.IsActive = true
+	req.Version = 1
 
 	_, err := s.client.Collection("organizations").Doc(req.OrganizationID).
 		Collection("requirements").Doc(req.ID).Set(ctx, req)
@@ -211,10 +1430,16 @@ func (s *FirestoreStore) GetRequirement(ctx context.Context, orgID, reqID string
 	return &req, nil
 }
 
-// ListRequirements lists all active requirements for an organization
-func (s *FirestoreStore) ListRequirements(ctx context.Context, orgID string) ([]*models.Requirement, error) {
-	iter := s.client.Collection("organizations").Doc(orgID).
-		Collection("requirements").Where("is_active", "==", true).Documents(ctx)
+// ListRequirements lists active requirements for an organization, one page at a time
+func (s *FirestoreStore) ListRequirements(ctx context.Context, orgID string, opts ListOptions) ([]*models.Requirement, string, error) {
+	q, err := requirementSort.resolve(opts)
+	if err != nil {
+		return nil, "", err
+	}
+
+	query := s.client.Collection("organizations").Doc(orgID).
+		Collection("requirements").Where("is_active", "==", true)
+	iter := applyPage(query, q).Documents(ctx)
 
 	var requirements []*models.Requirement
 	for {
@@ -223,25 +1448,27 @@ func (s *FirestoreStore) ListRequirements(ctx context.Context, orgID string) ([]
 			break
 		}
 		if err != nil {
-			return nil, fmt.Errorf("failed to iterate requirements: %w", err)
+			return nil, "", fmt.Errorf("failed to iterate requirements: %w", err)
 		}
 
 		var req models.Requirement
 		if err := doc.DataTo(&req); err != nil {
-			return nil, fmt.Errorf("failed to parse requirement: %w", err)
+			return nil, "", fmt.Errorf("failed to parse requirement: %w", err)
 		}
 		requirements = append(requirements, &req)
 	}
 
-	return requirements, nil
+	requirements, next := trimPage(q, requirements, func(r *models.Requirement) string { return r.ID })
+	return requirements, next, nil
 }
 
-// UpdateRequirement updates a requirement
+// UpdateRequirement updates a requirement, failing with ErrVersionConflict if
+// it changed since req was read
 func (s *FirestoreStore) UpdateRequirement(ctx context.Context, req *models.Requirement) error {
 	req.UpdatedAt = time.Now()
 
-	_, err := s.client.Collection("organizations").Doc(req.OrganizationID).
-		Collection("requirements").Doc(req.ID).Set(ctx, req)
+	ref := s.client.Collection("organizations").Doc(req.OrganizationID).Collection("requirements").Doc(req.ID)
+	err := s.setVersioned(ctx, ref, req, &req.Version)
 	if err != nil {
 		return fmt.Errorf("failed to update requirement: %w", err)
 	}
@@ -251,26 +1478,28 @@ func (s *FirestoreStore) UpdateRequirement(ctx context.Context, req *models.Requ
 
 // Evidence methods
 
-// CreateEvidence creates a new evidence item
+// CreateEvidence creates a new evidence item. Evidence counts for the
+// associated requirements are updated in the same transaction.
 func (s *FirestoreStore) CreateEvidence(ctx context.Context, evidence *models.Evidence) error {
-	evidence.ID = uuid.New().String()
+	// The upload URL flow pre-assigns the ID so it can be embedded in the object path
+	if evidence.ID == "" {
+		evidence.ID = uuid.New().String()
+	}
 	evidence.CreatedAt = time.Now()
 	evidence.UpdatedAt = time.Now()
+	evidence.Version = 1
 
-	_, err := s.client.Collection("organizations").Doc(evidence.OrganizationID).
-		Collection("evidence").Doc(evidence.ID).Set(ctx, evidence)
+	err := s.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		ref := s.evidenceRef(evidence.OrganizationID, evidence.ID)
+		if err := tx.Create(ref, evidence); err != nil {
+			return err
+		}
+		return s.applyEvidenceCountDeltas(tx, evidence.OrganizationID, evidenceCountDeltas(nil, evidence))
+	})
 	if err != nil {
 		return fmt.Errorf("failed to create evidence: %w", err)
 	}
 
-	// Update evidence count for associated requirements
-	for _, reqID := range evidence.RequirementIDs {
-		if err := s.incrementRequirementEvidenceCount(ctx, evidence.OrganizationID, reqID); err != nil {
-			// Log error but don't fail the operation
-			fmt.Printf("failed to increment evidence count for requirement %s: %v\n", reqID, err)
-		}
-	}
-
 	return nil
 }
 
@@ -290,17 +1519,33 @@ func (s *FirestoreStore) GetEvidence(ctx context.Context, orgID, evidenceID stri
 	return &evidence, nil
 }
 
-// ListEvidence lists all evidence for an organization
-func (s *FirestoreStore) ListEvidence(ctx context.Context, orgID string, filters map[string]interface{}) ([]*models.Evidence, error) {
+// ListEvidence lists active evidence for an organization, one page at a time
+func (s *FirestoreStore) ListEvidence(ctx context.Context, orgID string, filters map[string]interface{}, opts ListOptions) ([]*models.Evidence, string, error) {
+	q, err := evidenceSort.resolve(opts)
+	if err != nil {
+		return nil, "", err
+	}
+
+	status := interface{}("active")
+	if value, ok := filters[EvidenceStatusFilter]; ok {
+		status = value
+	}
 	query := s.client.Collection("organizations").Doc(orgID).Collection("evidence").
-		Where("status", "==", "active")
+		Where("status", "==", status)
 
 	// Apply additional filters
 	for key, value := range filters {
+		if key == EvidenceStatusFilter {
+			continue
+		}
+		if key == EvidenceRequirementFilter {
+			query = query.Where("requirement_ids", "array-contains", value)
+			continue
+		}
 		query = query.Where(key, "==", value)
 	}
 
-	iter := query.Documents(ctx)
+	iter := applyPage(query, q).Documents(ctx)
 
 	var evidenceList []*models.Evidence
 	for {
@@ -309,69 +1554,303 @@ func (s *FirestoreStore) ListEvidence(ctx context.Context, orgID string, filters
 			break
 		}
 		if err != nil {
-			return nil, fmt.Errorf("failed to iterate evidence: %w", err)
+			return nil, "", fmt.Errorf("failed to iterate evidence: %w", err)
 		}
 
 		var evidence models.Evidence
 		if err := doc.DataTo(&evidence); err != nil {
-			return nil, fmt.Errorf("failed to parse evidence: %w", err)
+			return nil, "", fmt.Errorf("failed to parse evidence: %w", err)
 		}
 		evidenceList = append(evidenceList, &evidence)
 	}
 
-	return evidenceList, nil
+	evidenceList, next := trimPage(q, evidenceList, func(e *models.Evidence) string { return e.ID })
+	return evidenceList, next, nil
 }
 
-// UpdateEvidence updates an evidence item
+// UpdateEvidence updates an evidence item, failing with ErrVersionConflict if
+// it changed since it was read. Changes to its status or requirement
+// associations adjust the affected evidence counts in the same transaction.
 func (s *FirestoreStore) UpdateEvidence(ctx context.Context, evidence *models.Evidence) error {
 	evidence.UpdatedAt = time.Now()
+	expected := evidence.Version
+
+	err := s.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		ref := s.evidenceRef(evidence.OrganizationID, evidence.ID)
+
+		before, err := s.getEvidenceTx(tx, ref)
+		if err != nil {
+			return err
+		}
+		if before != nil {
+			if err := checkVersion(before.Version, expected); err != nil {
+				return err
+			}
+		}
 
-	_, err := s.client.Collection("organizations").Doc(evidence.OrganizationID).
-		Collection("evidence").Doc(evidence.ID).Set(ctx, evidence)
+		evidence.Version = expected + 1
+		if err := tx.Set(ref, evidence); err != nil {
+			return err
+		}
+		return s.applyEvidenceCountDeltas(tx, evidence.OrganizationID, evidenceCountDeltas(before, evidence))
+	})
 	if err != nil {
+		evidence.Version = expected
 		return fmt.Errorf("failed to update evidence: %w", err)
 	}
 
 	return nil
 }
 
-// DeleteEvidence soft deletes an evidence item
-func (s *FirestoreStore) DeleteEvidence(ctx context.Context, orgID, evidenceID string) error {
-	// Get the evidence first to update requirement counts
-	evidence, err := s.GetEvidence(ctx, orgID, evidenceID)
-	if err != nil {
-		return err
-	}
+// DeleteEvidence soft deletes an evidence item and decrements the evidence
+// counts of its requirements in the same transaction. It fails with
+// ErrVersionConflict unless the stored version equals version.
+func (s *FirestoreStore) DeleteEvidence(ctx context.Context, orgID, evidenceID string, version int64) error {
+	err := s.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		ref := s.evidenceRef(orgID, evidenceID)
+
+		before, err := s.getEvidenceTx(tx, ref)
+		if err != nil {
+			return err
+		}
+		if before == nil {
+			return fmt.Errorf("evidence %s not found", evidenceID)
+		}
+		if err := checkVersion(before.Version, version); err != nil {
+			return err
+		}
+
+		after := *before
+		after.Status = "deleted"
 
-	// Update status to deleted
-	_, err = s.client.Collection("organizations").Doc(orgID).
-		Collection("evidence").Doc(evidenceID).Update(ctx, []firestore.Update{
-			{Path: "status", Value: "deleted"},
+		err = tx.Update(ref, []firestore.Update{
+			{Path: "status", Value: after.Status},
 			{Path: "updated_at", Value: time.Now()},
+			{Path: "version", Value: version + 1},
 		})
+		if err != nil {
+			return err
+		}
+		return s.applyEvidenceCountDeltas(tx, orgID, evidenceCountDeltas(before, &after))
+	})
 	if err != nil {
 		return fmt.Errorf("failed to delete evidence: %w", err)
 	}
 
-	// Decrement evidence count for associated requirements
-	for _, reqID := range evidence.RequirementIDs {
-		if err := s.decrementRequirementEvidenceCount(ctx, orgID, reqID); err != nil {
-			fmt.Printf("failed to decrement evidence count for requirement %s: %v\n", reqID, err)
+	return nil
+}
+
+// CreateEvidenceVersion records a pending upload of a new evidence file
+func (s *FirestoreStore) CreateEvidenceVersion(ctx context.Context, version *models.EvidenceVersion) error {
+	if version.ID == "" {
+		version.ID = uuid.New().String()
+	}
+	version.CreatedAt = time.Now()
+
+	_, err := s.evidenceVersionRef(version.OrganizationID, version.EvidenceID, version.ID).Set(ctx, version)
+	if err != nil {
+		return fmt.Errorf("failed to create evidence version: %w", err)
+	}
+
+	return nil
+}
+
+// GetEvidenceVersion retrieves a version of an evidence item by ID
+func (s *FirestoreStore) GetEvidenceVersion(ctx context.Context, orgID, evidenceID, versionID string) (*models.EvidenceVersion, error) {
+	doc, err := s.evidenceVersionRef(orgID, evidenceID, versionID).Get(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get evidence version: %w", err)
+	}
+
+	var version models.EvidenceVersion
+	if err := doc.DataTo(&version); err != nil {
+		return nil, fmt.Errorf("failed to parse evidence version: %w", err)
+	}
+
+	return &version, nil
+}
+
+// ListEvidenceVersions lists the published versions of an evidence item by
+// number. An evidence item has few versions, so they are sorted after
+// fetching rather than with a composite index.
+func (s *FirestoreStore) ListEvidenceVersions(ctx context.Context, orgID, evidenceID string) ([]*models.EvidenceVersion, error) {
+	evidence, err := s.GetEvidence(ctx, orgID, evidenceID)
+	if err != nil {
+		return nil, err
+	}
+	if legacy := legacyEvidenceVersion(evidence); legacy != nil {
+		return []*models.EvidenceVersion{legacy}, nil
+	}
+
+	iter := s.evidenceRef(orgID, evidenceID).Collection("versions").
+		Where("status", "==", "active").Documents(ctx)
+
+	var versions []*models.EvidenceVersion
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to iterate evidence versions: %w", err)
+		}
+
+		var version models.EvidenceVersion
+		if err := doc.DataTo(&version); err != nil {
+			return nil, fmt.Errorf("failed to parse evidence version: %w", err)
+		}
+		versions = append(versions, &version)
+	}
+
+	sortEvidenceVersions(versions)
+	return versions, nil
+}
+
+// PublishEvidenceVersion makes version the current file of evidence in one
+// transaction, failing with ErrVersionConflict if the evidence changed since
+// it was read
+func (s *FirestoreStore) PublishEvidenceVersion(ctx context.Context, evidence *models.Evidence, version *models.EvidenceVersion) error {
+	evidence.UpdatedAt = time.Now()
+	expected := evidence.Version
+
+	err := s.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		ref := s.evidenceRef(evidence.OrganizationID, evidence.ID)
+
+		before, err := s.getEvidenceTx(tx, ref)
+		if err != nil {
+			return err
+		}
+		if before == nil {
+			return fmt.Errorf("evidence %s not found", evidence.ID)
+		}
+		if err := checkVersion(before.Version, expected); err != nil {
+			return err
+		}
+
+		for _, v := range publishEvidenceVersion(before, evidence, version) {
+			if v.CreatedAt.IsZero() {
+				v.CreatedAt = time.Now()
+			}
+			if err := tx.Set(s.evidenceVersionRef(v.OrganizationID, v.EvidenceID, v.ID), v); err != nil {
+				return err
+			}
 		}
+
+		evidence.Version = expected + 1
+		if err := tx.Set(ref, evidence); err != nil {
+			return err
+		}
+		return s.applyEvidenceCountDeltas(tx, evidence.OrganizationID, evidenceCountDeltas(before, evidence))
+	})
+	if err != nil {
+		evidence.Version = expected
+		return fmt.Errorf("failed to publish evidence version: %w", err)
 	}
 
 	return nil
 }
 
+// ReconcileEvidenceCounts recomputes every requirement's evidence_count from
+// the organization's active evidence and corrects any drift. Each requirement
+// is checked and fixed in its own transaction so concurrent evidence changes
+// cannot be overwritten with a stale count.
+func (s *FirestoreStore) ReconcileEvidenceCounts(ctx context.Context, orgID string) ([]EvidenceCountDrift, error) {
+	reqDocs, err := s.client.Collection("organizations").Doc(orgID).
+		Collection("requirements").Documents(ctx).GetAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list requirements: %w", err)
+	}
+
+	var drift []EvidenceCountDrift
+	for _, reqDoc := range reqDocs {
+		var corrected *EvidenceCountDrift
+
+		err := s.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+			corrected = nil
+
+			snap, err := tx.Get(reqDoc.Ref)
+			if err != nil {
+				return err
+			}
+			var req models.Requirement
+			if err := snap.DataTo(&req); err != nil {
+				return err
+			}
+
+			query := s.client.Collection("organizations").Doc(orgID).Collection("evidence").
+				Where("status", "==", "active").
+				Where("requirement_ids", "array-contains", reqDoc.Ref.ID)
+			evidenceDocs, err := tx.Documents(query).GetAll()
+			if err != nil {
+				return err
+			}
+
+			actual := len(evidenceDocs)
+			if actual == req.EvidenceCount {
+				return nil
+			}
+
+			corrected = &EvidenceCountDrift{
+				RequirementID: reqDoc.Ref.ID,
+				Title:         req.Title,
+				StoredCount:   req.EvidenceCount,
+				ActualCount:   actual,
+			}
+			return tx.Update(reqDoc.Ref, []firestore.Update{
+				{Path: "evidence_count", Value: actual},
+				{Path: "updated_at", Value: time.Now()},
+				{Path: "version", Value: firestore.Increment(1)},
+			})
+		})
+		if err != nil {
+			return drift, fmt.Errorf("failed to reconcile requirement %s: %w", reqDoc.Ref.ID, err)
+		}
+
+		if corrected != nil {
+			drift = append(drift, *corrected)
+		}
+	}
+
+	return drift, nil
+}
+
 // Audit log methods
 
-// CreateAuditLog creates a new audit log entry
+// auditChainMaxAttempts is how many times an audit log write is tried. Every
+// write in an organization updates its chain head, so busy organizations
+// contend on that one document and need more retries than the default.
+const auditChainMaxAttempts = 20
+
+// CreateAuditLog appends an entry to the organization's audit log hash chain.
+// The entry and the chain head are written in one transaction so concurrent
+// writers cannot fork the chain; a transaction that loses a race for the head
+// is retried with backoff.
 func (s *FirestoreStore) CreateAuditLog(ctx context.Context, log *models.AuditLog) error {
 	log.ID = uuid.New().String()
 	log.Timestamp = time.Now()
 
-	_, err := s.client.Collection("organizations").Doc(log.OrganizationID).
-		Collection("audit_logs").Doc(log.ID).Set(ctx, log)
+	orgRef := s.client.Collection("organizations").Doc(log.OrganizationID)
+	headRef := s.auditChainHeadRef(log.OrganizationID)
+
+	err := s.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		var head AuditChainHead
+		snap, err := tx.Get(headRef)
+		if err != nil && status.Code(err) != codes.NotFound {
+			return err
+		}
+		if err == nil {
+			if err := snap.DataTo(&head); err != nil {
+				return err
+			}
+		}
+
+		log.Chain(head.Sequence, head.Hash)
+
+		if err := tx.Create(orgRef.Collection("audit_logs").Doc(log.ID), log); err != nil {
+			return err
+		}
+		return tx.Set(headRef, AuditChainHead{Sequence: log.Sequence, Hash: log.Hash})
+	}, firestore.MaxAttempts(auditChainMaxAttempts))
 	if err != nil {
 		return fmt.Errorf("failed to create audit log: %w", err)
 	}
@@ -379,20 +1858,180 @@ func (s *FirestoreStore) CreateAuditLog(ctx context.Context, log *models.AuditLo
 	return nil
 }
 
-// ListAuditLogs lists audit logs for an organization with optional filters
-func (s *FirestoreStore) ListAuditLogs(ctx context.Context, orgID string, filters map[string]interface{}, limit int) ([]*models.AuditLog, error) {
-	query := s.client.Collection("organizations").Doc(orgID).
-		Collection("audit_logs").OrderBy("timestamp", firestore.Desc)
+// GetAuditChainHead returns the last link of the organization's audit chain.
+// An organization with no chained entries has a zero head.
+func (s *FirestoreStore) GetAuditChainHead(ctx context.Context, orgID string) (*AuditChainHead, error) {
+	var head AuditChainHead
+
+	doc, err := s.auditChainHeadRef(orgID).Get(ctx)
+	if status.Code(err) == codes.NotFound {
+		return &head, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get audit chain head: %w", err)
+	}
 
-	if limit > 0 {
-		query = query.Limit(limit)
+	if err := doc.DataTo(&head); err != nil {
+		return nil, fmt.Errorf("failed to parse audit chain head: %w", err)
 	}
 
+	return &head, nil
+}
+
+// ListAuditLogsBySequence returns up to limit chained audit log entries with
+// a sequence greater than afterSequence, in sequence order
+func (s *FirestoreStore) ListAuditLogsBySequence(ctx context.Context, orgID string, afterSequence int64, limit int) ([]*models.AuditLog, error) {
+	query := s.client.Collection("organizations").Doc(orgID).Collection("audit_logs").
+		Where("sequence", ">", afterSequence).
+		OrderBy("sequence", firestore.Asc).
+		Limit(limit)
+
+	return s.auditLogDocuments(ctx, query)
+}
+
+// auditForwardCheckpoint is the stored progress of one audit log sink
+type auditForwardCheckpoint struct {
+	Sequence  int64     `firestore:"sequence"`
+	UpdatedAt time.Time `firestore:"updated_at"`
+}
+
+// GetAuditForwardCheckpoint returns the sequence of the last audit log entry
+// delivered to the named sink, or 0 if nothing has been delivered yet
+func (s *FirestoreStore) GetAuditForwardCheckpoint(ctx context.Context, orgID, sink string) (int64, error) {
+	doc, err := s.auditForwardCheckpointRef(orgID, sink).Get(ctx)
+	if status.Code(err) == codes.NotFound {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to get audit forward checkpoint: %w", err)
+	}
+
+	var checkpoint auditForwardCheckpoint
+	if err := doc.DataTo(&checkpoint); err != nil {
+		return 0, fmt.Errorf("failed to parse audit forward checkpoint: %w", err)
+	}
+
+	return checkpoint.Sequence, nil
+}
+
+// SaveAuditForwardCheckpoint records that entries up to sequence have been
+// delivered to the named sink
+func (s *FirestoreStore) SaveAuditForwardCheckpoint(ctx context.Context, orgID, sink string, sequence int64) error {
+	_, err := s.auditForwardCheckpointRef(orgID, sink).Set(ctx, auditForwardCheckpoint{
+		Sequence:  sequence,
+		UpdatedAt: time.Now(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save audit forward checkpoint: %w", err)
+	}
+
+	return nil
+}
+
+// ListAuditLogs lists audit logs for an organization with optional filters, one page at a time
+func (s *FirestoreStore) ListAuditLogs(ctx context.Context, orgID string, filter AuditLogFilter, opts ListOptions) ([]*models.AuditLog, string, error) {
+	q, err := auditLogSort.resolve(opts)
+	if err != nil {
+		return nil, "", err
+	}
+
+	query := s.client.Collection("organizations").Doc(orgID).Collection("audit_logs").Query
+
 	// Apply filters
-	for key, value := range filters {
-		query = query.Where(key, "==", value)
+	if filter.UserID != "" {
+		query = query.Where("user_id", "==", filter.UserID)
+	}
+	if filter.ActorType != "" {
+		query = query.Where("actor_type", "==", string(filter.ActorType))
+	}
+	switch len(filter.Actions) {
+	case 0:
+	case 1:
+		query = query.Where("action", "==", filter.Actions[0])
+	default:
+		actions := make([]string, len(filter.Actions))
+		for i, action := range filter.Actions {
+			actions[i] = string(action)
+		}
+		query = query.Where("action", "in", actions)
+	}
+	if filter.ResourceType != "" {
+		query = query.Where("resource_type", "==", filter.ResourceType)
 	}
+	if filter.ResourceID != "" {
+		query = query.Where("resource_id", "==", filter.ResourceID)
+	}
+	if !filter.From.IsZero() {
+		query = query.Where("timestamp", ">=", filter.From)
+	}
+	if !filter.To.IsZero() {
+		query = query.Where("timestamp", "<", filter.To)
+	}
+
+	if filter.Search != "" {
+		return s.searchAuditLogs(ctx, query, q, filter)
+	}
+
+	logs, err := s.auditLogDocuments(ctx, applyPage(query, q))
+	if err != nil {
+		return nil, "", err
+	}
+
+	logs, next := trimPage(q, logs, func(l *models.AuditLog) string { return l.ID })
+	return logs, next, nil
+}
+
+// searchAuditLogs pages through query in batches, keeping entries that match
+// the free-text search, which Firestore cannot evaluate itself. It stops after
+// scanning auditSearchScanLimit entries, returning a possibly short page with
+// a token that resumes the scan.
+func (s *FirestoreStore) searchAuditLogs(ctx context.Context, query firestore.Query, q *pageQuery, filter AuditLogFilter) ([]*models.AuditLog, string, error) {
+	scanLimit := auditSearchScanLimit
+	if q.size*10 > scanLimit {
+		scanLimit = q.size * 10
+	}
+
+	batch := *q
+	batch.size = auditSearchBatchSize
+
+	var matched []*models.AuditLog
+	scanned := 0
+	for {
+		docs, err := s.auditLogDocuments(ctx, applyPage(query, &batch))
+		if err != nil {
+			return nil, "", err
+		}
+		more := len(docs) > batch.size
+		if more {
+			docs = docs[:batch.size]
+		}
+
+		for _, log := range docs {
+			if !filter.matchesSearch(log) {
+				continue
+			}
+			matched = append(matched, log)
+			if q.size > 0 && len(matched) > q.size {
+				logs, next := trimPage(q, matched, func(l *models.AuditLog) string { return l.ID })
+				return logs, next, nil
+			}
+		}
+
+		if !more {
+			return matched, "", nil
+		}
+
+		last := docs[len(docs)-1]
+		scanned += len(docs)
+		if q.size > 0 && scanned >= scanLimit {
+			return matched, q.nextToken(last, last.ID), nil
+		}
+		batch.cursor = batch.cursorAfter(last, last.ID)
+	}
+}
 
+// auditLogDocuments runs an audit log query and decodes the results
+func (s *FirestoreStore) auditLogDocuments(ctx context.Context, query firestore.Query) ([]*models.AuditLog, error) {
 	iter := query.Documents(ctx)
 
 	var logs []*models.AuditLog
@@ -503,20 +2142,109 @@ func (s *FirestoreStore) ListRequirementTemplates(ctx context.Context, framework
 
 // Helper methods
 
-func (s *FirestoreStore) incrementRequirementEvidenceCount(ctx context.Context, orgID, reqID string) error {
-	_, err := s.client.Collection("organizations").Doc(orgID).
-		Collection("requirements").Doc(reqID).Update(ctx, []firestore.Update{
-			{Path: "evidence_count", Value: firestore.Increment(1)},
-			{Path: "updated_at", Value: time.Now()},
-		})
-	return err
+// applyPage orders the query by the resolved sort field with the document ID
+// as a tiebreaker, starts after the cursor and fetches one extra document so
+// trimPage can tell whether another page exists
+func applyPage(query firestore.Query, q *pageQuery) firestore.Query {
+	dir := firestore.Asc
+	if q.desc {
+		dir = firestore.Desc
+	}
+
+	query = query.OrderBy(q.field, dir).OrderBy(firestore.DocumentID, dir)
+	if q.cursor != nil {
+		query = query.StartAfter(q.cursorValue(), q.cursor.ID)
+	}
+	if q.size > 0 {
+		query = query.Limit(q.size + 1)
+	}
+	return query
+}
+
+func (s *FirestoreStore) auditChainHeadRef(orgID string) *firestore.DocumentRef {
+	return s.client.Collection("organizations").Doc(orgID).Collection("audit_chain").Doc("head")
+}
+
+func (s *FirestoreStore) auditForwardCheckpointRef(orgID, sink string) *firestore.DocumentRef {
+	return s.client.Collection("organizations").Doc(orgID).Collection("audit_forward_checkpoints").Doc(sink)
+}
+
+func (s *FirestoreStore) evidenceRef(orgID, evidenceID string) *firestore.DocumentRef {
+	return s.client.Collection("organizations").Doc(orgID).Collection("evidence").Doc(evidenceID)
+}
+
+func (s *FirestoreStore) evidenceVersionRef(orgID, evidenceID, versionID string) *firestore.DocumentRef {
+	return s.evidenceRef(orgID, evidenceID).Collection("versions").Doc(versionID)
+}
+
+// getEvidenceTx reads an evidence document inside a transaction, returning
+// nil if it does not exist yet
+func (s *FirestoreStore) getEvidenceTx(tx *firestore.Transaction, ref *firestore.DocumentRef) (*models.Evidence, error) {
+	snap, err := tx.Get(ref)
+	if status.Code(err) == codes.NotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var evidence models.Evidence
+	if err := snap.DataTo(&evidence); err != nil {
+		return nil, err
+	}
+	return &evidence, nil
 }
 
-func (s *FirestoreStore) decrementRequirementEvidenceCount(ctx context.Context, orgID, reqID string) error {
-	_, err := s.client.Collection("organizations").Doc(orgID).
-		Collection("requirements").Doc(reqID).Update(ctx, []firestore.Update{
-			{Path: "evidence_count", Value: firestore.Increment(-1)},
+// applyEvidenceCountDeltas queues evidence_count increments on the
+// transaction. A count change bumps the requirement's version so a concurrent
+// requirement edit cannot overwrite it. A missing requirement fails the
+// whole transaction.
+func (s *FirestoreStore) applyEvidenceCountDeltas(tx *firestore.Transaction, orgID string, deltas map[string]int) error {
+	for reqID, delta := range deltas {
+		if delta == 0 {
+			continue
+		}
+		ref := s.client.Collection("organizations").Doc(orgID).Collection("requirements").Doc(reqID)
+		err := tx.Update(ref, []firestore.Update{
+			{Path: "evidence_count", Value: firestore.Increment(delta)},
 			{Path: "updated_at", Value: time.Now()},
+			{Path: "version", Value: firestore.Increment(1)},
 		})
+		if err != nil {
+			return fmt.Errorf("failed to update evidence count for requirement %s: %w", reqID, err)
+		}
+	}
+	return nil
+}
+
+// setVersioned writes doc to ref in a transaction if the stored version still
+// equals *version, then advances *version. A document that does not exist yet
+// is written unconditionally, matching Set.
+func (s *FirestoreStore) setVersioned(ctx context.Context, ref *firestore.DocumentRef, doc interface{}, version *int64) error {
+	expected := *version
+
+	err := s.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		snap, err := tx.Get(ref)
+		if err != nil && status.Code(err) != codes.NotFound {
+			return err
+		}
+		if snap != nil && snap.Exists() {
+			var stored struct {
+				Version int64 `firestore:"version"`
+			}
+			if err := snap.DataTo(&stored); err != nil {
+				return err
+			}
+			if err := checkVersion(stored.Version, expected); err != nil {
+				return err
+			}
+		}
+
+		*version = expected + 1
+		return tx.Set(ref, doc)
+	})
+	if err != nil {
+		*version = expected
+	}
 	return err
 }
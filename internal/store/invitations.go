@@ -0,0 +1,69 @@
+package store
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"compliancesync-api/internal/models"
+)
+
+// Errors returned by invitation writes. Handlers map these to 4xx responses.
+var (
+	ErrSeatLimitReached     = errors.New("user limit reached")
+	ErrInvitationExists     = errors.New("a pending invitation already exists for this email")
+	ErrInvitationNotPending = errors.New("invitation is no longer pending")
+)
+
+// checkInvitationSeat verifies that inv can hold a seat in org alongside the
+// organization's other invitations. Active users and unexpired pending
+// invitations other than inv itself each take a seat, and an email may have
+// only one pending invitation at a time.
+func checkInvitationSeat(org *models.Organization, invitations []*models.Invitation, inv *models.Invitation, now time.Time) error {
+	used := org.ActiveUserCount
+	for _, other := range invitations {
+		if other.ID == inv.ID || !other.HoldsSeat(now) {
+			continue
+		}
+		if strings.EqualFold(other.Email, inv.Email) {
+			return ErrInvitationExists
+		}
+		used++
+	}
+
+	if used >= org.Subscription.MaxUsers {
+		return ErrSeatLimitReached
+	}
+	return nil
+}
+
+// checkProvisionSeat verifies that a user with email can be added to org
+// directly, as single sign-on and directory provisioning do. A pending
+// invitation for the same email already holds the seat the user will take,
+// so it is not counted twice.
+func checkProvisionSeat(org *models.Organization, invitations []*models.Invitation, email string, now time.Time) error {
+	used := org.ActiveUserCount
+	for _, inv := range invitations {
+		if inv.HoldsSeat(now) && !strings.EqualFold(inv.Email, email) {
+			used++
+		}
+	}
+
+	if used >= org.Subscription.MaxUsers {
+		return ErrSeatLimitReached
+	}
+	return nil
+}
+
+// activeUserDelta is the change in an organization's active user count when
+// a user's status changes from one value to another
+func activeUserDelta(from, to string) int {
+	switch {
+	case from != "active" && to == "active":
+		return 1
+	case from == "active" && to != "active":
+		return -1
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,7 @@
+package store
+
+import "errors"
+
+// ErrAlreadyMember is returned when a user joins an organization they
+// already belong to. Handlers map it to 409.
+var ErrAlreadyMember = errors.New("user is already a member of the organization")
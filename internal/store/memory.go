@@ -0,0 +1,1810 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"compliancesync-api/internal/models"
+	"github.com/google/uuid"
+)
+
+// MemoryStore implements the Store interface in process memory.
+// It mirrors the FirestoreStore semantics and is intended for handler tests
+// and local demos that run without a GCP project.
+type MemoryStore struct {
+	mu               sync.RWMutex
+	orgs             map[string]*models.Organization
+	users            map[string]*models.User
+	invitations      map[string]*models.Invitation
+	memberships      map[string]*models.Membership
+	roles            map[string]map[string]*models.Role // orgID -> roleID -> role
+	apiKeys          map[string]*models.APIKey
+	auditorGrants    map[string]*models.AuditorGrant
+	ssoConfigs       map[string]*models.SSOConfig // orgID -> configuration
+	domains          map[string]*models.Domain
+	sessions         map[string]*models.Session
+	samlAssertions   map[string]time.Time // issuer + "\n" + assertion ID -> expiry
+	requirements     map[string]map[string]*models.Requirement     // orgID -> reqID -> requirement
+	evidence         map[string]map[string]*models.Evidence        // orgID -> evidenceID -> evidence
+	evidenceVersions map[string]map[string]*models.EvidenceVersion // orgID -> versionID -> version
+	auditLogs        map[string][]*models.AuditLog                 // orgID -> entries in insertion order
+	checkpoints      map[string]map[string]int64                   // orgID -> sink -> last forwarded sequence
+	reports          map[string]map[string]*models.Report          // orgID -> reportID -> report
+	templates        map[string]*models.RequirementTemplate
+}
+
+// NewMemoryStore creates a new, empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		orgs:             make(map[string]*models.Organization),
+		users:            make(map[string]*models.User),
+		invitations:      make(map[string]*models.Invitation),
+		memberships:      make(map[string]*models.Membership),
+		roles:            make(map[string]map[string]*models.Role),
+		apiKeys:          make(map[string]*models.APIKey),
+		auditorGrants:    make(map[string]*models.AuditorGrant),
+		ssoConfigs:       make(map[string]*models.SSOConfig),
+		domains:          make(map[string]*models.Domain),
+		sessions:         make(map[string]*models.Session),
+		samlAssertions:   make(map[string]time.Time),
+		requirements:     make(map[string]map[string]*models.Requirement),
+		evidence:         make(map[string]map[string]*models.Evidence),
+		evidenceVersions: make(map[string]map[string]*models.EvidenceVersion),
+		auditLogs:        make(map[string][]*models.AuditLog),
+		checkpoints:      make(map[string]map[string]int64),
+		reports:          make(map[string]map[string]*models.Report),
+		templates:        make(map[string]*models.RequirementTemplate),
+	}
+}
+
+// Close is a no-op for the in-memory store
+func (s *MemoryStore) Close() error {
+	return nil
+}
+
+// Organization methods
+
+// CreateOrganization creates a new organization
+func (s *MemoryStore) CreateOrganization(ctx context.Context, org *models.Organization) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	org.ID = uuid.New().String()
+	org.CreatedAt = time.Now()
+	org.UpdatedAt = time.Now()
+	org.ActiveUserCount = 1 // Creator is the first user
+	org.Version = 1
+
+	s.orgs[org.ID] = cloneOrganization(org)
+	return nil
+}
+
+// GetOrganization retrieves an organization by ID
+func (s *MemoryStore) GetOrganization(ctx context.Context, orgID string) (*models.Organization, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	org, ok := s.orgs[orgID]
+	if !ok {
+		return nil, fmt.Errorf("failed to get organization: %s not found", orgID)
+	}
+	return cloneOrganization(org), nil
+}
+
+// UpdateOrganization updates an organization, failing with ErrVersionConflict
+// if it changed since org was read
+func (s *MemoryStore) UpdateOrganization(ctx context.Context, org *models.Organization) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if stored, ok := s.orgs[org.ID]; ok {
+		if err := checkVersion(stored.Version, org.Version); err != nil {
+			return fmt.Errorf("failed to update organization: %w", err)
+		}
+	}
+
+	org.UpdatedAt = time.Now()
+	org.Version++
+	s.orgs[org.ID] = cloneOrganization(org)
+	return nil
+}
+
+// CreateClientOrganization creates an organization managed by a partner,
+// with no users
+func (s *MemoryStore) CreateClientOrganization(ctx context.Context, partnerID string, org *models.Organization) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	org.ID = uuid.New().String()
+	org.PartnerID = partnerID
+	org.CreatedAt = time.Now()
+	org.UpdatedAt = time.Now()
+	org.ActiveUserCount = 0
+	org.Version = 1
+
+	s.orgs[org.ID] = cloneOrganization(org)
+	return nil
+}
+
+// ListClientOrganizations lists a partner's client organizations by name
+func (s *MemoryStore) ListClientOrganizations(ctx context.Context, partnerID string) ([]*models.Organization, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var orgs []*models.Organization
+	for _, org := range s.orgs {
+		if org.IsClientOf(partnerID) {
+			orgs = append(orgs, cloneOrganization(org))
+		}
+	}
+	sort.Slice(orgs, func(i, j int) bool {
+		if orgs[i].Name != orgs[j].Name {
+			return orgs[i].Name < orgs[j].Name
+		}
+		return orgs[i].ID < orgs[j].ID
+	})
+	return orgs, nil
+}
+
+// User methods
+
+// CreateUser creates a new user
+func (s *MemoryStore) CreateUser(ctx context.Context, user *models.User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user.CreatedAt = time.Now()
+	user.UpdatedAt = time.Now()
+	user.Status = "active"
+
+	s.users[user.UID] = clone(user)
+	return nil
+}
+
+// GetUser retrieves a user by UID
+func (s *MemoryStore) GetUser(ctx context.Context, uid string) (*models.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	user, ok := s.users[uid]
+	if !ok {
+		return nil, fmt.Errorf("failed to get user: %s not found", uid)
+	}
+	return clone(user), nil
+}
+
+// GetUserByEmail retrieves a user by email
+func (s *MemoryStore) GetUserByEmail(ctx context.Context, email string) (*models.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, user := range s.users {
+		if user.Email == email {
+			return clone(user), nil
+		}
+	}
+	return nil, fmt.Errorf("user not found")
+}
+
+// UpdateUser updates a user
+func (s *MemoryStore) UpdateUser(ctx context.Context, user *models.User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user.UpdatedAt = time.Now()
+	s.users[user.UID] = clone(user)
+	return nil
+}
+
+// ListUsersByOrganization lists users in an organization, one page at a time
+func (s *MemoryStore) ListUsersByOrganization(ctx context.Context, orgID string, opts ListOptions) ([]*models.User, string, error) {
+	q, err := userSort.resolve(opts)
+	if err != nil {
+		return nil, "", err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var users []*models.User
+	for _, user := range s.users {
+		if user.OrganizationID == orgID {
+			users = append(users, clone(user))
+		}
+	}
+
+	users, next := paginate(q, users, func(u *models.User) string { return u.UID })
+	return users, next, nil
+}
+
+// UpdateLastLogin updates the last login timestamp for a user
+func (s *MemoryStore) UpdateLastLogin(ctx context.Context, uid string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[uid]
+	if !ok {
+		return fmt.Errorf("failed to update last login: %s not found", uid)
+	}
+
+	now := time.Now()
+	user.LastLoginAt = &now
+	user.UpdatedAt = now
+	return nil
+}
+
+// ProvisionUser creates a user without an invitation and adds them to the
+// organization's active user count in one step
+func (s *MemoryStore) ProvisionUser(ctx context.Context, user *models.User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	org, invitations, err := s.seatUsage(user.OrganizationID)
+	if err != nil {
+		return fmt.Errorf("failed to provision user: %w", err)
+	}
+	if err := checkProvisionSeat(org, invitations, user.Email, now); err != nil {
+		return fmt.Errorf("failed to provision user: %w", err)
+	}
+	if _, ok := s.users[user.UID]; ok {
+		return fmt.Errorf("failed to provision user: %s already exists", user.UID)
+	}
+
+	user.CreatedAt = now
+	user.UpdatedAt = now
+	user.Status = "active"
+
+	org.ActiveUserCount++
+	org.UpdatedAt = now
+	org.Version++
+
+	s.users[user.UID] = clone(user)
+	return nil
+}
+
+// SetUserStatus saves a user with a new status, taking or releasing a seat
+func (s *MemoryStore) SetUserStatus(ctx context.Context, user *models.User, status string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.users[user.UID]
+	if !ok {
+		return fmt.Errorf("failed to set user status: %s not found", user.UID)
+	}
+
+	now := time.Now()
+	org, invitations, err := s.seatUsage(user.OrganizationID)
+	if err != nil {
+		return fmt.Errorf("failed to set user status: %w", err)
+	}
+	delta := activeUserDelta(stored.Status, status)
+	if delta > 0 {
+		if err := checkProvisionSeat(org, invitations, user.Email, now); err != nil {
+			return fmt.Errorf("failed to set user status: %w", err)
+		}
+	}
+
+	user.Status = status
+	user.UpdatedAt = now
+
+	if delta != 0 {
+		org.ActiveUserCount += delta
+		org.UpdatedAt = now
+		org.Version++
+	}
+
+	s.users[user.UID] = clone(user)
+	return nil
+}
+
+// Invitation methods
+
+// CreateInvitation stores a new pending invitation, failing with
+// ErrSeatLimitReached when the organization has no free seat or
+// ErrInvitationExists when the email already has a pending invitation
+func (s *MemoryStore) CreateInvitation(ctx context.Context, inv *models.Invitation) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	inv.ID = uuid.New().String()
+	inv.CreatedAt = time.Now()
+	inv.SentAt = inv.CreatedAt
+	inv.Status = "pending"
+
+	if err := s.checkInvitationSeat(inv); err != nil {
+		return fmt.Errorf("failed to create invitation: %w", err)
+	}
+
+	s.invitations[inv.ID] = clone(inv)
+	return nil
+}
+
+// GetInvitation retrieves an invitation by ID
+func (s *MemoryStore) GetInvitation(ctx context.Context, orgID, invitationID string) (*models.Invitation, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	inv, ok := s.invitations[invitationID]
+	if !ok || inv.OrganizationID != orgID {
+		return nil, fmt.Errorf("failed to get invitation: %s not found", invitationID)
+	}
+	return clone(inv), nil
+}
+
+// GetInvitationByToken retrieves an invitation by the hash of its token
+func (s *MemoryStore) GetInvitationByToken(ctx context.Context, tokenHash string) (*models.Invitation, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, inv := range s.invitations {
+		if inv.Token == tokenHash {
+			return clone(inv), nil
+		}
+	}
+	return nil, fmt.Errorf("invitation not found")
+}
+
+// ListInvitations lists an organization's invitations, one page at a time
+func (s *MemoryStore) ListInvitations(ctx context.Context, orgID string, opts ListOptions) ([]*models.Invitation, string, error) {
+	q, err := invitationSort.resolve(opts)
+	if err != nil {
+		return nil, "", err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var invitations []*models.Invitation
+	for _, inv := range s.invitations {
+		if inv.OrganizationID == orgID {
+			invitations = append(invitations, clone(inv))
+		}
+	}
+
+	invitations, next := paginate(q, invitations, func(i *models.Invitation) string { return i.ID })
+	return invitations, next, nil
+}
+
+// RenewInvitation saves a new token and expiry for a pending (possibly
+// expired) invitation. The seat check is repeated because an expired
+// invitation no longer holds a seat.
+func (s *MemoryStore) RenewInvitation(ctx context.Context, inv *models.Invitation) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.invitations[inv.ID]
+	if !ok {
+		return fmt.Errorf("failed to renew invitation: %s not found", inv.ID)
+	}
+	if stored.Status != "pending" {
+		return fmt.Errorf("failed to renew invitation: %w", ErrInvitationNotPending)
+	}
+
+	inv.SentAt = time.Now()
+	inv.Status = "pending"
+	if err := s.checkInvitationSeat(inv); err != nil {
+		return fmt.Errorf("failed to renew invitation: %w", err)
+	}
+
+	s.invitations[inv.ID] = clone(inv)
+	return nil
+}
+
+// UpdateInvitation saves a status change to a pending invitation, failing
+// with ErrInvitationNotPending if it was accepted or revoked in the meantime
+func (s *MemoryStore) UpdateInvitation(ctx context.Context, inv *models.Invitation) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.invitations[inv.ID]
+	if !ok {
+		return fmt.Errorf("failed to update invitation: %s not found", inv.ID)
+	}
+	if stored.Status != "pending" {
+		return fmt.Errorf("failed to update invitation: %w", ErrInvitationNotPending)
+	}
+
+	s.invitations[inv.ID] = clone(inv)
+	return nil
+}
+
+// AcceptInvitation marks a pending invitation accepted, creates the invited
+// user and adds them to the organization's active user count in one step
+func (s *MemoryStore) AcceptInvitation(ctx context.Context, inv *models.Invitation, user *models.User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	stored, ok := s.invitations[inv.ID]
+	if !ok || !stored.HoldsSeat(now) {
+		return fmt.Errorf("failed to accept invitation: %w", ErrInvitationNotPending)
+	}
+	org, ok := s.orgs[stored.OrganizationID]
+	if !ok {
+		return fmt.Errorf("failed to accept invitation: organization %s not found", stored.OrganizationID)
+	}
+
+	user.CreatedAt = now
+	user.UpdatedAt = now
+	user.Status = "active"
+
+	*inv = *clone(stored)
+	inv.Status = "accepted"
+	inv.AcceptedAt = &now
+	inv.AcceptedBy = user.UID
+
+	org.ActiveUserCount++
+	org.UpdatedAt = now
+	org.Version++
+
+	s.users[user.UID] = clone(user)
+	s.invitations[inv.ID] = clone(inv)
+	return nil
+}
+
+// checkInvitationSeat runs checkInvitationSeat against the stored
+// organization and invitations. Callers must hold s.mu.
+func (s *MemoryStore) checkInvitationSeat(inv *models.Invitation) error {
+	org, invitations, err := s.seatUsage(inv.OrganizationID)
+	if err != nil {
+		return err
+	}
+	return checkInvitationSeat(org, invitations, inv, time.Now())
+}
+
+// seatUsage returns the stored organization and its invitations for seat
+// accounting. Callers must hold s.mu.
+func (s *MemoryStore) seatUsage(orgID string) (*models.Organization, []*models.Invitation, error) {
+	org, ok := s.orgs[orgID]
+	if !ok {
+		return nil, nil, fmt.Errorf("organization %s not found", orgID)
+	}
+
+	var invitations []*models.Invitation
+	for _, inv := range s.invitations {
+		if inv.OrganizationID == orgID {
+			invitations = append(invitations, inv)
+		}
+	}
+	return org, invitations, nil
+}
+
+// Membership methods
+
+// JoinOrganization accepts an invitation for an existing user, creating their
+// membership in the invitation's organization
+func (s *MemoryStore) JoinOrganization(ctx context.Context, inv *models.Invitation, membership *models.Membership) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	stored, ok := s.invitations[inv.ID]
+	if !ok || !stored.HoldsSeat(now) {
+		return fmt.Errorf("failed to join organization: %w", ErrInvitationNotPending)
+	}
+	org, ok := s.orgs[stored.OrganizationID]
+	if !ok {
+		return fmt.Errorf("failed to join organization: organization %s not found", stored.OrganizationID)
+	}
+
+	membership.ID = models.MembershipID(stored.OrganizationID, membership.UserID)
+	if _, exists := s.memberships[membership.ID]; exists {
+		return fmt.Errorf("failed to join organization: %w", ErrAlreadyMember)
+	}
+	membership.OrganizationID = stored.OrganizationID
+	membership.Role = stored.Role
+	membership.InvitationID = stored.ID
+	membership.CreatedAt = now
+	membership.UpdatedAt = now
+
+	*inv = *clone(stored)
+	inv.Status = "accepted"
+	inv.AcceptedAt = &now
+	inv.AcceptedBy = membership.UserID
+
+	org.ActiveUserCount++
+	org.UpdatedAt = now
+	org.Version++
+
+	s.memberships[membership.ID] = clone(membership)
+	s.invitations[inv.ID] = clone(inv)
+	return nil
+}
+
+// GetMembership retrieves a user's membership in an organization
+func (s *MemoryStore) GetMembership(ctx context.Context, orgID, userID string) (*models.Membership, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	membership, ok := s.memberships[models.MembershipID(orgID, userID)]
+	if !ok {
+		return nil, fmt.Errorf("failed to get membership: %s not found", userID)
+	}
+	return clone(membership), nil
+}
+
+// ListMemberships lists the memberships in an organization, one page at a time
+func (s *MemoryStore) ListMemberships(ctx context.Context, orgID string, opts ListOptions) ([]*models.Membership, string, error) {
+	q, err := membershipSort.resolve(opts)
+	if err != nil {
+		return nil, "", err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var memberships []*models.Membership
+	for _, membership := range s.memberships {
+		if membership.OrganizationID == orgID {
+			memberships = append(memberships, clone(membership))
+		}
+	}
+
+	memberships, next := paginate(q, memberships, func(m *models.Membership) string { return m.ID })
+	return memberships, next, nil
+}
+
+// ListUserMemberships lists a user's memberships in all organizations
+func (s *MemoryStore) ListUserMemberships(ctx context.Context, userID string) ([]*models.Membership, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var memberships []*models.Membership
+	for _, membership := range s.memberships {
+		if membership.UserID == userID {
+			memberships = append(memberships, clone(membership))
+		}
+	}
+	sort.Slice(memberships, func(i, j int) bool { return memberships[i].CreatedAt.Before(memberships[j].CreatedAt) })
+	return memberships, nil
+}
+
+// UpdateMembership saves changes to a membership
+func (s *MemoryStore) UpdateMembership(ctx context.Context, membership *models.Membership) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.memberships[membership.ID]; !ok {
+		return fmt.Errorf("failed to update membership: %s not found", membership.UserID)
+	}
+	membership.UpdatedAt = time.Now()
+	s.memberships[membership.ID] = clone(membership)
+	return nil
+}
+
+// DeleteMembership removes a user's membership in an organization and frees
+// its seat
+func (s *MemoryStore) DeleteMembership(ctx context.Context, orgID, userID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id := models.MembershipID(orgID, userID)
+	if _, ok := s.memberships[id]; !ok {
+		return fmt.Errorf("failed to delete membership: %s not found", userID)
+	}
+	delete(s.memberships, id)
+
+	if org, ok := s.orgs[orgID]; ok {
+		org.ActiveUserCount--
+		org.UpdatedAt = time.Now()
+		org.Version++
+	}
+	return nil
+}
+
+// Custom role methods
+
+// CreateRole creates a new custom role
+func (s *MemoryStore) CreateRole(ctx context.Context, role *models.Role) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	role.ID = uuid.New().String()
+	role.CreatedAt = time.Now()
+	role.UpdatedAt = role.CreatedAt
+	role.Version = 1
+
+	if s.roles[role.OrganizationID] == nil {
+		s.roles[role.OrganizationID] = make(map[string]*models.Role)
+	}
+	s.roles[role.OrganizationID][role.ID] = cloneRole(role)
+	return nil
+}
+
+// GetRole retrieves a custom role by ID
+func (s *MemoryStore) GetRole(ctx context.Context, orgID, roleID string) (*models.Role, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	role, ok := s.roles[orgID][roleID]
+	if !ok {
+		return nil, fmt.Errorf("failed to get role: %s not found", roleID)
+	}
+	return cloneRole(role), nil
+}
+
+// ListRoles lists an organization's custom roles, one page at a time
+func (s *MemoryStore) ListRoles(ctx context.Context, orgID string, opts ListOptions) ([]*models.Role, string, error) {
+	q, err := roleSort.resolve(opts)
+	if err != nil {
+		return nil, "", err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var roles []*models.Role
+	for _, role := range s.roles[orgID] {
+		roles = append(roles, cloneRole(role))
+	}
+
+	roles, next := paginate(q, roles, func(r *models.Role) string { return r.ID })
+	return roles, next, nil
+}
+
+// UpdateRole updates a custom role
+func (s *MemoryStore) UpdateRole(ctx context.Context, role *models.Role) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.roles[role.OrganizationID][role.ID]
+	if !ok {
+		return fmt.Errorf("failed to update role: %s not found", role.ID)
+	}
+	if err := checkVersion(stored.Version, role.Version); err != nil {
+		return fmt.Errorf("failed to update role: %w", err)
+	}
+
+	role.UpdatedAt = time.Now()
+	role.Version++
+	s.roles[role.OrganizationID][role.ID] = cloneRole(role)
+	return nil
+}
+
+// DeleteRole deletes a custom role, failing with ErrRoleInUse while any user
+// or pending invitation is assigned to it
+func (s *MemoryStore) DeleteRole(ctx context.Context, orgID, roleID string, version int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.roles[orgID][roleID]
+	if !ok {
+		return fmt.Errorf("failed to get role: %s not found", roleID)
+	}
+	if err := checkVersion(stored.Version, version); err != nil {
+		return fmt.Errorf("failed to delete role: %w", err)
+	}
+
+	assigned := stored.UserRole()
+	for _, user := range s.users {
+		if user.OrganizationID == orgID && user.Role == assigned {
+			return fmt.Errorf("failed to delete role: %w", ErrRoleInUse)
+		}
+	}
+	for _, inv := range s.invitations {
+		if inv.OrganizationID == orgID && inv.Role == assigned && inv.Status == "pending" {
+			return fmt.Errorf("failed to delete role: %w", ErrRoleInUse)
+		}
+	}
+	for _, membership := range s.memberships {
+		if membership.OrganizationID == orgID && membership.Role == assigned {
+			return fmt.Errorf("failed to delete role: %w", ErrRoleInUse)
+		}
+	}
+
+	delete(s.roles[orgID], roleID)
+	return nil
+}
+
+// API key methods
+
+// CreateAPIKey stores a new API key
+func (s *MemoryStore) CreateAPIKey(ctx context.Context, key *models.APIKey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key.ID = uuid.New().String()
+	key.CreatedAt = time.Now()
+
+	s.apiKeys[key.ID] = cloneAPIKey(key)
+	return nil
+}
+
+// GetAPIKey retrieves an API key by ID
+func (s *MemoryStore) GetAPIKey(ctx context.Context, orgID, keyID string) (*models.APIKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	key, ok := s.apiKeys[keyID]
+	if !ok || key.OrganizationID != orgID {
+		return nil, fmt.Errorf("failed to get API key: %s not found", keyID)
+	}
+	return cloneAPIKey(key), nil
+}
+
+// GetAPIKeyByHash retrieves an API key by the hash of the key
+func (s *MemoryStore) GetAPIKeyByHash(ctx context.Context, keyHash string) (*models.APIKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, key := range s.apiKeys {
+		if key.KeyHash == keyHash {
+			return cloneAPIKey(key), nil
+		}
+	}
+	return nil, fmt.Errorf("API key not found")
+}
+
+// ListAPIKeys lists an organization's API keys, one page at a time
+func (s *MemoryStore) ListAPIKeys(ctx context.Context, orgID string, opts ListOptions) ([]*models.APIKey, string, error) {
+	q, err := apiKeySort.resolve(opts)
+	if err != nil {
+		return nil, "", err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var keys []*models.APIKey
+	for _, key := range s.apiKeys {
+		if key.OrganizationID == orgID {
+			keys = append(keys, cloneAPIKey(key))
+		}
+	}
+
+	keys, next := paginate(q, keys, func(k *models.APIKey) string { return k.ID })
+	return keys, next, nil
+}
+
+// UpdateAPIKey saves changes to an API key
+func (s *MemoryStore) UpdateAPIKey(ctx context.Context, key *models.APIKey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.apiKeys[key.ID]; !ok {
+		return fmt.Errorf("failed to update API key: %s not found", key.ID)
+	}
+
+	s.apiKeys[key.ID] = cloneAPIKey(key)
+	return nil
+}
+
+// TouchAPIKey records when an API key was last used
+func (s *MemoryStore) TouchAPIKey(ctx context.Context, keyID string, usedAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key, ok := s.apiKeys[keyID]
+	if !ok {
+		return fmt.Errorf("failed to update API key: %s not found", keyID)
+	}
+	key.LastUsedAt = &usedAt
+	return nil
+}
+
+// Auditor grant methods
+
+// CreateAuditorGrant stores a new auditor grant
+func (s *MemoryStore) CreateAuditorGrant(ctx context.Context, grant *models.AuditorGrant) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	grant.ID = uuid.New().String()
+	grant.CreatedAt = time.Now()
+
+	s.auditorGrants[grant.ID] = cloneAuditorGrant(grant)
+	return nil
+}
+
+// GetAuditorGrant retrieves an auditor grant by ID
+func (s *MemoryStore) GetAuditorGrant(ctx context.Context, orgID, grantID string) (*models.AuditorGrant, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	grant, ok := s.auditorGrants[grantID]
+	if !ok || grant.OrganizationID != orgID {
+		return nil, fmt.Errorf("failed to get auditor grant: %s not found", grantID)
+	}
+	return cloneAuditorGrant(grant), nil
+}
+
+// GetAuditorGrantByHash retrieves an auditor grant by the hash of its token
+func (s *MemoryStore) GetAuditorGrantByHash(ctx context.Context, tokenHash string) (*models.AuditorGrant, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, grant := range s.auditorGrants {
+		if grant.TokenHash == tokenHash {
+			return cloneAuditorGrant(grant), nil
+		}
+	}
+	return nil, fmt.Errorf("auditor grant not found")
+}
+
+// ListAuditorGrants lists an organization's auditor grants, one page at a time
+func (s *MemoryStore) ListAuditorGrants(ctx context.Context, orgID string, opts ListOptions) ([]*models.AuditorGrant, string, error) {
+	q, err := auditorGrantSort.resolve(opts)
+	if err != nil {
+		return nil, "", err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var grants []*models.AuditorGrant
+	for _, grant := range s.auditorGrants {
+		if grant.OrganizationID == orgID {
+			grants = append(grants, cloneAuditorGrant(grant))
+		}
+	}
+
+	grants, next := paginate(q, grants, func(g *models.AuditorGrant) string { return g.ID })
+	return grants, next, nil
+}
+
+// UpdateAuditorGrant saves changes to an auditor grant
+func (s *MemoryStore) UpdateAuditorGrant(ctx context.Context, grant *models.AuditorGrant) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.auditorGrants[grant.ID]; !ok {
+		return fmt.Errorf("failed to update auditor grant: %s not found", grant.ID)
+	}
+
+	s.auditorGrants[grant.ID] = cloneAuditorGrant(grant)
+	return nil
+}
+
+// TouchAuditorGrant records when an auditor grant was last used
+func (s *MemoryStore) TouchAuditorGrant(ctx context.Context, grantID string, accessedAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	grant, ok := s.auditorGrants[grantID]
+	if !ok {
+		return fmt.Errorf("failed to update auditor grant: %s not found", grantID)
+	}
+	grant.LastAccessedAt = &accessedAt
+	return nil
+}
+
+// Single sign-on methods
+
+// GetSSOConfig retrieves an organization's single sign-on configuration, or
+// nil if it has none
+func (s *MemoryStore) GetSSOConfig(ctx context.Context, orgID string) (*models.SSOConfig, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	config, ok := s.ssoConfigs[orgID]
+	if !ok {
+		return nil, nil
+	}
+	return cloneSSOConfig(config), nil
+}
+
+// SaveSSOConfig creates or replaces an organization's single sign-on
+// configuration, failing with ErrVersionConflict if it changed since config
+// was read. A new configuration has version 0.
+func (s *MemoryStore) SaveSSOConfig(ctx context.Context, config *models.SSOConfig) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var stored int64
+	if existing, ok := s.ssoConfigs[config.OrganizationID]; ok {
+		stored = existing.Version
+	}
+	if err := checkVersion(stored, config.Version); err != nil {
+		return fmt.Errorf("failed to save SSO config: %w", err)
+	}
+
+	config.UpdatedAt = time.Now()
+	config.Version++
+	s.ssoConfigs[config.OrganizationID] = cloneSSOConfig(config)
+	return nil
+}
+
+// CreateDomain stores a new pending domain claim, failing with
+// ErrDomainClaimed if the organization already claimed the name or another
+// organization verified it
+func (s *MemoryStore) CreateDomain(ctx context.Context, domain *models.Domain) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	domain.ID = uuid.New().String()
+	domain.CreatedAt = time.Now()
+	domain.Status = "pending"
+
+	if err := checkDomainClaim(domain, s.domainsNamed(domain.Name)); err != nil {
+		return fmt.Errorf("failed to create domain: %w", err)
+	}
+
+	s.domains[domain.ID] = clone(domain)
+	return nil
+}
+
+// GetDomain retrieves a domain claim by ID
+func (s *MemoryStore) GetDomain(ctx context.Context, orgID, domainID string) (*models.Domain, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	domain, ok := s.domains[domainID]
+	if !ok || domain.OrganizationID != orgID {
+		return nil, fmt.Errorf("failed to get domain: %s not found", domainID)
+	}
+	return clone(domain), nil
+}
+
+// GetVerifiedDomain retrieves the verified claim on a domain name
+func (s *MemoryStore) GetVerifiedDomain(ctx context.Context, name string) (*models.Domain, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, domain := range s.domainsNamed(name) {
+		if domain.Status == "verified" {
+			return clone(domain), nil
+		}
+	}
+	return nil, fmt.Errorf("domain not found")
+}
+
+// ListDomains lists an organization's domain claims, one page at a time
+func (s *MemoryStore) ListDomains(ctx context.Context, orgID string, opts ListOptions) ([]*models.Domain, string, error) {
+	q, err := domainSort.resolve(opts)
+	if err != nil {
+		return nil, "", err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var domains []*models.Domain
+	for _, domain := range s.domains {
+		if domain.OrganizationID == orgID {
+			domains = append(domains, clone(domain))
+		}
+	}
+
+	domains, next := paginate(q, domains, func(d *models.Domain) string { return d.ID })
+	return domains, next, nil
+}
+
+// VerifyDomain marks a domain claim verified, failing with ErrDomainClaimed
+// if another organization verified the name first
+func (s *MemoryStore) VerifyDomain(ctx context.Context, domain *models.Domain) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.domains[domain.ID]; !ok {
+		return fmt.Errorf("failed to verify domain: %s not found", domain.ID)
+	}
+	if err := checkDomainClaim(domain, s.domainsNamed(domain.Name)); err != nil {
+		return fmt.Errorf("failed to verify domain: %w", err)
+	}
+
+	now := time.Now()
+	domain.Status = "verified"
+	domain.VerifiedAt = &now
+	s.domains[domain.ID] = clone(domain)
+	return nil
+}
+
+// DeleteDomain removes a domain claim
+func (s *MemoryStore) DeleteDomain(ctx context.Context, orgID, domainID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	domain, ok := s.domains[domainID]
+	if !ok || domain.OrganizationID != orgID {
+		return fmt.Errorf("failed to delete domain: %s not found", domainID)
+	}
+
+	delete(s.domains, domainID)
+	return nil
+}
+
+// ClaimSAMLAssertion records an assertion until it expires, forgetting
+// expired ones
+func (s *MemoryStore) ClaimSAMLAssertion(ctx context.Context, issuer, assertionID string, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for key, expiry := range s.samlAssertions {
+		if !now.Before(expiry) {
+			delete(s.samlAssertions, key)
+		}
+	}
+
+	key := issuer + "\n" + assertionID
+	if _, ok := s.samlAssertions[key]; ok {
+		return ErrAssertionReplayed
+	}
+	s.samlAssertions[key] = expiresAt
+	return nil
+}
+
+// domainsNamed returns the stored claims on a domain name. Callers must
+// hold s.mu.
+func (s *MemoryStore) domainsNamed(name string) []*models.Domain {
+	var domains []*models.Domain
+	for _, domain := range s.domains {
+		if strings.EqualFold(domain.Name, name) {
+			domains = append(domains, domain)
+		}
+	}
+	return domains
+}
+
+// Session methods
+
+// CreateSession stores a new session
+func (s *MemoryStore) CreateSession(ctx context.Context, session *models.Session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session.ID = uuid.New().String()
+	session.CreatedAt = time.Now()
+
+	s.sessions[session.ID] = clone(session)
+	return nil
+}
+
+// GetSession retrieves a session in an organization by ID
+func (s *MemoryStore) GetSession(ctx context.Context, orgID, sessionID string) (*models.Session, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	session, ok := s.sessions[sessionID]
+	if !ok || session.OrganizationID != orgID {
+		return nil, fmt.Errorf("failed to get session: %s not found", sessionID)
+	}
+	return clone(session), nil
+}
+
+// GetSessionByHash retrieves a session by the hash of its token
+func (s *MemoryStore) GetSessionByHash(ctx context.Context, tokenHash string) (*models.Session, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, session := range s.sessions {
+		if session.TokenHash == tokenHash {
+			return clone(session), nil
+		}
+	}
+	return nil, fmt.Errorf("session not found")
+}
+
+// ListSessions lists a user's sessions in an organization, one page at a time
+func (s *MemoryStore) ListSessions(ctx context.Context, orgID, userID string, opts ListOptions) ([]*models.Session, string, error) {
+	q, err := sessionSort.resolve(opts)
+	if err != nil {
+		return nil, "", err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var sessions []*models.Session
+	for _, session := range s.sessions {
+		if session.OrganizationID == orgID && session.UserID == userID {
+			sessions = append(sessions, clone(session))
+		}
+	}
+
+	sessions, next := paginate(q, sessions, func(s *models.Session) string { return s.ID })
+	return sessions, next, nil
+}
+
+// UpdateSession saves changes to a session
+func (s *MemoryStore) UpdateSession(ctx context.Context, session *models.Session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.sessions[session.ID]; !ok {
+		return fmt.Errorf("failed to update session: %s not found", session.ID)
+	}
+
+	s.sessions[session.ID] = clone(session)
+	return nil
+}
+
+// Requirement methods
+
+// CreateRequirement creates a new requirement for an organization
+func (s *MemoryStore) CreateRequirement(ctx context.Context, req *models.Requirement) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	req.ID = uuid.New().String()
+	req.ActivatedAt = time.Now()
+	req.UpdatedAt = time.Now()
+	req.Status = models.StatusNotStarted
+	req.EvidenceCount = 0
+	req.IsActive = true
+	req.Version = 1
+
+	if s.requirements[req.OrganizationID] == nil {
+		s.requirements[req.OrganizationID] = make(map[string]*models.Requirement)
+	}
+	s.requirements[req.OrganizationID][req.ID] = cloneRequirement(req)
+	return nil
+}
+
+// GetRequirement retrieves a requirement by ID
+func (s *MemoryStore) GetRequirement(ctx context.Context, orgID, reqID string) (*models.Requirement, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	req, ok := s.requirements[orgID][reqID]
+	if !ok {
+		return nil, fmt.Errorf("failed to get requirement: %s not found", reqID)
+	}
+	return cloneRequirement(req), nil
+}
+
+// ListRequirements lists active requirements for an organization, one page at a time
+func (s *MemoryStore) ListRequirements(ctx context.Context, orgID string, opts ListOptions) ([]*models.Requirement, string, error) {
+	q, err := requirementSort.resolve(opts)
+	if err != nil {
+		return nil, "", err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var requirements []*models.Requirement
+	for _, req := range s.requirements[orgID] {
+		if req.IsActive {
+			requirements = append(requirements, cloneRequirement(req))
+		}
+	}
+
+	requirements, next := paginate(q, requirements, func(r *models.Requirement) string { return r.ID })
+	return requirements, next, nil
+}
+
+// UpdateRequirement updates a requirement, failing with ErrVersionConflict if
+// it changed since req was read
+func (s *MemoryStore) UpdateRequirement(ctx context.Context, req *models.Requirement) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if stored, ok := s.requirements[req.OrganizationID][req.ID]; ok {
+		if err := checkVersion(stored.Version, req.Version); err != nil {
+			return fmt.Errorf("failed to update requirement: %w", err)
+		}
+	}
+
+	req.UpdatedAt = time.Now()
+	req.Version++
+	if s.requirements[req.OrganizationID] == nil {
+		s.requirements[req.OrganizationID] = make(map[string]*models.Requirement)
+	}
+	s.requirements[req.OrganizationID][req.ID] = cloneRequirement(req)
+	return nil
+}
+
+// Evidence methods
+
+// CreateEvidence creates a new evidence item and updates the evidence counts
+// of its requirements atomically
+func (s *MemoryStore) CreateEvidence(ctx context.Context, evidence *models.Evidence) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if evidence.ID == "" {
+		evidence.ID = uuid.New().String()
+	}
+	if _, exists := s.evidence[evidence.OrganizationID][evidence.ID]; exists {
+		return fmt.Errorf("failed to create evidence: %s already exists", evidence.ID)
+	}
+	evidence.CreatedAt = time.Now()
+	evidence.UpdatedAt = time.Now()
+	evidence.Version = 1
+
+	if err := s.applyEvidenceCountDeltas(evidence.OrganizationID, evidenceCountDeltas(nil, evidence)); err != nil {
+		return fmt.Errorf("failed to create evidence: %w", err)
+	}
+
+	if s.evidence[evidence.OrganizationID] == nil {
+		s.evidence[evidence.OrganizationID] = make(map[string]*models.Evidence)
+	}
+	s.evidence[evidence.OrganizationID][evidence.ID] = cloneEvidence(evidence)
+	return nil
+}
+
+// GetEvidence retrieves an evidence item by ID
+func (s *MemoryStore) GetEvidence(ctx context.Context, orgID, evidenceID string) (*models.Evidence, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	evidence, ok := s.evidence[orgID][evidenceID]
+	if !ok {
+		return nil, fmt.Errorf("failed to get evidence: %s not found", evidenceID)
+	}
+	return cloneEvidence(evidence), nil
+}
+
+// ListEvidence lists active evidence for an organization, one page at a time
+func (s *MemoryStore) ListEvidence(ctx context.Context, orgID string, filters map[string]interface{}, opts ListOptions) ([]*models.Evidence, string, error) {
+	q, err := evidenceSort.resolve(opts)
+	if err != nil {
+		return nil, "", err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	// The requirement filter matches an element of RequirementIDs rather
+	// than a field, so it is applied separately
+	requirementID, byRequirement := filters[EvidenceRequirementFilter]
+	if byRequirement {
+		filters = withoutKey(filters, EvidenceRequirementFilter)
+	}
+
+	status := "active"
+	if value, ok := filters[EvidenceStatusFilter]; ok {
+		status = fmt.Sprint(value)
+		filters = withoutKey(filters, EvidenceStatusFilter)
+	}
+
+	var evidenceList []*models.Evidence
+	for _, evidence := range s.evidence[orgID] {
+		if evidence.Status != status || !matchesFilters(evidence, filters) {
+			continue
+		}
+		if byRequirement && !containsID(evidence.RequirementIDs, fmt.Sprint(requirementID)) {
+			continue
+		}
+		evidenceList = append(evidenceList, cloneEvidence(evidence))
+	}
+
+	evidenceList, next := paginate(q, evidenceList, func(e *models.Evidence) string { return e.ID })
+	return evidenceList, next, nil
+}
+
+// UpdateEvidence updates an evidence item, failing with ErrVersionConflict if
+// it changed since it was read. Evidence counts are adjusted for any
+// requirements whose association with active evidence changed.
+func (s *MemoryStore) UpdateEvidence(ctx context.Context, evidence *models.Evidence) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	before := s.evidence[evidence.OrganizationID][evidence.ID]
+	if before != nil {
+		if err := checkVersion(before.Version, evidence.Version); err != nil {
+			return fmt.Errorf("failed to update evidence: %w", err)
+		}
+	}
+	if err := s.applyEvidenceCountDeltas(evidence.OrganizationID, evidenceCountDeltas(before, evidence)); err != nil {
+		return fmt.Errorf("failed to update evidence: %w", err)
+	}
+
+	evidence.UpdatedAt = time.Now()
+	evidence.Version++
+
+	if s.evidence[evidence.OrganizationID] == nil {
+		s.evidence[evidence.OrganizationID] = make(map[string]*models.Evidence)
+	}
+	s.evidence[evidence.OrganizationID][evidence.ID] = cloneEvidence(evidence)
+	return nil
+}
+
+// DeleteEvidence soft deletes an evidence item and decrements the evidence
+// counts of its requirements. It fails with ErrVersionConflict unless the
+// stored version equals version.
+func (s *MemoryStore) DeleteEvidence(ctx context.Context, orgID, evidenceID string, version int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	before, ok := s.evidence[orgID][evidenceID]
+	if !ok {
+		return fmt.Errorf("failed to get evidence: %s not found", evidenceID)
+	}
+	if err := checkVersion(before.Version, version); err != nil {
+		return fmt.Errorf("failed to delete evidence: %w", err)
+	}
+
+	after := cloneEvidence(before)
+	after.Status = "deleted"
+	after.UpdatedAt = time.Now()
+	after.Version++
+
+	if err := s.applyEvidenceCountDeltas(orgID, evidenceCountDeltas(before, after)); err != nil {
+		return fmt.Errorf("failed to delete evidence: %w", err)
+	}
+
+	s.evidence[orgID][evidenceID] = after
+	return nil
+}
+
+// CreateEvidenceVersion records a pending upload of a new evidence file
+func (s *MemoryStore) CreateEvidenceVersion(ctx context.Context, version *models.EvidenceVersion) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if version.ID == "" {
+		version.ID = uuid.New().String()
+	}
+	version.CreatedAt = time.Now()
+
+	if s.evidenceVersions[version.OrganizationID] == nil {
+		s.evidenceVersions[version.OrganizationID] = make(map[string]*models.EvidenceVersion)
+	}
+	s.evidenceVersions[version.OrganizationID][version.ID] = clone(version)
+	return nil
+}
+
+// GetEvidenceVersion retrieves a version of an evidence item by ID
+func (s *MemoryStore) GetEvidenceVersion(ctx context.Context, orgID, evidenceID, versionID string) (*models.EvidenceVersion, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	version, ok := s.evidenceVersions[orgID][versionID]
+	if !ok || version.EvidenceID != evidenceID {
+		return nil, fmt.Errorf("failed to get evidence version: %s not found", versionID)
+	}
+	return clone(version), nil
+}
+
+// ListEvidenceVersions lists the published versions of an evidence item by number
+func (s *MemoryStore) ListEvidenceVersions(ctx context.Context, orgID, evidenceID string) ([]*models.EvidenceVersion, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	evidence, ok := s.evidence[orgID][evidenceID]
+	if !ok {
+		return nil, fmt.Errorf("failed to get evidence: %s not found", evidenceID)
+	}
+	if legacy := legacyEvidenceVersion(evidence); legacy != nil {
+		return []*models.EvidenceVersion{legacy}, nil
+	}
+
+	var versions []*models.EvidenceVersion
+	for _, version := range s.evidenceVersions[orgID] {
+		if version.EvidenceID == evidenceID && version.Status == "active" {
+			versions = append(versions, clone(version))
+		}
+	}
+	sortEvidenceVersions(versions)
+	return versions, nil
+}
+
+// PublishEvidenceVersion makes version the current file of evidence, failing
+// with ErrVersionConflict if the evidence changed since it was read
+func (s *MemoryStore) PublishEvidenceVersion(ctx context.Context, evidence *models.Evidence, version *models.EvidenceVersion) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	before, ok := s.evidence[evidence.OrganizationID][evidence.ID]
+	if !ok {
+		return fmt.Errorf("failed to publish evidence version: evidence %s not found", evidence.ID)
+	}
+	if err := checkVersion(before.Version, evidence.Version); err != nil {
+		return fmt.Errorf("failed to publish evidence version: %w", err)
+	}
+
+	writes := publishEvidenceVersion(before, evidence, version)
+	if err := s.applyEvidenceCountDeltas(evidence.OrganizationID, evidenceCountDeltas(before, evidence)); err != nil {
+		return fmt.Errorf("failed to publish evidence version: %w", err)
+	}
+
+	evidence.UpdatedAt = time.Now()
+	evidence.Version++
+	s.evidence[evidence.OrganizationID][evidence.ID] = cloneEvidence(evidence)
+
+	if s.evidenceVersions[evidence.OrganizationID] == nil {
+		s.evidenceVersions[evidence.OrganizationID] = make(map[string]*models.EvidenceVersion)
+	}
+	for _, v := range writes {
+		if v.CreatedAt.IsZero() {
+			v.CreatedAt = time.Now()
+		}
+		s.evidenceVersions[evidence.OrganizationID][v.ID] = clone(v)
+	}
+	return nil
+}
+
+// ReconcileEvidenceCounts recomputes every requirement's evidence count from
+// the organization's active evidence and corrects any drift
+func (s *MemoryStore) ReconcileEvidenceCounts(ctx context.Context, orgID string) ([]EvidenceCountDrift, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	actual := make(map[string]int)
+	for _, evidence := range s.evidence[orgID] {
+		for reqID := range countedRequirementIDs(evidence) {
+			actual[reqID]++
+		}
+	}
+
+	var drift []EvidenceCountDrift
+	for reqID, req := range s.requirements[orgID] {
+		if req.EvidenceCount == actual[reqID] {
+			continue
+		}
+		drift = append(drift, EvidenceCountDrift{
+			RequirementID: reqID,
+			Title:         req.Title,
+			StoredCount:   req.EvidenceCount,
+			ActualCount:   actual[reqID],
+		})
+		req.EvidenceCount = actual[reqID]
+		req.UpdatedAt = time.Now()
+		req.Version++
+	}
+
+	sort.Slice(drift, func(i, j int) bool { return drift[i].RequirementID < drift[j].RequirementID })
+	return drift, nil
+}
+
+// Audit log methods
+
+// CreateAuditLog creates a new audit log entry
+func (s *MemoryStore) CreateAuditLog(ctx context.Context, log *models.AuditLog) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	log.ID = uuid.New().String()
+	log.Timestamp = time.Now()
+
+	head := s.auditChainHead(log.OrganizationID)
+	log.Chain(head.Sequence, head.Hash)
+
+	s.auditLogs[log.OrganizationID] = append(s.auditLogs[log.OrganizationID], cloneAuditLog(log))
+	return nil
+}
+
+// GetAuditChainHead returns the last link of the organization's audit chain
+func (s *MemoryStore) GetAuditChainHead(ctx context.Context, orgID string) (*AuditChainHead, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	head := s.auditChainHead(orgID)
+	return &head, nil
+}
+
+// ListAuditLogsBySequence returns up to limit chained audit log entries with
+// a sequence greater than afterSequence, in sequence order
+func (s *MemoryStore) ListAuditLogsBySequence(ctx context.Context, orgID string, afterSequence int64, limit int) ([]*models.AuditLog, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var logs []*models.AuditLog
+	for _, entry := range s.auditLogs[orgID] {
+		if entry.Sequence > afterSequence {
+			logs = append(logs, cloneAuditLog(entry))
+		}
+	}
+
+	sort.SliceStable(logs, func(i, j int) bool { return logs[i].Sequence < logs[j].Sequence })
+	if limit > 0 && len(logs) > limit {
+		logs = logs[:limit]
+	}
+	return logs, nil
+}
+
+// GetAuditForwardCheckpoint returns the sequence of the last audit log entry
+// delivered to the named sink, or 0 if nothing has been delivered yet
+func (s *MemoryStore) GetAuditForwardCheckpoint(ctx context.Context, orgID, sink string) (int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.checkpoints[orgID][sink], nil
+}
+
+// SaveAuditForwardCheckpoint records that entries up to sequence have been
+// delivered to the named sink
+func (s *MemoryStore) SaveAuditForwardCheckpoint(ctx context.Context, orgID, sink string, sequence int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.checkpoints[orgID] == nil {
+		s.checkpoints[orgID] = make(map[string]int64)
+	}
+	s.checkpoints[orgID][sink] = sequence
+	return nil
+}
+
+// ListAuditLogs lists audit logs for an organization with optional filters, one page at a time
+func (s *MemoryStore) ListAuditLogs(ctx context.Context, orgID string, filter AuditLogFilter, opts ListOptions) ([]*models.AuditLog, string, error) {
+	q, err := auditLogSort.resolve(opts)
+	if err != nil {
+		return nil, "", err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var logs []*models.AuditLog
+	for _, entry := range s.auditLogs[orgID] {
+		if filter.matches(entry) {
+			logs = append(logs, cloneAuditLog(entry))
+		}
+	}
+
+	logs, next := paginate(q, logs, func(l *models.AuditLog) string { return l.ID })
+	return logs, next, nil
+}
+
+// Report methods
+
+// CreateReport creates a new report
+func (s *MemoryStore) CreateReport(ctx context.Context, report *models.Report) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	report.ID = uuid.New().String()
+	report.CreatedAt = time.Now()
+
+	if s.reports[report.OrganizationID] == nil {
+		s.reports[report.OrganizationID] = make(map[string]*models.Report)
+	}
+	s.reports[report.OrganizationID][report.ID] = cloneReport(report)
+	return nil
+}
+
+// GetReport retrieves a report by ID
+func (s *MemoryStore) GetReport(ctx context.Context, orgID, reportID string) (*models.Report, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	report, ok := s.reports[orgID][reportID]
+	if !ok {
+		return nil, fmt.Errorf("failed to get report: %s not found", reportID)
+	}
+	return cloneReport(report), nil
+}
+
+// UpdateReport updates a report
+func (s *MemoryStore) UpdateReport(ctx context.Context, report *models.Report) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.reports[report.OrganizationID] == nil {
+		s.reports[report.OrganizationID] = make(map[string]*models.Report)
+	}
+	s.reports[report.OrganizationID][report.ID] = cloneReport(report)
+	return nil
+}
+
+// Requirement template methods
+
+// AddRequirementTemplate seeds a requirement template. Templates are managed
+// out of band in Firestore (see scripts/seed-requirements.sh), so this is only
+// available on the in-memory store.
+func (s *MemoryStore) AddRequirementTemplate(template *models.RequirementTemplate) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if template.ID == "" {
+		template.ID = uuid.New().String()
+	}
+	s.templates[template.ID] = clone(template)
+}
+
+// GetRequirementTemplate retrieves a requirement template by ID
+func (s *MemoryStore) GetRequirementTemplate(ctx context.Context, templateID string) (*models.RequirementTemplate, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	template, ok := s.templates[templateID]
+	if !ok {
+		return nil, fmt.Errorf("failed to get requirement template: %s not found", templateID)
+	}
+	return clone(template), nil
+}
+
+// ListRequirementTemplates lists requirement templates by framework
+func (s *MemoryStore) ListRequirementTemplates(ctx context.Context, framework models.RegulatoryFramework) ([]*models.RequirementTemplate, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var templates []*models.RequirementTemplate
+	for _, template := range s.templates {
+		if template.RegulatoryFramework == framework && template.IsActive {
+			templates = append(templates, clone(template))
+		}
+	}
+	sort.Slice(templates, func(i, j int) bool { return templates[i].ID < templates[j].ID })
+
+	return templates, nil
+}
+
+// Helper methods
+
+// applyEvidenceCountDeltas adjusts requirement evidence counts and bumps the
+// version of each changed requirement. Every requirement is checked before any
+// count changes so a missing requirement leaves all counts untouched. Callers
+// must hold s.mu.
+func (s *MemoryStore) applyEvidenceCountDeltas(orgID string, deltas map[string]int) error {
+	for reqID := range deltas {
+		if _, ok := s.requirements[orgID][reqID]; !ok {
+			return fmt.Errorf("requirement %s not found", reqID)
+		}
+	}
+	for reqID, delta := range deltas {
+		if delta == 0 {
+			continue
+		}
+		req := s.requirements[orgID][reqID]
+		req.EvidenceCount += delta
+		req.UpdatedAt = time.Now()
+		req.Version++
+	}
+	return nil
+}
+
+// auditChainHead derives the chain head from the last appended entry.
+// Callers must hold s.mu.
+func (s *MemoryStore) auditChainHead(orgID string) AuditChainHead {
+	entries := s.auditLogs[orgID]
+	if len(entries) == 0 {
+		return AuditChainHead{}
+	}
+	last := entries[len(entries)-1]
+	return AuditChainHead{Sequence: last.Sequence, Hash: last.Hash}
+}
+
+// cloneOrganization copies an organization including its baseline
+func cloneOrganization(o *models.Organization) *models.Organization {
+	c := clone(o)
+	c.BaselineTemplateIDs = append([]string(nil), o.BaselineTemplateIDs...)
+	return c
+}
+
+// cloneEvidence copies evidence including its requirement IDs so later
+// changes to the caller's slice cannot alter stored associations
+func cloneEvidence(e *models.Evidence) *models.Evidence {
+	c := clone(e)
+	c.RequirementIDs = append([]string(nil), e.RequirementIDs...)
+	c.Tags = append([]string(nil), e.Tags...)
+	c.Metadata = cloneMap(e.Metadata)
+	if e.Scan != nil {
+		c.Scan = clone(e.Scan)
+	}
+	return c
+}
+
+// cloneRequirement copies a requirement including its evidence types and due
+// dates
+func cloneRequirement(r *models.Requirement) *models.Requirement {
+	c := clone(r)
+	c.EvidenceTypes = append([]string(nil), r.EvidenceTypes...)
+	if r.NextDueDate != nil {
+		c.NextDueDate = clone(r.NextDueDate)
+	}
+	if r.LastCompletedDate != nil {
+		c.LastCompletedDate = clone(r.LastCompletedDate)
+	}
+	return c
+}
+
+// cloneAuditLog copies an audit log entry including its changes and metadata,
+// which are hashed into the audit chain and must not change once stored
+func cloneAuditLog(l *models.AuditLog) *models.AuditLog {
+	c := clone(l)
+	c.Changes = cloneMap(l.Changes)
+	c.Metadata = cloneMap(l.Metadata)
+	return c
+}
+
+// cloneReport copies a report including its requirement IDs and dates
+func cloneReport(r *models.Report) *models.Report {
+	c := clone(r)
+	c.RequirementIDs = append([]string(nil), r.RequirementIDs...)
+	if r.AsOf != nil {
+		c.AsOf = clone(r.AsOf)
+	}
+	if r.CompletedAt != nil {
+		c.CompletedAt = clone(r.CompletedAt)
+	}
+	return c
+}
+
+func cloneRole(r *models.Role) *models.Role {
+	c := clone(r)
+	c.Permissions = append([]models.Permission(nil), r.Permissions...)
+	return c
+}
+
+func cloneAPIKey(k *models.APIKey) *models.APIKey {
+	c := clone(k)
+	c.Scopes = append([]models.APIKeyScope(nil), k.Scopes...)
+	return c
+}
+
+func cloneAuditorGrant(g *models.AuditorGrant) *models.AuditorGrant {
+	c := clone(g)
+	c.RequirementIDs = append([]string(nil), g.RequirementIDs...)
+	c.ReportIDs = append([]string(nil), g.ReportIDs...)
+	return c
+}
+
+// cloneSSOConfig copies an SSO configuration including its IdP certificates
+func cloneSSOConfig(sc *models.SSOConfig) *models.SSOConfig {
+	c := clone(sc)
+	c.SAMLIdPCertificates = append([]string(nil), sc.SAMLIdPCertificates...)
+	return c
+}
+
+// clone returns a shallow copy so callers never share the stored value
+func clone[T any](v *T) *T {
+	c := *v
+	return &c
+}
+
+// cloneMap deep-copies a JSON-like map, including nested maps and slices
+func cloneMap(m map[string]interface{}) map[string]interface{} {
+	if m == nil {
+		return nil
+	}
+	c := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		c[k] = cloneValue(v)
+	}
+	return c
+}
+
+func cloneValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		return cloneMap(v)
+	case []interface{}:
+		c := make([]interface{}, len(v))
+		for i, e := range v {
+			c[i] = cloneValue(e)
+		}
+		return c
+	case []string:
+		return append([]string(nil), v...)
+	default:
+		return v
+	}
+}
+
+// containsID reports whether ids includes id
+func containsID(ids []string, id string) bool {
+	for _, v := range ids {
+		if v == id {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesFilters reports whether every filter key (a firestore field name)
+// equals the corresponding field on doc
+func matchesFilters(doc interface{}, filters map[string]interface{}) bool {
+	if len(filters) == 0 {
+		return true
+	}
+
+	v := reflect.Indirect(reflect.ValueOf(doc))
+	t := v.Type()
+
+	for key, want := range filters {
+		matched := false
+		for i := 0; i < t.NumField(); i++ {
+			name := strings.Split(t.Field(i).Tag.Get("firestore"), ",")[0]
+			if name != key {
+				continue
+			}
+			got := v.Field(i).Interface()
+			matched = reflect.DeepEqual(got, want) || fmt.Sprint(got) == fmt.Sprint(want)
+			break
+		}
+		if !matched {
+			return false
+		}
+	}
+
+	return true
+}
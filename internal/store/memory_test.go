@@ -0,0 +1,274 @@
+package store_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"compliancesync-api/internal/models"
+	"compliancesync-api/internal/store"
+	"compliancesync-api/internal/store/storetest"
+)
+
+const orgID = storetest.OrgID
+
+func TestMemoryStoreDeleteEvidenceIsSoft(t *testing.T) {
+	ctx := context.Background()
+	s := store.NewMemoryStore()
+	req := storetest.NewRequirement(t, s, "Access review")
+	evidence := storetest.NewEvidence(t, s, "active", req.ID)
+
+	if err := s.DeleteEvidence(ctx, orgID, evidence.ID, evidence.Version+1); !errors.Is(err, store.ErrVersionConflict) {
+		t.Fatalf("DeleteEvidence with a stale version: got %v, want ErrVersionConflict", err)
+	}
+	if err := s.DeleteEvidence(ctx, orgID, evidence.ID, evidence.Version); err != nil {
+		t.Fatalf("DeleteEvidence: %v", err)
+	}
+
+	got, err := s.GetEvidence(ctx, orgID, evidence.ID)
+	if err != nil {
+		t.Fatalf("GetEvidence after delete: %v", err)
+	}
+	if got.Status != "deleted" {
+		t.Errorf("status = %q, want deleted", got.Status)
+	}
+	if got.Version != evidence.Version+1 {
+		t.Errorf("version = %d, want %d", got.Version, evidence.Version+1)
+	}
+
+	active, _, err := s.ListEvidence(ctx, orgID, nil, store.ListOptions{})
+	if err != nil {
+		t.Fatalf("ListEvidence: %v", err)
+	}
+	if len(active) != 0 {
+		t.Errorf("ListEvidence returned %d items, want deleted evidence left out", len(active))
+	}
+
+	deleted, _, err := s.ListEvidence(ctx, orgID, map[string]interface{}{store.EvidenceStatusFilter: "deleted"}, store.ListOptions{})
+	if err != nil {
+		t.Fatalf("ListEvidence deleted: %v", err)
+	}
+	if len(deleted) != 1 || deleted[0].ID != evidence.ID {
+		t.Errorf("ListEvidence deleted = %v, want the deleted evidence", deleted)
+	}
+}
+
+func TestMemoryStoreListsOnlyActiveItems(t *testing.T) {
+	ctx := context.Background()
+	s := store.NewMemoryStore()
+	active := storetest.NewRequirement(t, s, "Active")
+	inactive := storetest.NewRequirement(t, s, "Inactive")
+
+	inactive.IsActive = false
+	if err := s.UpdateRequirement(ctx, inactive); err != nil {
+		t.Fatalf("UpdateRequirement: %v", err)
+	}
+
+	requirements, _, err := s.ListRequirements(ctx, orgID, store.ListOptions{})
+	if err != nil {
+		t.Fatalf("ListRequirements: %v", err)
+	}
+	if len(requirements) != 1 || requirements[0].ID != active.ID {
+		t.Errorf("ListRequirements = %v, want only %s", requirements, active.ID)
+	}
+
+	listed := storetest.NewEvidence(t, s, "active", active.ID)
+	storetest.NewEvidence(t, s, "uploading", active.ID)
+	storetest.NewEvidence(t, s, "quarantined", active.ID)
+
+	evidence, _, err := s.ListEvidence(ctx, orgID, nil, store.ListOptions{})
+	if err != nil {
+		t.Fatalf("ListEvidence: %v", err)
+	}
+	if len(evidence) != 1 || evidence[0].ID != listed.ID {
+		t.Errorf("ListEvidence = %v, want only %s", evidence, listed.ID)
+	}
+
+	byRequirement, _, err := s.ListEvidence(ctx, orgID, map[string]interface{}{store.EvidenceRequirementFilter: inactive.ID}, store.ListOptions{})
+	if err != nil {
+		t.Fatalf("ListEvidence by requirement: %v", err)
+	}
+	if len(byRequirement) != 0 {
+		t.Errorf("ListEvidence for %s returned %d items, want 0", inactive.ID, len(byRequirement))
+	}
+}
+
+func TestMemoryStoreEvidenceCountDeltas(t *testing.T) {
+	ctx := context.Background()
+	s := store.NewMemoryStore()
+	reqA := storetest.NewRequirement(t, s, "A")
+	reqB := storetest.NewRequirement(t, s, "B")
+
+	counts := func() string {
+		return fmt.Sprintf("A=%d B=%d", storetest.EvidenceCount(t, s, reqA.ID), storetest.EvidenceCount(t, s, reqB.ID))
+	}
+
+	evidence := storetest.NewEvidence(t, s, "uploading", reqA.ID)
+	if got := counts(); got != "A=0 B=0" {
+		t.Errorf("after uploading: %s, want uploads left uncounted", got)
+	}
+
+	steps := []struct {
+		name   string
+		change func(e *models.Evidence)
+		want   string
+	}{
+		{"activate", func(e *models.Evidence) { e.Status = "active" }, "A=1 B=0"},
+		{"link B", func(e *models.Evidence) { e.RequirementIDs = []string{reqA.ID, reqB.ID} }, "A=1 B=1"},
+		{"unlink A", func(e *models.Evidence) { e.RequirementIDs = []string{reqB.ID} }, "A=0 B=1"},
+		{"quarantine", func(e *models.Evidence) { e.Status = "quarantined" }, "A=0 B=0"},
+		{"release", func(e *models.Evidence) { e.Status = "active" }, "A=0 B=1"},
+	}
+	for _, step := range steps {
+		step.change(evidence)
+		if err := s.UpdateEvidence(ctx, evidence); err != nil {
+			t.Fatalf("%s: UpdateEvidence: %v", step.name, err)
+		}
+		if got := counts(); got != step.want {
+			t.Errorf("after %s: %s, want %s", step.name, got, step.want)
+		}
+	}
+
+	if err := s.DeleteEvidence(ctx, orgID, evidence.ID, evidence.Version); err != nil {
+		t.Fatalf("DeleteEvidence: %v", err)
+	}
+	if got := counts(); got != "A=0 B=0" {
+		t.Errorf("after delete: %s, want A=0 B=0", got)
+	}
+
+	// An unknown requirement fails the change without touching any count
+	other := storetest.NewEvidence(t, s, "active", reqA.ID)
+	other.RequirementIDs = []string{reqA.ID, reqB.ID, "missing"}
+	if err := s.UpdateEvidence(ctx, other); err == nil {
+		t.Fatal("UpdateEvidence with an unknown requirement succeeded")
+	}
+	if got := counts(); got != "A=1 B=0" {
+		t.Errorf("after failed update: %s, want A=1 B=0", got)
+	}
+}
+
+func TestMemoryStoreAuditLogOrdering(t *testing.T) {
+	ctx := context.Background()
+	s := store.NewMemoryStore()
+
+	for i := 1; i <= 5; i++ {
+		log := &models.AuditLog{
+			OrganizationID: orgID,
+			UserID:         "user-1",
+			Action:         models.ActionEvidenceUpdated,
+			ResourceType:   "evidence",
+			Description:    fmt.Sprintf("entry %d", i),
+			Metadata:       map[string]interface{}{"step": i},
+		}
+		if err := s.CreateAuditLog(ctx, log); err != nil {
+			t.Fatalf("CreateAuditLog: %v", err)
+		}
+	}
+	// Another organization keeps its own chain
+	if err := s.CreateAuditLog(ctx, &models.AuditLog{OrganizationID: "org-2", Description: "other"}); err != nil {
+		t.Fatalf("CreateAuditLog: %v", err)
+	}
+
+	logs, _, err := s.ListAuditLogs(ctx, orgID, store.AuditLogFilter{}, store.ListOptions{})
+	if err != nil {
+		t.Fatalf("ListAuditLogs: %v", err)
+	}
+	if len(logs) != 5 {
+		t.Fatalf("ListAuditLogs returned %d entries, want the organization's 5", len(logs))
+	}
+	for i := 1; i < len(logs); i++ {
+		if logs[i].Timestamp.After(logs[i-1].Timestamp) {
+			t.Errorf("ListAuditLogs is not newest first at entry %d", i)
+		}
+	}
+
+	first, next, err := s.ListAuditLogs(ctx, orgID, store.AuditLogFilter{}, store.ListOptions{PageSize: 3})
+	if err != nil {
+		t.Fatalf("ListAuditLogs first page: %v", err)
+	}
+	rest, last, err := s.ListAuditLogs(ctx, orgID, store.AuditLogFilter{}, store.ListOptions{PageSize: 3, PageToken: next})
+	if err != nil {
+		t.Fatalf("ListAuditLogs second page: %v", err)
+	}
+	if len(first) != 3 || len(rest) != 2 || next == "" || last != "" {
+		t.Fatalf("pages of 3 returned %d and %d entries, want 3 and 2", len(first), len(rest))
+	}
+	for i, log := range append(first, rest...) {
+		if log.ID != logs[i].ID {
+			t.Errorf("paged entry %d is %s, want %s", i, log.ID, logs[i].ID)
+		}
+	}
+
+	matched, _, err := s.ListAuditLogs(ctx, orgID, store.AuditLogFilter{Search: "ENTRY 3"}, store.ListOptions{})
+	if err != nil {
+		t.Fatalf("ListAuditLogs with search: %v", err)
+	}
+	if len(matched) != 1 || matched[0].Description != "entry 3" {
+		t.Errorf("ListAuditLogs searching for entry 3 returned %d entries", len(matched))
+	}
+
+	chain, err := s.ListAuditLogsBySequence(ctx, orgID, 0, 0)
+	if err != nil {
+		t.Fatalf("ListAuditLogsBySequence: %v", err)
+	}
+	if len(chain) != 5 {
+		t.Fatalf("ListAuditLogsBySequence returned %d entries, want 5", len(chain))
+	}
+	prevHash := ""
+	for i, log := range chain {
+		if log.Sequence != int64(i+1) {
+			t.Errorf("entry %d has sequence %d, want %d", i, log.Sequence, i+1)
+		}
+		if log.PrevHash != prevHash {
+			t.Errorf("entry %d does not link to the previous entry", log.Sequence)
+		}
+		if log.Hash != log.ComputeHash() {
+			t.Errorf("entry %d hash does not verify", log.Sequence)
+		}
+		prevHash = log.Hash
+	}
+
+	page, err := s.ListAuditLogsBySequence(ctx, orgID, 2, 2)
+	if err != nil {
+		t.Fatalf("ListAuditLogsBySequence after 2: %v", err)
+	}
+	if len(page) != 2 || page[0].Sequence != 3 || page[1].Sequence != 4 {
+		t.Errorf("ListAuditLogsBySequence(after 2, limit 2) returned the wrong entries")
+	}
+
+	// Stored entries cannot be changed through a returned copy
+	chain[0].Metadata["step"] = "tampered"
+	again, err := s.ListAuditLogsBySequence(ctx, orgID, 0, 1)
+	if err != nil {
+		t.Fatalf("ListAuditLogsBySequence: %v", err)
+	}
+	if again[0].Hash != again[0].ComputeHash() {
+		t.Error("changing a returned entry altered the stored entry")
+	}
+}
+
+func TestMemoryStoreClaimSAMLAssertion(t *testing.T) {
+	ctx := context.Background()
+	s := store.NewMemoryStore()
+	expires := time.Now().Add(time.Hour)
+
+	if err := s.ClaimSAMLAssertion(ctx, "https://idp.example.com", "_a1", expires); err != nil {
+		t.Fatalf("ClaimSAMLAssertion: %v", err)
+	}
+	if err := s.ClaimSAMLAssertion(ctx, "https://idp.example.com", "_a1", expires); !errors.Is(err, store.ErrAssertionReplayed) {
+		t.Errorf("second ClaimSAMLAssertion = %v, want ErrAssertionReplayed", err)
+	}
+	// Another identity provider's assertion IDs do not collide
+	if err := s.ClaimSAMLAssertion(ctx, "https://other.example.com", "_a1", expires); err != nil {
+		t.Errorf("ClaimSAMLAssertion for another issuer: %v", err)
+	}
+	// An expired claim is forgotten
+	if err := s.ClaimSAMLAssertion(ctx, "https://idp.example.com", "_a2", time.Now().Add(-time.Second)); err != nil {
+		t.Fatalf("ClaimSAMLAssertion: %v", err)
+	}
+	if err := s.ClaimSAMLAssertion(ctx, "https://idp.example.com", "_a2", expires); err != nil {
+		t.Errorf("ClaimSAMLAssertion after expiry: %v", err)
+	}
+}
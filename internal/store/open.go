@@ -0,0 +1,25 @@
+package store
+
+import (
+	"context"
+	"fmt"
+)
+
+// Open creates the store for the named backend: firestore, sqlite, postgres
+// or memory. projectID is used by Firestore and databaseURL by the SQL
+// backends.
+func Open(ctx context.Context, backend, projectID, databaseURL string) (Store, error) {
+	switch backend {
+	case "firestore":
+		return NewFirestoreStore(ctx, projectID)
+	case DialectSQLite, DialectPostgres:
+		if databaseURL == "" {
+			return nil, fmt.Errorf("DATABASE_URL environment variable is required for the %s backend", backend)
+		}
+		return NewSQLStore(ctx, backend, databaseURL)
+	case "memory":
+		return NewMemoryStore(), nil
+	default:
+		return nil, fmt.Errorf("unknown STORE_BACKEND %q (expected firestore, sqlite, postgres or memory)", backend)
+	}
+}
@@ -0,0 +1,282 @@
+package store
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Page size limits applied to client-supplied page sizes
+const (
+	DefaultPageSize = 50
+	MaxPageSize     = 500
+)
+
+// Errors returned for invalid list options. Handlers map these to 400 responses.
+var (
+	ErrInvalidPageToken = errors.New("invalid page token")
+	ErrInvalidSort      = errors.New("invalid sort option")
+)
+
+// ListOptions controls paging and ordering for list queries.
+// The zero value returns every match in the collection's default order.
+type ListOptions struct {
+	PageSize  int    // Maximum results to return; 0 means no limit
+	PageToken string // NextPageToken from a previous page
+	SortBy    string // Field name (firestore tag); empty uses the collection default
+	Order     string // "asc" or "desc"; empty uses the collection default
+}
+
+// sortSpec describes the sortable fields of a collection
+type sortSpec struct {
+	fields       map[string]bool // sortable field name -> true when the field is a time.Time
+	defaultField string
+	defaultOrder string
+}
+
+// Sort specifications for each paginated collection
+var (
+	evidenceSort = sortSpec{
+		fields:       map[string]bool{"evidence_date": true, "created_at": true, "title": false},
+		defaultField: "evidence_date",
+		defaultOrder: "desc",
+	}
+	requirementSort = sortSpec{
+		fields:       map[string]bool{"title": false, "activated_at": true, "updated_at": true},
+		defaultField: "title",
+		defaultOrder: "asc",
+	}
+	userSort = sortSpec{
+		fields:       map[string]bool{"email": false, "full_name": false, "created_at": true},
+		defaultField: "email",
+		defaultOrder: "asc",
+	}
+	invitationSort = sortSpec{
+		fields:       map[string]bool{"created_at": true, "expires_at": true, "email": false},
+		defaultField: "created_at",
+		defaultOrder: "desc",
+	}
+	membershipSort = sortSpec{
+		fields:       map[string]bool{"email": false, "created_at": true},
+		defaultField: "email",
+		defaultOrder: "asc",
+	}
+	roleSort = sortSpec{
+		fields:       map[string]bool{"name": false, "created_at": true},
+		defaultField: "name",
+		defaultOrder: "asc",
+	}
+	apiKeySort = sortSpec{
+		fields:       map[string]bool{"created_at": true, "name": false},
+		defaultField: "created_at",
+		defaultOrder: "desc",
+	}
+	auditorGrantSort = sortSpec{
+		fields:       map[string]bool{"created_at": true, "expires_at": true, "auditor_email": false},
+		defaultField: "created_at",
+		defaultOrder: "desc",
+	}
+	domainSort = sortSpec{
+		fields:       map[string]bool{"name": false, "created_at": true},
+		defaultField: "name",
+		defaultOrder: "asc",
+	}
+	sessionSort = sortSpec{
+		fields:       map[string]bool{"created_at": true},
+		defaultField: "created_at",
+		defaultOrder: "desc",
+	}
+	auditLogSort = sortSpec{
+		fields:       map[string]bool{"timestamp": true},
+		defaultField: "timestamp",
+		defaultOrder: "desc",
+	}
+)
+
+// pageCursor is the decoded form of a page token. It records the sort the
+// token was issued for plus the sort value and ID of the last returned item.
+type pageCursor struct {
+	SortBy string `json:"s"`
+	Order  string `json:"o"`
+	Value  string `json:"v"`
+	ID     string `json:"i"`
+}
+
+// pageQuery is a resolved ListOptions ready for a backend to execute
+type pageQuery struct {
+	field  string
+	desc   bool
+	isTime bool
+	size   int
+	cursor *pageCursor
+}
+
+// resolve validates opts against the collection's sort spec and decodes the page token
+func (spec sortSpec) resolve(opts ListOptions) (*pageQuery, error) {
+	field := opts.SortBy
+	if field == "" {
+		field = spec.defaultField
+	}
+	isTime, ok := spec.fields[field]
+	if !ok {
+		return nil, fmt.Errorf("%w: cannot sort by %q", ErrInvalidSort, field)
+	}
+
+	order := strings.ToLower(opts.Order)
+	if order == "" {
+		order = spec.defaultOrder
+		if opts.SortBy != "" && opts.SortBy != spec.defaultField {
+			order = "asc"
+		}
+	}
+	if order != "asc" && order != "desc" {
+		return nil, fmt.Errorf("%w: order must be asc or desc", ErrInvalidSort)
+	}
+
+	q := &pageQuery{field: field, desc: order == "desc", isTime: isTime, size: opts.PageSize}
+
+	if opts.PageToken != "" {
+		raw, err := base64.RawURLEncoding.DecodeString(opts.PageToken)
+		if err != nil {
+			return nil, ErrInvalidPageToken
+		}
+		var cursor pageCursor
+		if err := json.Unmarshal(raw, &cursor); err != nil {
+			return nil, ErrInvalidPageToken
+		}
+		// A token is only valid for the ordering it was issued under
+		if cursor.SortBy != field || cursor.Order != order || cursor.ID == "" {
+			return nil, ErrInvalidPageToken
+		}
+		if isTime {
+			if _, err := time.Parse(time.RFC3339Nano, cursor.Value); err != nil {
+				return nil, ErrInvalidPageToken
+			}
+		}
+		q.cursor = &cursor
+	}
+
+	return q, nil
+}
+
+// order returns the resolved sort direction as "asc" or "desc"
+func (q *pageQuery) order() string {
+	if q.desc {
+		return "desc"
+	}
+	return "asc"
+}
+
+// cursorValue returns the cursor's sort value typed for the field
+func (q *pageQuery) cursorValue() interface{} {
+	if q.isTime {
+		t, _ := time.Parse(time.RFC3339Nano, q.cursor.Value)
+		return t
+	}
+	return q.cursor.Value
+}
+
+// cursorAfter returns a cursor positioned just after last
+func (q *pageQuery) cursorAfter(last interface{}, id string) *pageCursor {
+	cursor := &pageCursor{SortBy: q.field, Order: q.order(), ID: id}
+	switch v := sortValue(last, q.field).(type) {
+	case time.Time:
+		cursor.Value = v.UTC().Format(time.RFC3339Nano)
+	case string:
+		cursor.Value = v
+	}
+	return cursor
+}
+
+// nextToken builds the token for the page following last
+func (q *pageQuery) nextToken(last interface{}, id string) string {
+	raw, _ := json.Marshal(q.cursorAfter(last, id))
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+// sortValue returns the value of the field with the given firestore tag,
+// as a time.Time or a plain string
+func sortValue(doc interface{}, field string) interface{} {
+	v := reflect.Indirect(reflect.ValueOf(doc))
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		if strings.Split(t.Field(i).Tag.Get("firestore"), ",")[0] != field {
+			continue
+		}
+		f := v.Field(i)
+		if ts, ok := f.Interface().(time.Time); ok {
+			return ts
+		}
+		if f.Kind() == reflect.String {
+			return f.String()
+		}
+		return fmt.Sprint(f.Interface())
+	}
+	return ""
+}
+
+// compareSortValues orders two values returned by sortValue
+func compareSortValues(a, b interface{}) int {
+	switch av := a.(type) {
+	case time.Time:
+		bv, _ := b.(time.Time)
+		return av.Compare(bv)
+	default:
+		as, bs := fmt.Sprint(a), fmt.Sprint(b)
+		return strings.Compare(as, bs)
+	}
+}
+
+// paginate sorts docs by the resolved field with ID as a tiebreaker, skips
+// past the cursor and returns one page plus the next page token. It is used
+// by backends that hold the full result set in memory.
+func paginate[T any](q *pageQuery, docs []*T, id func(*T) string) ([]*T, string) {
+	cmp := func(a, b *T) int {
+		c := compareSortValues(sortValue(a, q.field), sortValue(b, q.field))
+		if c == 0 {
+			c = strings.Compare(id(a), id(b))
+		}
+		if q.desc {
+			c = -c
+		}
+		return c
+	}
+
+	slices.SortStableFunc(docs, cmp)
+
+	start := 0
+	if q.cursor != nil {
+		cursorValue := q.cursorValue()
+		for start < len(docs) {
+			c := compareSortValues(sortValue(docs[start], q.field), cursorValue)
+			if c == 0 {
+				c = strings.Compare(id(docs[start]), q.cursor.ID)
+			}
+			if q.desc {
+				c = -c
+			}
+			if c > 0 {
+				break
+			}
+			start++
+		}
+	}
+
+	return trimPage(q, docs[start:], id)
+}
+
+// trimPage drops the look-ahead document fetched by a backend and returns the
+// next page token when there are more results
+func trimPage[T any](q *pageQuery, docs []*T, id func(*T) string) ([]*T, string) {
+	if q.size <= 0 || len(docs) <= q.size {
+		return docs, ""
+	}
+	docs = docs[:q.size]
+	last := docs[len(docs)-1]
+	return docs, q.nextToken(last, id(last))
+}
@@ -0,0 +1,7 @@
+package store
+
+import "errors"
+
+// ErrRoleInUse is returned when deleting a custom role that is still
+// assigned to a user or a pending invitation. Handlers map it to 409.
+var ErrRoleInUse = errors.New("role is still assigned")
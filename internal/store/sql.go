@@ -0,0 +1,2830 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"compliancesync-api/internal/models"
+	"github.com/google/uuid"
+	_ "github.com/jackc/pgx/v5/stdlib"
+	_ "modernc.org/sqlite"
+)
+
+// SQL dialects supported by SQLStore
+const (
+	DialectSQLite   = "sqlite"
+	DialectPostgres = "postgres"
+)
+
+// SQLStore implements the Store interface on top of database/sql.
+// It supports SQLite (embedded, pure Go) and Postgres.
+type SQLStore struct {
+	db      *sql.DB
+	dialect string
+}
+
+// NewSQLStore opens a SQL database and applies any pending schema migrations.
+// dialect is DialectSQLite or DialectPostgres; dsn is a file path or URI for
+// SQLite and a connection URL for Postgres.
+func NewSQLStore(ctx context.Context, dialect, dsn string) (*SQLStore, error) {
+	var driverName string
+	switch dialect {
+	case DialectSQLite:
+		driverName = "sqlite"
+		dsn = sqliteDSN(dsn)
+	case DialectPostgres:
+		driverName = "pgx"
+	default:
+		return nil, fmt.Errorf("unsupported sql dialect: %s", dialect)
+	}
+
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s database: %w", dialect, err)
+	}
+
+	if dialect == DialectSQLite {
+		// SQLite allows a single writer; serialising access also keeps
+		// ":memory:" databases on one connection
+		db.SetMaxOpenConns(1)
+	}
+
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to connect to %s database: %w", dialect, err)
+	}
+
+	s := &SQLStore{db: db, dialect: dialect}
+	if err := s.migrate(ctx); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Close closes the database connection pool
+func (s *SQLStore) Close() error {
+	return s.db.Close()
+}
+
+// Organization methods
+
+const organizationColumns = `id, name, industry, employee_count, regulatory_framework, website, address, phone,
+	subscription_tier, subscription_status, stripe_customer_id, stripe_subscription_id,
+	current_period_start, current_period_end, cancel_at_period_end, max_users, monthly_price,
+	created_at, updated_at, updated_by, active_user_count, version,
+	partner, partner_id, baseline_template_ids`
+
+// CreateOrganization creates a new organization
+func (s *SQLStore) CreateOrganization(ctx context.Context, org *models.Organization) error {
+	org.ID = uuid.New().String()
+	org.CreatedAt = time.Now()
+	org.UpdatedAt = time.Now()
+	org.ActiveUserCount = 1 // Creator is the first user
+	org.Version = 1
+
+	if err := s.saveOrganization(ctx, s.db, org); err != nil {
+		return fmt.Errorf("failed to create organization: %w", err)
+	}
+
+	return nil
+}
+
+// GetOrganization retrieves an organization by ID
+func (s *SQLStore) GetOrganization(ctx context.Context, orgID string) (*models.Organization, error) {
+	row := s.db.QueryRowContext(ctx, s.rebind(`SELECT `+organizationColumns+` FROM organizations WHERE id = ?`), orgID)
+
+	org, err := scanOrganization(row)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get organization: %w", err)
+	}
+
+	return org, nil
+}
+
+// UpdateOrganization updates an organization, failing with ErrVersionConflict
+// if it changed since org was read
+func (s *SQLStore) UpdateOrganization(ctx context.Context, org *models.Organization) error {
+	org.UpdatedAt = time.Now()
+	expected := org.Version
+
+	err := s.withTx(ctx, func(tx *sql.Tx) error {
+		if err := s.claimVersion(ctx, tx, "organizations", "id = ?", expected, org.ID); err != nil {
+			return err
+		}
+		org.Version = expected + 1
+		return s.saveOrganization(ctx, tx, org)
+	})
+	if err != nil {
+		org.Version = expected
+		return fmt.Errorf("failed to update organization: %w", err)
+	}
+
+	return nil
+}
+
+func (s *SQLStore) saveOrganization(ctx context.Context, q execer, org *models.Organization) error {
+	sub := org.Subscription
+	return s.upsert(ctx, q, "organizations", organizationColumns, "id",
+		org.ID, org.Name, string(org.Industry), string(org.EmployeeCount), string(org.RegulatoryFramework),
+		org.Website, org.Address, org.Phone,
+		string(sub.Tier), sub.Status, sub.StripeCustomerID, sub.StripeSubscriptionID,
+		utc(sub.CurrentPeriodStart), utc(sub.CurrentPeriodEnd), sub.CancelAtPeriodEnd, sub.MaxUsers, sub.MonthlyPrice,
+		utc(org.CreatedAt), utc(org.UpdatedAt), org.UpdatedBy, org.ActiveUserCount, org.Version,
+		org.Partner, org.PartnerID, toJSON(org.BaselineTemplateIDs))
+}
+
+func scanOrganization(row rowScanner) (*models.Organization, error) {
+	var org models.Organization
+	var baseline string
+	sub := &org.Subscription
+	err := row.Scan(&org.ID, &org.Name, &org.Industry, &org.EmployeeCount, &org.RegulatoryFramework,
+		&org.Website, &org.Address, &org.Phone,
+		&sub.Tier, &sub.Status, &sub.StripeCustomerID, &sub.StripeSubscriptionID,
+		&sub.CurrentPeriodStart, &sub.CurrentPeriodEnd, &sub.CancelAtPeriodEnd, &sub.MaxUsers, &sub.MonthlyPrice,
+		&org.CreatedAt, &org.UpdatedAt, &org.UpdatedBy, &org.ActiveUserCount, &org.Version,
+		&org.Partner, &org.PartnerID, &baseline)
+	if err != nil {
+		return nil, err
+	}
+	if err := fromJSON(baseline, &org.BaselineTemplateIDs); err != nil {
+		return nil, err
+	}
+	return &org, nil
+}
+
+// CreateClientOrganization creates an organization managed by a partner,
+// with no users
+func (s *SQLStore) CreateClientOrganization(ctx context.Context, partnerID string, org *models.Organization) error {
+	org.ID = uuid.New().String()
+	org.PartnerID = partnerID
+	org.CreatedAt = time.Now()
+	org.UpdatedAt = time.Now()
+	org.ActiveUserCount = 0
+	org.Version = 1
+
+	if err := s.saveOrganization(ctx, s.db, org); err != nil {
+		return fmt.Errorf("failed to create client organization: %w", err)
+	}
+
+	return nil
+}
+
+// ListClientOrganizations lists a partner's client organizations by name
+func (s *SQLStore) ListClientOrganizations(ctx context.Context, partnerID string) ([]*models.Organization, error) {
+	rows, err := s.db.QueryContext(ctx, s.rebind(`SELECT `+organizationColumns+` FROM organizations
+		WHERE partner_id = ? ORDER BY name, id`), partnerID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query client organizations: %w", err)
+	}
+	defer rows.Close()
+
+	var orgs []*models.Organization
+	for rows.Next() {
+		org, err := scanOrganization(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse organization: %w", err)
+		}
+		orgs = append(orgs, org)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate client organizations: %w", err)
+	}
+
+	return orgs, nil
+}
+
+// User methods
+
+const userColumns = `uid, email, full_name, organization_id, role, status, email_verified,
+	created_at, updated_at, last_login_at, tokens_revoked_at`
+
+// CreateUser creates a new user
+func (s *SQLStore) CreateUser(ctx context.Context, user *models.User) error {
+	user.CreatedAt = time.Now()
+	user.UpdatedAt = time.Now()
+	user.Status = "active"
+
+	if err := s.saveUser(ctx, s.db, user); err != nil {
+		return fmt.Errorf("failed to create user: %w", err)
+	}
+
+	return nil
+}
+
+// GetUser retrieves a user by UID
+func (s *SQLStore) GetUser(ctx context.Context, uid string) (*models.User, error) {
+	row := s.db.QueryRowContext(ctx, s.rebind(`SELECT `+userColumns+` FROM users WHERE uid = ?`), uid)
+
+	user, err := scanUser(row)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	return user, nil
+}
+
+// GetUserByEmail retrieves a user by email
+func (s *SQLStore) GetUserByEmail(ctx context.Context, email string) (*models.User, error) {
+	row := s.db.QueryRowContext(ctx, s.rebind(`SELECT `+userColumns+` FROM users WHERE email = ? LIMIT 1`), email)
+
+	user, err := scanUser(row)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("user not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query user: %w", err)
+	}
+
+	return user, nil
+}
+
+// UpdateUser updates a user
+func (s *SQLStore) UpdateUser(ctx context.Context, user *models.User) error {
+	user.UpdatedAt = time.Now()
+
+	if err := s.saveUser(ctx, s.db, user); err != nil {
+		return fmt.Errorf("failed to update user: %w", err)
+	}
+
+	return nil
+}
+
+// ListUsersByOrganization lists users in an organization, one page at a time
+func (s *SQLStore) ListUsersByOrganization(ctx context.Context, orgID string, opts ListOptions) ([]*models.User, string, error) {
+	q, err := userSort.resolve(opts)
+	if err != nil {
+		return nil, "", err
+	}
+
+	where, args, tail := pageClause(q, "uid")
+	query := `SELECT ` + userColumns + ` FROM users WHERE organization_id = ?` + where + tail
+	rows, err := s.db.QueryContext(ctx, s.rebind(query), append([]interface{}{orgID}, args...)...)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to query users: %w", err)
+	}
+	defer rows.Close()
+
+	var users []*models.User
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to parse user: %w", err)
+		}
+		users = append(users, user)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, "", fmt.Errorf("failed to iterate users: %w", err)
+	}
+
+	users, next := trimPage(q, users, func(u *models.User) string { return u.UID })
+	return users, next, nil
+}
+
+// UpdateLastLogin updates the last login timestamp for a user
+func (s *SQLStore) UpdateLastLogin(ctx context.Context, uid string) error {
+	now := utc(time.Now())
+	res, err := s.db.ExecContext(ctx, s.rebind(`UPDATE users SET last_login_at = ?, updated_at = ? WHERE uid = ?`), now, now, uid)
+	if err != nil {
+		return fmt.Errorf("failed to update last login: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("failed to update last login: %w", sql.ErrNoRows)
+	}
+
+	return nil
+}
+
+// ProvisionUser creates a user without an invitation and adds them to the
+// organization's active user count in one transaction
+func (s *SQLStore) ProvisionUser(ctx context.Context, user *models.User) error {
+	err := s.withTx(ctx, func(tx *sql.Tx) error {
+		now := time.Now()
+
+		org, invitations, err := s.seatUsage(ctx, tx, user.OrganizationID)
+		if err != nil {
+			return err
+		}
+		if err := checkProvisionSeat(org, invitations, user.Email, now); err != nil {
+			return err
+		}
+
+		var exists int
+		err = tx.QueryRowContext(ctx, s.rebind(`SELECT COUNT(*) FROM users WHERE uid = ?`), user.UID).Scan(&exists)
+		if err != nil {
+			return err
+		}
+		if exists > 0 {
+			return fmt.Errorf("%s already exists", user.UID)
+		}
+
+		user.CreatedAt = now
+		user.UpdatedAt = now
+		user.Status = "active"
+
+		if err := s.saveUser(ctx, tx, user); err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, s.rebind(`UPDATE organizations
+			SET active_user_count = active_user_count + 1, updated_at = ?, version = version + 1
+			WHERE id = ?`), utc(now), user.OrganizationID)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to provision user: %w", err)
+	}
+
+	return nil
+}
+
+// SetUserStatus saves a user with a new status, taking or releasing a seat
+// in the same transaction
+func (s *SQLStore) SetUserStatus(ctx context.Context, user *models.User, status string) error {
+	err := s.withTx(ctx, func(tx *sql.Tx) error {
+		now := time.Now()
+
+		org, invitations, err := s.seatUsage(ctx, tx, user.OrganizationID)
+		if err != nil {
+			return err
+		}
+
+		var stored string
+		err = tx.QueryRowContext(ctx, s.rebind(`SELECT status FROM users WHERE uid = ?`), user.UID).Scan(&stored)
+		if err != nil {
+			return err
+		}
+		delta := activeUserDelta(stored, status)
+		if delta > 0 {
+			if err := checkProvisionSeat(org, invitations, user.Email, now); err != nil {
+				return err
+			}
+		}
+
+		user.Status = status
+		user.UpdatedAt = now
+
+		if err := s.saveUser(ctx, tx, user); err != nil {
+			return err
+		}
+		if delta == 0 {
+			return nil
+		}
+		_, err = tx.ExecContext(ctx, s.rebind(`UPDATE organizations
+			SET active_user_count = active_user_count + ?, updated_at = ?, version = version + 1
+			WHERE id = ?`), delta, utc(now), user.OrganizationID)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to set user status: %w", err)
+	}
+
+	return nil
+}
+
+func (s *SQLStore) saveUser(ctx context.Context, q execer, user *models.User) error {
+	return s.upsert(ctx, q, "users", userColumns, "uid",
+		user.UID, user.Email, user.FullName, user.OrganizationID, string(user.Role), user.Status, user.EmailVerified,
+		utc(user.CreatedAt), utc(user.UpdatedAt), nullTime(user.LastLoginAt), nullTime(user.TokensRevokedAt))
+}
+
+func scanUser(row rowScanner) (*models.User, error) {
+	var user models.User
+	var lastLogin, tokensRevoked sql.NullTime
+	err := row.Scan(&user.UID, &user.Email, &user.FullName, &user.OrganizationID, &user.Role, &user.Status,
+		&user.EmailVerified, &user.CreatedAt, &user.UpdatedAt, &lastLogin, &tokensRevoked)
+	if err != nil {
+		return nil, err
+	}
+	user.LastLoginAt = timePtr(lastLogin)
+	user.TokensRevokedAt = timePtr(tokensRevoked)
+
+	return &user, nil
+}
+
+// Invitation methods
+
+const invitationColumns = `id, email, organization_id, role, invited_by, message, token, status,
+	created_at, expires_at, sent_at, accepted_at, accepted_by`
+
+// CreateInvitation stores a new pending invitation, failing with
+// ErrSeatLimitReached when the organization has no free seat or
+// ErrInvitationExists when the email already has a pending invitation
+func (s *SQLStore) CreateInvitation(ctx context.Context, inv *models.Invitation) error {
+	inv.ID = uuid.New().String()
+	inv.CreatedAt = time.Now()
+	inv.SentAt = inv.CreatedAt
+	inv.Status = "pending"
+
+	err := s.withTx(ctx, func(tx *sql.Tx) error {
+		if err := s.checkInvitationSeat(ctx, tx, inv); err != nil {
+			return err
+		}
+		return s.saveInvitation(ctx, tx, inv)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create invitation: %w", err)
+	}
+
+	return nil
+}
+
+// GetInvitation retrieves an invitation by ID
+func (s *SQLStore) GetInvitation(ctx context.Context, orgID, invitationID string) (*models.Invitation, error) {
+	row := s.db.QueryRowContext(ctx, s.rebind(`SELECT `+invitationColumns+` FROM invitations
+		WHERE organization_id = ? AND id = ?`), orgID, invitationID)
+
+	inv, err := scanInvitation(row)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get invitation: %w", err)
+	}
+
+	return inv, nil
+}
+
+// GetInvitationByToken retrieves an invitation by the hash of its token
+func (s *SQLStore) GetInvitationByToken(ctx context.Context, tokenHash string) (*models.Invitation, error) {
+	row := s.db.QueryRowContext(ctx, s.rebind(`SELECT `+invitationColumns+` FROM invitations WHERE token = ?`), tokenHash)
+
+	inv, err := scanInvitation(row)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("invitation not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query invitation: %w", err)
+	}
+
+	return inv, nil
+}
+
+// ListInvitations lists an organization's invitations, one page at a time
+func (s *SQLStore) ListInvitations(ctx context.Context, orgID string, opts ListOptions) ([]*models.Invitation, string, error) {
+	q, err := invitationSort.resolve(opts)
+	if err != nil {
+		return nil, "", err
+	}
+
+	where, args, tail := pageClause(q, "id")
+	query := `SELECT ` + invitationColumns + ` FROM invitations WHERE organization_id = ?` + where + tail
+	rows, err := s.db.QueryContext(ctx, s.rebind(query), append([]interface{}{orgID}, args...)...)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to query invitations: %w", err)
+	}
+	defer rows.Close()
+
+	var invitations []*models.Invitation
+	for rows.Next() {
+		inv, err := scanInvitation(rows)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to parse invitation: %w", err)
+		}
+		invitations = append(invitations, inv)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, "", fmt.Errorf("failed to iterate invitations: %w", err)
+	}
+
+	invitations, next := trimPage(q, invitations, func(i *models.Invitation) string { return i.ID })
+	return invitations, next, nil
+}
+
+// RenewInvitation saves a new token and expiry for a pending (possibly
+// expired) invitation. The seat check is repeated because an expired
+// invitation no longer holds a seat.
+func (s *SQLStore) RenewInvitation(ctx context.Context, inv *models.Invitation) error {
+	inv.SentAt = time.Now()
+	inv.Status = "pending"
+
+	err := s.withTx(ctx, func(tx *sql.Tx) error {
+		if err := s.checkInvitationSeat(ctx, tx, inv); err != nil {
+			return err
+		}
+		if _, err := s.loadPendingInvitation(ctx, tx, inv.ID); err != nil {
+			return err
+		}
+		return s.saveInvitation(ctx, tx, inv)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to renew invitation: %w", err)
+	}
+
+	return nil
+}
+
+// UpdateInvitation saves a status change to a pending invitation, failing
+// with ErrInvitationNotPending if it was accepted or revoked in the meantime
+func (s *SQLStore) UpdateInvitation(ctx context.Context, inv *models.Invitation) error {
+	err := s.withTx(ctx, func(tx *sql.Tx) error {
+		if err := s.lockOrganization(ctx, tx, inv.OrganizationID); err != nil {
+			return err
+		}
+		if _, err := s.loadPendingInvitation(ctx, tx, inv.ID); err != nil {
+			return err
+		}
+		return s.saveInvitation(ctx, tx, inv)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update invitation: %w", err)
+	}
+
+	return nil
+}
+
+// AcceptInvitation marks a pending invitation accepted, creates the invited
+// user and adds them to the organization's active user count in one
+// transaction
+func (s *SQLStore) AcceptInvitation(ctx context.Context, inv *models.Invitation, user *models.User) error {
+	err := s.withTx(ctx, func(tx *sql.Tx) error {
+		now := time.Now()
+
+		if err := s.lockOrganization(ctx, tx, inv.OrganizationID); err != nil {
+			return err
+		}
+		stored, err := s.loadPendingInvitation(ctx, tx, inv.ID)
+		if err != nil {
+			return err
+		}
+		if stored.IsExpired(now) {
+			return ErrInvitationNotPending
+		}
+
+		user.CreatedAt = now
+		user.UpdatedAt = now
+		user.Status = "active"
+
+		*inv = *stored
+		inv.Status = "accepted"
+		inv.AcceptedAt = &now
+		inv.AcceptedBy = user.UID
+
+		if err := s.saveUser(ctx, tx, user); err != nil {
+			return err
+		}
+		if err := s.saveInvitation(ctx, tx, inv); err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, s.rebind(`UPDATE organizations
+			SET active_user_count = active_user_count + 1, updated_at = ?, version = version + 1
+			WHERE id = ?`), utc(now), inv.OrganizationID)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to accept invitation: %w", err)
+	}
+
+	return nil
+}
+
+// lockOrganization takes the organization row lock for the transaction so
+// seat accounting for its invitations is serialized
+func (s *SQLStore) lockOrganization(ctx context.Context, tx *sql.Tx, orgID string) error {
+	// A no-op update takes the row lock
+	res, err := tx.ExecContext(ctx, s.rebind(`UPDATE organizations SET version = version WHERE id = ?`), orgID)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("organization %s not found", orgID)
+	}
+	return nil
+}
+
+// loadPendingInvitation reads an invitation inside tx, failing with
+// ErrInvitationNotPending unless its status is pending
+func (s *SQLStore) loadPendingInvitation(ctx context.Context, tx *sql.Tx, invitationID string) (*models.Invitation, error) {
+	row := tx.QueryRowContext(ctx, s.rebind(`SELECT `+invitationColumns+` FROM invitations WHERE id = ?`), invitationID)
+	inv, err := scanInvitation(row)
+	if err != nil {
+		return nil, err
+	}
+	if inv.Status != "pending" {
+		return nil, ErrInvitationNotPending
+	}
+	return inv, nil
+}
+
+// checkInvitationSeat locks the organization and runs checkInvitationSeat
+// against its pending invitations inside tx
+func (s *SQLStore) checkInvitationSeat(ctx context.Context, tx *sql.Tx, inv *models.Invitation) error {
+	org, invitations, err := s.seatUsage(ctx, tx, inv.OrganizationID)
+	if err != nil {
+		return err
+	}
+	return checkInvitationSeat(org, invitations, inv, time.Now())
+}
+
+// seatUsage locks the organization and reads its user count, user limit and
+// pending invitations for seat accounting inside tx
+func (s *SQLStore) seatUsage(ctx context.Context, tx *sql.Tx, orgID string) (*models.Organization, []*models.Invitation, error) {
+	if err := s.lockOrganization(ctx, tx, orgID); err != nil {
+		return nil, nil, err
+	}
+
+	var org models.Organization
+	err := tx.QueryRowContext(ctx, s.rebind(`SELECT active_user_count, max_users FROM organizations WHERE id = ?`),
+		orgID).Scan(&org.ActiveUserCount, &org.Subscription.MaxUsers)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	rows, err := tx.QueryContext(ctx, s.rebind(`SELECT `+invitationColumns+` FROM invitations
+		WHERE organization_id = ? AND status = 'pending'`), orgID)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	var invitations []*models.Invitation
+	for rows.Next() {
+		inv, err := scanInvitation(rows)
+		if err != nil {
+			return nil, nil, err
+		}
+		invitations = append(invitations, inv)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	return &org, invitations, nil
+}
+
+func (s *SQLStore) saveInvitation(ctx context.Context, q execer, inv *models.Invitation) error {
+	return s.upsert(ctx, q, "invitations", invitationColumns, "id",
+		inv.ID, inv.Email, inv.OrganizationID, string(inv.Role), inv.InvitedBy, inv.Message, inv.Token, inv.Status,
+		utc(inv.CreatedAt), utc(inv.ExpiresAt), utc(inv.SentAt), nullTime(inv.AcceptedAt), inv.AcceptedBy)
+}
+
+func scanInvitation(row rowScanner) (*models.Invitation, error) {
+	var inv models.Invitation
+	var acceptedAt sql.NullTime
+	err := row.Scan(&inv.ID, &inv.Email, &inv.OrganizationID, &inv.Role, &inv.InvitedBy, &inv.Message, &inv.Token,
+		&inv.Status, &inv.CreatedAt, &inv.ExpiresAt, &inv.SentAt, &acceptedAt, &inv.AcceptedBy)
+	if err != nil {
+		return nil, err
+	}
+	inv.AcceptedAt = timePtr(acceptedAt)
+
+	return &inv, nil
+}
+
+// Membership methods
+
+const membershipColumns = `id, user_id, organization_id, email, role, invitation_id, created_at, updated_at`
+
+// JoinOrganization accepts an invitation for an existing user, creating their
+// membership in the invitation's organization
+func (s *SQLStore) JoinOrganization(ctx context.Context, inv *models.Invitation, membership *models.Membership) error {
+	err := s.withTx(ctx, func(tx *sql.Tx) error {
+		now := time.Now()
+
+		if err := s.lockOrganization(ctx, tx, inv.OrganizationID); err != nil {
+			return err
+		}
+		stored, err := s.loadPendingInvitation(ctx, tx, inv.ID)
+		if err != nil {
+			return err
+		}
+		if stored.IsExpired(now) {
+			return ErrInvitationNotPending
+		}
+
+		membership.ID = models.MembershipID(stored.OrganizationID, membership.UserID)
+		var existing int
+		err = tx.QueryRowContext(ctx, s.rebind(`SELECT COUNT(*) FROM memberships WHERE id = ?`), membership.ID).Scan(&existing)
+		if err != nil {
+			return err
+		}
+		if existing > 0 {
+			return ErrAlreadyMember
+		}
+
+		membership.OrganizationID = stored.OrganizationID
+		membership.Role = stored.Role
+		membership.InvitationID = stored.ID
+		membership.CreatedAt = now
+		membership.UpdatedAt = now
+
+		*inv = *stored
+		inv.Status = "accepted"
+		inv.AcceptedAt = &now
+		inv.AcceptedBy = membership.UserID
+
+		if err := s.saveMembership(ctx, tx, membership); err != nil {
+			return err
+		}
+		if err := s.saveInvitation(ctx, tx, inv); err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, s.rebind(`UPDATE organizations
+			SET active_user_count = active_user_count + 1, updated_at = ?, version = version + 1
+			WHERE id = ?`), utc(now), inv.OrganizationID)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to join organization: %w", err)
+	}
+
+	return nil
+}
+
+// GetMembership retrieves a user's membership in an organization
+func (s *SQLStore) GetMembership(ctx context.Context, orgID, userID string) (*models.Membership, error) {
+	row := s.db.QueryRowContext(ctx, s.rebind(`SELECT `+membershipColumns+` FROM memberships
+		WHERE organization_id = ? AND user_id = ?`), orgID, userID)
+
+	membership, err := scanMembership(row)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get membership: %w", err)
+	}
+
+	return membership, nil
+}
+
+// ListMemberships lists the memberships in an organization, one page at a time
+func (s *SQLStore) ListMemberships(ctx context.Context, orgID string, opts ListOptions) ([]*models.Membership, string, error) {
+	q, err := membershipSort.resolve(opts)
+	if err != nil {
+		return nil, "", err
+	}
+
+	where, args, tail := pageClause(q, "id")
+	query := `SELECT ` + membershipColumns + ` FROM memberships WHERE organization_id = ?` + where + tail
+	rows, err := s.db.QueryContext(ctx, s.rebind(query), append([]interface{}{orgID}, args...)...)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to query memberships: %w", err)
+	}
+	defer rows.Close()
+
+	var memberships []*models.Membership
+	for rows.Next() {
+		membership, err := scanMembership(rows)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to parse membership: %w", err)
+		}
+		memberships = append(memberships, membership)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, "", fmt.Errorf("failed to iterate memberships: %w", err)
+	}
+
+	memberships, next := trimPage(q, memberships, func(m *models.Membership) string { return m.ID })
+	return memberships, next, nil
+}
+
+// ListUserMemberships lists a user's memberships in all organizations
+func (s *SQLStore) ListUserMemberships(ctx context.Context, userID string) ([]*models.Membership, error) {
+	rows, err := s.db.QueryContext(ctx, s.rebind(`SELECT `+membershipColumns+` FROM memberships
+		WHERE user_id = ? ORDER BY created_at`), userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query memberships: %w", err)
+	}
+	defer rows.Close()
+
+	var memberships []*models.Membership
+	for rows.Next() {
+		membership, err := scanMembership(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse membership: %w", err)
+		}
+		memberships = append(memberships, membership)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate memberships: %w", err)
+	}
+
+	return memberships, nil
+}
+
+// UpdateMembership saves changes to a membership
+func (s *SQLStore) UpdateMembership(ctx context.Context, membership *models.Membership) error {
+	membership.UpdatedAt = time.Now()
+
+	if err := s.saveMembership(ctx, s.db, membership); err != nil {
+		return fmt.Errorf("failed to update membership: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteMembership removes a user's membership in an organization and frees
+// its seat
+func (s *SQLStore) DeleteMembership(ctx context.Context, orgID, userID string) error {
+	err := s.withTx(ctx, func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(ctx, s.rebind(`DELETE FROM memberships WHERE organization_id = ? AND user_id = ?`),
+			orgID, userID)
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err == nil && n == 0 {
+			return sql.ErrNoRows
+		}
+
+		_, err = tx.ExecContext(ctx, s.rebind(`UPDATE organizations
+			SET active_user_count = active_user_count - 1, updated_at = ?, version = version + 1
+			WHERE id = ?`), utc(time.Now()), orgID)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete membership: %w", err)
+	}
+
+	return nil
+}
+
+func (s *SQLStore) saveMembership(ctx context.Context, q execer, membership *models.Membership) error {
+	return s.upsert(ctx, q, "memberships", membershipColumns, "id",
+		membership.ID, membership.UserID, membership.OrganizationID, membership.Email, string(membership.Role),
+		membership.InvitationID, utc(membership.CreatedAt), utc(membership.UpdatedAt))
+}
+
+func scanMembership(row rowScanner) (*models.Membership, error) {
+	var membership models.Membership
+	err := row.Scan(&membership.ID, &membership.UserID, &membership.OrganizationID, &membership.Email, &membership.Role,
+		&membership.InvitationID, &membership.CreatedAt, &membership.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &membership, nil
+}
+
+// Custom role methods
+
+const roleColumns = `id, organization_id, name, description, permissions, created_by, created_at,
+	updated_by, updated_at, version`
+
+// CreateRole creates a new custom role
+func (s *SQLStore) CreateRole(ctx context.Context, role *models.Role) error {
+	role.ID = uuid.New().String()
+	role.CreatedAt = time.Now()
+	role.UpdatedAt = role.CreatedAt
+	role.Version = 1
+
+	if err := s.saveRole(ctx, s.db, role); err != nil {
+		return fmt.Errorf("failed to create role: %w", err)
+	}
+
+	return nil
+}
+
+// GetRole retrieves a custom role by ID
+func (s *SQLStore) GetRole(ctx context.Context, orgID, roleID string) (*models.Role, error) {
+	row := s.db.QueryRowContext(ctx, s.rebind(`SELECT `+roleColumns+` FROM roles
+		WHERE organization_id = ? AND id = ?`), orgID, roleID)
+
+	role, err := scanRole(row)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get role: %w", err)
+	}
+
+	return role, nil
+}
+
+// ListRoles lists an organization's custom roles, one page at a time
+func (s *SQLStore) ListRoles(ctx context.Context, orgID string, opts ListOptions) ([]*models.Role, string, error) {
+	q, err := roleSort.resolve(opts)
+	if err != nil {
+		return nil, "", err
+	}
+
+	where, args, tail := pageClause(q, "id")
+	query := `SELECT ` + roleColumns + ` FROM roles WHERE organization_id = ?` + where + tail
+	rows, err := s.db.QueryContext(ctx, s.rebind(query), append([]interface{}{orgID}, args...)...)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to query roles: %w", err)
+	}
+	defer rows.Close()
+
+	var roles []*models.Role
+	for rows.Next() {
+		role, err := scanRole(rows)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to parse role: %w", err)
+		}
+		roles = append(roles, role)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, "", fmt.Errorf("failed to iterate roles: %w", err)
+	}
+
+	roles, next := trimPage(q, roles, func(r *models.Role) string { return r.ID })
+	return roles, next, nil
+}
+
+// UpdateRole updates a custom role
+func (s *SQLStore) UpdateRole(ctx context.Context, role *models.Role) error {
+	role.UpdatedAt = time.Now()
+	expected := role.Version
+
+	err := s.withTx(ctx, func(tx *sql.Tx) error {
+		err := s.claimVersion(ctx, tx, "roles", "organization_id = ? AND id = ?", expected, role.OrganizationID, role.ID)
+		if err != nil {
+			return err
+		}
+		role.Version = expected + 1
+		return s.saveRole(ctx, tx, role)
+	})
+	if err != nil {
+		role.Version = expected
+		return fmt.Errorf("failed to update role: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteRole deletes a custom role, failing with ErrRoleInUse while any user
+// or pending invitation is assigned to it
+func (s *SQLStore) DeleteRole(ctx context.Context, orgID, roleID string, version int64) error {
+	err := s.withTx(ctx, func(tx *sql.Tx) error {
+		row := tx.QueryRowContext(ctx, s.rebind(`SELECT `+roleColumns+` FROM roles
+			WHERE organization_id = ? AND id = ?`), orgID, roleID)
+		role, err := scanRole(row)
+		if err != nil {
+			return err
+		}
+		if err := checkVersion(role.Version, version); err != nil {
+			return err
+		}
+
+		assigned := string(role.UserRole())
+		var inUse int
+		err = tx.QueryRowContext(ctx, s.rebind(`SELECT
+			(SELECT COUNT(*) FROM users WHERE organization_id = ? AND role = ?) +
+			(SELECT COUNT(*) FROM invitations WHERE organization_id = ? AND role = ? AND status = 'pending') +
+			(SELECT COUNT(*) FROM memberships WHERE organization_id = ? AND role = ?)`),
+			orgID, assigned, orgID, assigned, orgID, assigned).Scan(&inUse)
+		if err != nil {
+			return err
+		}
+		if inUse > 0 {
+			return ErrRoleInUse
+		}
+
+		res, err := tx.ExecContext(ctx, s.rebind(`DELETE FROM roles WHERE organization_id = ? AND id = ? AND version = ?`),
+			orgID, roleID, version)
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err == nil && n == 0 {
+			return ErrVersionConflict
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete role: %w", err)
+	}
+
+	return nil
+}
+
+func (s *SQLStore) saveRole(ctx context.Context, q execer, role *models.Role) error {
+	return s.upsert(ctx, q, "roles", roleColumns, "id",
+		role.ID, role.OrganizationID, role.Name, role.Description, toJSON(role.Permissions), role.CreatedBy,
+		utc(role.CreatedAt), role.UpdatedBy, utc(role.UpdatedAt), role.Version)
+}
+
+func scanRole(row rowScanner) (*models.Role, error) {
+	var role models.Role
+	var permissions string
+	err := row.Scan(&role.ID, &role.OrganizationID, &role.Name, &role.Description, &permissions, &role.CreatedBy,
+		&role.CreatedAt, &role.UpdatedBy, &role.UpdatedAt, &role.Version)
+	if err != nil {
+		return nil, err
+	}
+	if err := fromJSON(permissions, &role.Permissions); err != nil {
+		return nil, err
+	}
+
+	return &role, nil
+}
+
+// API key methods
+
+const apiKeyColumns = `id, organization_id, name, prefix, key_hash, scopes, created_by, created_at,
+	expires_at, last_used_at, revoked_at, revoked_by`
+
+// CreateAPIKey stores a new API key
+func (s *SQLStore) CreateAPIKey(ctx context.Context, key *models.APIKey) error {
+	key.ID = uuid.New().String()
+	key.CreatedAt = time.Now()
+
+	if err := s.saveAPIKey(ctx, key); err != nil {
+		return fmt.Errorf("failed to create API key: %w", err)
+	}
+
+	return nil
+}
+
+// GetAPIKey retrieves an API key by ID
+func (s *SQLStore) GetAPIKey(ctx context.Context, orgID, keyID string) (*models.APIKey, error) {
+	row := s.db.QueryRowContext(ctx, s.rebind(`SELECT `+apiKeyColumns+` FROM api_keys
+		WHERE organization_id = ? AND id = ?`), orgID, keyID)
+
+	key, err := scanAPIKey(row)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get API key: %w", err)
+	}
+
+	return key, nil
+}
+
+// GetAPIKeyByHash retrieves an API key by the hash of the key
+func (s *SQLStore) GetAPIKeyByHash(ctx context.Context, keyHash string) (*models.APIKey, error) {
+	row := s.db.QueryRowContext(ctx, s.rebind(`SELECT `+apiKeyColumns+` FROM api_keys WHERE key_hash = ?`), keyHash)
+
+	key, err := scanAPIKey(row)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("API key not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query API key: %w", err)
+	}
+
+	return key, nil
+}
+
+// ListAPIKeys lists an organization's API keys, one page at a time
+func (s *SQLStore) ListAPIKeys(ctx context.Context, orgID string, opts ListOptions) ([]*models.APIKey, string, error) {
+	q, err := apiKeySort.resolve(opts)
+	if err != nil {
+		return nil, "", err
+	}
+
+	where, args, tail := pageClause(q, "id")
+	query := `SELECT ` + apiKeyColumns + ` FROM api_keys WHERE organization_id = ?` + where + tail
+	rows, err := s.db.QueryContext(ctx, s.rebind(query), append([]interface{}{orgID}, args...)...)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to query API keys: %w", err)
+	}
+	defer rows.Close()
+
+	var keys []*models.APIKey
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to parse API key: %w", err)
+		}
+		keys = append(keys, key)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, "", fmt.Errorf("failed to iterate API keys: %w", err)
+	}
+
+	keys, next := trimPage(q, keys, func(k *models.APIKey) string { return k.ID })
+	return keys, next, nil
+}
+
+// UpdateAPIKey saves changes to an API key
+func (s *SQLStore) UpdateAPIKey(ctx context.Context, key *models.APIKey) error {
+	if err := s.saveAPIKey(ctx, key); err != nil {
+		return fmt.Errorf("failed to update API key: %w", err)
+	}
+
+	return nil
+}
+
+// TouchAPIKey records when an API key was last used
+func (s *SQLStore) TouchAPIKey(ctx context.Context, keyID string, usedAt time.Time) error {
+	_, err := s.db.ExecContext(ctx, s.rebind(`UPDATE api_keys SET last_used_at = ? WHERE id = ?`), utc(usedAt), keyID)
+	if err != nil {
+		return fmt.Errorf("failed to update API key: %w", err)
+	}
+
+	return nil
+}
+
+func (s *SQLStore) saveAPIKey(ctx context.Context, key *models.APIKey) error {
+	return s.upsert(ctx, s.db, "api_keys", apiKeyColumns, "id",
+		key.ID, key.OrganizationID, key.Name, key.Prefix, key.KeyHash, toJSON(key.Scopes), key.CreatedBy,
+		utc(key.CreatedAt), nullTime(key.ExpiresAt), nullTime(key.LastUsedAt), nullTime(key.RevokedAt), key.RevokedBy)
+}
+
+func scanAPIKey(row rowScanner) (*models.APIKey, error) {
+	var key models.APIKey
+	var scopes string
+	var expiresAt, lastUsedAt, revokedAt sql.NullTime
+	err := row.Scan(&key.ID, &key.OrganizationID, &key.Name, &key.Prefix, &key.KeyHash, &scopes, &key.CreatedBy,
+		&key.CreatedAt, &expiresAt, &lastUsedAt, &revokedAt, &key.RevokedBy)
+	if err != nil {
+		return nil, err
+	}
+	if err := fromJSON(scopes, &key.Scopes); err != nil {
+		return nil, err
+	}
+	key.ExpiresAt = timePtr(expiresAt)
+	key.LastUsedAt = timePtr(lastUsedAt)
+	key.RevokedAt = timePtr(revokedAt)
+
+	return &key, nil
+}
+
+// Auditor grant methods
+
+const auditorGrantColumns = `id, organization_id, auditor_email, auditor_name, purpose, requirement_ids,
+	report_ids, window_start, window_end, expires_at, token_hash, created_by, created_at, last_accessed_at,
+	revoked_at, revoked_by`
+
+// CreateAuditorGrant stores a new auditor grant
+func (s *SQLStore) CreateAuditorGrant(ctx context.Context, grant *models.AuditorGrant) error {
+	grant.ID = uuid.New().String()
+	grant.CreatedAt = time.Now()
+
+	if err := s.saveAuditorGrant(ctx, grant); err != nil {
+		return fmt.Errorf("failed to create auditor grant: %w", err)
+	}
+
+	return nil
+}
+
+// GetAuditorGrant retrieves an auditor grant by ID
+func (s *SQLStore) GetAuditorGrant(ctx context.Context, orgID, grantID string) (*models.AuditorGrant, error) {
+	row := s.db.QueryRowContext(ctx, s.rebind(`SELECT `+auditorGrantColumns+` FROM auditor_grants
+		WHERE organization_id = ? AND id = ?`), orgID, grantID)
+
+	grant, err := scanAuditorGrant(row)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get auditor grant: %w", err)
+	}
+
+	return grant, nil
+}
+
+// GetAuditorGrantByHash retrieves an auditor grant by the hash of its token
+func (s *SQLStore) GetAuditorGrantByHash(ctx context.Context, tokenHash string) (*models.AuditorGrant, error) {
+	row := s.db.QueryRowContext(ctx, s.rebind(`SELECT `+auditorGrantColumns+` FROM auditor_grants
+		WHERE token_hash = ?`), tokenHash)
+
+	grant, err := scanAuditorGrant(row)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("auditor grant not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query auditor grant: %w", err)
+	}
+
+	return grant, nil
+}
+
+// ListAuditorGrants lists an organization's auditor grants, one page at a time
+func (s *SQLStore) ListAuditorGrants(ctx context.Context, orgID string, opts ListOptions) ([]*models.AuditorGrant, string, error) {
+	q, err := auditorGrantSort.resolve(opts)
+	if err != nil {
+		return nil, "", err
+	}
+
+	where, args, tail := pageClause(q, "id")
+	query := `SELECT ` + auditorGrantColumns + ` FROM auditor_grants WHERE organization_id = ?` + where + tail
+	rows, err := s.db.QueryContext(ctx, s.rebind(query), append([]interface{}{orgID}, args...)...)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to query auditor grants: %w", err)
+	}
+	defer rows.Close()
+
+	var grants []*models.AuditorGrant
+	for rows.Next() {
+		grant, err := scanAuditorGrant(rows)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to parse auditor grant: %w", err)
+		}
+		grants = append(grants, grant)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, "", fmt.Errorf("failed to iterate auditor grants: %w", err)
+	}
+
+	grants, next := trimPage(q, grants, func(g *models.AuditorGrant) string { return g.ID })
+	return grants, next, nil
+}
+
+// UpdateAuditorGrant saves changes to an auditor grant
+func (s *SQLStore) UpdateAuditorGrant(ctx context.Context, grant *models.AuditorGrant) error {
+	if err := s.saveAuditorGrant(ctx, grant); err != nil {
+		return fmt.Errorf("failed to update auditor grant: %w", err)
+	}
+
+	return nil
+}
+
+// TouchAuditorGrant records when an auditor grant was last used
+func (s *SQLStore) TouchAuditorGrant(ctx context.Context, grantID string, accessedAt time.Time) error {
+	_, err := s.db.ExecContext(ctx, s.rebind(`UPDATE auditor_grants SET last_accessed_at = ? WHERE id = ?`),
+		utc(accessedAt), grantID)
+	if err != nil {
+		return fmt.Errorf("failed to update auditor grant: %w", err)
+	}
+
+	return nil
+}
+
+func (s *SQLStore) saveAuditorGrant(ctx context.Context, grant *models.AuditorGrant) error {
+	return s.upsert(ctx, s.db, "auditor_grants", auditorGrantColumns, "id",
+		grant.ID, grant.OrganizationID, grant.AuditorEmail, grant.AuditorName, grant.Purpose,
+		toJSON(grant.RequirementIDs), toJSON(grant.ReportIDs), utc(grant.WindowStart), utc(grant.WindowEnd),
+		utc(grant.ExpiresAt), grant.TokenHash, grant.CreatedBy, utc(grant.CreatedAt),
+		nullTime(grant.LastAccessedAt), nullTime(grant.RevokedAt), grant.RevokedBy)
+}
+
+func scanAuditorGrant(row rowScanner) (*models.AuditorGrant, error) {
+	var grant models.AuditorGrant
+	var requirementIDs, reportIDs string
+	var lastAccessedAt, revokedAt sql.NullTime
+	err := row.Scan(&grant.ID, &grant.OrganizationID, &grant.AuditorEmail, &grant.AuditorName, &grant.Purpose,
+		&requirementIDs, &reportIDs, &grant.WindowStart, &grant.WindowEnd, &grant.ExpiresAt, &grant.TokenHash,
+		&grant.CreatedBy, &grant.CreatedAt, &lastAccessedAt, &revokedAt, &grant.RevokedBy)
+	if err != nil {
+		return nil, err
+	}
+	if err := fromJSON(requirementIDs, &grant.RequirementIDs); err != nil {
+		return nil, err
+	}
+	if err := fromJSON(reportIDs, &grant.ReportIDs); err != nil {
+		return nil, err
+	}
+	grant.LastAccessedAt = timePtr(lastAccessedAt)
+	grant.RevokedAt = timePtr(revokedAt)
+
+	return &grant, nil
+}
+
+// Single sign-on methods
+
+const ssoConfigColumns = `organization_id, protocol, enabled, enforced, default_role, oidc_issuer,
+	oidc_client_id, oidc_client_secret, saml_metadata_url, saml_idp_entity_id, saml_idp_sso_url,
+	saml_idp_certificates, updated_by, updated_at, version`
+
+// GetSSOConfig retrieves an organization's single sign-on configuration, or
+// nil if it has none
+func (s *SQLStore) GetSSOConfig(ctx context.Context, orgID string) (*models.SSOConfig, error) {
+	row := s.db.QueryRowContext(ctx, s.rebind(`SELECT `+ssoConfigColumns+` FROM sso_configs
+		WHERE organization_id = ?`), orgID)
+
+	config, err := scanSSOConfig(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get SSO config: %w", err)
+	}
+
+	return config, nil
+}
+
+// SaveSSOConfig creates or replaces an organization's single sign-on
+// configuration, failing with ErrVersionConflict if it changed since config
+// was read. A new configuration has version 0.
+func (s *SQLStore) SaveSSOConfig(ctx context.Context, config *models.SSOConfig) error {
+	config.UpdatedAt = time.Now()
+	expected := config.Version
+
+	err := s.withTx(ctx, func(tx *sql.Tx) error {
+		err := s.claimVersion(ctx, tx, "sso_configs", "organization_id = ?", expected, config.OrganizationID)
+		if err != nil {
+			return err
+		}
+		config.Version = expected + 1
+		return s.upsert(ctx, tx, "sso_configs", ssoConfigColumns, "organization_id",
+			config.OrganizationID, string(config.Protocol), config.Enabled, config.Enforced,
+			string(config.DefaultRole), config.OIDCIssuer, config.OIDCClientID, config.OIDCClientSecret,
+			config.SAMLMetadataURL, config.SAMLIdPEntityID, config.SAMLIdPSSOURL,
+			toJSON(config.SAMLIdPCertificates), config.UpdatedBy, utc(config.UpdatedAt), config.Version)
+	})
+	if err != nil {
+		config.Version = expected
+		return fmt.Errorf("failed to save SSO config: %w", err)
+	}
+
+	return nil
+}
+
+func scanSSOConfig(row rowScanner) (*models.SSOConfig, error) {
+	var config models.SSOConfig
+	var certificates string
+	err := row.Scan(&config.OrganizationID, &config.Protocol, &config.Enabled, &config.Enforced,
+		&config.DefaultRole, &config.OIDCIssuer, &config.OIDCClientID, &config.OIDCClientSecret,
+		&config.SAMLMetadataURL, &config.SAMLIdPEntityID, &config.SAMLIdPSSOURL, &certificates,
+		&config.UpdatedBy, &config.UpdatedAt, &config.Version)
+	if err != nil {
+		return nil, err
+	}
+	if err := fromJSON(certificates, &config.SAMLIdPCertificates); err != nil {
+		return nil, err
+	}
+
+	return &config, nil
+}
+
+const domainColumns = `id, organization_id, name, verification_token, status, created_by, created_at, verified_at`
+
+// CreateDomain stores a new pending domain claim, failing with
+// ErrDomainClaimed if the organization already claimed the name or another
+// organization verified it
+func (s *SQLStore) CreateDomain(ctx context.Context, domain *models.Domain) error {
+	domain.ID = uuid.New().String()
+	domain.CreatedAt = time.Now()
+	domain.Status = "pending"
+
+	err := s.withTx(ctx, func(tx *sql.Tx) error {
+		if err := s.checkDomainClaim(ctx, tx, domain); err != nil {
+			return err
+		}
+		return s.saveDomain(ctx, tx, domain)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create domain: %w", err)
+	}
+
+	return nil
+}
+
+// GetDomain retrieves a domain claim by ID
+func (s *SQLStore) GetDomain(ctx context.Context, orgID, domainID string) (*models.Domain, error) {
+	row := s.db.QueryRowContext(ctx, s.rebind(`SELECT `+domainColumns+` FROM domains
+		WHERE organization_id = ? AND id = ?`), orgID, domainID)
+
+	domain, err := scanDomain(row)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get domain: %w", err)
+	}
+
+	return domain, nil
+}
+
+// GetVerifiedDomain retrieves the verified claim on a domain name
+func (s *SQLStore) GetVerifiedDomain(ctx context.Context, name string) (*models.Domain, error) {
+	row := s.db.QueryRowContext(ctx, s.rebind(`SELECT `+domainColumns+` FROM domains
+		WHERE name = ? AND status = 'verified'`), name)
+
+	domain, err := scanDomain(row)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("domain not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query domain: %w", err)
+	}
+
+	return domain, nil
+}
+
+// ListDomains lists an organization's domain claims, one page at a time
+func (s *SQLStore) ListDomains(ctx context.Context, orgID string, opts ListOptions) ([]*models.Domain, string, error) {
+	q, err := domainSort.resolve(opts)
+	if err != nil {
+		return nil, "", err
+	}
+
+	where, args, tail := pageClause(q, "id")
+	query := `SELECT ` + domainColumns + ` FROM domains WHERE organization_id = ?` + where + tail
+	rows, err := s.db.QueryContext(ctx, s.rebind(query), append([]interface{}{orgID}, args...)...)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to query domains: %w", err)
+	}
+	defer rows.Close()
+
+	var domains []*models.Domain
+	for rows.Next() {
+		domain, err := scanDomain(rows)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to parse domain: %w", err)
+		}
+		domains = append(domains, domain)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, "", fmt.Errorf("failed to iterate domains: %w", err)
+	}
+
+	domains, next := trimPage(q, domains, func(d *models.Domain) string { return d.ID })
+	return domains, next, nil
+}
+
+// VerifyDomain marks a domain claim verified, failing with ErrDomainClaimed
+// if another organization verified the name first
+func (s *SQLStore) VerifyDomain(ctx context.Context, domain *models.Domain) error {
+	err := s.withTx(ctx, func(tx *sql.Tx) error {
+		if err := s.checkDomainClaim(ctx, tx, domain); err != nil {
+			return err
+		}
+
+		now := time.Now()
+		domain.Status = "verified"
+		domain.VerifiedAt = &now
+		return s.saveDomain(ctx, tx, domain)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to verify domain: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteDomain removes a domain claim
+func (s *SQLStore) DeleteDomain(ctx context.Context, orgID, domainID string) error {
+	res, err := s.db.ExecContext(ctx, s.rebind(`DELETE FROM domains WHERE organization_id = ? AND id = ?`),
+		orgID, domainID)
+	if err != nil {
+		return fmt.Errorf("failed to delete domain: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("failed to delete domain: %w", sql.ErrNoRows)
+	}
+
+	return nil
+}
+
+// ClaimSAMLAssertion records an assertion until it expires, removing expired
+// ones first. The primary key backs up the check when the same assertion is
+// posted to two instances at once.
+func (s *SQLStore) ClaimSAMLAssertion(ctx context.Context, issuer, assertionID string, expiresAt time.Time) error {
+	err := s.withTx(ctx, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, s.rebind(`DELETE FROM saml_assertions WHERE expires_at <= ?`), utc(time.Now()))
+		if err != nil {
+			return err
+		}
+
+		var existing int
+		err = tx.QueryRowContext(ctx, s.rebind(`SELECT COUNT(*) FROM saml_assertions WHERE issuer = ? AND id = ?`),
+			issuer, assertionID).Scan(&existing)
+		if err != nil {
+			return err
+		}
+		if existing > 0 {
+			return ErrAssertionReplayed
+		}
+
+		_, err = tx.ExecContext(ctx, s.rebind(`INSERT INTO saml_assertions (issuer, id, expires_at) VALUES (?, ?, ?)`),
+			issuer, assertionID, utc(expiresAt))
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to claim SAML assertion: %w", err)
+	}
+
+	return nil
+}
+
+// checkDomainClaim runs checkDomainClaim inside tx against the stored claims
+// on the same name. The unique index on verified names backs it up when two
+// organizations verify at once.
+func (s *SQLStore) checkDomainClaim(ctx context.Context, tx *sql.Tx, domain *models.Domain) error {
+	rows, err := tx.QueryContext(ctx, s.rebind(`SELECT `+domainColumns+` FROM domains WHERE name = ?`), domain.Name)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var existing []*models.Domain
+	for rows.Next() {
+		other, err := scanDomain(rows)
+		if err != nil {
+			return err
+		}
+		existing = append(existing, other)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	return checkDomainClaim(domain, existing)
+}
+
+func (s *SQLStore) saveDomain(ctx context.Context, q execer, domain *models.Domain) error {
+	return s.upsert(ctx, q, "domains", domainColumns, "id",
+		domain.ID, domain.OrganizationID, domain.Name, domain.VerificationToken, domain.Status, domain.CreatedBy,
+		utc(domain.CreatedAt), nullTime(domain.VerifiedAt))
+}
+
+func scanDomain(row rowScanner) (*models.Domain, error) {
+	var domain models.Domain
+	var verifiedAt sql.NullTime
+	err := row.Scan(&domain.ID, &domain.OrganizationID, &domain.Name, &domain.VerificationToken, &domain.Status,
+		&domain.CreatedBy, &domain.CreatedAt, &verifiedAt)
+	if err != nil {
+		return nil, err
+	}
+	domain.VerifiedAt = timePtr(verifiedAt)
+
+	return &domain, nil
+}
+
+// Session methods
+
+const sessionColumns = `id, user_id, organization_id, token_hash, auth_method, ip_address, user_agent,
+	created_at, expires_at, revoked_at`
+
+// CreateSession stores a new session
+func (s *SQLStore) CreateSession(ctx context.Context, session *models.Session) error {
+	session.ID = uuid.New().String()
+	session.CreatedAt = time.Now()
+
+	if err := s.saveSession(ctx, session); err != nil {
+		return fmt.Errorf("failed to create session: %w", err)
+	}
+
+	return nil
+}
+
+// GetSession retrieves a session in an organization by ID
+func (s *SQLStore) GetSession(ctx context.Context, orgID, sessionID string) (*models.Session, error) {
+	row := s.db.QueryRowContext(ctx, s.rebind(`SELECT `+sessionColumns+` FROM sessions
+		WHERE organization_id = ? AND id = ?`), orgID, sessionID)
+
+	session, err := scanSession(row)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get session: %w", err)
+	}
+
+	return session, nil
+}
+
+// GetSessionByHash retrieves a session by the hash of its token
+func (s *SQLStore) GetSessionByHash(ctx context.Context, tokenHash string) (*models.Session, error) {
+	row := s.db.QueryRowContext(ctx, s.rebind(`SELECT `+sessionColumns+` FROM sessions
+		WHERE token_hash = ?`), tokenHash)
+
+	session, err := scanSession(row)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("session not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query session: %w", err)
+	}
+
+	return session, nil
+}
+
+// ListSessions lists a user's sessions in an organization, one page at a time
+func (s *SQLStore) ListSessions(ctx context.Context, orgID, userID string, opts ListOptions) ([]*models.Session, string, error) {
+	q, err := sessionSort.resolve(opts)
+	if err != nil {
+		return nil, "", err
+	}
+
+	where, args, tail := pageClause(q, "id")
+	query := `SELECT ` + sessionColumns + ` FROM sessions WHERE organization_id = ? AND user_id = ?` + where + tail
+	rows, err := s.db.QueryContext(ctx, s.rebind(query), append([]interface{}{orgID, userID}, args...)...)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to query sessions: %w", err)
+	}
+	defer rows.Close()
+
+	var sessions []*models.Session
+	for rows.Next() {
+		session, err := scanSession(rows)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to parse session: %w", err)
+		}
+		sessions = append(sessions, session)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, "", fmt.Errorf("failed to iterate sessions: %w", err)
+	}
+
+	sessions, next := trimPage(q, sessions, func(s *models.Session) string { return s.ID })
+	return sessions, next, nil
+}
+
+// UpdateSession saves changes to a session
+func (s *SQLStore) UpdateSession(ctx context.Context, session *models.Session) error {
+	if err := s.saveSession(ctx, session); err != nil {
+		return fmt.Errorf("failed to update session: %w", err)
+	}
+
+	return nil
+}
+
+func (s *SQLStore) saveSession(ctx context.Context, session *models.Session) error {
+	return s.upsert(ctx, s.db, "sessions", sessionColumns, "id",
+		session.ID, session.UserID, session.OrganizationID, session.TokenHash, session.AuthMethod,
+		session.IPAddress, session.UserAgent, utc(session.CreatedAt), utc(session.ExpiresAt),
+		nullTime(session.RevokedAt))
+}
+
+func scanSession(row rowScanner) (*models.Session, error) {
+	var session models.Session
+	var revokedAt sql.NullTime
+	err := row.Scan(&session.ID, &session.UserID, &session.OrganizationID, &session.TokenHash,
+		&session.AuthMethod, &session.IPAddress, &session.UserAgent, &session.CreatedAt, &session.ExpiresAt,
+		&revokedAt)
+	if err != nil {
+		return nil, err
+	}
+	session.RevokedAt = timePtr(revokedAt)
+
+	return &session, nil
+}
+
+// Requirement methods
+
+const requirementColumns = `id, organization_id, template_id, title, description, category, authority,
+	evidence_types, frequency, status, next_due_date, last_completed_date, evidence_count, notes,
+	activated_at, activated_by, updated_at, updated_by, is_active, version`
+
+// CreateRequirement creates a new requirement for an organization
+func (s *SQLStore) CreateRequirement(ctx context.Context, req *models.Requirement) error {
+	req.ID = uuid.New().String()
+	req.ActivatedAt = time.Now()
+	req.UpdatedAt = time.Now()
+	req.Status = models.StatusNotStarted
+	req.EvidenceCount = 0
+	req.IsActive = true
+	req.Version = 1
+
+	if err := s.saveRequirement(ctx, s.db, req); err != nil {
+		return fmt.Errorf("failed to create requirement: %w", err)
+	}
+
+	return nil
+}
+
+// GetRequirement retrieves a requirement by ID
+func (s *SQLStore) GetRequirement(ctx context.Context, orgID, reqID string) (*models.Requirement, error) {
+	row := s.db.QueryRowContext(ctx, s.rebind(`SELECT `+requirementColumns+` FROM requirements
+		WHERE organization_id = ? AND id = ?`), orgID, reqID)
+
+	req, err := scanRequirement(row)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get requirement: %w", err)
+	}
+
+	return req, nil
+}
+
+// ListRequirements lists active requirements for an organization, one page at a time
+func (s *SQLStore) ListRequirements(ctx context.Context, orgID string, opts ListOptions) ([]*models.Requirement, string, error) {
+	q, err := requirementSort.resolve(opts)
+	if err != nil {
+		return nil, "", err
+	}
+
+	where, args, tail := pageClause(q, "id")
+	query := `SELECT ` + requirementColumns + ` FROM requirements WHERE organization_id = ? AND is_active = ?` + where + tail
+	rows, err := s.db.QueryContext(ctx, s.rebind(query), append([]interface{}{orgID, true}, args...)...)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to query requirements: %w", err)
+	}
+	defer rows.Close()
+
+	var requirements []*models.Requirement
+	for rows.Next() {
+		req, err := scanRequirement(rows)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to parse requirement: %w", err)
+		}
+		requirements = append(requirements, req)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, "", fmt.Errorf("failed to iterate requirements: %w", err)
+	}
+
+	requirements, next := trimPage(q, requirements, func(r *models.Requirement) string { return r.ID })
+	return requirements, next, nil
+}
+
+// UpdateRequirement updates a requirement, failing with ErrVersionConflict if
+// it changed since req was read
+func (s *SQLStore) UpdateRequirement(ctx context.Context, req *models.Requirement) error {
+	req.UpdatedAt = time.Now()
+	expected := req.Version
+
+	err := s.withTx(ctx, func(tx *sql.Tx) error {
+		err := s.claimVersion(ctx, tx, "requirements", "organization_id = ? AND id = ?", expected, req.OrganizationID, req.ID)
+		if err != nil {
+			return err
+		}
+		req.Version = expected + 1
+		return s.saveRequirement(ctx, tx, req)
+	})
+	if err != nil {
+		req.Version = expected
+		return fmt.Errorf("failed to update requirement: %w", err)
+	}
+
+	return nil
+}
+
+func (s *SQLStore) saveRequirement(ctx context.Context, q execer, req *models.Requirement) error {
+	return s.upsert(ctx, q, "requirements", requirementColumns, "id",
+		req.ID, req.OrganizationID, req.TemplateID, req.Title, req.Description, string(req.Category), req.Authority,
+		toJSON(req.EvidenceTypes), string(req.Frequency), string(req.Status), nullTime(req.NextDueDate),
+		nullTime(req.LastCompletedDate), req.EvidenceCount, req.Notes,
+		utc(req.ActivatedAt), req.ActivatedBy, utc(req.UpdatedAt), req.UpdatedBy, req.IsActive, req.Version)
+}
+
+func scanRequirement(row rowScanner) (*models.Requirement, error) {
+	var req models.Requirement
+	var evidenceTypes string
+	var nextDue, lastCompleted sql.NullTime
+	err := row.Scan(&req.ID, &req.OrganizationID, &req.TemplateID, &req.Title, &req.Description, &req.Category,
+		&req.Authority, &evidenceTypes, &req.Frequency, &req.Status, &nextDue, &lastCompleted, &req.EvidenceCount,
+		&req.Notes, &req.ActivatedAt, &req.ActivatedBy, &req.UpdatedAt, &req.UpdatedBy, &req.IsActive, &req.Version)
+	if err != nil {
+		return nil, err
+	}
+	if err := fromJSON(evidenceTypes, &req.EvidenceTypes); err != nil {
+		return nil, err
+	}
+	req.NextDueDate = timePtr(nextDue)
+	req.LastCompletedDate = timePtr(lastCompleted)
+
+	return &req, nil
+}
+
+// Evidence methods
+
+const evidenceColumns = `id, organization_id, title, description, source, evidence_date, file_url, file_name,
+	file_size, file_type, external_link, metadata, uploaded_by, created_at, updated_at, status, version,
+	content_hash, file_version, tags, scan`
+
+// evidenceFilterColumns are the columns ListEvidence accepts as filter keys
+var evidenceFilterColumns = map[string]bool{
+	"source": true, "file_type": true, "uploaded_by": true, "content_hash": true,
+}
+
+// CreateEvidence creates a new evidence item and updates the evidence counts
+// of its requirements in the same transaction
+func (s *SQLStore) CreateEvidence(ctx context.Context, evidence *models.Evidence) error {
+	// The upload URL flow pre-assigns the ID so it can be embedded in the object path
+	if evidence.ID == "" {
+		evidence.ID = uuid.New().String()
+	}
+	evidence.CreatedAt = time.Now()
+	evidence.UpdatedAt = time.Now()
+	evidence.Version = 1
+
+	err := s.withTx(ctx, func(tx *sql.Tx) error {
+		if err := s.saveEvidence(ctx, tx, evidence); err != nil {
+			return err
+		}
+		return s.applyEvidenceCountDeltas(ctx, tx, evidence.OrganizationID, evidenceCountDeltas(nil, evidence))
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create evidence: %w", err)
+	}
+
+	return nil
+}
+
+// GetEvidence retrieves an evidence item by ID
+func (s *SQLStore) GetEvidence(ctx context.Context, orgID, evidenceID string) (*models.Evidence, error) {
+	evidence, err := s.loadEvidence(ctx, s.db, orgID, evidenceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get evidence: %w", err)
+	}
+	return evidence, nil
+}
+
+// ListEvidence lists active evidence for an organization, one page at a time
+func (s *SQLStore) ListEvidence(ctx context.Context, orgID string, filters map[string]interface{}, opts ListOptions) ([]*models.Evidence, string, error) {
+	q, err := evidenceSort.resolve(opts)
+	if err != nil {
+		return nil, "", err
+	}
+
+	requirementID, byRequirement := filters[EvidenceRequirementFilter]
+	if byRequirement {
+		filters = withoutKey(filters, EvidenceRequirementFilter)
+	}
+	status := "active"
+	if value, ok := filters[EvidenceStatusFilter]; ok {
+		status = fmt.Sprint(value)
+		filters = withoutKey(filters, EvidenceStatusFilter)
+	}
+
+	where, args, err := filterClause(filters, evidenceFilterColumns)
+	if err != nil {
+		return nil, "", err
+	}
+	if byRequirement {
+		where += ` AND id IN (SELECT evidence_id FROM evidence_requirements
+			WHERE organization_id = ? AND requirement_id = ?)`
+		args = append(args, orgID, fmt.Sprint(requirementID))
+	}
+	pageWhere, pageArgs, tail := pageClause(q, "id")
+
+	query := `SELECT ` + evidenceColumns + ` FROM evidence WHERE organization_id = ? AND status = ?` + where + pageWhere + tail
+	args = append(append([]interface{}{orgID, status}, args...), pageArgs...)
+	rows, err := s.db.QueryContext(ctx, s.rebind(query), args...)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to query evidence: %w", err)
+	}
+	defer rows.Close()
+
+	var evidenceList []*models.Evidence
+	for rows.Next() {
+		evidence, err := scanEvidence(rows)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to parse evidence: %w", err)
+		}
+		evidenceList = append(evidenceList, evidence)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, "", fmt.Errorf("failed to iterate evidence: %w", err)
+	}
+
+	evidenceList, next := trimPage(q, evidenceList, func(e *models.Evidence) string { return e.ID })
+
+	ids := make([]string, 0, len(evidenceList))
+	for _, evidence := range evidenceList {
+		ids = append(ids, evidence.ID)
+	}
+	links, err := s.evidenceRequirementIDs(ctx, s.db, orgID, ids)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to get evidence requirements: %w", err)
+	}
+	for _, evidence := range evidenceList {
+		evidence.RequirementIDs = links[evidence.ID]
+	}
+
+	return evidenceList, next, nil
+}
+
+// UpdateEvidence updates an evidence item, failing with ErrVersionConflict if
+// it changed since it was read. Evidence counts are adjusted for any
+// requirements whose association with active evidence changed.
+func (s *SQLStore) UpdateEvidence(ctx context.Context, evidence *models.Evidence) error {
+	evidence.UpdatedAt = time.Now()
+	expected := evidence.Version
+
+	err := s.withTx(ctx, func(tx *sql.Tx) error {
+		err := s.claimVersion(ctx, tx, "evidence", "organization_id = ? AND id = ?", expected, evidence.OrganizationID, evidence.ID)
+		if err != nil {
+			return err
+		}
+
+		before, err := s.loadEvidence(ctx, tx, evidence.OrganizationID, evidence.ID)
+		if errors.Is(err, sql.ErrNoRows) {
+			before = nil
+		} else if err != nil {
+			return err
+		}
+
+		evidence.Version = expected + 1
+		if err := s.saveEvidence(ctx, tx, evidence); err != nil {
+			return err
+		}
+		return s.applyEvidenceCountDeltas(ctx, tx, evidence.OrganizationID, evidenceCountDeltas(before, evidence))
+	})
+	if err != nil {
+		evidence.Version = expected
+		return fmt.Errorf("failed to update evidence: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteEvidence soft deletes an evidence item and decrements the evidence
+// counts of its requirements in the same transaction. It fails with
+// ErrVersionConflict unless the stored version equals version.
+func (s *SQLStore) DeleteEvidence(ctx context.Context, orgID, evidenceID string, version int64) error {
+	err := s.withTx(ctx, func(tx *sql.Tx) error {
+		before, err := s.loadEvidence(ctx, tx, orgID, evidenceID)
+		if err != nil {
+			return err
+		}
+		if err := checkVersion(before.Version, version); err != nil {
+			return err
+		}
+
+		after := *before
+		after.Status = "deleted"
+
+		res, err := tx.ExecContext(ctx, s.rebind(`UPDATE evidence SET status = ?, updated_at = ?, version = version + 1
+			WHERE organization_id = ? AND id = ? AND version = ?`), after.Status, utc(time.Now()), orgID, evidenceID, version)
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err == nil && n == 0 {
+			return ErrVersionConflict
+		}
+		return s.applyEvidenceCountDeltas(ctx, tx, orgID, evidenceCountDeltas(before, &after))
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete evidence: %w", err)
+	}
+
+	return nil
+}
+
+// Evidence version methods
+
+const evidenceVersionColumns = `id, organization_id, evidence_id, number, file_url, file_name, file_size,
+	file_type, content_hash, note, status, uploaded_by, created_at, current_from`
+
+// CreateEvidenceVersion records a pending upload of a new evidence file
+func (s *SQLStore) CreateEvidenceVersion(ctx context.Context, version *models.EvidenceVersion) error {
+	if version.ID == "" {
+		version.ID = uuid.New().String()
+	}
+	version.CreatedAt = time.Now()
+
+	if err := s.saveEvidenceVersion(ctx, s.db, version); err != nil {
+		return fmt.Errorf("failed to create evidence version: %w", err)
+	}
+
+	return nil
+}
+
+// GetEvidenceVersion retrieves a version of an evidence item by ID
+func (s *SQLStore) GetEvidenceVersion(ctx context.Context, orgID, evidenceID, versionID string) (*models.EvidenceVersion, error) {
+	row := s.db.QueryRowContext(ctx, s.rebind(`SELECT `+evidenceVersionColumns+` FROM evidence_versions
+		WHERE organization_id = ? AND evidence_id = ? AND id = ?`), orgID, evidenceID, versionID)
+
+	version, err := scanEvidenceVersion(row)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get evidence version: %w", err)
+	}
+
+	return version, nil
+}
+
+// ListEvidenceVersions lists the published versions of an evidence item by number
+func (s *SQLStore) ListEvidenceVersions(ctx context.Context, orgID, evidenceID string) ([]*models.EvidenceVersion, error) {
+	evidence, err := s.loadEvidence(ctx, s.db, orgID, evidenceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get evidence: %w", err)
+	}
+	if legacy := legacyEvidenceVersion(evidence); legacy != nil {
+		return []*models.EvidenceVersion{legacy}, nil
+	}
+
+	rows, err := s.db.QueryContext(ctx, s.rebind(`SELECT `+evidenceVersionColumns+` FROM evidence_versions
+		WHERE organization_id = ? AND evidence_id = ? AND status = ? ORDER BY number`), orgID, evidenceID, "active")
+	if err != nil {
+		return nil, fmt.Errorf("failed to query evidence versions: %w", err)
+	}
+	defer rows.Close()
+
+	var versions []*models.EvidenceVersion
+	for rows.Next() {
+		version, err := scanEvidenceVersion(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse evidence version: %w", err)
+		}
+		versions = append(versions, version)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate evidence versions: %w", err)
+	}
+
+	return versions, nil
+}
+
+// PublishEvidenceVersion makes version the current file of evidence in one
+// transaction, failing with ErrVersionConflict if the evidence changed since
+// it was read
+func (s *SQLStore) PublishEvidenceVersion(ctx context.Context, evidence *models.Evidence, version *models.EvidenceVersion) error {
+	evidence.UpdatedAt = time.Now()
+	expected := evidence.Version
+
+	err := s.withTx(ctx, func(tx *sql.Tx) error {
+		err := s.claimVersion(ctx, tx, "evidence", "organization_id = ? AND id = ?", expected, evidence.OrganizationID, evidence.ID)
+		if err != nil {
+			return err
+		}
+
+		before, err := s.loadEvidence(ctx, tx, evidence.OrganizationID, evidence.ID)
+		if err != nil {
+			return err
+		}
+
+		for _, v := range publishEvidenceVersion(before, evidence, version) {
+			if v.CreatedAt.IsZero() {
+				v.CreatedAt = time.Now()
+			}
+			if err := s.saveEvidenceVersion(ctx, tx, v); err != nil {
+				return err
+			}
+		}
+
+		evidence.Version = expected + 1
+		if err := s.saveEvidence(ctx, tx, evidence); err != nil {
+			return err
+		}
+		return s.applyEvidenceCountDeltas(ctx, tx, evidence.OrganizationID, evidenceCountDeltas(before, evidence))
+	})
+	if err != nil {
+		evidence.Version = expected
+		return fmt.Errorf("failed to publish evidence version: %w", err)
+	}
+
+	return nil
+}
+
+func (s *SQLStore) saveEvidenceVersion(ctx context.Context, q execer, version *models.EvidenceVersion) error {
+	return s.upsert(ctx, q, "evidence_versions", evidenceVersionColumns, "id",
+		version.ID, version.OrganizationID, version.EvidenceID, version.Number, version.FileURL,
+		version.FileName, version.FileSize, version.FileType, version.ContentHash, version.Note,
+		version.Status, version.UploadedBy, utc(version.CreatedAt), nullTime(version.CurrentFrom))
+}
+
+func scanEvidenceVersion(row rowScanner) (*models.EvidenceVersion, error) {
+	var version models.EvidenceVersion
+	var currentFrom sql.NullTime
+	err := row.Scan(&version.ID, &version.OrganizationID, &version.EvidenceID, &version.Number,
+		&version.FileURL, &version.FileName, &version.FileSize, &version.FileType, &version.ContentHash,
+		&version.Note, &version.Status, &version.UploadedBy, &version.CreatedAt, &currentFrom)
+	if err != nil {
+		return nil, err
+	}
+	version.CurrentFrom = timePtr(currentFrom)
+
+	return &version, nil
+}
+
+// ReconcileEvidenceCounts recomputes every requirement's evidence_count from
+// the organization's active evidence and corrects any drift in one transaction
+func (s *SQLStore) ReconcileEvidenceCounts(ctx context.Context, orgID string) ([]EvidenceCountDrift, error) {
+	var drift []EvidenceCountDrift
+
+	err := s.withTx(ctx, func(tx *sql.Tx) error {
+		drift = nil
+
+		rows, err := tx.QueryContext(ctx, s.rebind(`SELECT r.id, r.title, r.evidence_count,
+			(SELECT COUNT(*) FROM evidence_requirements er
+				JOIN evidence e ON e.organization_id = er.organization_id AND e.id = er.evidence_id
+				WHERE er.organization_id = r.organization_id AND er.requirement_id = r.id
+				AND e.status = ?) AS actual_count
+			FROM requirements r WHERE r.organization_id = ? ORDER BY r.id`), "active", orgID)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var d EvidenceCountDrift
+			if err := rows.Scan(&d.RequirementID, &d.Title, &d.StoredCount, &d.ActualCount); err != nil {
+				return err
+			}
+			if d.StoredCount != d.ActualCount {
+				drift = append(drift, d)
+			}
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		rows.Close()
+
+		for _, d := range drift {
+			_, err := tx.ExecContext(ctx, s.rebind(`UPDATE requirements
+				SET evidence_count = ?, updated_at = ?, version = version + 1
+				WHERE organization_id = ? AND id = ?`), d.ActualCount, utc(time.Now()), orgID, d.RequirementID)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to reconcile evidence counts: %w", err)
+	}
+
+	return drift, nil
+}
+
+// loadEvidence reads an evidence row and its requirement links using q,
+// which may be the database or an open transaction
+func (s *SQLStore) loadEvidence(ctx context.Context, q querier, orgID, evidenceID string) (*models.Evidence, error) {
+	row := q.QueryRowContext(ctx, s.rebind(`SELECT `+evidenceColumns+` FROM evidence
+		WHERE organization_id = ? AND id = ?`), orgID, evidenceID)
+
+	evidence, err := scanEvidence(row)
+	if err != nil {
+		return nil, err
+	}
+
+	links, err := s.evidenceRequirementIDs(ctx, q, orgID, []string{evidence.ID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get evidence requirements: %w", err)
+	}
+	evidence.RequirementIDs = links[evidence.ID]
+
+	return evidence, nil
+}
+
+// saveEvidence upserts the evidence row and replaces its requirement links
+func (s *SQLStore) saveEvidence(ctx context.Context, tx *sql.Tx, evidence *models.Evidence) error {
+	err := s.upsert(ctx, tx, "evidence", evidenceColumns, "id",
+		evidence.ID, evidence.OrganizationID, evidence.Title, evidence.Description, string(evidence.Source),
+		utc(evidence.EvidenceDate), evidence.FileURL, evidence.FileName, evidence.FileSize, evidence.FileType,
+		evidence.ExternalLink, toJSON(evidence.Metadata), evidence.UploadedBy,
+		utc(evidence.CreatedAt), utc(evidence.UpdatedAt), evidence.Status, evidence.Version,
+		evidence.ContentHash, evidence.FileVersion, toJSON(evidence.Tags), toJSON(evidence.Scan))
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, s.rebind(`DELETE FROM evidence_requirements WHERE evidence_id = ?`), evidence.ID)
+	if err != nil {
+		return err
+	}
+
+	seen := make(map[string]bool, len(evidence.RequirementIDs))
+	for i, reqID := range evidence.RequirementIDs {
+		if seen[reqID] {
+			continue
+		}
+		seen[reqID] = true
+
+		_, err := tx.ExecContext(ctx, s.rebind(`INSERT INTO evidence_requirements
+			(organization_id, evidence_id, requirement_id, position) VALUES (?, ?, ?, ?)`),
+			evidence.OrganizationID, evidence.ID, reqID, i)
+		if err != nil {
+			return fmt.Errorf("failed to link requirement %s: %w", reqID, err)
+		}
+	}
+
+	return nil
+}
+
+// evidenceRequirementIDs loads the ordered requirement IDs for each evidence ID
+func (s *SQLStore) evidenceRequirementIDs(ctx context.Context, q querier, orgID string, evidenceIDs []string) (map[string][]string, error) {
+	links := make(map[string][]string, len(evidenceIDs))
+	if len(evidenceIDs) == 0 {
+		return links, nil
+	}
+
+	args := []interface{}{orgID}
+	for _, id := range evidenceIDs {
+		args = append(args, id)
+	}
+	query := `SELECT evidence_id, requirement_id FROM evidence_requirements
+		WHERE organization_id = ? AND evidence_id IN (` + placeholders(len(evidenceIDs)) + `)
+		ORDER BY evidence_id, position`
+
+	rows, err := q.QueryContext(ctx, s.rebind(query), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var evidenceID, reqID string
+		if err := rows.Scan(&evidenceID, &reqID); err != nil {
+			return nil, err
+		}
+		links[evidenceID] = append(links[evidenceID], reqID)
+	}
+
+	return links, rows.Err()
+}
+
+func scanEvidence(row rowScanner) (*models.Evidence, error) {
+	var evidence models.Evidence
+	var metadata, tags, scan string
+	err := row.Scan(&evidence.ID, &evidence.OrganizationID, &evidence.Title, &evidence.Description,
+		&evidence.Source, &evidence.EvidenceDate, &evidence.FileURL, &evidence.FileName, &evidence.FileSize,
+		&evidence.FileType, &evidence.ExternalLink, &metadata, &evidence.UploadedBy,
+		&evidence.CreatedAt, &evidence.UpdatedAt, &evidence.Status, &evidence.Version,
+		&evidence.ContentHash, &evidence.FileVersion, &tags, &scan)
+	if err != nil {
+		return nil, err
+	}
+	if err := fromJSON(metadata, &evidence.Metadata); err != nil {
+		return nil, err
+	}
+	if err := fromJSON(tags, &evidence.Tags); err != nil {
+		return nil, err
+	}
+	if err := fromJSON(scan, &evidence.Scan); err != nil {
+		return nil, err
+	}
+
+	return &evidence, nil
+}
+
+// Audit log methods
+
+const auditLogColumns = `id, organization_id, timestamp, user_id, user_email, action, resource_type,
+	resource_id, description, changes, ip_address, user_agent, metadata, sequence, prev_hash, hash, actor_type`
+
+// CreateAuditLog appends an entry to the organization's audit log hash chain.
+// The chain head row is locked for the transaction so concurrent writers
+// cannot fork the chain.
+func (s *SQLStore) CreateAuditLog(ctx context.Context, log *models.AuditLog) error {
+	log.ID = uuid.New().String()
+	log.Timestamp = time.Now()
+
+	err := s.withTx(ctx, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, s.rebind(`INSERT INTO audit_chain_heads (organization_id, sequence, hash)
+			VALUES (?, 0, '') ON CONFLICT (organization_id) DO NOTHING`), log.OrganizationID)
+		if err != nil {
+			return err
+		}
+
+		// A no-op update takes the row lock before the head is read
+		_, err = tx.ExecContext(ctx, s.rebind(`UPDATE audit_chain_heads SET sequence = sequence
+			WHERE organization_id = ?`), log.OrganizationID)
+		if err != nil {
+			return err
+		}
+
+		var head AuditChainHead
+		err = tx.QueryRowContext(ctx, s.rebind(`SELECT sequence, hash FROM audit_chain_heads
+			WHERE organization_id = ?`), log.OrganizationID).Scan(&head.Sequence, &head.Hash)
+		if err != nil {
+			return err
+		}
+
+		log.Chain(head.Sequence, head.Hash)
+
+		_, err = tx.ExecContext(ctx, s.rebind(`INSERT INTO audit_logs (`+auditLogColumns+`)
+			VALUES (`+placeholders(17)+`)`),
+			log.ID, log.OrganizationID, utc(log.Timestamp), log.UserID, log.UserEmail, string(log.Action),
+			log.ResourceType, log.ResourceID, log.Description, toJSON(log.Changes), log.IPAddress, log.UserAgent,
+			toJSON(log.Metadata), log.Sequence, log.PrevHash, log.Hash, string(log.ActorType))
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, s.rebind(`UPDATE audit_chain_heads SET sequence = ?, hash = ?
+			WHERE organization_id = ?`), log.Sequence, log.Hash, log.OrganizationID)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create audit log: %w", err)
+	}
+
+	return nil
+}
+
+// ListAuditLogs lists audit logs for an organization with optional filters, one page at a time
+func (s *SQLStore) ListAuditLogs(ctx context.Context, orgID string, filter AuditLogFilter, opts ListOptions) ([]*models.AuditLog, string, error) {
+	q, err := auditLogSort.resolve(opts)
+	if err != nil {
+		return nil, "", err
+	}
+
+	where, args := auditLogFilterClause(filter)
+	pageWhere, pageArgs, tail := pageClause(q, "id")
+
+	query := `SELECT ` + auditLogColumns + ` FROM audit_logs WHERE organization_id = ?` + where + pageWhere + tail
+	args = append(append([]interface{}{orgID}, args...), pageArgs...)
+	rows, err := s.db.QueryContext(ctx, s.rebind(query), args...)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to query audit logs: %w", err)
+	}
+	defer rows.Close()
+
+	var logs []*models.AuditLog
+	for rows.Next() {
+		log, err := scanAuditLog(rows)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to parse audit log: %w", err)
+		}
+		logs = append(logs, log)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, "", fmt.Errorf("failed to iterate audit logs: %w", err)
+	}
+
+	logs, next := trimPage(q, logs, func(l *models.AuditLog) string { return l.ID })
+	return logs, next, nil
+}
+
+// GetAuditChainHead returns the last link of the organization's audit chain.
+// An organization with no chained entries has a zero head.
+func (s *SQLStore) GetAuditChainHead(ctx context.Context, orgID string) (*AuditChainHead, error) {
+	var head AuditChainHead
+	err := s.db.QueryRowContext(ctx, s.rebind(`SELECT sequence, hash FROM audit_chain_heads
+		WHERE organization_id = ?`), orgID).Scan(&head.Sequence, &head.Hash)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("failed to get audit chain head: %w", err)
+	}
+
+	return &head, nil
+}
+
+// ListAuditLogsBySequence returns up to limit chained audit log entries with
+// a sequence greater than afterSequence, in sequence order
+func (s *SQLStore) ListAuditLogsBySequence(ctx context.Context, orgID string, afterSequence int64, limit int) ([]*models.AuditLog, error) {
+	rows, err := s.db.QueryContext(ctx, s.rebind(`SELECT `+auditLogColumns+` FROM audit_logs
+		WHERE organization_id = ? AND sequence > ? ORDER BY sequence LIMIT ?`), orgID, afterSequence, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query audit logs: %w", err)
+	}
+	defer rows.Close()
+
+	var logs []*models.AuditLog
+	for rows.Next() {
+		log, err := scanAuditLog(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse audit log: %w", err)
+		}
+		logs = append(logs, log)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate audit logs: %w", err)
+	}
+
+	return logs, nil
+}
+
+// GetAuditForwardCheckpoint returns the sequence of the last audit log entry
+// delivered to the named sink, or 0 if nothing has been delivered yet
+func (s *SQLStore) GetAuditForwardCheckpoint(ctx context.Context, orgID, sink string) (int64, error) {
+	var sequence int64
+	err := s.db.QueryRowContext(ctx, s.rebind(`SELECT sequence FROM audit_forward_checkpoints
+		WHERE organization_id = ? AND sink = ?`), orgID, sink).Scan(&sequence)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return 0, fmt.Errorf("failed to get audit forward checkpoint: %w", err)
+	}
+
+	return sequence, nil
+}
+
+// SaveAuditForwardCheckpoint records that entries up to sequence have been
+// delivered to the named sink
+func (s *SQLStore) SaveAuditForwardCheckpoint(ctx context.Context, orgID, sink string, sequence int64) error {
+	_, err := s.db.ExecContext(ctx, s.rebind(`INSERT INTO audit_forward_checkpoints (organization_id, sink, sequence, updated_at)
+		VALUES (?, ?, ?, ?) ON CONFLICT (organization_id, sink)
+		DO UPDATE SET sequence = excluded.sequence, updated_at = excluded.updated_at`),
+		orgID, sink, sequence, utc(time.Now()))
+	if err != nil {
+		return fmt.Errorf("failed to save audit forward checkpoint: %w", err)
+	}
+
+	return nil
+}
+
+// auditLogFilterClause builds the WHERE conditions for an audit log filter
+func auditLogFilterClause(filter AuditLogFilter) (string, []interface{}) {
+	var clause strings.Builder
+	var args []interface{}
+
+	if filter.UserID != "" {
+		clause.WriteString(" AND user_id = ?")
+		args = append(args, filter.UserID)
+	}
+	if filter.ActorType != "" {
+		clause.WriteString(" AND actor_type = ?")
+		args = append(args, string(filter.ActorType))
+	}
+	if len(filter.Actions) > 0 {
+		clause.WriteString(" AND action IN (" + placeholders(len(filter.Actions)) + ")")
+		for _, action := range filter.Actions {
+			args = append(args, string(action))
+		}
+	}
+	if filter.ResourceType != "" {
+		clause.WriteString(" AND resource_type = ?")
+		args = append(args, filter.ResourceType)
+	}
+	if filter.ResourceID != "" {
+		clause.WriteString(" AND resource_id = ?")
+		args = append(args, filter.ResourceID)
+	}
+	if !filter.From.IsZero() {
+		clause.WriteString(" AND timestamp >= ?")
+		args = append(args, utc(filter.From))
+	}
+	if !filter.To.IsZero() {
+		clause.WriteString(" AND timestamp < ?")
+		args = append(args, utc(filter.To))
+	}
+	if filter.Search != "" {
+		pattern := "%" + likeEscaper.Replace(strings.ToLower(filter.Search)) + "%"
+		clause.WriteString(` AND (LOWER(description) LIKE ? ESCAPE '\' OR LOWER(user_email) LIKE ? ESCAPE '\')`)
+		args = append(args, pattern, pattern)
+	}
+
+	return clause.String(), args
+}
+
+// likeEscaper escapes LIKE wildcards so search text matches literally
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+func scanAuditLog(row rowScanner) (*models.AuditLog, error) {
+	var log models.AuditLog
+	var changes, metadata string
+	err := row.Scan(&log.ID, &log.OrganizationID, &log.Timestamp, &log.UserID, &log.UserEmail, &log.Action,
+		&log.ResourceType, &log.ResourceID, &log.Description, &changes, &log.IPAddress, &log.UserAgent, &metadata,
+		&log.Sequence, &log.PrevHash, &log.Hash, &log.ActorType)
+	if err != nil {
+		return nil, err
+	}
+	if err := fromJSON(changes, &log.Changes); err != nil {
+		return nil, err
+	}
+	if err := fromJSON(metadata, &log.Metadata); err != nil {
+		return nil, err
+	}
+
+	return &log, nil
+}
+
+// Report methods
+
+const reportColumns = `id, organization_id, title, description, type, requirement_ids, status, file_url,
+	generated_by, created_at, completed_at, error_message, as_of`
+
+// CreateReport creates a new report
+func (s *SQLStore) CreateReport(ctx context.Context, report *models.Report) error {
+	report.ID = uuid.New().String()
+	report.CreatedAt = time.Now()
+
+	if err := s.saveReport(ctx, report); err != nil {
+		return fmt.Errorf("failed to create report: %w", err)
+	}
+
+	return nil
+}
+
+// GetReport retrieves a report by ID
+func (s *SQLStore) GetReport(ctx context.Context, orgID, reportID string) (*models.Report, error) {
+	row := s.db.QueryRowContext(ctx, s.rebind(`SELECT `+reportColumns+` FROM reports
+		WHERE organization_id = ? AND id = ?`), orgID, reportID)
+
+	var report models.Report
+	var requirementIDs string
+	var completedAt, asOf sql.NullTime
+	err := row.Scan(&report.ID, &report.OrganizationID, &report.Title, &report.Description, &report.Type,
+		&requirementIDs, &report.Status, &report.FileURL, &report.GeneratedBy, &report.CreatedAt, &completedAt,
+		&report.ErrorMessage, &asOf)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get report: %w", err)
+	}
+	if err := fromJSON(requirementIDs, &report.RequirementIDs); err != nil {
+		return nil, fmt.Errorf("failed to parse report: %w", err)
+	}
+	report.CompletedAt = timePtr(completedAt)
+	report.AsOf = timePtr(asOf)
+
+	return &report, nil
+}
+
+// UpdateReport updates a report
+func (s *SQLStore) UpdateReport(ctx context.Context, report *models.Report) error {
+	if err := s.saveReport(ctx, report); err != nil {
+		return fmt.Errorf("failed to update report: %w", err)
+	}
+
+	return nil
+}
+
+func (s *SQLStore) saveReport(ctx context.Context, report *models.Report) error {
+	return s.upsert(ctx, s.db, "reports", reportColumns, "id",
+		report.ID, report.OrganizationID, report.Title, report.Description, report.Type,
+		toJSON(report.RequirementIDs), report.Status, report.FileURL, report.GeneratedBy,
+		utc(report.CreatedAt), nullTime(report.CompletedAt), report.ErrorMessage, nullTime(report.AsOf))
+}
+
+// Requirement template methods
+
+const templateColumns = `id, title, description, category, regulatory_framework, authority, evidence_types,
+	frequency, is_active, created_at, updated_at`
+
+// GetRequirementTemplate retrieves a requirement template by ID
+func (s *SQLStore) GetRequirementTemplate(ctx context.Context, templateID string) (*models.RequirementTemplate, error) {
+	row := s.db.QueryRowContext(ctx, s.rebind(`SELECT `+templateColumns+` FROM requirement_templates WHERE id = ?`), templateID)
+
+	template, err := scanTemplate(row)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get requirement template: %w", err)
+	}
+
+	return template, nil
+}
+
+// ListRequirementTemplates lists requirement templates by framework
+func (s *SQLStore) ListRequirementTemplates(ctx context.Context, framework models.RegulatoryFramework) ([]*models.RequirementTemplate, error) {
+	rows, err := s.db.QueryContext(ctx, s.rebind(`SELECT `+templateColumns+` FROM requirement_templates
+		WHERE regulatory_framework = ? AND is_active = ? ORDER BY id`), string(framework), true)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query templates: %w", err)
+	}
+	defer rows.Close()
+
+	var templates []*models.RequirementTemplate
+	for rows.Next() {
+		template, err := scanTemplate(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse template: %w", err)
+		}
+		templates = append(templates, template)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate templates: %w", err)
+	}
+
+	return templates, nil
+}
+
+// SaveRequirementTemplate creates or replaces a requirement template. The
+// Firestore deployment seeds templates out of band; SQL deployments use this.
+func (s *SQLStore) SaveRequirementTemplate(ctx context.Context, template *models.RequirementTemplate) error {
+	if template.ID == "" {
+		template.ID = uuid.New().String()
+	}
+	if template.CreatedAt.IsZero() {
+		template.CreatedAt = time.Now()
+	}
+	template.UpdatedAt = time.Now()
+
+	err := s.upsert(ctx, s.db, "requirement_templates", templateColumns, "id",
+		template.ID, template.Title, template.Description, string(template.Category),
+		string(template.RegulatoryFramework), template.Authority, toJSON(template.EvidenceTypes),
+		string(template.Frequency), template.IsActive, utc(template.CreatedAt), utc(template.UpdatedAt))
+	if err != nil {
+		return fmt.Errorf("failed to save requirement template: %w", err)
+	}
+
+	return nil
+}
+
+func scanTemplate(row rowScanner) (*models.RequirementTemplate, error) {
+	var template models.RequirementTemplate
+	var evidenceTypes string
+	err := row.Scan(&template.ID, &template.Title, &template.Description, &template.Category,
+		&template.RegulatoryFramework, &template.Authority, &evidenceTypes, &template.Frequency,
+		&template.IsActive, &template.CreatedAt, &template.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if err := fromJSON(evidenceTypes, &template.EvidenceTypes); err != nil {
+		return nil, err
+	}
+
+	return &template, nil
+}
+
+// Migrations
+
+// migrate applies every migration newer than the recorded schema version
+func (s *SQLStore) migrate(ctx context.Context) error {
+	_, err := s.db.ExecContext(ctx, s.ddl(`CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    INTEGER PRIMARY KEY,
+		applied_at TIMESTAMP NOT NULL
+	)`))
+	if err != nil {
+		return fmt.Errorf("failed to create schema_migrations table: %w", err)
+	}
+
+	var current int
+	row := s.db.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_migrations`)
+	if err := row.Scan(&current); err != nil {
+		return fmt.Errorf("failed to read schema version: %w", err)
+	}
+
+	for _, m := range sqlMigrations {
+		if m.version <= current {
+			continue
+		}
+
+		err := s.withTx(ctx, func(tx *sql.Tx) error {
+			for _, stmt := range m.statements {
+				if _, err := tx.ExecContext(ctx, s.ddl(stmt)); err != nil {
+					return err
+				}
+			}
+			_, err := tx.ExecContext(ctx, s.rebind(`INSERT INTO schema_migrations (version, applied_at) VALUES (?, ?)`),
+				m.version, utc(time.Now()))
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("failed to apply migration %d: %w", m.version, err)
+		}
+	}
+
+	return nil
+}
+
+// Helper methods
+
+// rowScanner is satisfied by *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// execer is satisfied by *sql.DB and *sql.Tx
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// querier is satisfied by *sql.DB and *sql.Tx
+type querier interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+func (s *SQLStore) withTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// upsert inserts a row or replaces every non-key column when the key exists,
+// matching Firestore's Set semantics
+func (s *SQLStore) upsert(ctx context.Context, q execer, table, columns, key string, values ...interface{}) error {
+	cols := splitColumns(columns)
+
+	var updates []string
+	for _, col := range cols {
+		if col != key {
+			updates = append(updates, col+" = excluded."+col)
+		}
+	}
+
+	query := fmt.Sprintf(`INSERT INTO %s (%s) VALUES (%s) ON CONFLICT (%s) DO UPDATE SET %s`,
+		table, strings.Join(cols, ", "), placeholders(len(cols)), key, strings.Join(updates, ", "))
+
+	_, err := q.ExecContext(ctx, s.rebind(query), values...)
+	return err
+}
+
+// applyEvidenceCountDeltas adjusts requirement evidence counts inside tx and
+// bumps each changed requirement's version. A missing requirement fails the
+// transaction.
+func (s *SQLStore) applyEvidenceCountDeltas(ctx context.Context, tx *sql.Tx, orgID string, deltas map[string]int) error {
+	for reqID, delta := range deltas {
+		if delta == 0 {
+			continue
+		}
+		res, err := tx.ExecContext(ctx, s.rebind(`UPDATE requirements
+			SET evidence_count = evidence_count + ?, updated_at = ?, version = version + 1
+			WHERE organization_id = ? AND id = ?`), delta, utc(time.Now()), orgID, reqID)
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err == nil && n == 0 {
+			return fmt.Errorf("requirement %s not found", reqID)
+		}
+	}
+	return nil
+}
+
+// claimVersion bumps a row's version inside tx if it still equals expected,
+// returning ErrVersionConflict when another writer changed the row first. The
+// row stays locked until tx ends. A row that does not exist yet passes so
+// updates keep their upsert semantics.
+func (s *SQLStore) claimVersion(ctx context.Context, tx *sql.Tx, table, where string, expected int64, args ...interface{}) error {
+	res, err := tx.ExecContext(ctx, s.rebind(`UPDATE `+table+` SET version = version + 1
+		WHERE `+where+` AND version = ?`), append(args, expected)...)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil || n > 0 {
+		return err
+	}
+
+	var exists int
+	err = tx.QueryRowContext(ctx, s.rebind(`SELECT COUNT(*) FROM `+table+` WHERE `+where), args...).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if exists > 0 {
+		return ErrVersionConflict
+	}
+	return nil
+}
+
+// rebind rewrites ? placeholders into the dialect's bind syntax
+func (s *SQLStore) rebind(query string) string {
+	if s.dialect != DialectPostgres {
+		return query
+	}
+
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// ddl adapts a schema statement to the dialect
+func (s *SQLStore) ddl(stmt string) string {
+	if s.dialect == DialectPostgres {
+		return strings.ReplaceAll(stmt, "TIMESTAMP", "TIMESTAMPTZ")
+	}
+	return stmt
+}
+
+// sqliteDSN enables foreign key enforcement and a sortable time format
+func sqliteDSN(dsn string) string {
+	sep := "?"
+	if strings.Contains(dsn, "?") {
+		sep = "&"
+	}
+	if !strings.Contains(dsn, "foreign_keys") {
+		dsn += sep + "_pragma=foreign_keys(1)"
+		sep = "&"
+	}
+	if !strings.Contains(dsn, "_time_format") {
+		dsn += sep + "_time_format=sqlite"
+	}
+	return dsn
+}
+
+// filterClause builds an AND clause from equality filters, rejecting any key
+// that is not an allowed column
+func filterClause(filters map[string]interface{}, allowed map[string]bool) (string, []interface{}, error) {
+	var clause strings.Builder
+	var args []interface{}
+	for key, value := range filters {
+		if !allowed[key] {
+			return "", nil, fmt.Errorf("unsupported filter: %s", key)
+		}
+		clause.WriteString(" AND " + key + " = ?")
+
+		// Named string types (models.AuditAction etc.) are passed as plain strings
+		if v := reflect.ValueOf(value); v.Kind() == reflect.String {
+			value = v.String()
+		}
+		args = append(args, value)
+	}
+	return clause.String(), args, nil
+}
+
+// pageClause returns the keyset condition for the cursor plus the ORDER BY and
+// LIMIT tail. One extra row is fetched so trimPage can detect another page.
+// The sort field comes from a sortSpec, never from user input directly.
+func pageClause(q *pageQuery, idColumn string) (string, []interface{}, string) {
+	dir, cmp := "ASC", ">"
+	if q.desc {
+		dir, cmp = "DESC", "<"
+	}
+
+	var where string
+	var args []interface{}
+	if q.cursor != nil {
+		value := q.cursorValue()
+		if t, ok := value.(time.Time); ok {
+			value = utc(t)
+		}
+		where = fmt.Sprintf(" AND (%[1]s %[2]s ? OR (%[1]s = ? AND %[3]s %[2]s ?))", q.field, cmp, idColumn)
+		args = []interface{}{value, value, q.cursor.ID}
+	}
+
+	tail := fmt.Sprintf(" ORDER BY %s %s, %s %s", q.field, dir, idColumn, dir)
+	if q.size > 0 {
+		tail += " LIMIT " + strconv.Itoa(q.size+1)
+	}
+
+	return where, args, tail
+}
+
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
+func splitColumns(columns string) []string {
+	var cols []string
+	for _, col := range strings.Split(columns, ",") {
+		cols = append(cols, strings.TrimSpace(col))
+	}
+	return cols
+}
+
+// utc normalises times so SQLite's text timestamps sort chronologically
+func utc(t time.Time) time.Time {
+	return t.UTC()
+}
+
+func nullTime(t *time.Time) sql.NullTime {
+	if t == nil {
+		return sql.NullTime{}
+	}
+	return sql.NullTime{Time: t.UTC(), Valid: true}
+}
+
+func timePtr(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
+
+func toJSON(v interface{}) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "null"
+	}
+	return string(b)
+}
+
+func fromJSON(s string, v interface{}) error {
+	if s == "" {
+		return nil
+	}
+	return json.Unmarshal([]byte(s), v)
+}
@@ -0,0 +1,435 @@
+package store
+
+// sqlMigration is a numbered schema change applied once per database.
+// Statements are written for SQLite and Postgres alike; the TIMESTAMP type is
+// rewritten to TIMESTAMPTZ for Postgres so times round-trip with their zone.
+type sqlMigration struct {
+	version    int
+	statements []string
+}
+
+// sqlMigrations lists every schema change in order. Never edit an applied
+// migration; append a new one instead.
+var sqlMigrations = []sqlMigration{
+	{
+		version: 1,
+		statements: []string{
+			`CREATE TABLE organizations (
+				id                     TEXT PRIMARY KEY,
+				name                   TEXT NOT NULL,
+				industry               TEXT NOT NULL DEFAULT '',
+				employee_count         TEXT NOT NULL DEFAULT '',
+				regulatory_framework   TEXT NOT NULL DEFAULT '',
+				website                TEXT NOT NULL DEFAULT '',
+				address                TEXT NOT NULL DEFAULT '',
+				phone                  TEXT NOT NULL DEFAULT '',
+				subscription_tier      TEXT NOT NULL DEFAULT '',
+				subscription_status    TEXT NOT NULL DEFAULT '',
+				stripe_customer_id     TEXT NOT NULL DEFAULT '',
+				stripe_subscription_id TEXT NOT NULL DEFAULT '',
+				current_period_start   TIMESTAMP NOT NULL,
+				current_period_end     TIMESTAMP NOT NULL,
+				cancel_at_period_end   BOOLEAN NOT NULL DEFAULT FALSE,
+				max_users              INTEGER NOT NULL DEFAULT 0,
+				monthly_price          DOUBLE PRECISION NOT NULL DEFAULT 0,
+				created_at             TIMESTAMP NOT NULL,
+				updated_at             TIMESTAMP NOT NULL,
+				updated_by             TEXT NOT NULL DEFAULT '',
+				active_user_count      INTEGER NOT NULL DEFAULT 0
+			)`,
+			`CREATE TABLE users (
+				uid             TEXT PRIMARY KEY,
+				email           TEXT NOT NULL,
+				full_name       TEXT NOT NULL DEFAULT '',
+				organization_id TEXT NOT NULL REFERENCES organizations (id),
+				role            TEXT NOT NULL,
+				status          TEXT NOT NULL,
+				email_verified  BOOLEAN NOT NULL DEFAULT FALSE,
+				created_at      TIMESTAMP NOT NULL,
+				updated_at      TIMESTAMP NOT NULL,
+				last_login_at   TIMESTAMP
+			)`,
+			`CREATE INDEX users_email_idx ON users (email)`,
+			`CREATE INDEX users_organization_idx ON users (organization_id)`,
+			`CREATE TABLE requirement_templates (
+				id                   TEXT PRIMARY KEY,
+				title                TEXT NOT NULL,
+				description          TEXT NOT NULL DEFAULT '',
+				category             TEXT NOT NULL DEFAULT '',
+				regulatory_framework TEXT NOT NULL,
+				authority            TEXT NOT NULL DEFAULT '',
+				evidence_types       TEXT NOT NULL DEFAULT '[]',
+				frequency            TEXT NOT NULL DEFAULT '',
+				is_active            BOOLEAN NOT NULL DEFAULT TRUE,
+				created_at           TIMESTAMP NOT NULL,
+				updated_at           TIMESTAMP NOT NULL
+			)`,
+			`CREATE INDEX requirement_templates_framework_idx ON requirement_templates (regulatory_framework, is_active)`,
+			`CREATE TABLE requirements (
+				id                  TEXT PRIMARY KEY,
+				organization_id     TEXT NOT NULL REFERENCES organizations (id),
+				template_id         TEXT NOT NULL DEFAULT '',
+				title               TEXT NOT NULL,
+				description         TEXT NOT NULL DEFAULT '',
+				category            TEXT NOT NULL DEFAULT '',
+				authority           TEXT NOT NULL DEFAULT '',
+				evidence_types      TEXT NOT NULL DEFAULT '[]',
+				frequency           TEXT NOT NULL DEFAULT '',
+				status              TEXT NOT NULL,
+				next_due_date       TIMESTAMP,
+				last_completed_date TIMESTAMP,
+				evidence_count      INTEGER NOT NULL DEFAULT 0,
+				notes               TEXT NOT NULL DEFAULT '',
+				activated_at        TIMESTAMP NOT NULL,
+				activated_by        TEXT NOT NULL DEFAULT '',
+				updated_at          TIMESTAMP NOT NULL,
+				updated_by          TEXT NOT NULL DEFAULT '',
+				is_active           BOOLEAN NOT NULL DEFAULT TRUE,
+				UNIQUE (organization_id, id)
+			)`,
+			`CREATE TABLE evidence (
+				id              TEXT PRIMARY KEY,
+				organization_id TEXT NOT NULL REFERENCES organizations (id),
+				title           TEXT NOT NULL DEFAULT '',
+				description     TEXT NOT NULL DEFAULT '',
+				source          TEXT NOT NULL DEFAULT '',
+				evidence_date   TIMESTAMP NOT NULL,
+				file_url        TEXT NOT NULL DEFAULT '',
+				file_name       TEXT NOT NULL DEFAULT '',
+				file_size       BIGINT NOT NULL DEFAULT 0,
+				file_type       TEXT NOT NULL DEFAULT '',
+				external_link   TEXT NOT NULL DEFAULT '',
+				metadata        TEXT NOT NULL DEFAULT '{}',
+				uploaded_by     TEXT NOT NULL DEFAULT '',
+				created_at      TIMESTAMP NOT NULL,
+				updated_at      TIMESTAMP NOT NULL,
+				status          TEXT NOT NULL,
+				UNIQUE (organization_id, id)
+			)`,
+			`CREATE INDEX evidence_organization_status_idx ON evidence (organization_id, status)`,
+			// Join table for Evidence.RequirementIDs. The composite keys keep
+			// both sides inside the same organization.
+			`CREATE TABLE evidence_requirements (
+				organization_id TEXT NOT NULL,
+				evidence_id     TEXT NOT NULL,
+				requirement_id  TEXT NOT NULL,
+				position        INTEGER NOT NULL,
+				PRIMARY KEY (evidence_id, requirement_id),
+				FOREIGN KEY (organization_id, evidence_id) REFERENCES evidence (organization_id, id) ON DELETE CASCADE,
+				FOREIGN KEY (organization_id, requirement_id) REFERENCES requirements (organization_id, id)
+			)`,
+			`CREATE INDEX evidence_requirements_requirement_idx ON evidence_requirements (organization_id, requirement_id)`,
+			`CREATE TABLE audit_logs (
+				id              TEXT PRIMARY KEY,
+				organization_id TEXT NOT NULL REFERENCES organizations (id),
+				timestamp       TIMESTAMP NOT NULL,
+				user_id         TEXT NOT NULL DEFAULT '',
+				user_email      TEXT NOT NULL DEFAULT '',
+				action          TEXT NOT NULL,
+				resource_type   TEXT NOT NULL DEFAULT '',
+				resource_id     TEXT NOT NULL DEFAULT '',
+				description     TEXT NOT NULL DEFAULT '',
+				changes         TEXT NOT NULL DEFAULT '{}',
+				ip_address      TEXT NOT NULL DEFAULT '',
+				user_agent      TEXT NOT NULL DEFAULT '',
+				metadata        TEXT NOT NULL DEFAULT '{}'
+			)`,
+			`CREATE INDEX audit_logs_organization_timestamp_idx ON audit_logs (organization_id, timestamp)`,
+			`CREATE TABLE reports (
+				id              TEXT PRIMARY KEY,
+				organization_id TEXT NOT NULL REFERENCES organizations (id),
+				title           TEXT NOT NULL DEFAULT '',
+				description     TEXT NOT NULL DEFAULT '',
+				type            TEXT NOT NULL,
+				requirement_ids TEXT NOT NULL DEFAULT '[]',
+				status          TEXT NOT NULL,
+				file_url        TEXT NOT NULL DEFAULT '',
+				generated_by    TEXT NOT NULL DEFAULT '',
+				created_at      TIMESTAMP NOT NULL,
+				completed_at    TIMESTAMP,
+				error_message   TEXT NOT NULL DEFAULT ''
+			)`,
+		},
+	},
+	{
+		// Version counters for optimistic concurrency control
+		version: 2,
+		statements: []string{
+			`ALTER TABLE organizations ADD COLUMN version BIGINT NOT NULL DEFAULT 0`,
+			`ALTER TABLE requirements ADD COLUMN version BIGINT NOT NULL DEFAULT 0`,
+			`ALTER TABLE evidence ADD COLUMN version BIGINT NOT NULL DEFAULT 0`,
+		},
+	},
+	{
+		// Hash chain for tamper-evident audit logs
+		version: 3,
+		statements: []string{
+			`ALTER TABLE audit_logs ADD COLUMN sequence BIGINT NOT NULL DEFAULT 0`,
+			`ALTER TABLE audit_logs ADD COLUMN prev_hash TEXT NOT NULL DEFAULT ''`,
+			`ALTER TABLE audit_logs ADD COLUMN hash TEXT NOT NULL DEFAULT ''`,
+			`CREATE UNIQUE INDEX audit_logs_organization_sequence_idx ON audit_logs (organization_id, sequence)
+				WHERE sequence > 0`,
+			`CREATE TABLE audit_chain_heads (
+				organization_id TEXT PRIMARY KEY,
+				sequence        BIGINT NOT NULL,
+				hash            TEXT NOT NULL
+			)`,
+		},
+	},
+	{
+		// Forwarding checkpoints for shipping audit logs to external sinks
+		version: 4,
+		statements: []string{
+			`CREATE TABLE audit_forward_checkpoints (
+				organization_id TEXT NOT NULL,
+				sink            TEXT NOT NULL,
+				sequence        BIGINT NOT NULL,
+				updated_at      TIMESTAMP NOT NULL,
+				PRIMARY KEY (organization_id, sink)
+			)`,
+		},
+	},
+	{
+		// Persisted user invitations
+		version: 5,
+		statements: []string{
+			`CREATE TABLE invitations (
+				id              TEXT PRIMARY KEY,
+				email           TEXT NOT NULL,
+				organization_id TEXT NOT NULL REFERENCES organizations (id),
+				role            TEXT NOT NULL,
+				invited_by      TEXT NOT NULL DEFAULT '',
+				message         TEXT NOT NULL DEFAULT '',
+				token           TEXT NOT NULL,
+				status          TEXT NOT NULL,
+				created_at      TIMESTAMP NOT NULL,
+				expires_at      TIMESTAMP NOT NULL,
+				sent_at         TIMESTAMP NOT NULL,
+				accepted_at     TIMESTAMP,
+				accepted_by     TEXT NOT NULL DEFAULT ''
+			)`,
+			`CREATE UNIQUE INDEX invitations_token_idx ON invitations (token)`,
+			`CREATE INDEX invitations_organization_status_idx ON invitations (organization_id, status)`,
+		},
+	},
+	{
+		// Scoped API keys for machine-to-machine access
+		version: 6,
+		statements: []string{
+			`CREATE TABLE api_keys (
+				id              TEXT PRIMARY KEY,
+				organization_id TEXT NOT NULL REFERENCES organizations (id),
+				name            TEXT NOT NULL,
+				prefix          TEXT NOT NULL,
+				key_hash        TEXT NOT NULL,
+				scopes          TEXT NOT NULL,
+				created_by      TEXT NOT NULL DEFAULT '',
+				created_at      TIMESTAMP NOT NULL,
+				expires_at      TIMESTAMP,
+				last_used_at    TIMESTAMP,
+				revoked_at      TIMESTAMP,
+				revoked_by      TEXT NOT NULL DEFAULT ''
+			)`,
+			`CREATE UNIQUE INDEX api_keys_key_hash_idx ON api_keys (key_hash)`,
+			`CREATE INDEX api_keys_organization_idx ON api_keys (organization_id)`,
+		},
+	},
+	{
+		// Organization-defined custom roles
+		version: 7,
+		statements: []string{
+			`CREATE TABLE roles (
+				id              TEXT PRIMARY KEY,
+				organization_id TEXT NOT NULL REFERENCES organizations (id),
+				name            TEXT NOT NULL,
+				description     TEXT NOT NULL DEFAULT '',
+				permissions     TEXT NOT NULL,
+				created_by      TEXT NOT NULL DEFAULT '',
+				created_at      TIMESTAMP NOT NULL,
+				updated_by      TEXT NOT NULL DEFAULT '',
+				updated_at      TIMESTAMP NOT NULL,
+				version         BIGINT NOT NULL DEFAULT 0
+			)`,
+			`CREATE INDEX roles_organization_idx ON roles (organization_id)`,
+		},
+	},
+	{
+		// Time-boxed external auditor access, and the actor type of audit entries
+		version: 8,
+		statements: []string{
+			`CREATE TABLE auditor_grants (
+				id               TEXT PRIMARY KEY,
+				organization_id  TEXT NOT NULL REFERENCES organizations (id),
+				auditor_email    TEXT NOT NULL,
+				auditor_name     TEXT NOT NULL DEFAULT '',
+				purpose          TEXT NOT NULL DEFAULT '',
+				requirement_ids  TEXT NOT NULL DEFAULT '[]',
+				report_ids       TEXT NOT NULL DEFAULT '[]',
+				window_start     TIMESTAMP NOT NULL,
+				window_end       TIMESTAMP NOT NULL,
+				expires_at       TIMESTAMP NOT NULL,
+				token_hash       TEXT NOT NULL,
+				created_by       TEXT NOT NULL DEFAULT '',
+				created_at       TIMESTAMP NOT NULL,
+				last_accessed_at TIMESTAMP,
+				revoked_at       TIMESTAMP,
+				revoked_by       TEXT NOT NULL DEFAULT ''
+			)`,
+			`CREATE UNIQUE INDEX auditor_grants_token_hash_idx ON auditor_grants (token_hash)`,
+			`CREATE INDEX auditor_grants_organization_idx ON auditor_grants (organization_id)`,
+			`ALTER TABLE audit_logs ADD COLUMN actor_type TEXT NOT NULL DEFAULT ''`,
+			`CREATE INDEX audit_logs_organization_actor_type_idx ON audit_logs (organization_id, actor_type, timestamp)`,
+		},
+	},
+	{
+		// Per-organization single sign-on, verified email domains and API-issued sessions
+		version: 9,
+		statements: []string{
+			`CREATE TABLE sso_configs (
+				organization_id       TEXT PRIMARY KEY REFERENCES organizations (id),
+				protocol              TEXT NOT NULL,
+				enabled               BOOLEAN NOT NULL DEFAULT FALSE,
+				enforced              BOOLEAN NOT NULL DEFAULT FALSE,
+				default_role          TEXT NOT NULL,
+				oidc_issuer           TEXT NOT NULL DEFAULT '',
+				oidc_client_id        TEXT NOT NULL DEFAULT '',
+				oidc_client_secret    TEXT NOT NULL DEFAULT '',
+				saml_metadata_url     TEXT NOT NULL DEFAULT '',
+				saml_idp_entity_id    TEXT NOT NULL DEFAULT '',
+				saml_idp_sso_url      TEXT NOT NULL DEFAULT '',
+				saml_idp_certificates TEXT NOT NULL DEFAULT '[]',
+				updated_by            TEXT NOT NULL DEFAULT '',
+				updated_at            TIMESTAMP NOT NULL,
+				version               BIGINT NOT NULL DEFAULT 0
+			)`,
+			`CREATE TABLE domains (
+				id                 TEXT PRIMARY KEY,
+				organization_id    TEXT NOT NULL REFERENCES organizations (id),
+				name               TEXT NOT NULL,
+				verification_token TEXT NOT NULL,
+				status             TEXT NOT NULL,
+				created_by         TEXT NOT NULL DEFAULT '',
+				created_at         TIMESTAMP NOT NULL,
+				verified_at        TIMESTAMP
+			)`,
+			`CREATE INDEX domains_organization_idx ON domains (organization_id)`,
+			`CREATE INDEX domains_name_idx ON domains (name)`,
+			`CREATE UNIQUE INDEX domains_verified_name_idx ON domains (name) WHERE status = 'verified'`,
+			`CREATE TABLE sessions (
+				id              TEXT PRIMARY KEY,
+				user_id         TEXT NOT NULL,
+				organization_id TEXT NOT NULL REFERENCES organizations (id),
+				token_hash      TEXT NOT NULL,
+				auth_method     TEXT NOT NULL,
+				ip_address      TEXT NOT NULL DEFAULT '',
+				user_agent      TEXT NOT NULL DEFAULT '',
+				created_at      TIMESTAMP NOT NULL,
+				expires_at      TIMESTAMP NOT NULL,
+				revoked_at      TIMESTAMP
+			)`,
+			`CREATE UNIQUE INDEX sessions_token_hash_idx ON sessions (token_hash)`,
+			`CREATE INDEX sessions_user_idx ON sessions (user_id)`,
+		},
+	},
+	{
+		// Revocation of a user's ID tokens and sessions
+		version: 10,
+		statements: []string{
+			`ALTER TABLE users ADD COLUMN tokens_revoked_at TIMESTAMP`,
+		},
+	},
+	{
+		// Memberships in organizations other than the user's own
+		version: 11,
+		statements: []string{
+			`CREATE TABLE memberships (
+				id              TEXT PRIMARY KEY,
+				user_id         TEXT NOT NULL,
+				organization_id TEXT NOT NULL REFERENCES organizations (id),
+				email           TEXT NOT NULL,
+				role            TEXT NOT NULL,
+				invitation_id   TEXT NOT NULL DEFAULT '',
+				created_at      TIMESTAMP NOT NULL,
+				updated_at      TIMESTAMP NOT NULL
+			)`,
+			`CREATE UNIQUE INDEX memberships_organization_user_idx ON memberships (organization_id, user_id)`,
+			`CREATE INDEX memberships_user_idx ON memberships (user_id)`,
+		},
+	},
+	{
+		// Partner organizations and the client organizations they manage
+		version: 12,
+		statements: []string{
+			`ALTER TABLE organizations ADD COLUMN partner BOOLEAN NOT NULL DEFAULT FALSE`,
+			`ALTER TABLE organizations ADD COLUMN partner_id TEXT NOT NULL DEFAULT ''`,
+			`ALTER TABLE organizations ADD COLUMN baseline_template_ids TEXT NOT NULL DEFAULT '[]'`,
+			`CREATE INDEX organizations_partner_idx ON organizations (partner_id)`,
+		},
+	},
+	{
+		// SHA-256 of uploaded evidence files
+		version: 13,
+		statements: []string{
+			`ALTER TABLE evidence ADD COLUMN content_hash TEXT NOT NULL DEFAULT ''`,
+		},
+	},
+	{
+		// Duplicate detection looks up evidence by content hash
+		version: 14,
+		statements: []string{
+			`CREATE INDEX evidence_content_hash_idx ON evidence (organization_id, content_hash)`,
+		},
+	},
+	{
+		// Versioned evidence files
+		version: 15,
+		statements: []string{
+			`ALTER TABLE evidence ADD COLUMN file_version INTEGER NOT NULL DEFAULT 0`,
+			`CREATE TABLE evidence_versions (
+				id              TEXT PRIMARY KEY,
+				organization_id TEXT NOT NULL,
+				evidence_id     TEXT NOT NULL,
+				number          INTEGER NOT NULL DEFAULT 0,
+				file_url        TEXT NOT NULL,
+				file_name       TEXT NOT NULL DEFAULT '',
+				file_size       BIGINT NOT NULL DEFAULT 0,
+				file_type       TEXT NOT NULL DEFAULT '',
+				content_hash    TEXT NOT NULL DEFAULT '',
+				note            TEXT NOT NULL DEFAULT '',
+				status          TEXT NOT NULL,
+				uploaded_by     TEXT NOT NULL DEFAULT '',
+				created_at      TIMESTAMP NOT NULL,
+				current_from    TIMESTAMP,
+				FOREIGN KEY (organization_id, evidence_id) REFERENCES evidence (organization_id, id) ON DELETE CASCADE
+			)`,
+			`CREATE INDEX evidence_versions_evidence_idx ON evidence_versions (organization_id, evidence_id, number)`,
+			`ALTER TABLE reports ADD COLUMN as_of TIMESTAMP`,
+		},
+	},
+	{
+		// Evidence tags
+		version: 16,
+		statements: []string{
+			`ALTER TABLE evidence ADD COLUMN tags TEXT NOT NULL DEFAULT '[]'`,
+		},
+	},
+	{
+		// Malware scan results
+		version: 17,
+		statements: []string{
+			`ALTER TABLE evidence ADD COLUMN scan TEXT NOT NULL DEFAULT 'null'`,
+		},
+	},
+	{
+		// SAML assertions accepted by any instance, kept until they expire
+		version: 18,
+		statements: []string{
+			`CREATE TABLE saml_assertions (
+				issuer     TEXT NOT NULL,
+				id         TEXT NOT NULL,
+				expires_at TIMESTAMP NOT NULL,
+				PRIMARY KEY (issuer, id)
+			)`,
+		},
+	},
+}
@@ -0,0 +1,32 @@
+package store
+
+import (
+	"errors"
+	"strings"
+
+	"compliancesync-api/internal/models"
+)
+
+// Errors returned by domain writes. Handlers map these to 409 responses.
+var (
+	ErrDomainClaimed = errors.New("domain is already claimed")
+)
+
+// ErrAssertionReplayed means a SAML assertion was already accepted
+var ErrAssertionReplayed = errors.New("SAML assertion has already been used")
+
+// checkDomainClaim verifies that domain can be claimed by its organization:
+// the organization must not have claimed the name already, and no other
+// organization may have verified it. existing holds the stored domains with
+// the same name.
+func checkDomainClaim(domain *models.Domain, existing []*models.Domain) error {
+	for _, other := range existing {
+		if other.ID == domain.ID || !strings.EqualFold(other.Name, domain.Name) {
+			continue
+		}
+		if other.OrganizationID == domain.OrganizationID || other.Status == "verified" {
+			return ErrDomainClaimed
+		}
+	}
+	return nil
+}
@@ -0,0 +1,181 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"compliancesync-api/internal/models"
+)
+
+// Store defines the persistence operations used by the API server.
+// FirestoreStore is the production implementation; SQLStore targets SQLite
+// and Postgres for non-Google deployments, and MemoryStore provides the same
+// semantics without any external dependency.
+//
+// List methods return one page of results plus the token for the next page,
+// which is empty on the last page.
+type Store interface {
+	// Close releases any resources held by the store
+	Close() error
+
+	// Organizations
+	CreateOrganization(ctx context.Context, org *models.Organization) error
+	GetOrganization(ctx context.Context, orgID string) (*models.Organization, error)
+	UpdateOrganization(ctx context.Context, org *models.Organization) error
+	// CreateClientOrganization creates an organization managed by the partner
+	// organization partnerID. It starts without users, since the partner's
+	// staff act in it without taking a seat.
+	CreateClientOrganization(ctx context.Context, partnerID string, org *models.Organization) error
+	ListClientOrganizations(ctx context.Context, partnerID string) ([]*models.Organization, error)
+
+	// Users
+	CreateUser(ctx context.Context, user *models.User) error
+	GetUser(ctx context.Context, uid string) (*models.User, error)
+	GetUserByEmail(ctx context.Context, email string) (*models.User, error)
+	UpdateUser(ctx context.Context, user *models.User) error
+	ListUsersByOrganization(ctx context.Context, orgID string, opts ListOptions) ([]*models.User, string, error)
+	UpdateLastLogin(ctx context.Context, uid string) error
+	// ProvisionUser creates a user without an invitation and adds them to
+	// the organization's active user count, failing with ErrSeatLimitReached
+	// when the organization has no free seat
+	ProvisionUser(ctx context.Context, user *models.User) error
+	// SetUserStatus saves user with the given status and keeps the active
+	// user count in step. Activating a user takes a seat and fails with
+	// ErrSeatLimitReached when the organization has no free seat.
+	SetUserStatus(ctx context.Context, user *models.User, status string) error
+
+	// Invitations
+	CreateInvitation(ctx context.Context, inv *models.Invitation) error
+	GetInvitation(ctx context.Context, orgID, invitationID string) (*models.Invitation, error)
+	GetInvitationByToken(ctx context.Context, tokenHash string) (*models.Invitation, error)
+	ListInvitations(ctx context.Context, orgID string, opts ListOptions) ([]*models.Invitation, string, error)
+	RenewInvitation(ctx context.Context, inv *models.Invitation) error
+	UpdateInvitation(ctx context.Context, inv *models.Invitation) error
+	AcceptInvitation(ctx context.Context, inv *models.Invitation, user *models.User) error
+
+	// Memberships in organizations other than the user's own. JoinOrganization
+	// accepts an invitation for an existing user as a membership, which takes
+	// the seat the invitation held, and fails with ErrAlreadyMember when the
+	// user already has one. DeleteMembership frees the seat.
+	JoinOrganization(ctx context.Context, inv *models.Invitation, membership *models.Membership) error
+	GetMembership(ctx context.Context, orgID, userID string) (*models.Membership, error)
+	ListMemberships(ctx context.Context, orgID string, opts ListOptions) ([]*models.Membership, string, error)
+	ListUserMemberships(ctx context.Context, userID string) ([]*models.Membership, error)
+	UpdateMembership(ctx context.Context, membership *models.Membership) error
+	DeleteMembership(ctx context.Context, orgID, userID string) error
+
+	// Custom roles
+	CreateRole(ctx context.Context, role *models.Role) error
+	GetRole(ctx context.Context, orgID, roleID string) (*models.Role, error)
+	ListRoles(ctx context.Context, orgID string, opts ListOptions) ([]*models.Role, string, error)
+	UpdateRole(ctx context.Context, role *models.Role) error
+	DeleteRole(ctx context.Context, orgID, roleID string, version int64) error
+
+	// API keys
+	CreateAPIKey(ctx context.Context, key *models.APIKey) error
+	GetAPIKey(ctx context.Context, orgID, keyID string) (*models.APIKey, error)
+	GetAPIKeyByHash(ctx context.Context, keyHash string) (*models.APIKey, error)
+	ListAPIKeys(ctx context.Context, orgID string, opts ListOptions) ([]*models.APIKey, string, error)
+	UpdateAPIKey(ctx context.Context, key *models.APIKey) error
+	TouchAPIKey(ctx context.Context, keyID string, usedAt time.Time) error
+
+	// Auditor grants
+	CreateAuditorGrant(ctx context.Context, grant *models.AuditorGrant) error
+	GetAuditorGrant(ctx context.Context, orgID, grantID string) (*models.AuditorGrant, error)
+	GetAuditorGrantByHash(ctx context.Context, tokenHash string) (*models.AuditorGrant, error)
+	ListAuditorGrants(ctx context.Context, orgID string, opts ListOptions) ([]*models.AuditorGrant, string, error)
+	UpdateAuditorGrant(ctx context.Context, grant *models.AuditorGrant) error
+	TouchAuditorGrant(ctx context.Context, grantID string, accessedAt time.Time) error
+
+	// Single sign-on. GetSSOConfig returns nil when the organization has not
+	// configured it.
+	GetSSOConfig(ctx context.Context, orgID string) (*models.SSOConfig, error)
+	SaveSSOConfig(ctx context.Context, config *models.SSOConfig) error
+	CreateDomain(ctx context.Context, domain *models.Domain) error
+	GetDomain(ctx context.Context, orgID, domainID string) (*models.Domain, error)
+	GetVerifiedDomain(ctx context.Context, name string) (*models.Domain, error)
+	ListDomains(ctx context.Context, orgID string, opts ListOptions) ([]*models.Domain, string, error)
+	VerifyDomain(ctx context.Context, domain *models.Domain) error
+	DeleteDomain(ctx context.Context, orgID, domainID string) error
+
+	// ClaimSAMLAssertion records an identity provider's assertion until it
+	// expires, failing with ErrAssertionReplayed if it was already recorded
+	ClaimSAMLAssertion(ctx context.Context, issuer, assertionID string, expiresAt time.Time) error
+
+	// Sessions
+	CreateSession(ctx context.Context, session *models.Session) error
+	GetSession(ctx context.Context, orgID, sessionID string) (*models.Session, error)
+	GetSessionByHash(ctx context.Context, tokenHash string) (*models.Session, error)
+	ListSessions(ctx context.Context, orgID, userID string, opts ListOptions) ([]*models.Session, string, error)
+	UpdateSession(ctx context.Context, session *models.Session) error
+
+	// Requirements
+	CreateRequirement(ctx context.Context, req *models.Requirement) error
+	GetRequirement(ctx context.Context, orgID, reqID string) (*models.Requirement, error)
+	ListRequirements(ctx context.Context, orgID string, opts ListOptions) ([]*models.Requirement, string, error)
+	UpdateRequirement(ctx context.Context, req *models.Requirement) error
+
+	// Evidence
+	CreateEvidence(ctx context.Context, evidence *models.Evidence) error
+	GetEvidence(ctx context.Context, orgID, evidenceID string) (*models.Evidence, error)
+	// ListEvidence filters on evidence fields by equality; the
+	// EvidenceRequirementFilter key matches evidence linked to a requirement
+	ListEvidence(ctx context.Context, orgID string, filters map[string]interface{}, opts ListOptions) ([]*models.Evidence, string, error)
+	UpdateEvidence(ctx context.Context, evidence *models.Evidence) error
+	DeleteEvidence(ctx context.Context, orgID, evidenceID string, version int64) error
+	ReconcileEvidenceCounts(ctx context.Context, orgID string) ([]EvidenceCountDrift, error)
+
+	// Evidence versions. CreateEvidenceVersion records a pending upload of a
+	// new file. PublishEvidenceVersion numbers the version and saves evidence
+	// with it as the current file in one transaction, failing with
+	// ErrVersionConflict if the evidence changed since it was read.
+	// ListEvidenceVersions returns the published versions by number; evidence
+	// finalized before versioning reports its file as version 1.
+	CreateEvidenceVersion(ctx context.Context, version *models.EvidenceVersion) error
+	GetEvidenceVersion(ctx context.Context, orgID, evidenceID, versionID string) (*models.EvidenceVersion, error)
+	ListEvidenceVersions(ctx context.Context, orgID, evidenceID string) ([]*models.EvidenceVersion, error)
+	PublishEvidenceVersion(ctx context.Context, evidence *models.Evidence, version *models.EvidenceVersion) error
+
+	// Audit logs
+	CreateAuditLog(ctx context.Context, log *models.AuditLog) error
+	ListAuditLogs(ctx context.Context, orgID string, filter AuditLogFilter, opts ListOptions) ([]*models.AuditLog, string, error)
+	GetAuditChainHead(ctx context.Context, orgID string) (*AuditChainHead, error)
+	ListAuditLogsBySequence(ctx context.Context, orgID string, afterSequence int64, limit int) ([]*models.AuditLog, error)
+	GetAuditForwardCheckpoint(ctx context.Context, orgID, sink string) (int64, error)
+	SaveAuditForwardCheckpoint(ctx context.Context, orgID, sink string, sequence int64) error
+
+	// Reports
+	CreateReport(ctx context.Context, report *models.Report) error
+	GetReport(ctx context.Context, orgID, reportID string) (*models.Report, error)
+	UpdateReport(ctx context.Context, report *models.Report) error
+
+	// Requirement templates
+	GetRequirementTemplate(ctx context.Context, templateID string) (*models.RequirementTemplate, error)
+	ListRequirementTemplates(ctx context.Context, framework models.RegulatoryFramework) ([]*models.RequirementTemplate, error)
+}
+
+// Compile-time checks that the implementations satisfy Store
+var (
+	_ Store = (*FirestoreStore)(nil)
+	_ Store = (*MemoryStore)(nil)
+	_ Store = (*SQLStore)(nil)
+)
+
+// EvidenceRequirementFilter is the ListEvidence filter key that matches
+// evidence associated with the given requirement ID
+const EvidenceRequirementFilter = "requirement_id"
+
+// EvidenceStatusFilter is the ListEvidence filter key that lists evidence
+// with another status, such as quarantined, instead of active evidence
+const EvidenceStatusFilter = "status"
+
+// withoutKey returns a copy of filters without key
+func withoutKey(filters map[string]interface{}, key string) map[string]interface{} {
+	rest := make(map[string]interface{}, len(filters))
+	for k, v := range filters {
+		if k != key {
+			rest[k] = v
+		}
+	}
+	return rest
+}
@@ -0,0 +1,70 @@
+// Package storetest provides fixtures for tests that run against a
+// store.Store, such as store and handler tests using the MemoryStore.
+package storetest
+
+import (
+	"context"
+	"path"
+	"testing"
+
+	"compliancesync-api/internal/models"
+	"compliancesync-api/internal/store"
+)
+
+// OrgID is the organization fixtures are created in
+const OrgID = "org-1"
+
+// NewRequirement creates an active requirement in OrgID
+func NewRequirement(t testing.TB, s store.Store, title string) *models.Requirement {
+	t.Helper()
+	req := &models.Requirement{OrganizationID: OrgID, Title: title}
+	if err := s.CreateRequirement(context.Background(), req); err != nil {
+		t.Fatalf("CreateRequirement: %v", err)
+	}
+	return req
+}
+
+// NewEvidence creates evidence in OrgID with the given status, linked to
+// reqIDs
+func NewEvidence(t testing.TB, s store.Store, status string, reqIDs ...string) *models.Evidence {
+	t.Helper()
+	evidence := &models.Evidence{
+		OrganizationID: OrgID,
+		Title:          "Evidence",
+		Status:         status,
+		RequirementIDs: reqIDs,
+	}
+	if err := s.CreateEvidence(context.Background(), evidence); err != nil {
+		t.Fatalf("CreateEvidence: %v", err)
+	}
+	return evidence
+}
+
+// NewUpload creates pending evidence in OrgID for a text file of size
+// bytes stored at fileURL, as the upload-url endpoint does
+func NewUpload(t testing.TB, s store.Store, fileURL string, size int64) *models.Evidence {
+	t.Helper()
+	evidence := &models.Evidence{
+		OrganizationID: OrgID,
+		FileName:       path.Base(fileURL),
+		FileSize:       size,
+		FileType:       "text/plain",
+		FileURL:        fileURL,
+		Status:         "uploading",
+		UploadedBy:     "user-1",
+	}
+	if err := s.CreateEvidence(context.Background(), evidence); err != nil {
+		t.Fatalf("CreateEvidence: %v", err)
+	}
+	return evidence
+}
+
+// EvidenceCount returns the stored evidence_count of a requirement in OrgID
+func EvidenceCount(t testing.TB, s store.Store, reqID string) int {
+	t.Helper()
+	req, err := s.GetRequirement(context.Background(), OrgID, reqID)
+	if err != nil {
+		t.Fatalf("GetRequirement: %v", err)
+	}
+	return req.EvidenceCount
+}
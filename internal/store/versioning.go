@@ -0,0 +1,16 @@
+package store
+
+import "errors"
+
+// ErrVersionConflict is returned when a write carries a Version that no longer
+// matches the stored document, meaning someone else changed it since it was
+// read. Handlers map this to 412 Precondition Failed.
+var ErrVersionConflict = errors.New("version conflict")
+
+// checkVersion compares the version a caller read against the stored version
+func checkVersion(stored, expected int64) error {
+	if stored != expected {
+		return ErrVersionConflict
+	}
+	return nil
+}
@@ -0,0 +1,182 @@
+# Firestore composite indexes
+#
+# Paginated list endpoints order by a sort field (plus the document ID as a
+# tiebreaker) after equality filters, which Firestore only serves from a
+# composite index. Each index is created in both sort directions.
+
+locals {
+  firestore_sort_orders = ["ASCENDING", "DESCENDING"]
+
+  # collection => list of { filters = equality fields, sort = order-by field }
+  firestore_index_specs = {
+    organizations = [
+      { filters = ["partner_id"], sort = "name" },
+    ]
+    users = [
+      { filters = ["organization_id"], sort = "email" },
+      { filters = ["organization_id"], sort = "full_name" },
+      { filters = ["organization_id"], sort = "created_at" },
+    ]
+    invitations = [
+      { filters = ["organization_id"], sort = "created_at" },
+      { filters = ["organization_id"], sort = "expires_at" },
+      { filters = ["organization_id"], sort = "email" },
+    ]
+    memberships = [
+      { filters = ["organization_id"], sort = "email" },
+      { filters = ["organization_id"], sort = "created_at" },
+      { filters = ["user_id"], sort = "created_at" },
+    ]
+    api_keys = [
+      { filters = ["organization_id"], sort = "created_at" },
+      { filters = ["organization_id"], sort = "name" },
+    ]
+    auditor_grants = [
+      { filters = ["organization_id"], sort = "created_at" },
+      { filters = ["organization_id"], sort = "expires_at" },
+      { filters = ["organization_id"], sort = "auditor_email" },
+    ]
+    domains = [
+      { filters = ["organization_id"], sort = "name" },
+      { filters = ["organization_id"], sort = "created_at" },
+    ]
+    sessions = [
+      { filters = ["organization_id", "user_id"], sort = "created_at" },
+    ]
+    requirements = [
+      { filters = ["is_active"], sort = "title" },
+      { filters = ["is_active"], sort = "activated_at" },
+      { filters = ["is_active"], sort = "updated_at" },
+    ]
+    evidence = [
+      { filters = ["status"], sort = "evidence_date" },
+      { filters = ["status"], sort = "created_at" },
+      { filters = ["status"], sort = "title" },
+      { filters = ["status", "source"], sort = "evidence_date" },
+      { filters = ["status", "source"], sort = "created_at" },
+      { filters = ["status", "source"], sort = "title" },
+      { filters = ["status", "content_hash"], sort = "created_at" },
+    ]
+    # from/to are range filters on the sort field itself, so they need no
+    # extra index fields. A multi-value action filter is an "in" query, which
+    # uses the same index as equality. The free-text q filter is applied after
+    # fetching and needs no index.
+    audit_logs = [
+      { filters = ["user_id"], sort = "timestamp" },
+      { filters = ["actor_type"], sort = "timestamp" },
+      { filters = ["action"], sort = "timestamp" },
+      { filters = ["resource_type"], sort = "timestamp" },
+      { filters = ["resource_id"], sort = "timestamp" },
+      { filters = ["action", "user_id"], sort = "timestamp" },
+      { filters = ["action", "resource_type"], sort = "timestamp" },
+      { filters = ["resource_type", "resource_id"], sort = "timestamp" },
+      { filters = ["action", "resource_type", "resource_id"], sort = "timestamp" },
+    ]
+  }
+
+  firestore_indexes = merge([
+    for collection, specs in local.firestore_index_specs : merge([
+      for spec in specs : {
+        for order in local.firestore_sort_orders :
+        "${collection}-${join("-", spec.filters)}-${spec.sort}-${lower(order)}" => {
+          collection = collection
+          filters    = spec.filters
+          sort       = spec.sort
+          order      = order
+        }
+      }
+    ]...)
+  ]...)
+}
+
+resource "google_firestore_index" "list_indexes" {
+  for_each = local.firestore_indexes
+
+  project    = var.project_id
+  collection = each.value.collection
+
+  dynamic "fields" {
+    for_each = each.value.filters
+    content {
+      field_path = fields.value
+      order      = "ASCENDING"
+    }
+  }
+
+  fields {
+    field_path = each.value.sort
+    order      = each.value.order
+  }
+
+  fields {
+    field_path = "__name__"
+    order      = each.value.order
+  }
+
+  depends_on = [google_project_service.services]
+}
+
+# Evidence count reconciliation counts active evidence per requirement
+resource "google_firestore_index" "evidence_requirement_status" {
+  project    = var.project_id
+  collection = "evidence"
+
+  fields {
+    field_path = "status"
+    order      = "ASCENDING"
+  }
+
+  fields {
+    field_path   = "requirement_ids"
+    array_config = "CONTAINS"
+  }
+
+  depends_on = [google_project_service.services]
+}
+
+# The auditor portal lists a requirement's active evidence, which combines
+# the status filter with array-contains on requirement_ids
+resource "google_firestore_index" "evidence_by_requirement" {
+  for_each = {
+    for pair in setproduct(["evidence_date", "created_at", "title"], local.firestore_sort_orders) :
+    "${pair[0]}-${lower(pair[1])}" => { sort = pair[0], order = pair[1] }
+  }
+
+  project    = var.project_id
+  collection = "evidence"
+
+  fields {
+    field_path = "status"
+    order      = "ASCENDING"
+  }
+
+  fields {
+    field_path   = "requirement_ids"
+    array_config = "CONTAINS"
+  }
+
+  fields {
+    field_path = each.value.sort
+    order      = each.value.order
+  }
+
+  fields {
+    field_path = "__name__"
+    order      = each.value.order
+  }
+
+  depends_on = [google_project_service.services]
+}
+
+# Accepted SAML assertions are only kept until they expire
+resource "google_firestore_field" "saml_assertions_ttl" {
+  project    = var.project_id
+  collection = "saml_assertions"
+  field      = "expires_at"
+
+  ttl_config {}
+
+  index_config {}
+
+  depends_on = [google_project_service.services]
+}